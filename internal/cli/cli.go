@@ -0,0 +1,445 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
+	"github.com/shapled/mocroc/internal/storage"
+)
+
+// 退出码
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// clientInfo 命令行创建的历史记录的客户端信息
+const clientInfo = "MoCroc CLI"
+
+// errUsage 参数错误，已经输出了用法说明
+var errUsage = errors.New("参数错误")
+
+// CLI 无界面的命令行模式
+// 与界面共用 crocmgr 和 storage，传输记录写入同一份历史记录。
+type CLI struct {
+	history  *storage.HistoryStorage
+	profiles *storage.RelayProfileStore
+	stdin    io.Reader // 逐个询问同名文件时读取选择
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+// IsCommand 判断启动参数是否为命令行子命令，否则启动界面
+func IsCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "send", "receive", "history", "relay", "profiles", "diagnose", "help", "-h", "-help", "--help":
+		return true
+	}
+	return false
+}
+
+// Run 执行命令行子命令并返回退出码
+// 设置保存在界面使用的 Fyne 偏好设置文件中，历史记录与界面共用应用数据目录中的历史记录文件。
+func Run(appID string, args []string, stdout, stderr io.Writer) int {
+	path, err := storage.PreferencesPath(appID)
+	if err != nil {
+		fmt.Fprintf(stderr, "错误: %v\n", err)
+		return exitError
+	}
+	prefs, err := storage.OpenFilePreferences(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "错误: %v\n", err)
+		return exitError
+	}
+	historyPath, err := storage.HistoryPath(appID)
+	if err != nil {
+		fmt.Fprintf(stderr, "错误: %v\n", err)
+		return exitError
+	}
+	history, err := storage.OpenHistoryStorage(historyPath, prefs)
+	if err != nil {
+		fmt.Fprintf(stderr, "错误: %v\n", err)
+		return exitError
+	}
+	defer history.Close()
+
+	c := New(history, storage.NewRelayProfileStore(prefs), stdout, stderr)
+	return c.Run(args)
+}
+
+// New 使用指定的历史记录和中继配置存储创建命令行
+func New(history *storage.HistoryStorage, profiles *storage.RelayProfileStore, stdout, stderr io.Writer) *CLI {
+	return &CLI{history: history, profiles: profiles, stdin: os.Stdin, stdout: stdout, stderr: stderr}
+}
+
+// Run 执行子命令并返回退出码
+func (c *CLI) Run(args []string) int {
+	if len(args) == 0 {
+		c.usage()
+		return exitUsage
+	}
+
+	var err error
+	switch args[0] {
+	case "send":
+		err = c.runSend(args[1:])
+	case "receive":
+		err = c.runReceive(args[1:])
+	case "history":
+		err = c.runHistory(args[1:])
+	case "relay":
+		err = c.runRelay(args[1:])
+	case "profiles":
+		err = c.runProfiles(args[1:])
+	case "diagnose":
+		err = c.runDiagnose(args[1:])
+	case "help", "-h", "-help", "--help":
+		c.usage()
+		return exitOK
+	default:
+		fmt.Fprintf(c.stderr, "未知命令: %s\n", args[0])
+		c.usage()
+		return exitUsage
+	}
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errUsage):
+		return exitUsage
+	default:
+		fmt.Fprintf(c.stderr, "错误: %v\n", err)
+		return exitError
+	}
+}
+
+func (c *CLI) usage() {
+	fmt.Fprint(c.stderr, `用法:
+  mocroc                                 启动图形界面
+  mocroc <mocroc://链接>                 启动图形界面并打开接收页
+  mocroc send [选项] <路径...>           发送文件或文件夹
+  mocroc send [选项] -text <文本>        发送文本
+  mocroc receive [选项] <接收码>         接收文件
+  mocroc receive [选项] -qr <图片>       使用二维码图片中的接收码和中继接收
+  mocroc receive [选项] <mocroc://链接>  使用链接中的接收码和中继接收
+  mocroc history list [选项]             列出和筛选历史记录
+  mocroc history export [-o 文件]        导出历史记录为 JSON
+  mocroc relay [-port 端口] [-pass 密码]  运行内置中继，供局域网或离线环境使用
+  mocroc profiles <list|add|remove|default> 管理中继配置
+  mocroc diagnose [-profile 名称]        检查中继的连通性、密码和延迟
+
+使用 "mocroc <命令> -h" 查看命令选项。
+`)
+}
+
+// newFlagSet 创建子命令的参数解析器，错误信息输出到 stderr
+func (c *CLI) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	return fs
+}
+
+// parseFlags 解析参数，把解析失败统一转换为 errUsage
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+// relayFlags 中继服务器相关的选项
+// 从中继配置开始，命令行中显式指定的选项覆盖配置中的值。
+type relayFlags struct {
+	fs       *flag.FlagSet
+	profile  string
+	address  string
+	address6 string
+	ports    string
+	password string
+	local    bool
+	port     int
+	fastest  bool
+}
+
+func (r *relayFlags) register(fs *flag.FlagSet) {
+	r.fs = fs
+	fs.StringVar(&r.profile, "profile", "", "中继配置名称，默认使用默认配置")
+	fs.StringVar(&r.address, "relay", "", "中继服务器地址")
+	fs.StringVar(&r.address6, "relay6", "", "IPv6 中继服务器地址")
+	fs.StringVar(&r.ports, "ports", "", "中继端口，逗号分隔")
+	fs.StringVar(&r.password, "pass", "", "中继服务器密码")
+	fs.BoolVar(&r.local, "local-relay", false, "在本机启动内置中继并使用它")
+	fs.IntVar(&r.port, "relay-port", crocmgr.DefaultLocalRelayPort, "内置中继端口")
+	fs.BoolVar(&r.fastest, "fastest", false, "自动选择延迟最低的中继")
+}
+
+// auto 是否自动选择延迟最低的中继
+// 指定了 -fastest，或者开启了自动选择且没有指定其他中继选项时自动选择。
+func (r *relayFlags) auto(store *storage.RelayProfileStore) bool {
+	if r.fastest {
+		return true
+	}
+	explicit := false
+	r.fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "profile", "relay", "relay6", "ports", "pass", "local-relay", "relay-port":
+			explicit = true
+		}
+	})
+	return !explicit && store.AutoSelect()
+}
+
+// resolve 返回本次传输使用的中继配置
+func (r *relayFlags) resolve(store *storage.RelayProfileStore) (crocmgr.RelayProfile, error) {
+	profile := store.Default()
+	if r.profile != "" {
+		p, ok := store.Get(r.profile)
+		if !ok {
+			return profile, fmt.Errorf("未找到中继配置 %s", r.profile)
+		}
+		profile = p
+	}
+
+	r.fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "relay":
+			profile.Address = r.address
+			profile.Embedded = false
+		case "relay6":
+			profile.Address6 = r.address6
+		case "ports":
+			profile.Ports = crocmgr.ParseRelayPorts(r.ports)
+		case "pass":
+			profile.Password = r.password
+		case "local-relay":
+			profile.Embedded = r.local
+		case "relay-port":
+			profile.Ports = []string{strconv.Itoa(r.port)}
+		}
+	})
+	return profile, nil
+}
+
+// applyRelay 把中继配置写入 croc 配置，需要时启动内置中继
+func (c *CLI) applyRelay(r *relayFlags, options *croc.Options) error {
+	profile, err := r.resolve(c.profiles)
+	if err != nil {
+		return err
+	}
+	if r.auto(c.profiles) {
+		fastest, status, err := crocmgr.NewDiagnostics().Fastest(context.Background(), c.profiles.List())
+		if err != nil {
+			return fmt.Errorf("自动选择中继失败: %w", err)
+		}
+		fmt.Fprintf(c.stdout, "自动选择中继: %s (%s)\n", fastest.Name, status.Summary())
+		profile = fastest
+	}
+	relay, err := profile.Apply(options)
+	if err != nil {
+		return err
+	}
+	if relay != nil {
+		c.printLocalRelay(relay)
+	}
+	return nil
+}
+
+// printLocalRelay 输出局域网内其他设备可以使用的中继地址
+func (c *CLI) printLocalRelay(relay *crocmgr.LocalRelay) {
+	fmt.Fprintf(c.stdout, "内置中继已启动: %s\n", relay.Address())
+	for _, address := range relay.LANAddresses() {
+		fmt.Fprintf(c.stdout, "其他设备可以使用: -relay %s\n", address)
+	}
+}
+
+// runTransfer 启动传输任务并等待结束
+// 传输事件输出到终端并写入历史记录，收到中断信号时取消任务。
+func (c *CLI) runTransfer(historyID string, direction crocmgr.Direction, code string,
+	start func(m *crocmgr.Manager) (*crocmgr.Transfer, error), message func(crocmgr.Event) string) error {
+	m := crocmgr.NewManager()
+	defer m.Close()
+
+	final := make(chan crocmgr.Event, 1)
+	m.Events().Subscribe(func(e crocmgr.Event) {
+		if e.Direction != direction || e.Code != code {
+			return
+		}
+		msg := message(e)
+		c.printEvent(e, msg)
+		// 进度事件不改变状态，不需要写入历史记录
+		if e.Type != crocmgr.EventProgress && e.Type != crocmgr.EventFileStarted {
+			c.updateHistory(historyID, e, msg)
+		}
+		if e.IsFinal() {
+			final <- e
+		}
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	transfer, err := start(m)
+	if err != nil {
+		c.updateHistory(historyID, crocmgr.Event{State: lifecycle.Failed}, err.Error())
+		return err
+	}
+
+	var e crocmgr.Event
+	select {
+	case e = <-final:
+	case <-ctx.Done():
+		transfer.Cancel()
+		e = <-final
+	}
+	if e.Type == crocmgr.EventCompleted {
+		return nil
+	}
+	if e.Resume != nil {
+		fmt.Fprintln(c.stderr, resumeHint(*e.Resume))
+	}
+	return e.Err
+}
+
+// resumeHint 返回继续中断传输的提示
+func resumeHint(r crocmgr.Resume) string {
+	done := fmt.Sprintf("已完成 %d/%d 个文件 (%s / %s)", r.FilesDone(), len(r.Files),
+		storage.FormatFileSize(r.BytesDone()), storage.FormatFileSize(r.TotalBytes()))
+	if r.Direction == crocmgr.DirectionSend {
+		return done + "，使用 -code " + r.Code + " 重新发送相同的文件，接收方可以继续接收"
+	}
+	return done + "，再次运行相同的命令即可继续接收"
+}
+
+// printEvent 输出传输事件，进度在同一行刷新
+func (c *CLI) printEvent(e crocmgr.Event, message string) {
+	if e.Type == crocmgr.EventProgress {
+		fmt.Fprintf(c.stderr, "\r%-72s", message)
+		return
+	}
+	if e.Type == crocmgr.EventFileStarted {
+		return
+	}
+	if e.State == lifecycle.Verifying || e.IsFinal() {
+		fmt.Fprintln(c.stderr)
+	}
+	if e.Type != crocmgr.EventFailed {
+		fmt.Fprintln(c.stdout, message)
+	}
+	if e.IsText {
+		fmt.Fprintln(c.stdout, e.Text)
+	}
+	if e.IsFinal() {
+		c.printConflicts(e.Files)
+	}
+	if e.Verification != nil {
+		c.printVerification(*e.Verification)
+	}
+}
+
+// printConflicts 输出与已有文件同名的文件的处理结果
+func (c *CLI) printConflicts(files []crocmgr.ReceivedFile) {
+	for _, f := range files {
+		switch f.Conflict {
+		case crocmgr.ConflictRename:
+			fmt.Fprintf(c.stdout, "已重命名: %s -> %s\n", f.Name, f.Path)
+		case crocmgr.ConflictOverwrite:
+			fmt.Fprintf(c.stdout, "已覆盖: %s\n", f.Name)
+		case crocmgr.ConflictSkip:
+			fmt.Fprintf(c.stdout, "已跳过: %s\n", f.Name)
+		}
+	}
+}
+
+// printVerification 输出接收文件的校验值，格式与 sha256sum 类似
+func (c *CLI) printVerification(v crocmgr.Verification) {
+	fmt.Fprintln(c.stdout, "校验结果: "+v.Summary())
+	for _, f := range v.Files {
+		switch {
+		case f.Error != "":
+			fmt.Fprintf(c.stdout, "  ✗ %s: 无法读取: %s\n", f.Name, f.Error)
+		case f.OK:
+			fmt.Fprintf(c.stdout, "  ✓ %s  %s\n", f.Actual, f.Name)
+		default:
+			fmt.Fprintf(c.stdout, "  ✗ %s  %s (期望 %s)\n", f.Actual, f.Name, f.Expected)
+		}
+	}
+}
+
+// updateHistory 更新历史记录状态和耗时，接收完成时补充文件信息
+func (c *CLI) updateHistory(historyID string, e crocmgr.Event, message string) {
+	if err := c.history.Transition(historyID, e.State, message); err != nil {
+		fmt.Fprintf(c.stderr, "更新历史记录失败: %v\n", err)
+		return
+	}
+
+	err := c.history.Update(historyID, func(item *storage.HistoryItem) {
+		item.Duration = int64(time.Since(item.Timestamp).Seconds())
+		if e.IsFinal() {
+			item.Resume = e.Resume
+			if e.Verification != nil {
+				item.Verification = e.Verification
+			}
+			if len(e.Files) > 0 {
+				item.ReceivedFiles = e.Files
+			}
+		}
+		if item.Type == "receive" && e.IsText {
+			item.FileName = "文本内容"
+			item.FileSize = storage.FormatFileSize(int64(len(e.Text)))
+			item.NumFiles = 1
+			if c.history.StoreText() {
+				item.Text = e.Text
+			}
+		} else if item.Type == "receive" && e.Progress.NumFiles > 0 {
+			item.NumFiles = e.Progress.NumFiles
+			item.FileSize = storage.FormatFileSize(e.Progress.TotalBytes)
+			if e.Progress.NumFiles == 1 {
+				item.FileName = e.Progress.FileName
+			} else {
+				item.FileName = fmt.Sprintf("%d 个文件", e.Progress.NumFiles)
+			}
+		}
+		if e.Relay != nil {
+			item.Relay = e.Relay
+		}
+		if e.Manifest != nil {
+			item.SetManifest(*e.Manifest)
+			if item.Type == "receive" {
+				item.FileName = e.Manifest.Name()
+			}
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(c.stderr, "更新历史记录失败: %v\n", err)
+	}
+}
+
+// formatProgress 格式化传输进度，多文件时附带当前文件信息
+func formatProgress(action string, p crocmgr.Progress) string {
+	message := fmt.Sprintf("%s... %.1f%% (%s / %s)", action, p.Fraction()*100,
+		storage.FormatFileSize(p.BytesDone), storage.FormatFileSize(p.TotalBytes))
+	if p.NumFiles > 1 {
+		message += fmt.Sprintf(" 文件 %d/%d: %s", p.FileIndex+1, p.NumFiles, p.FileName)
+	}
+	return message
+}
@@ -0,0 +1,665 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schollz/croc/v10/src/models"
+	"github.com/shapled/mocroc/internal/codephrase"
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
+	"github.com/shapled/mocroc/internal/share"
+	"github.com/shapled/mocroc/internal/storage"
+)
+
+// newTestCLI 创建使用临时偏好设置文件的命令行
+func newTestCLI(t *testing.T) (*CLI, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	prefs, err := storage.OpenFilePreferences(filepath.Join(t.TempDir(), "preferences.json"))
+	if err != nil {
+		t.Fatalf("OpenFilePreferences failed: %v", err)
+	}
+	history, err := storage.OpenHistoryStorage(filepath.Join(t.TempDir(), storage.HistoryFileName), prefs)
+	if err != nil {
+		t.Fatalf("OpenHistoryStorage failed: %v", err)
+	}
+	t.Cleanup(func() { history.Close() })
+	var stdout, stderr bytes.Buffer
+	return New(history, storage.NewRelayProfileStore(prefs), &stdout, &stderr), &stdout, &stderr
+}
+
+func TestIsCommand(t *testing.T) {
+	cases := map[string]bool{
+		"":        false,
+		"send":    true,
+		"receive": true,
+		"history": true,
+		"--help":  true,
+		"-psn_0":  false,
+		// 系统打开链接时启动界面
+		"mocroc://receive?code=x": false,
+	}
+	for arg, want := range cases {
+		var args []string
+		if arg != "" {
+			args = []string{arg}
+		}
+		if got := IsCommand(args); got != want {
+			t.Errorf("IsCommand(%q) = %v, want %v", arg, got, want)
+		}
+	}
+}
+
+func TestRun_UsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"unknown"},
+		{"send"},
+		{"send", "-text", "hi", "file.txt"},
+		{"receive"},
+		{"history"},
+		{"history", "remove"},
+		{"history", "list", "-bogus"},
+	} {
+		c, _, stderr := newTestCLI(t)
+		if code := c.Run(args); code != exitUsage {
+			t.Errorf("Run(%v) = %d, want %d", args, code, exitUsage)
+		}
+		if stderr.Len() == 0 {
+			t.Errorf("Run(%v) printed no usage", args)
+		}
+	}
+}
+
+func TestRun_HistoryListAndExport(t *testing.T) {
+	c, stdout, _ := newTestCLI(t)
+
+	if code := c.Run([]string{"history", "list"}); code != exitOK {
+		t.Fatalf("history list = %d", code)
+	}
+	if !strings.Contains(stdout.String(), "暂无传输记录") {
+		t.Errorf("unexpected empty list output: %q", stdout.String())
+	}
+
+	for i, code := range []string{"first-code-1000", "second-code-2000"} {
+		_, err := c.history.Add(storage.HistoryItem{
+			Type:      "send",
+			FileName:  "file.txt",
+			FileSize:  "1 KB",
+			Code:      code,
+			Status:    lifecycle.Completed,
+			Timestamp: time.Now().Add(time.Duration(i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	stdout.Reset()
+	if code := c.Run([]string{"history", "list", "-n", "1"}); code != exitOK {
+		t.Fatalf("history list = %d", code)
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "second-code-2000") || strings.Contains(out, "first-code-1000") {
+		t.Errorf("list -n 1 should show only the newest record: %q", out)
+	}
+	if !strings.Contains(out, "显示第 1-1 条，共 2 条") {
+		t.Errorf("list -n 1 should show the page: %q", out)
+	}
+
+	stdout.Reset()
+	if code := c.Run([]string{"history", "list", "-code", "FIRST", "-status", "completed,failed", "-since", time.Now().Format(time.DateOnly)}); code != exitOK {
+		t.Fatalf("history list = %d", code)
+	}
+	out = stdout.String()
+	if !strings.Contains(out, "first-code-1000") || strings.Contains(out, "second-code-2000") {
+		t.Errorf("list -code should filter by code: %q", out)
+	}
+	for _, args := range [][]string{{"-sort", "name"}, {"-since", "yesterday"}, {"-min-size", "big"}} {
+		if code := c.Run(append([]string{"history", "list"}, args...)); code != exitError {
+			t.Errorf("history list %v = %d, want %d", args, code, exitError)
+		}
+	}
+
+	exportPath := filepath.Join(t.TempDir(), "history.json")
+	if code := c.Run([]string{"history", "export", "-o", exportPath}); code != exitOK {
+		t.Fatalf("history export = %d", code)
+	}
+	data, err := os.ReadFile(exportPath)
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	var items []storage.HistoryItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		t.Fatalf("export is not valid JSON: %v", err)
+	}
+	if len(items) != 2 || items[0].Code != "second-code-2000" {
+		t.Errorf("unexpected export: %+v", items)
+	}
+}
+
+// TestRun_Profiles 测试中继配置的添加、列出、删除以及命令行参数覆盖
+func TestRun_Profiles(t *testing.T) {
+	c, stdout, _ := newTestCLI(t)
+
+	args := []string{"profiles", "add", "-name", "office", "-relay", "relay.example.com:9109", "-ports", "9109,9110", "-pass", "secret", "-default"}
+	if code := c.Run(args); code != exitOK {
+		t.Fatalf("profiles add = %d", code)
+	}
+	if code := c.Run([]string{"profiles", "add", "-name", "bad", "-ports", "abc"}); code != exitError {
+		t.Errorf("invalid profile add = %d, want %d", code, exitError)
+	}
+
+	if code := c.Run([]string{"profiles", "list"}); code != exitOK {
+		t.Fatalf("profiles list = %d", code)
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "*  office") || !strings.Contains(out, "9109,9110") {
+		t.Errorf("office should be listed as default: %q", out)
+	}
+
+	var r relayFlags
+	fs := c.newFlagSet("test")
+	r.register(fs)
+	if err := fs.Parse([]string{"-ports", "9200"}); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := r.resolve(c.profiles)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if profile.Name != "office" || profile.Password != "secret" || len(profile.Ports) != 1 || profile.Ports[0] != "9200" {
+		t.Errorf("flags should override only the given fields: %+v", profile)
+	}
+
+	if code := c.Run([]string{"profiles", "remove", "office"}); code != exitOK {
+		t.Fatalf("profiles remove = %d", code)
+	}
+	if _, ok := c.profiles.Get("office"); ok {
+		t.Error("office should be removed")
+	}
+}
+
+func TestSendHistoryItem(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	os.WriteFile(a, make([]byte, 1024), 0o644)
+	os.WriteFile(b, make([]byte, 1024), 0o644)
+	itemFor := func(paths ...string) storage.HistoryItem {
+		plan, err := planSend(paths, crocmgr.IgnoreRules{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sendHistoryItem("code", paths, plan, "")
+	}
+
+	item := itemFor(a)
+	if item.FileName != "a.txt" || item.NumFiles != 1 || item.FileSize != "1.0 KB" {
+		t.Errorf("unexpected single file item: %+v", item)
+	}
+	if item.Status != lifecycle.Preparing || item.ClientInfo != clientInfo {
+		t.Errorf("unexpected status or client info: %+v", item)
+	}
+
+	item = itemFor(a, b)
+	if item.FileName != "2 个文件" || item.NumFiles != 2 || item.FileSize != "2.0 KB" {
+		t.Errorf("unexpected multi file item: %+v", item)
+	}
+
+	// 文件夹按其中的文件计算大小，记录文件夹数
+	folder := filepath.Join(dir, "folder")
+	os.MkdirAll(filepath.Join(folder, "sub", "empty"), 0o755)
+	os.WriteFile(filepath.Join(folder, "sub", "c.txt"), make([]byte, 2048), 0o644)
+	item = itemFor(folder)
+	if item.FileName != "folder" || item.NumFiles != 1 || item.NumFolders != 3 || item.FileSize != "2.0 KB" {
+		t.Errorf("unexpected folder item: %+v", item)
+	}
+
+	item = sendHistoryItem("code", nil, crocmgr.SendPlan{}, "hello")
+	if item.FileName != "文本内容" || item.FileSize != "5 B" {
+		t.Errorf("unexpected text item: %+v", item)
+	}
+}
+
+// TestRun_SendDryRun 只列出按忽略规则要发送的文件，不创建历史记录
+func TestRun_SendDryRun(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "proj")
+	for name, data := range map[string]string{"main.go": "package main", "debug.log": "log", ".DS_Store": "x", ".gitignore": "*.tmp\n", "a.tmp": "tmp"} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, stdout, stderr := newTestCLI(t)
+	if rc := c.Run([]string{"send", "-dry-run", "-exclude", "*.log", "-gitignore", dir}); rc != exitOK {
+		t.Fatalf("send -dry-run = %d: %s", rc, stderr.String())
+	}
+	out := stdout.String()
+	for _, want := range []string{"发送: proj/main.go", "忽略: proj/debug.log (3 B) ← *.log", "忽略: proj/.DS_Store", "忽略: proj/a.tmp (3 B) ← *.tmp (proj/.gitignore:1)", "共发送 2 个文件"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if items, _ := c.history.GetAll(); len(items) != 0 {
+		t.Errorf("dry run should not create history: %+v", items)
+	}
+	if rc := c.Run([]string{"send", "-dry-run", "-ignore", "unknown", dir}); rc != exitError {
+		t.Errorf("unknown preset = %d", rc)
+	}
+}
+
+// TestRun_SendReceiveLocalRelay 通过内置中继完成一次命令行收发，并写入共享历史记录
+func TestRun_SendReceiveLocalRelay(t *testing.T) {
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+
+	src := filepath.Join(t.TempDir(), "cli.txt")
+	if err := os.WriteFile(src, []byte("hello from cli"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	port := strconv.Itoa(45000 + int(time.Now().UnixNano()%1000)*5)
+	code := "cli-relay-" + strconv.Itoa(int(time.Now().UnixNano()%10000))
+
+	sender, _, senderErr := newTestCLI(t)
+	sent := make(chan int, 1)
+	go func() {
+		sent <- sender.Run([]string{"send", "-local-relay", "-relay-port", port, "-no-local", "-hash", "highway", "-code", code, src})
+	}()
+	time.Sleep(500 * time.Millisecond)
+
+	receiver, receiverOut, receiverErr := newTestCLI(t)
+	if rc := receiver.Run([]string{"receive", "-relay", "127.0.0.1:" + port, "-out", out, code}); rc != exitOK {
+		t.Fatalf("receive = %d: %s", rc, receiverErr.String())
+	}
+	select {
+	case rc := <-sent:
+		if rc != exitOK {
+			t.Fatalf("send = %d: %s", rc, senderErr.String())
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("send did not finish")
+	}
+
+	data, err := os.ReadFile(filepath.Join(out, "cli.txt"))
+	if err != nil || string(data) != "hello from cli" {
+		t.Fatalf("received %q, %v", data, err)
+	}
+	if !strings.Contains(receiverOut.String(), "全部 1 个文件校验通过（highway）") {
+		t.Errorf("verification not printed: %s", receiverOut.String())
+	}
+	if items, _ := receiver.history.GetAll(); len(items) != 1 || items[0].Verification == nil || !items[0].Verification.Passed() {
+		t.Errorf("verification not recorded in history: %+v", items)
+	}
+	for _, c := range []*CLI{sender, receiver} {
+		items, _ := c.history.GetAll()
+		if len(items) != 1 || items[0].Status != lifecycle.Completed || items[0].Code != code {
+			t.Errorf("unexpected history: %+v", items)
+			continue
+		}
+		m := items[0].Manifest
+		if m == nil || len(m.Files) != 1 || m.Files[0].Path != "cli.txt" || m.Files[0].Hash == "" || m.TotalBytes != 14 || m.HashAlgorithm != "highway" {
+			t.Errorf("unexpected manifest: %+v", m)
+		}
+	}
+	if items, _ := receiver.history.GetAll(); len(items) == 1 && items[0].Manifest != nil && items[0].Manifest.SavePath != out {
+		t.Errorf("manifest save path = %q, want %q", items[0].Manifest.SavePath, out)
+	}
+	if items, _ := sender.history.GetAll(); len(items) == 1 {
+		if r := items[0].Relay; r == nil || !r.Embedded || len(r.Ports) == 0 || r.Ports[0] != port {
+			t.Errorf("relay not recorded in history: %+v", r)
+		}
+		if len(items[0].Paths) != 1 || items[0].Paths[0] != src {
+			t.Errorf("send paths not recorded in history: %v", items[0].Paths)
+		}
+	}
+}
+
+// TestRun_ReceiveResumes 保存目录中有中断的接收时只补全缺少的部分
+func TestRun_ReceiveResumes(t *testing.T) {
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+
+	chunk := models.TCP_BUFFER_SIZE / 2
+	data := make([]byte, 6*chunk)
+	rand.Read(data)
+	src := filepath.Join(t.TempDir(), "big.bin")
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	code := "cli-resume-" + strconv.Itoa(int(time.Now().UnixNano()%10000))
+
+	// 上次中断时接收了前一半，并留下了断点清单
+	partial := make([]byte, len(data))
+	copy(partial, data[:3*chunk])
+	if err := os.WriteFile(filepath.Join(out, "big.bin"), partial, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	manifest, _ := json.Marshal(crocmgr.Resume{
+		Direction: crocmgr.DirectionReceive,
+		Code:      code,
+		Dir:       out,
+		Files:     []crocmgr.ResumeFile{{Name: "big.bin", Size: int64(len(data)), BytesDone: int64(3 * chunk)}},
+	})
+	if err := os.WriteFile(crocmgr.ResumePath(out, code), manifest, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	port := strconv.Itoa(47000 + int(time.Now().UnixNano()%1000)*5)
+	sender, _, senderErr := newTestCLI(t)
+	sent := make(chan int, 1)
+	go func() {
+		sent <- sender.Run([]string{"send", "-local-relay", "-relay-port", port, "-no-local", "-code", code, src})
+	}()
+	time.Sleep(500 * time.Millisecond)
+
+	receiver, stdout, receiverErr := newTestCLI(t)
+	if rc := receiver.Run([]string{"receive", "-relay", "127.0.0.1:" + port, "-out", out, code}); rc != exitOK {
+		t.Fatalf("receive = %d: %s", rc, receiverErr.String())
+	}
+	select {
+	case rc := <-sent:
+		if rc != exitOK {
+			t.Fatalf("send = %d: %s", rc, senderErr.String())
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("send did not finish")
+	}
+
+	if !strings.Contains(stdout.String(), "继续中断的接收: 已完成 0/1 个文件") {
+		t.Errorf("resume not reported: %q", stdout.String())
+	}
+	got, err := os.ReadFile(filepath.Join(out, "big.bin"))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("resumed file differs from the source: %v", err)
+	}
+	if _, err := os.Stat(crocmgr.ResumePath(out, code)); !os.IsNotExist(err) {
+		t.Errorf("manifest should be removed: %v", err)
+	}
+	items, _ := receiver.history.GetAll()
+	if len(items) != 1 || items[0].Status != lifecycle.Completed || items[0].Resume != nil {
+		t.Errorf("unexpected history: %+v", items)
+	}
+}
+
+// TestRun_ReceiveConflicts 逐个询问同名文件，重命名后的位置写入历史记录
+func TestRun_ReceiveConflicts(t *testing.T) {
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+
+	srcDir := t.TempDir()
+	out := t.TempDir()
+	var srcs []string
+	for _, name := range []string{"a.txt", "b.txt"} {
+		srcs = append(srcs, filepath.Join(srcDir, name))
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte("new "+name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(out, name), []byte("old "+name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	port := strconv.Itoa(49000 + int(time.Now().UnixNano()%1000)*5)
+	code := "cli-conflict-" + strconv.Itoa(int(time.Now().UnixNano()%10000))
+
+	sender, _, senderErr := newTestCLI(t)
+	sent := make(chan int, 1)
+	go func() {
+		sent <- sender.Run(append([]string{"send", "-local-relay", "-relay-port", port, "-no-local", "-code", code}, srcs...))
+	}()
+	time.Sleep(500 * time.Millisecond)
+
+	// a.txt 跳过，b.txt 直接回车使用默认的重命名保存
+	receiver, stdout, receiverErr := newTestCLI(t)
+	receiver.stdin = strings.NewReader("s\n\n")
+	if rc := receiver.Run([]string{"receive", "-relay", "127.0.0.1:" + port, "-out", out, "-conflict", "ask", code}); rc != exitOK {
+		t.Fatalf("receive = %d: %s", rc, receiverErr.String())
+	}
+	select {
+	case rc := <-sent:
+		if rc != exitOK {
+			t.Fatalf("send = %d: %s", rc, senderErr.String())
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("send did not finish")
+	}
+
+	for name, want := range map[string]string{"a.txt": "old a.txt", "b.txt": "old b.txt", "b (1).txt": "new b.txt"} {
+		if data, err := os.ReadFile(filepath.Join(out, name)); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, want)
+		}
+	}
+	if !strings.Contains(stdout.String(), "已跳过: a.txt") || !strings.Contains(stdout.String(), "已重命名: b.txt -> ") {
+		t.Errorf("conflicts not printed: %s", stdout.String())
+	}
+	items, _ := receiver.history.GetAll()
+	if len(items) != 1 || len(items[0].ReceivedFiles) != 2 || items[0].ReceivedFiles[1].Path != filepath.Join(out, "b (1).txt") {
+		t.Errorf("received files not recorded in history: %+v", items)
+	}
+
+	c, _, _ := newTestCLI(t)
+	if rc := c.Run([]string{"receive", "-conflict", "merge", code}); rc != exitError {
+		t.Errorf("invalid conflict policy = %d, want %d", rc, exitError)
+	}
+}
+
+// TestRun_SendReceiveText 命令行收发文本，接收端输出文本而不保存文件
+func TestRun_SendReceiveText(t *testing.T) {
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+
+	out := t.TempDir()
+	port := strconv.Itoa(46000 + int(time.Now().UnixNano()%1000)*5)
+	code := "cli-text-" + strconv.Itoa(int(time.Now().UnixNano()%10000))
+
+	sender, _, senderErr := newTestCLI(t)
+	sent := make(chan int, 1)
+	go func() {
+		sent <- sender.Run([]string{"send", "-local-relay", "-relay-port", port, "-no-local", "-code", code, "-text", "hello text"})
+	}()
+	time.Sleep(500 * time.Millisecond)
+
+	receiver, stdout, receiverErr := newTestCLI(t)
+	receiver.history.SetStoreText(true)
+	if rc := receiver.Run([]string{"receive", "-relay", "127.0.0.1:" + port, "-out", out, code}); rc != exitOK {
+		t.Fatalf("receive = %d: %s", rc, receiverErr.String())
+	}
+	select {
+	case rc := <-sent:
+		if rc != exitOK {
+			t.Fatalf("send = %d: %s", rc, senderErr.String())
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("send did not finish")
+	}
+
+	if !strings.Contains(stdout.String(), "hello text") {
+		t.Errorf("text not printed: %q", stdout.String())
+	}
+	if entries, _ := os.ReadDir(out); len(entries) != 0 {
+		t.Errorf("receiver left %d files", len(entries))
+	}
+	items, _ := receiver.history.GetAll()
+	if len(items) != 1 || items[0].FileName != "文本内容" || items[0].Text != "hello text" {
+		t.Errorf("unexpected receive history: %+v", items)
+	}
+	items, _ = sender.history.GetAll()
+	if len(items) != 1 || items[0].Text != "" {
+		t.Errorf("sender stored text without opt-in: %+v", items)
+	}
+}
+
+// TestRun_ReceiveInvalidLink 无效的链接在连接中继之前报错，不产生历史记录
+func TestRun_ReceiveInvalidLink(t *testing.T) {
+	c, _, stderr := newTestCLI(t)
+	if rc := c.Run([]string{"receive", "mocroc://receive?code=x&ports=abc"}); rc != exitError {
+		t.Fatalf("receive invalid link = %d, want %d", rc, exitError)
+	}
+	if !strings.Contains(stderr.String(), share.ErrInvalidInvite.Error()) {
+		t.Errorf("unexpected error output: %q", stderr.String())
+	}
+	if items, _ := c.history.GetAll(); len(items) != 0 {
+		t.Errorf("history = %+v, want empty", items)
+	}
+}
+
+// TestRun_InvalidCodes 无效的接收码和生成设置在创建历史记录之前报错
+func TestRun_InvalidCodes(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want error
+	}{
+		{[]string{"send", "-code", "1234", "-text", "hi"}, codephrase.ErrInvalidCode},
+		{[]string{"send", "-wordlist", "klingon", "-text", "hi"}, codephrase.ErrInvalidOptions},
+		{[]string{"send", "-words", "1", "-text", "hi"}, codephrase.ErrInvalidOptions},
+		{[]string{"receive", "12 34"}, codephrase.ErrInvalidCode},
+		{[]string{"receive", "482 bravo lemon"}, codephrase.ErrInvalidCode},
+	} {
+		c, _, stderr := newTestCLI(t)
+		if rc := c.Run(tc.args); rc != exitError {
+			t.Errorf("Run(%q) = %d, want %d", tc.args, rc, exitError)
+		}
+		if !strings.Contains(stderr.String(), tc.want.Error()) {
+			t.Errorf("Run(%q) printed %q", tc.args, stderr.String())
+		}
+		if items, _ := c.history.GetAll(); len(items) != 0 {
+			t.Errorf("Run(%q) created history %+v", tc.args, items)
+		}
+	}
+}
+
+// TestRun_ReceiveFromQRCode 从发送端生成的二维码图片读取接收码和内置中继地址
+func TestRun_ReceiveFromQRCode(t *testing.T) {
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+
+	src := filepath.Join(t.TempDir(), "qr.txt")
+	if err := os.WriteFile(src, []byte("hello from qr"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	relayPort := 44000 + int(time.Now().UnixNano()%1000)*5
+	port := strconv.Itoa(relayPort)
+	code := "cli-qr-" + strconv.Itoa(int(time.Now().UnixNano()%10000))
+
+	sender, _, senderErr := newTestCLI(t)
+	sent := make(chan int, 1)
+	go func() {
+		sent <- sender.Run([]string{"send", "-local-relay", "-relay-port", port, "-no-local", "-code", code, src})
+	}()
+	time.Sleep(500 * time.Millisecond)
+
+	// 与发送详情页显示的二维码内容相同
+	options := crocmgr.DefaultOptions(true, code)
+	relay, err := crocmgr.StartLocalRelay(relayPort, crocmgr.DefaultRelayPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay.Apply(&options)
+	png, err := share.NewInvite(options).QRCode(share.QRCodeSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qrFile := filepath.Join(t.TempDir(), "invite.png")
+	if err := os.WriteFile(qrFile, png, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	receiver, stdout, receiverErr := newTestCLI(t)
+	if rc := receiver.Run([]string{"receive", "-qr", qrFile, code}); rc != exitUsage {
+		t.Errorf("-qr with code = %d, want usage", rc)
+	}
+	if rc := receiver.Run([]string{"receive", "-qr", qrFile, "-out", out}); rc != exitOK {
+		t.Fatalf("receive -qr = %d: %s", rc, receiverErr.String())
+	}
+	if !strings.Contains(stdout.String(), "已识别接收码: "+code) {
+		t.Errorf("unexpected output: %q", stdout.String())
+	}
+	select {
+	case rc := <-sent:
+		if rc != exitOK {
+			t.Fatalf("send = %d: %s", rc, senderErr.String())
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("send did not finish")
+	}
+
+	data, err := os.ReadFile(filepath.Join(out, "qr.txt"))
+	if err != nil || string(data) != "hello from qr" {
+		t.Fatalf("received %q, %v", data, err)
+	}
+}
+
+// TestRun_Diagnose 通过内置中继测试中继诊断和自动选择
+func TestRun_Diagnose(t *testing.T) {
+	port := 47000 + int(time.Now().UnixNano()%1000)*5
+	relay, err := crocmgr.StartLocalRelay(port, "diag-pass")
+	if err != nil {
+		t.Fatalf("StartLocalRelay failed: %v", err)
+	}
+
+	c, stdout, stderr := newTestCLI(t)
+	good := crocmgr.RelayProfile{Name: "lan", Address: relay.Address(), Ports: relay.Ports, Password: "diag-pass"}
+	dead := crocmgr.RelayProfile{Name: "dead", Address: "127.0.0.1:1", Ports: []string{"1"}, Password: "diag-pass"}
+	for _, p := range []crocmgr.RelayProfile{good, dead} {
+		if err := c.profiles.Save(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if rc := c.Run([]string{"diagnose", "-profile", "lan", "-timeout", "2s"}); rc != exitOK {
+		t.Fatalf("diagnose lan = %d: %s", rc, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "可用") {
+		t.Errorf("unexpected output: %q", stdout.String())
+	}
+	if rc := c.Run([]string{"diagnose", "-profile", "dead", "-timeout", "2s"}); rc != exitError {
+		t.Errorf("diagnose dead = %d, want %d", rc, exitError)
+	}
+
+	var r relayFlags
+	fs := c.newFlagSet("test")
+	r.register(fs)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if r.auto(c.profiles) {
+		t.Error("auto select should be off by default")
+	}
+	c.profiles.SetAutoSelect(true)
+	if !r.auto(c.profiles) {
+		t.Error("auto select should follow the stored setting")
+	}
+	if err := fs.Parse([]string{"-profile", "lan"}); err != nil {
+		t.Fatal(err)
+	}
+	if r.auto(c.profiles) {
+		t.Error("an explicit profile should disable auto select")
+	}
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+// runDiagnose 检查中继配置，全部不可用时返回错误
+func (c *CLI) runDiagnose(args []string) error {
+	fs := c.newFlagSet("diagnose")
+	name := fs.String("profile", "", "只检查指定的中继配置")
+	timeout := fs.Duration("timeout", crocmgr.DefaultProbeTimeout, "检查单个中继的超时时间")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	profiles := c.profiles.List()
+	if *name != "" {
+		p, ok := c.profiles.Get(*name)
+		if !ok {
+			return fmt.Errorf("未找到中继配置 %s", *name)
+		}
+		profiles = []crocmgr.RelayProfile{p}
+	}
+
+	d := crocmgr.NewDiagnostics()
+	d.Timeout = *timeout
+	statuses := d.CheckAll(context.Background(), profiles)
+
+	healthy := 0
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "名称\t地址\t状态")
+	for _, s := range statuses {
+		if s.Healthy() {
+			healthy++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Profile, s.Address, s.Summary())
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if healthy == 0 {
+		return crocmgr.ErrNoHealthyRelay
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shapled/mocroc/internal/lifecycle"
+	"github.com/shapled/mocroc/internal/storage"
+)
+
+// runHistory 查看或导出历史记录
+func (c *CLI) runHistory(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(c.stderr, "用法: mocroc history <list|export> [选项]")
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		return c.runHistoryList(args[1:])
+	case "export":
+		return c.runHistoryExport(args[1:])
+	default:
+		fmt.Fprintf(c.stderr, "未知的 history 子命令: %s\n", args[0])
+		return errUsage
+	}
+}
+
+// runHistoryList 按条件列出历史记录，默认按时间倒序
+func (c *CLI) runHistoryList(args []string) error {
+	fs := c.newFlagSet("history list")
+	limit := fs.Int("n", 20, "最多显示的记录数，0 表示全部")
+	offset := fs.Int("offset", 0, "跳过的记录数，用于翻页")
+	typ := fs.String("type", "", "只显示 send 或 receive")
+	status := fs.String("status", "", "只显示这些状态，逗号分隔，例如 failed,cancelled")
+	since := fs.String("since", "", "只显示这一天（YYYY-MM-DD）及之后的记录")
+	until := fs.String("until", "", "只显示这一天（YYYY-MM-DD）及之前的记录")
+	code := fs.String("code", "", "接收码包含的内容")
+	name := fs.String("name", "", "文件名或文件夹中的路径包含的内容")
+	minSize := fs.String("min-size", "", "最小大小，例如 10MB")
+	maxSize := fs.String("max-size", "", "最大大小，例如 1GB")
+	sortBy := fs.String("sort", string(storage.SortByTime), "排序字段：time、size 或 duration")
+	asc := fs.Bool("asc", false, "从小到大排序，默认最新、最大、最久的在前")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	q := storage.HistoryQuery{
+		Type:      *typ,
+		Code:      *code,
+		Name:      *name,
+		Sort:      storage.HistorySort(*sortBy),
+		Ascending: *asc,
+		Offset:    *offset,
+		Limit:     *limit,
+	}
+	for _, s := range strings.Split(*status, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			q.Statuses = append(q.Statuses, lifecycle.State(s))
+		}
+	}
+	var err error
+	if q.Since, err = parseDate(*since, 0); err != nil {
+		return err
+	}
+	if q.Until, err = parseDate(*until, 1); err != nil {
+		return err
+	}
+	if q.MinSize, err = parseSize(*minSize); err != nil {
+		return err
+	}
+	if q.MaxSize, err = parseSize(*maxSize); err != nil {
+		return err
+	}
+
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	result, err := c.history.Query(q)
+	if err != nil {
+		return fmt.Errorf("读取历史记录失败: %w", err)
+	}
+	if len(result.Items) == 0 {
+		fmt.Fprintln(c.stdout, "暂无传输记录")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "时间\t类型\t状态\t文件\t大小\t接收码")
+	for _, item := range result.Items {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			item.Timestamp.Format("2006-01-02 15:04"), item.Type, item.Status,
+			item.FileName, item.FileSize, item.Code)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(result.Items) < result.Total {
+		fmt.Fprintf(c.stdout, "显示第 %d-%d 条，共 %d 条\n", *offset+1, *offset+len(result.Items), result.Total)
+	}
+	return nil
+}
+
+// parseDate 解析本地时间的日期，加上 days 天；为空时返回零值
+func parseDate(s string, days int) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("无效的日期 %q，格式为 YYYY-MM-DD", s)
+	}
+	return t.AddDate(0, 0, days), nil
+}
+
+// parseSize 解析字节数或带单位的大小，例如 1024、10MB、1.5 GB；为空时返回 0
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	if n, ok := storage.ParseFileSize(s); ok {
+		return n, nil
+	}
+	return 0, fmt.Errorf("无效的大小 %q", s)
+}
+
+// runHistoryExport 导出历史记录为 JSON
+func (c *CLI) runHistoryExport(args []string) error {
+	fs := c.newFlagSet("history export")
+	output := fs.String("o", "", "输出文件，默认输出到标准输出")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	data, err := c.history.Export()
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		fmt.Fprintln(c.stdout, data)
+		return nil
+	}
+	if err := os.WriteFile(*output, []byte(data+"\n"), 0o644); err != nil {
+		return fmt.Errorf("写入导出文件失败: %w", err)
+	}
+	fmt.Fprintf(c.stderr, "已导出到 %s\n", *output)
+	return nil
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+// runProfiles 管理中继配置
+func (c *CLI) runProfiles(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(c.stderr, "用法: mocroc profiles <list|add|remove|default> [选项]")
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		return c.runProfilesList()
+	case "add":
+		return c.runProfilesAdd(args[1:])
+	case "remove":
+		if len(args) != 2 {
+			fmt.Fprintln(c.stderr, "用法: mocroc profiles remove <名称>")
+			return errUsage
+		}
+		return c.profiles.Delete(args[1])
+	case "default":
+		if len(args) != 2 {
+			fmt.Fprintln(c.stderr, "用法: mocroc profiles default <名称>")
+			return errUsage
+		}
+		return c.profiles.SetDefault(args[1])
+	default:
+		fmt.Fprintf(c.stderr, "未知的 profiles 子命令: %s\n", args[0])
+		return errUsage
+	}
+}
+
+// runProfilesList 列出中继配置，默认配置前标记 *
+func (c *CLI) runProfilesList() error {
+	defaultName := c.profiles.Default().Name
+
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\t名称\t地址\t端口\t选项")
+	for _, p := range c.profiles.List() {
+		mark := ""
+		if p.Name == defaultName {
+			mark = "*"
+		}
+		address := p.Address
+		if p.Address6 != "" {
+			address += " / " + p.Address6
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", mark, p.Name, address, strings.Join(p.Ports, ","), profileFlags(p))
+	}
+	return w.Flush()
+}
+
+// profileFlags 返回中继配置的开关选项说明
+func profileFlags(p crocmgr.RelayProfile) string {
+	var flags []string
+	if p.Embedded {
+		flags = append(flags, "内置中继")
+	}
+	if p.OnlyLocal {
+		flags = append(flags, "仅局域网")
+	}
+	if p.DisableLocal {
+		flags = append(flags, "禁用局域网")
+	}
+	return strings.Join(flags, ",")
+}
+
+// runProfilesAdd 添加或替换中继配置
+func (c *CLI) runProfilesAdd(args []string) error {
+	fs := c.newFlagSet("profiles add")
+	name := fs.String("name", "", "配置名称")
+	address := fs.String("relay", "", "中继服务器地址")
+	address6 := fs.String("relay6", "", "IPv6 中继服务器地址")
+	ports := fs.String("ports", strings.Join(crocmgr.DefaultRelayPorts(), ","), "中继端口，逗号分隔")
+	password := fs.String("pass", crocmgr.DefaultRelayPassword, "中继服务器密码")
+	onlyLocal := fs.Bool("only-local", false, "仅使用局域网")
+	disableLocal := fs.Bool("no-local", false, "禁用局域网直连")
+	embedded := fs.Bool("embedded", false, "在本机启动内置中继，监听第一个端口")
+	setDefault := fs.Bool("default", false, "设为默认配置")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	profile := crocmgr.RelayProfile{
+		Name:         *name,
+		Address:      *address,
+		Address6:     *address6,
+		Ports:        crocmgr.ParseRelayPorts(*ports),
+		Password:     *password,
+		OnlyLocal:    *onlyLocal,
+		DisableLocal: *disableLocal,
+		Embedded:     *embedded,
+	}
+	if err := c.profiles.Save(profile); err != nil {
+		return err
+	}
+	if *setDefault {
+		return c.profiles.SetDefault(strings.TrimSpace(*name))
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shapled/mocroc/internal/codephrase"
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
+	"github.com/shapled/mocroc/internal/share"
+	"github.com/shapled/mocroc/internal/storage"
+)
+
+// runReceive 使用接收码接收文件
+func (c *CLI) runReceive(args []string) error {
+	fs := c.newFlagSet("receive")
+	var relay relayFlags
+	relay.register(fs)
+	out := fs.String("out", ".", "保存目录")
+	qr := fs.String("qr", "", "从二维码图片读取接收码和中继设置")
+	conflict := fs.String("conflict", string(crocmgr.DefaultConflictPolicy), "保存目录中已有同名文件时的处理方式: "+conflictNames())
+	fs.Usage = func() {
+		fmt.Fprintln(c.stderr, "用法: mocroc receive [选项] <接收码|mocroc://链接>")
+		fmt.Fprintln(c.stderr, "      mocroc receive [选项] -qr <二维码图片>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	policy, err := crocmgr.ParseConflictPolicy(*conflict)
+	if err != nil {
+		return err
+	}
+
+	var invite *share.Invite
+	if *qr != "" {
+		if fs.NArg() != 0 {
+			fmt.Fprintln(c.stderr, "-qr 不能与接收码同时使用")
+			return errUsage
+		}
+		decoded, err := share.DecodeQRCodeFile(*qr)
+		if err != nil {
+			return err
+		}
+		invite = &decoded
+		fmt.Fprintf(c.stdout, "已识别接收码: %s，中继: %s\n", decoded.Code, decoded.RelayDescription())
+	} else if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	} else if share.IsInviteURI(fs.Arg(0)) {
+		parsed, err := share.ParseInvite(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		invite = &parsed
+		fmt.Fprintf(c.stdout, "接收码: %s，中继: %s\n", parsed.Code, parsed.RelayDescription())
+	}
+	code := fs.Arg(0)
+	if invite != nil {
+		code = invite.Code
+	}
+	// 在连接中继之前拦截无效的接收码，拼写可能有误时只提示
+	result, err := codephrase.Inspect(code)
+	if err != nil {
+		return err
+	}
+	code = result.Code
+	if result.Suggestion != "" {
+		fmt.Fprintf(c.stderr, "警告: 接收码中的单词可能有误，是否是 %s？\n", result.Suggestion)
+	} else if len(result.Unknown) > 0 {
+		fmt.Fprintf(c.stderr, "警告: 词表中没有 %s，请与发送方确认接收码\n", strings.Join(result.Unknown, "、"))
+	}
+
+	savePath, err := filepath.Abs(*out)
+	if err != nil {
+		return fmt.Errorf("获取保存目录失败: %w", err)
+	}
+
+	// 保存目录中有这个接收码中断的接收时继续接收，发送方的文件与中断时相同才只请求缺少的部分
+	resume, err := crocmgr.LoadResume(savePath, code)
+	resuming := err == nil
+	if resuming {
+		fmt.Fprintf(c.stdout, "继续中断的接收: 已完成 %d/%d 个文件 (%s / %s)\n", resume.FilesDone(), len(resume.Files),
+			storage.FormatFileSize(resume.BytesDone()), storage.FormatFileSize(resume.TotalBytes()))
+	}
+
+	historyID, err := c.history.Add(storage.HistoryItem{
+		Type:       "receive",
+		FileName:   "等待接收文件信息",
+		FileSize:   "未知",
+		Code:       code,
+		Status:     lifecycle.Preparing,
+		Timestamp:  time.Now(),
+		ClientInfo: clientInfo,
+	})
+	if err != nil {
+		return fmt.Errorf("创建历史记录失败: %w", err)
+	}
+
+	// 二维码和链接中的中继是发送方使用的中继，优先于本机的中继配置
+	options := crocmgr.DefaultOptions(false, code)
+	options.Dir = savePath
+	if invite != nil {
+		invite.Apply(&options)
+	} else if err := c.applyRelay(&relay, &options); err != nil {
+		c.updateHistory(historyID, crocmgr.Event{State: lifecycle.Failed}, err.Error())
+		return err
+	}
+
+	err = c.runTransfer(historyID, crocmgr.DirectionReceive, code,
+		func(m *crocmgr.Manager) (*crocmgr.Transfer, error) {
+			if resuming {
+				return m.StartReceiveResume(options, resume)
+			}
+			// 命令行不需要预览，收到文件列表后直接接收，逐个询问时只询问同名文件
+			m.Events().Subscribe(func(e crocmgr.Event) {
+				if e.Type != crocmgr.EventOffer {
+					return
+				}
+				var choices crocmgr.ConflictChoices
+				if policy == crocmgr.ConflictAsk {
+					choices = c.askConflicts(e.Offer.Conflicts())
+				}
+				if t, ok := m.GetTransfer(e.TransferID); ok {
+					t.AcceptWith(policy, choices)
+				}
+			})
+			return m.StartReceiveWithPreview(options)
+		},
+		func(e crocmgr.Event) string { return receiveMessage(e, savePath) },
+	)
+	if resuming && errors.Is(err, crocmgr.ErrNotResumable) {
+		fmt.Fprintf(c.stderr, "保存目录中的断点清单与发送的文件不一致，删除 %s 后可以重新接收\n", crocmgr.ResumePath(savePath, code))
+	}
+	return err
+}
+
+// conflictNames 返回同名文件处理方式的名称，用于参数说明
+func conflictNames() string {
+	var names []string
+	for _, p := range crocmgr.ConflictPolicies() {
+		names = append(names, string(p)+"（"+p.Description()+"）")
+	}
+	return strings.Join(names, "、")
+}
+
+// askConflicts 在终端逐个询问同名文件的处理方式，直接回车时重命名保存
+func (c *CLI) askConflicts(files []crocmgr.OfferFile) crocmgr.ConflictChoices {
+	choices := make(crocmgr.ConflictChoices)
+	reader := bufio.NewReader(c.stdin)
+	for _, f := range files {
+		for {
+			fmt.Fprintf(c.stderr, "%s 已存在，[r]重命名保存 [o]覆盖 [s]跳过 (默认 r): ", f.Path())
+			line, err := reader.ReadString('\n')
+			answer := strings.ToLower(strings.TrimSpace(line))
+			policy, ok := conflictAnswers[answer]
+			if ok {
+				choices[f.Path()] = policy
+				break
+			}
+			if err != nil {
+				// 没有更多输入时使用默认方式
+				choices[f.Path()] = crocmgr.ConflictRename
+				break
+			}
+		}
+	}
+	return choices
+}
+
+// conflictAnswers 终端中询问同名文件时可以输入的选择
+var conflictAnswers = map[string]crocmgr.ConflictPolicy{
+	"":          crocmgr.ConflictRename,
+	"r":         crocmgr.ConflictRename,
+	"rename":    crocmgr.ConflictRename,
+	"o":         crocmgr.ConflictOverwrite,
+	"overwrite": crocmgr.ConflictOverwrite,
+	"s":         crocmgr.ConflictSkip,
+	"skip":      crocmgr.ConflictSkip,
+}
+
+// receiveMessage 返回接收事件对应的状态信息
+func receiveMessage(e crocmgr.Event, savePath string) string {
+	switch e.Type {
+	case crocmgr.EventOffer:
+		if e.Offer.IsText {
+			return "收到文本，正在接收..."
+		}
+		return fmt.Sprintf("收到 %d 个文件 (%s)，开始接收...", e.Offer.NumFiles(), storage.FormatFileSize(e.Offer.TotalBytes))
+	case crocmgr.EventCompleted:
+		if e.IsText {
+			return "文本接收完成:"
+		}
+		return "接收完成，文件保存在: " + savePath
+	case crocmgr.EventFailed:
+		if e.Err != nil {
+			return "接收失败: " + e.Err.Error()
+		}
+		return "接收失败"
+	case crocmgr.EventCancelled:
+		return "接收已取消"
+	}
+
+	switch e.State {
+	case lifecycle.Waiting:
+		return "正在连接发送方..."
+	case lifecycle.Verifying:
+		return "接收完成，正在校验文件..."
+	default:
+		return formatProgress("正在接收", e.Progress)
+	}
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+// runRelay 在前台运行内置中继，直到收到中断信号
+func (c *CLI) runRelay(args []string) error {
+	fs := c.newFlagSet("relay")
+	port := fs.Int("port", crocmgr.DefaultLocalRelayPort, "中继端口")
+	password := fs.String("pass", crocmgr.DefaultRelayPassword, "中继密码")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	relay, err := crocmgr.StartLocalRelay(*port, *password)
+	if err != nil {
+		return err
+	}
+	c.printLocalRelay(relay)
+	fmt.Fprintln(c.stdout, "按 Ctrl+C 停止中继")
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	return nil
+}
@@ -0,0 +1,226 @@
+package cli
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/shapled/mocroc/internal/codephrase"
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
+	"github.com/shapled/mocroc/internal/share"
+	"github.com/shapled/mocroc/internal/storage"
+)
+
+// runSend 发送文件、文件夹或文本
+func (c *CLI) runSend(args []string) error {
+	fs := c.newFlagSet("send")
+	var relay relayFlags
+	relay.register(fs)
+	code := fs.String("code", "", "接收码，默认自动生成")
+	wordlist := fs.String("wordlist", codephrase.DefaultOptions().Wordlist, "自动生成接收码使用的词表: "+wordlistNames())
+	words := fs.Int("words", codephrase.DefaultWords, "自动生成的接收码包含的单词数量")
+	text := fs.String("text", "", "发送文本而不是文件")
+	zip := fs.Bool("zip", false, "压缩文件夹后发送")
+	hash := fs.String("hash", crocmgr.DefaultHashAlgorithm, "接收方校验文件使用的算法: "+hashNames())
+	noLocal := fs.Bool("no-local", false, "禁用局域网直连")
+	var exclude []string
+	fs.Func("exclude", "不发送匹配的文件，写法与 .gitignore 相同，可以重复指定", func(p string) error {
+		exclude = append(exclude, p)
+		return nil
+	})
+	presets := fs.String("ignore", strings.Join(crocmgr.DefaultIgnoreRules().Presets, ","), "启用的内置忽略规则，逗号分隔，none 表示不启用: "+presetNames())
+	gitIgnore := fs.Bool("gitignore", false, "遵循文件夹中的 .gitignore")
+	dryRun := fs.Bool("dry-run", false, "只列出要发送和被忽略的文件，不发送")
+	fs.Usage = func() {
+		fmt.Fprintln(c.stderr, "用法: mocroc send [选项] <路径...>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	paths := fs.Args()
+	if *text == "" && len(paths) == 0 {
+		fmt.Fprintln(c.stderr, "请指定要发送的文件或使用 -text 发送文本")
+		fs.Usage()
+		return errUsage
+	}
+	if *text != "" && len(paths) > 0 {
+		fmt.Fprintln(c.stderr, "-text 不能与文件路径同时使用")
+		return errUsage
+	}
+
+	if err := crocmgr.ValidateHashAlgorithm(*hash); err != nil {
+		return err
+	}
+	rules := crocmgr.IgnoreRules{Patterns: exclude, GitIgnore: *gitIgnore}
+	if *presets != "none" {
+		rules.Presets = strings.FieldsFunc(*presets, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+	if *dryRun && *text != "" {
+		fmt.Fprintln(c.stderr, "-dry-run 只能用于发送文件")
+		return errUsage
+	}
+	var plan crocmgr.SendPlan
+	if *text == "" {
+		var err error
+		if plan, err = planSend(paths, rules); err != nil {
+			return err
+		}
+	}
+	if *dryRun {
+		c.printSendPlan(plan)
+		return nil
+	}
+
+	codeOptions := codephrase.Options{Wordlist: *wordlist, Words: *words}
+	strength := ""
+	if *code == "" {
+		generated, err := codephrase.Generate(codeOptions)
+		if err != nil {
+			return fmt.Errorf("生成接收码失败: %w", err)
+		}
+		*code = generated
+		strength = codeOptions.Describe()
+	} else if err := codephrase.Validate(*code); err != nil {
+		return err
+	}
+
+	item := sendHistoryItem(*code, paths, plan, *text)
+	if c.history.StoreText() {
+		item.Text = *text
+	}
+	historyID, err := c.history.Add(item)
+	if err != nil {
+		return fmt.Errorf("创建历史记录失败: %w", err)
+	}
+
+	options := crocmgr.DefaultOptions(true, *code)
+	options.ZipFolder = *zip
+	options.HashAlgorithm = *hash
+	rules.Apply(&options)
+	if err := c.applyRelay(&relay, &options); err != nil {
+		c.updateHistory(historyID, crocmgr.Event{State: lifecycle.Failed}, err.Error())
+		return err
+	}
+	if *noLocal {
+		options.DisableLocal = true
+	}
+
+	// 文本使用 croc 的文本模式发送，接收端直接显示内容
+	start := func(m *crocmgr.Manager) (*crocmgr.Transfer, error) {
+		return m.StartSendText(options, *text)
+	}
+	if *text == "" {
+		// 记录发送的路径，中断后可以从历史记录继续发送
+		start = func(m *crocmgr.Manager) (*crocmgr.Transfer, error) {
+			return m.StartSendPaths(options, paths)
+		}
+	}
+
+	fmt.Fprintf(c.stdout, "接收码: %s\n", *code)
+	if strength != "" {
+		fmt.Fprintf(c.stdout, "接收码强度: %s\n", strength)
+	}
+	fmt.Fprintf(c.stdout, "在另一台设备上运行: mocroc receive %s\n", *code)
+	fmt.Fprintf(c.stdout, "接收链接: %s\n", share.NewInvite(options).URI())
+
+	return c.runTransfer(historyID, crocmgr.DirectionSend, *code, start, sendMessage)
+}
+
+// wordlistNames 返回内置词表名称，用于参数说明
+func wordlistNames() string {
+	var names []string
+	for _, list := range codephrase.Wordlists() {
+		names = append(names, list.Name)
+	}
+	return strings.Join(names, "、")
+}
+
+// presetNames 返回内置忽略规则的名称，用于参数说明
+func presetNames() string {
+	var names []string
+	for _, p := range crocmgr.IgnorePresets() {
+		names = append(names, p.Name+"（"+p.Description+"）")
+	}
+	return strings.Join(names, "、")
+}
+
+// planSend 按忽略规则列出要发送的文件，不压缩文件夹
+func planSend(paths []string, rules crocmgr.IgnoreRules) (crocmgr.SendPlan, error) {
+	var options croc.Options
+	rules.Apply(&options)
+	return crocmgr.PlanSend(paths, nil, options)
+}
+
+// printSendPlan 列出要发送和被忽略的文件
+func (c *CLI) printSendPlan(plan crocmgr.SendPlan) {
+	for _, f := range plan.Files {
+		fmt.Fprintf(c.stdout, "发送: %s (%s)\n", path.Join(f.FolderRemote, f.Name), storage.FormatFileSize(f.Size))
+	}
+	for _, f := range plan.Excluded {
+		fmt.Fprintf(c.stdout, "忽略: %s (%s) ← %s\n", f.Name, storage.FormatFileSize(f.Size), f.Rule)
+	}
+	fmt.Fprintf(c.stdout, "共发送 %d 个文件 (%s)，忽略 %d 个文件 (%s)\n", len(plan.Files), storage.FormatFileSize(plan.TotalBytes()),
+		len(plan.Excluded), storage.FormatFileSize(plan.ExcludedBytes()))
+}
+
+// hashNames 返回可以选择的校验算法，用于参数说明
+func hashNames() string {
+	var names []string
+	for _, a := range crocmgr.HashAlgorithms() {
+		names = append(names, a.Name)
+	}
+	return strings.Join(names, "、")
+}
+
+// sendMessage 返回发送事件对应的状态信息
+func sendMessage(e crocmgr.Event) string {
+	switch e.Type {
+	case crocmgr.EventCompleted:
+		return "发送完成"
+	case crocmgr.EventFailed:
+		if e.Err != nil {
+			return "发送失败: " + e.Err.Error()
+		}
+		return "发送失败"
+	case crocmgr.EventCancelled:
+		return "发送已取消"
+	}
+
+	switch e.State {
+	case lifecycle.Waiting:
+		return "等待接收方连接..."
+	case lifecycle.Verifying:
+		return "发送完成，等待接收方校验..."
+	default:
+		return formatProgress("正在发送", e.Progress)
+	}
+}
+
+// sendHistoryItem 创建发送历史记录，与界面发送页面记录的内容一致
+// 发送文件时 plan 是按忽略规则筛选后的文件，大小和文件夹数以它为准。
+func sendHistoryItem(code string, paths []string, plan crocmgr.SendPlan, text string) storage.HistoryItem {
+	item := storage.HistoryItem{
+		Type:       "send",
+		Code:       code,
+		Status:     lifecycle.Preparing,
+		Timestamp:  time.Now(),
+		ClientInfo: clientInfo,
+	}
+
+	if text != "" {
+		item.FileName = "文本内容"
+		item.FileSize = storage.FormatFileSize(int64(len(text)))
+		item.NumFiles = 1
+		return item
+	}
+	item.SetSendPlan(paths, plan)
+	return item
+}
@@ -0,0 +1,132 @@
+// Package codephrase 生成和校验接收码
+// 接收码使用 croc 的格式 "四位数字-单词-单词-单词"：croc 用前 4 个字符确定中继上的房间，
+// 第 6 个字符开始的部分作为 PAKE 密码。随机数来自 crypto/rand。
+package codephrase
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// 单词数量范围
+const (
+	MinWords     = 2
+	MaxWords     = 8
+	DefaultWords = 3
+)
+
+// PinDigits 接收码开头的数字位数，与 croc 相同
+const PinDigits = 4
+
+// Separator 接收码各部分之间的分隔符
+const Separator = "-"
+
+// ErrInvalidOptions 无效的接收码生成设置
+var ErrInvalidOptions = errors.New("无效的接收码设置")
+
+// Options 接收码生成设置
+type Options struct {
+	Wordlist string // 词表名称
+	Words    int    // 单词数量
+}
+
+// DefaultOptions 返回默认设置：croc 词表、3 个单词
+func DefaultOptions() Options {
+	return Options{Wordlist: wordlists[0].Name, Words: DefaultWords}
+}
+
+// Validate 检查词表和单词数量
+func (o Options) Validate() error {
+	if _, ok := LookupWordlist(o.Wordlist); !ok {
+		return fmt.Errorf("%w: 未知的词表 %q", ErrInvalidOptions, o.Wordlist)
+	}
+	if o.Words < MinWords || o.Words > MaxWords {
+		return fmt.Errorf("%w: 单词数量需要在 %d 到 %d 之间", ErrInvalidOptions, MinWords, MaxWords)
+	}
+	return nil
+}
+
+// Entropy 估计生成的接收码的熵（比特），设置无效时返回 0
+func (o Options) Entropy() float64 {
+	if o.Validate() != nil {
+		return 0
+	}
+	list, _ := LookupWordlist(o.Wordlist)
+	return PinDigits*math.Log2(10) + float64(o.Words)*math.Log2(float64(len(list.Words)))
+}
+
+// WordsForEntropy 返回达到指定熵所需的最少单词数量，不超过 MaxWords
+func WordsForEntropy(wordlist string, bits float64) (int, error) {
+	for words := MinWords; words <= MaxWords; words++ {
+		o := Options{Wordlist: wordlist, Words: words}
+		if err := o.Validate(); err != nil {
+			return 0, err
+		}
+		if o.Entropy() >= bits {
+			return words, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %d 个单词无法达到 %.0f 位熵", ErrInvalidOptions, MaxWords, bits)
+}
+
+// Strength 返回熵对应的强度说明
+// croc 使用 PAKE，接收码只能在线猜测，40 位以上已经足够。
+func Strength(bits float64) string {
+	switch {
+	case bits >= 60:
+		return "很强"
+	case bits >= 40:
+		return "强"
+	case bits >= 30:
+		return "中等"
+	default:
+		return "弱"
+	}
+}
+
+// Describe 返回设置的熵估计，例如 "约 45 位熵（强）"
+func (o Options) Describe() string {
+	bits := o.Entropy()
+	return fmt.Sprintf("约 %.0f 位熵（%s）", bits, Strength(bits))
+}
+
+// Generate 生成接收码，例如 "4821-bravo-lemon-orbit"
+func Generate(o Options) (string, error) {
+	if err := o.Validate(); err != nil {
+		return "", err
+	}
+	list, _ := LookupWordlist(o.Wordlist)
+
+	parts := make([]string, 0, o.Words+1)
+	var pin strings.Builder
+	for range PinDigits {
+		n, err := randomInt(10)
+		if err != nil {
+			return "", err
+		}
+		pin.WriteByte(byte('0' + n))
+	}
+	parts = append(parts, pin.String())
+
+	for range o.Words {
+		n, err := randomInt(len(list.Words))
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, list.Words[n])
+	}
+	return strings.Join(parts, Separator), nil
+}
+
+// randomInt 返回 [0, n) 中均匀分布的随机数
+func randomInt(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("生成随机数失败: %w", err)
+	}
+	return int(v.Int64()), nil
+}
@@ -0,0 +1,156 @@
+package codephrase
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGenerate_Format(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9]{4}(-[a-z]+){3}$`)
+	for _, list := range Wordlists() {
+		for i := 0; i < 100; i++ {
+			code, err := Generate(Options{Wordlist: list.Name, Words: 3})
+			if err != nil {
+				t.Fatalf("Generate(%s) failed: %v", list.Name, err)
+			}
+			if !pattern.MatchString(code) {
+				t.Fatalf("code %q does not match NNNN-word-word-word", code)
+			}
+			for _, word := range strings.Split(code, Separator)[1:] {
+				if _, found := slices.BinarySearch(list.Words, word); !found {
+					t.Fatalf("word %q of %q is not in wordlist %s", word, code, list.Name)
+				}
+			}
+			if err := Validate(code); err != nil {
+				t.Fatalf("Validate(%q) = %v", code, err)
+			}
+		}
+	}
+}
+
+func TestGenerate_Unique(t *testing.T) {
+	codes := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		code, err := Generate(DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codes[code] {
+			t.Fatalf("duplicate code %q after %d codes", code, i)
+		}
+		codes[code] = true
+	}
+}
+
+func TestGenerate_WordCount(t *testing.T) {
+	for words := MinWords; words <= MaxWords; words++ {
+		code, err := Generate(Options{Wordlist: WordlistCroc, Words: words})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(strings.Split(code, Separator)) - 1; n != words {
+			t.Errorf("code %q has %d words, want %d", code, n, words)
+		}
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	if err := DefaultOptions().Validate(); err != nil {
+		t.Errorf("default options: %v", err)
+	}
+	for _, o := range []Options{
+		{Wordlist: "klingon", Words: 3},
+		{Wordlist: WordlistCroc, Words: MinWords - 1},
+		{Wordlist: WordlistCroc, Words: MaxWords + 1},
+	} {
+		if err := o.Validate(); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%+v: Validate() = %v, want ErrInvalidOptions", o, err)
+		}
+		if _, err := Generate(o); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%+v: Generate() = %v, want ErrInvalidOptions", o, err)
+		}
+		if bits := o.Entropy(); bits != 0 {
+			t.Errorf("%+v: Entropy() = %v, want 0", o, bits)
+		}
+	}
+}
+
+func TestOptions_Entropy(t *testing.T) {
+	// croc 词表至少有 1626 个单词：4 位数字约 13.3 位，每个单词约 10.7 位
+	list, _ := LookupWordlist(WordlistCroc)
+	if len(list.Words) < 1626 {
+		t.Fatalf("croc wordlist has %d words", len(list.Words))
+	}
+	got := Options{Wordlist: WordlistCroc, Words: 3}.Entropy()
+	want := 4*math.Log2(10) + 3*math.Log2(float64(len(list.Words)))
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("Entropy() = %v, want %v", got, want)
+	}
+	if desc := (Options{Wordlist: WordlistCroc, Words: 3}).Describe(); desc != "约 45 位熵（强）" {
+		t.Errorf("Describe() = %q", desc)
+	}
+
+	more := Options{Wordlist: WordlistCroc, Words: 4}.Entropy()
+	if more <= got {
+		t.Errorf("4 words = %v bits, not more than 3 words = %v", more, got)
+	}
+}
+
+func TestWordsForEntropy(t *testing.T) {
+	words, err := WordsForEntropy(WordlistCroc, 45)
+	if err != nil || words != 3 {
+		t.Errorf("WordsForEntropy(croc, 45) = %d, %v, want 3", words, err)
+	}
+	if words, err := WordsForEntropy(WordlistCroc, 0); err != nil || words != MinWords {
+		t.Errorf("WordsForEntropy(croc, 0) = %d, %v", words, err)
+	}
+	if _, err := WordsForEntropy(WordlistShort, 1000); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("unreachable entropy = %v", err)
+	}
+	if _, err := WordsForEntropy("klingon", 40); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("unknown wordlist = %v", err)
+	}
+}
+
+func TestWordlists(t *testing.T) {
+	lower := regexp.MustCompile(`^[a-z]+$`)
+	for _, list := range Wordlists() {
+		if len(list.Words) < 100 {
+			t.Errorf("wordlist %s has only %d words", list.Name, len(list.Words))
+		}
+		if !slices.IsSorted(list.Words) || len(slices.Compact(slices.Clone(list.Words))) != len(list.Words) {
+			t.Errorf("wordlist %s is not sorted and unique", list.Name)
+		}
+		for _, w := range list.Words {
+			if !lower.MatchString(w) {
+				t.Errorf("wordlist %s contains %q", list.Name, w)
+			}
+		}
+	}
+	if _, ok := LookupWordlist(DefaultOptions().Wordlist); !ok {
+		t.Error("default wordlist not found")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, code := range []string{
+		"1234-bravo-lemon-orbit", // 生成的格式
+		"5678-alpha-delta",       // croc 命令行
+		"quickfox-bigbird-4821",  // mocroc 旧版
+		"cli-qr-1234",            // 自定义
+		"123-456-789",            // 自定义
+	} {
+		if err := Validate(code); err != nil {
+			t.Errorf("Validate(%q) = %v", code, err)
+		}
+	}
+	for _, code := range []string{"", "12345", "1234 bravo lemon", "1234-bravo\t", "1234-\x00bravo", "482-bravo-lemon", "48211-bravo"} {
+		if err := Validate(code); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("Validate(%q) = %v, want ErrInvalidCode", code, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package codephrase
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Format 接收码的格式
+type Format int
+
+const (
+	FormatCustom Format = iota // 自定义接收码，原样使用
+	FormatCroc                 // 四位数字-单词-...，mocroc 和 croc 命令行生成
+	FormatLegacy               // 单词-单词-四位数字，mocroc 旧版生成
+)
+
+// Inspection 接收码的检查结果
+type Inspection struct {
+	Code       string   // 规范化后的接收码
+	Format     Format   // 接收码格式
+	Wordlist   string   // 最可能使用的词表，自定义接收码为空
+	Unknown    []string // 不在词表中的单词
+	Suggestion string   // 修正拼写后的接收码，没有把握时为空
+}
+
+// separators 输入时可能被当作分隔符的字符，croc 格式中统一为 "-"
+const separators = "-_.,;:/+·、，。—－"
+
+// Normalize 规范化输入的接收码
+// 去掉首尾空白；croc 格式和旧版格式的接收码统一为小写，空格等分隔符替换为 "-"。
+// 自定义接收码区分大小写，除首尾空白外保持不变。
+func Normalize(code string) string {
+	code = strings.TrimSpace(code)
+	fields := strings.FieldsFunc(code, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(separators, r)
+	})
+	if formatOf(fields) == FormatCustom {
+		return code
+	}
+	return strings.ToLower(strings.Join(fields, Separator))
+}
+
+// Inspect 规范化并检查接收码
+// croc 无法使用的接收码返回 ErrInvalidCode；单词不在词表中时给出最接近的修正建议，但不报错，
+// 因为发送方也可能使用了自定义接收码。
+func Inspect(code string) (Inspection, error) {
+	code = Normalize(code)
+	result := Inspection{Code: code}
+	if err := Validate(code); err != nil {
+		return result, err
+	}
+
+	fields := strings.Split(code, Separator)
+	result.Format = formatOf(fields)
+	var words []string
+	switch result.Format {
+	case FormatCroc:
+		words = fields[1:]
+	case FormatLegacy:
+		words = fields[:len(fields)-1]
+	default:
+		return result, nil
+	}
+
+	list := guessWordlist(result.Format, words)
+	result.Wordlist = list.Name
+	corrected := make([]string, len(fields))
+	copy(corrected, fields)
+	offset := 0
+	if result.Format == FormatCroc {
+		offset = 1
+	}
+	suggest := true
+	for i, word := range words {
+		if list.contains(word) {
+			continue
+		}
+		result.Unknown = append(result.Unknown, word)
+		if nearest, ok := list.nearest(word); ok {
+			corrected[i+offset] = nearest
+		} else {
+			suggest = false
+		}
+	}
+	if len(result.Unknown) > 0 && suggest {
+		result.Suggestion = strings.Join(corrected, Separator)
+	}
+	return result, nil
+}
+
+// formatOf 根据各部分判断接收码格式，不区分大小写
+func formatOf(fields []string) Format {
+	if len(fields) < 2 {
+		return FormatCustom
+	}
+	if isPin(fields[0]) && allLetters(fields[1:]) {
+		return FormatCroc
+	}
+	if len(fields) >= 3 && isPin(fields[len(fields)-1]) && allLetters(fields[:len(fields)-1]) {
+		return FormatLegacy
+	}
+	return FormatCustom
+}
+
+func isPin(s string) bool {
+	return len(s) == PinDigits && isDigits(s)
+}
+
+func allLetters(words []string) bool {
+	for _, w := range words {
+		if w == "" {
+			return false
+		}
+		for _, r := range w {
+			if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// guessWordlist 返回包含最多单词的词表，相同时按内置词表的顺序
+// 旧版格式固定使用组合词词表。
+func guessWordlist(format Format, words []string) Wordlist {
+	if format == FormatLegacy {
+		list, _ := LookupWordlist(WordlistCompound)
+		return list
+	}
+	best, bestCount := wordlists[0], -1
+	for _, list := range wordlists {
+		count := 0
+		for _, w := range words {
+			if list.contains(w) {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = list, count
+		}
+	}
+	return best
+}
@@ -0,0 +1,122 @@
+package codephrase
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"  4821-bravo-lemon-orbit\n": "4821-bravo-lemon-orbit",
+		"4821 Bravo Lemon Orbit":     "4821-bravo-lemon-orbit",
+		"4821_bravo.lemon--orbit":    "4821-bravo-lemon-orbit",
+		"4821－bravo，lemon":           "4821-bravo-lemon",
+		"QuickFox BigBird 4821":      "quickfox-bigbird-4821",
+		// 自定义接收码区分大小写，保持不变
+		"My_Secret.Code":   "My_Secret.Code",
+		"abc 123 def 4567": "abc 123 def 4567",
+	}
+	for in, want := range cases {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestInspect_Formats(t *testing.T) {
+	cases := []struct {
+		code     string
+		format   Format
+		wordlist string
+	}{
+		{"4821 bravo lemon orbit", FormatCroc, WordlistCroc},
+		{"4821-quickfox-bigbird", FormatCroc, WordlistCompound},
+		{"quickfox-bigbird-4821", FormatLegacy, WordlistCompound},
+		{"my-secret-code", FormatCustom, ""},
+	}
+	for _, tc := range cases {
+		got, err := Inspect(tc.code)
+		if err != nil {
+			t.Errorf("Inspect(%q) failed: %v", tc.code, err)
+			continue
+		}
+		if got.Format != tc.format || got.Wordlist != tc.wordlist {
+			t.Errorf("Inspect(%q) = %+v, want format %d wordlist %q", tc.code, got, tc.format, tc.wordlist)
+		}
+		if len(got.Unknown) != 0 || got.Suggestion != "" {
+			t.Errorf("Inspect(%q) reported typos: %+v", tc.code, got)
+		}
+	}
+}
+
+func TestInspect_Generated(t *testing.T) {
+	for _, list := range Wordlists() {
+		for i := 0; i < 20; i++ {
+			code, err := Generate(Options{Wordlist: list.Name, Words: 4})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Inspect(code)
+			if err != nil || got.Code != code || got.Format != FormatCroc || len(got.Unknown) != 0 {
+				t.Fatalf("Inspect(%q) = %+v, %v", code, got, err)
+			}
+		}
+	}
+}
+
+func TestInspect_Suggestion(t *testing.T) {
+	cases := map[string]string{
+		"4821-bravo-lemno-orbit":  "4821-bravo-lemon-orbit", // 相邻字母交换
+		"4821 Brvo lemon orbit":   "4821-bravo-lemon-orbit", // 漏字母
+		"4821-bravo-lemon-orbitt": "4821-bravo-lemon-orbit", // 多字母
+		"quikfox-bigbird-4821":    "quickfox-bigbird-4821",  // 旧版格式
+	}
+	for in, want := range cases {
+		got, err := Inspect(in)
+		if err != nil {
+			t.Errorf("Inspect(%q) failed: %v", in, err)
+			continue
+		}
+		if got.Suggestion != want {
+			t.Errorf("Inspect(%q).Suggestion = %q, want %q (%+v)", in, got.Suggestion, want, got)
+		}
+	}
+
+	// 完全不像词表中的单词时只报告，不给建议
+	got, err := Inspect("4821-bravo-xqzvw-orbit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Suggestion != "" || !slices.Equal(got.Unknown, []string{"xqzvw"}) {
+		t.Errorf("Inspect = %+v", got)
+	}
+}
+
+func TestInspect_Invalid(t *testing.T) {
+	for _, code := range []string{"", "   ", "12-3", "My Secret\x00"} {
+		if _, err := Inspect(code); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("Inspect(%q) = %v, want ErrInvalidCode", code, err)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"lemon", "lemon", 0},
+		{"lemno", "lemon", 1},
+		{"lemo", "lemon", 1},
+		{"lemonn", "lemon", 1},
+		{"lemin", "lemon", 1},
+		{"melon", "lemon", 2},
+		{"orange", "lemon", 3}, // 超过上限
+	}
+	for _, tc := range cases {
+		if got := editDistance(tc.a, tc.b, 2); got != tc.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
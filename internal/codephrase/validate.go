@@ -0,0 +1,51 @@
+package codephrase
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// MinCodeLength croc 接受的最短接收码（字节），前 4 个字符确定房间，其余作为密码
+const MinCodeLength = 6
+
+// ErrInvalidCode 无效的接收码
+var ErrInvalidCode = errors.New("无效的接收码")
+
+// Validate 检查接收码能否被 croc 使用
+// 除了生成的格式，也接受 croc 命令行和 mocroc 旧版的接收码，以及自定义接收码。
+func Validate(code string) error {
+	if code == "" {
+		return fmt.Errorf("%w: 接收码为空", ErrInvalidCode)
+	}
+	for _, r := range code {
+		if unicode.IsSpace(r) {
+			return fmt.Errorf("%w: 不能包含空格", ErrInvalidCode)
+		}
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("%w: 包含无法显示的字符", ErrInvalidCode)
+		}
+	}
+	if len(code) < MinCodeLength {
+		return fmt.Errorf("%w: 至少需要 %d 个字符", ErrInvalidCode, MinCodeLength)
+	}
+	// 数字加单词的接收码只可能是少输或多输了数字
+	if fields := strings.Split(code, Separator); len(fields) > 1 && isDigits(fields[0]) &&
+		len(fields[0]) != PinDigits && allLetters(fields[1:]) {
+		return fmt.Errorf("%w: 开头应为 %d 位数字", ErrInvalidCode, PinDigits)
+	}
+	return nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,209 @@
+package codephrase
+
+import (
+	"slices"
+
+	"github.com/schollz/croc/v10/src/mnemonicode"
+)
+
+// 内置词表名称
+const (
+	WordlistCroc     = "croc"
+	WordlistCompound = "compound"
+	WordlistShort    = "short"
+)
+
+// maxShortWordLen 常用短词的最大长度
+const maxShortWordLen = 5
+
+// Wordlist 生成接收码使用的词表
+type Wordlist struct {
+	Name        string
+	Description string
+	Words       []string // 去重后的单词，全部为小写字母
+}
+
+// wordlists 内置词表，第一个为默认词表
+var wordlists = []Wordlist{
+	{
+		Name:        WordlistCroc,
+		Description: "croc 词表（与 croc 命令行相同）",
+		Words:       uniqueWords(mnemonicode.WordList),
+	},
+	{
+		Name:        WordlistCompound,
+		Description: "组合词（mocroc 旧版格式）",
+		Words:       compoundWords(),
+	},
+	{
+		Name:        WordlistShort,
+		Description: "常用短词（方便口述）",
+		Words:       shortWords(),
+	},
+}
+
+// Wordlists 返回所有内置词表
+func Wordlists() []Wordlist {
+	return slices.Clone(wordlists)
+}
+
+// LookupWordlist 按名称查找词表
+func LookupWordlist(name string) (Wordlist, bool) {
+	for _, list := range wordlists {
+		if list.Name == name {
+			return list, true
+		}
+	}
+	return Wordlist{}, false
+}
+
+// contains 判断单词是否在词表中
+func (l Wordlist) contains(word string) bool {
+	_, found := slices.BinarySearch(l.Words, word)
+	return found
+}
+
+// nearest 返回与单词编辑距离最小的词表单词
+// 距离超过 maxTypos 或有多个同样接近的单词时没有把握，返回 false。
+func (l Wordlist) nearest(word string) (string, bool) {
+	limit := maxTypos(word)
+	best, bestDistance, ties := "", limit+1, 0
+	for _, w := range l.Words {
+		d := editDistance(word, w, limit)
+		switch {
+		case d < bestDistance:
+			best, bestDistance, ties = w, d, 0
+		case d == bestDistance:
+			ties++
+		}
+	}
+	if bestDistance > limit || ties > 0 {
+		return "", false
+	}
+	return best, true
+}
+
+// maxTypos 允许修正的拼写错误数量，短单词只修正一处
+func maxTypos(word string) int {
+	if len(word) <= 4 {
+		return 1
+	}
+	return 2
+}
+
+// editDistance 计算两个单词的编辑距离，相邻字母交换算一处错误
+// 超过 limit 时返回 limit+1。
+func editDistance(a, b string, limit int) int {
+	if d := len(a) - len(b); d > limit || -d > limit {
+		return limit + 1
+	}
+	// prev2、prev、cur 分别是前两行、前一行和当前行
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return min(prev[len(b)], limit+1)
+}
+
+// wordRoots1 英语词根列表 - 第一部分 (前缀/形容词)
+var wordRoots1 = []string{
+	"act", "ask", "big", "bold", "bright", "calm", "clear", "cool", "dark", "deep",
+	"easy", "fast", "fine", "flat", "free", "full", "good", "grand", "great", "green",
+	"hard", "high", "honest", "hot", "huge", "kind", "large", "late", "light", "long",
+	"loud", "low", "mad", "main", "new", "nice", "old", "open", "plain", "pure",
+	"quick", "quiet", "rare", "real", "rich", "round", "safe", "sharp", "slow", "soft",
+	"sore", "square", "star", "still", "sweet", "thick", "thin", "tight", "true", "vast",
+	"warm", "weak", "white", "wild", "wise", "young",
+}
+
+// wordRoots2 英语词根列表 - 第二部分 (名词/动作)
+var wordRoots2 = []string{
+	"art", "ball", "band", "bank", "base", "bell", "bird", "boat", "body", "book",
+	"box", "boy", "bug", "camp", "car", "card", "care", "case", "cat", "chair",
+	"chance", "change", "charge", "city", "class", "cloud", "coat", "code", "coin", "come",
+	"cook", "copper", "copy", "corn", "cost", "cottage", "cotton", "count", "cover", "crack",
+	"cream", "crop", "cross", "crowd", "crown", "cry", "cup", "curve", "cut", "dance",
+	"day", "deal", "deer", "design", "door", "draw", "dream", "dress", "drop", "drum",
+	"duck", "dust", "earth", "edge", "engine", "event", "face", "fact", "fall", "family",
+	"farm", "father", "fear", "field", "fire", "fish", "flag", "flower", "fly", "forest",
+	"form", "fountain", "fox", "friend", "fruit", "game", "garden", "gate", "giant", "gift",
+	"girl", "glass", "glove", "gold", "grass", "group", "guide", "hair", "hand", "head",
+	"heart", "hill", "history", "home", "hope", "horn", "horse", "hour", "house", "hunter",
+	"iron", "island", "jack", "jam", "jar", "jet", "job", "join", "judge", "key",
+	"kick", "king", "kiss", "kite", "knife", "lake", "lamp", "land", "language", "leaf",
+	"leg", "letter", "life", "light", "line", "lion", "lock", "look", "love", "machine",
+	"man", "map", "mark", "mask", "match", "meal", "meat", "milk", "mind", "mine",
+	"minute", "mirror", "money", "moon", "morning", "mother", "mountain", "mouth", "music", "name",
+	"nation", "nature", "nerve", "news", "night", "noise", "north", "nose", "note", "number",
+	"ocean", "offer", "office", "orange", "order", "page", "paint", "paper", "park", "part",
+	"pen", "pencil", "person", "picture", "pie", "pilot", "pipe", "place", "plane", "plant",
+	"plate", "play", "point", "pond", "post", "pot", "price", "prince", "prison", "problem",
+	"process", "produce", "queen", "question", "rain", "range", "rate", "ray", "reason", "record",
+	"rest", "rice", "ring", "river", "road", "rock", "roll", "roof", "room", "root",
+	"rose", "rule", "salt", "sand", "scale", "school", "science", "sea", "seat", "seed",
+	"serve", "shade", "shake", "shape", "share", "sheep", "sheet", "ship", "shirt", "shoe",
+	"shop", "show", "side", "sign", "silk", "silver", "sing", "size", "skin", "skirt",
+	"sky", "sleep", "slave", "snow", "soap", "soldier", "son", "song", "sort", "sound",
+	"south", "space", "spare", "speak", "spring", "square", "stamp", "star", "state", "steam",
+	"steel", "step", "stick", "stone", "stop", "store", "storm", "story", "street", "study",
+	"substance", "sugar", "summer", "support", "surprise", "system", "table", "tail", "teacher", "team",
+	"teeth", "temperature", "test", "text", "than", "that", "theft", "theory", "there", "thick",
+	"thing", "thought", "thread", "thrill", "throat", "thumb", "thunder", "ticket", "time", "tin",
+	"tire", "title", "today", "together", "tomorrow", "tone", "tongue", "tooth", "top", "touch",
+	"tower", "town", "trade", "train", "transport", "tray", "tree", "trick", "trip", "trouble",
+	"trousers", "truck", "turn", "twist", "umbrella", "uncle", "under", "unit", "value", "verse",
+	"vessel", "view", "voice", "walk", "wall", "war", "wash", "watch", "water", "wave",
+	"weather", "week", "weight", "west", "wheel", "whip", "whistle", "white", "wide", "wife",
+	"wind", "window", "wing", "winter", "wire", "wise", "woman", "women", "wood", "word",
+	"work", "world", "worm", "wound", "write", "wrong", "year", "yesterday", "young", "youth",
+}
+
+// compoundWords 两个词根组合成的单词，例如 "quickfox"
+func compoundWords() []string {
+	words := make([]string, 0, len(wordRoots1)*len(wordRoots2))
+	for _, a := range wordRoots1 {
+		for _, b := range wordRoots2 {
+			words = append(words, a+b)
+		}
+	}
+	return uniqueWords(words)
+}
+
+// shortWords 词根中不超过 maxShortWordLen 个字母的单词
+func shortWords() []string {
+	var words []string
+	for _, w := range slices.Concat(wordRoots1, wordRoots2) {
+		if len(w) <= maxShortWordLen {
+			words = append(words, w)
+		}
+	}
+	return uniqueWords(words)
+}
+
+// uniqueWords 排序并去除重复的单词，重复的单词会让熵的估计偏高
+func uniqueWords(words []string) []string {
+	words = slices.Clone(words)
+	slices.Sort(words)
+	return slices.Compact(words)
+}
@@ -0,0 +1,144 @@
+package crocmgr
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/schollz/croc/v10/src/croc"
+)
+
+// zipFolders 把计划中每个所选文件夹的文件和空文件夹压缩为一个文件，代替这些文件发送
+// 压缩文件只包含按忽略规则和取消勾选筛选后的内容，与预览一致；接收方的 croc 把它解压到接收目录。
+// 压缩文件写入临时目录，不在工作目录中留下文件，调用方负责用 removeArchives 删除。
+func zipFolders(paths []string, plan SendPlan) (SendPlan, error) {
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		root := filepath.Base(abs)
+		within := func(f croc.FileInfo) bool {
+			folder := path.Clean(f.FolderRemote)
+			return !f.TempFile && (folder == root || isSkipped([]string{root}, folder))
+		}
+
+		var files, emptyFolders []croc.FileInfo
+		rest := plan
+		rest.Files, rest.EmptyFolders = nil, nil
+		for _, f := range plan.Files {
+			if within(f) {
+				files = append(files, f)
+			} else {
+				rest.Files = append(rest.Files, f)
+			}
+		}
+		for _, f := range plan.EmptyFolders {
+			if within(f) {
+				emptyFolders = append(emptyFolders, f)
+			} else {
+				rest.EmptyFolders = append(rest.EmptyFolders, f)
+			}
+		}
+		if len(files) == 0 && len(emptyFolders) == 0 {
+			continue
+		}
+
+		archive, err := writeArchive(root, files, emptyFolders)
+		if err != nil {
+			removeArchives(rest.Files)
+			return SendPlan{}, err
+		}
+		rest.Files = append(rest.Files, archive)
+		plan = rest
+	}
+	return plan, nil
+}
+
+// writeArchive 在临时目录中创建 root.zip，返回 croc 发送压缩文件使用的文件信息
+// 与 croc 一样不压缩内容，croc 传输时会压缩。
+func writeArchive(root string, files, emptyFolders []croc.FileInfo) (croc.FileInfo, error) {
+	dir, err := os.MkdirTemp("", "mocroc-zip-")
+	if err != nil {
+		return croc.FileInfo{}, fmt.Errorf("创建压缩文件失败: %w", err)
+	}
+	name := filepath.Join(dir, root+".zip")
+	if err := writeZip(name, files, emptyFolders); err != nil {
+		os.RemoveAll(dir)
+		return croc.FileInfo{}, fmt.Errorf("压缩文件夹 %s 失败: %w", root, err)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		os.RemoveAll(dir)
+		return croc.FileInfo{}, fmt.Errorf("压缩文件夹 %s 失败: %w", root, err)
+	}
+	return croc.FileInfo{
+		Name:         info.Name(),
+		FolderRemote: "./",
+		FolderSource: dir,
+		Size:         info.Size(),
+		ModTime:      info.ModTime(),
+		Mode:         info.Mode(),
+		TempFile:     true,
+	}, nil
+}
+
+// writeZip 把文件和空文件夹按发送方的相对路径写入压缩文件
+func writeZip(name string, files, emptyFolders []croc.FileInfo) error {
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := zip.NewWriter(out)
+	w.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, flate.NoCompression)
+	})
+	for _, f := range files {
+		if err := addZipFile(w, f); err != nil {
+			return err
+		}
+	}
+	for _, f := range emptyFolders {
+		if _, err := w.Create(path.Clean(f.FolderRemote) + "/"); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// addZipFile 写入一个文件，保留修改时间和权限
+func addZipFile(w *zip.Writer, f croc.FileInfo) error {
+	src, err := os.Open(filepath.Join(f.FolderSource, f.Name))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = path.Join(path.Clean(f.FolderRemote), f.Name)
+	header.Method = zip.Deflate
+	dst, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
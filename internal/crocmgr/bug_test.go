@@ -7,30 +7,25 @@ import (
 	"time"
 
 	"github.com/schollz/croc/v10/src/croc"
+	"github.com/shapled/mocroc/internal/codephrase"
 )
 
-// TestBug_FixedCodeGeneration 测试接收码生成的问题
-// 根据 send.go:404-412，generateCode 总是返回固定值，这是个 bug
+// TestBug_FixedCodeGeneration 接收码曾经使用固定值或以时间为种子的 math/rand 生成
+// 现在由 codephrase 使用 crypto/rand 生成，多次生成不应重复。
 func TestBug_FixedCodeGeneration(t *testing.T) {
-	// 多次生成代码，验证是否随机化
 	codes := make(map[string]bool)
 	const numCodes = 100
 
 	for i := 0; i < numCodes; i++ {
-		// 模拟 generateCode 的逻辑
-		adjectives := []string{"red", "blue", "green", "yellow", "orange", "purple", "pink", "brown"}
-		animals := []string{"cat", "dog", "frog", "bird", "fish", "lion", "tiger", "bear"}
-		code := adjectives[0] + animals[0] + "123"
-
+		code, err := codephrase.Generate(codephrase.DefaultOptions())
+		if err != nil {
+			t.Fatalf("生成接收码失败: %v", err)
+		}
 		codes[code] = true
 	}
 
-	// 当前实现总是返回相同代码
-	if len(codes) == 1 {
-		t.Log("⚠️  BUG 发现：接收码生成不随机，总是返回固定值")
-		t.Log("   应该使用随机索引来生成唯一码")
-	} else {
-		t.Logf("✅ 接收码生成正常，生成了 %d 个不同的码", len(codes))
+	if len(codes) != numCodes {
+		t.Errorf("生成了 %d 个接收码，只有 %d 个不同", numCodes, len(codes))
 	}
 }
 
@@ -234,17 +229,28 @@ func TestBug_GoroutineLeak(t *testing.T) {
 	}
 }
 
-// TestBug_ReceivePreviewNotImplemented 测试接收端预览功能未实现
-// 根据 receive.go:236-248，previewFiles 只是模拟，没有实际连接
+// TestBug_ReceivePreviewNotImplemented 测试接收端预览读取真实的文件列表
+// 之前 receive.go 的 previewFiles 只返回硬编码的示例文件，现在读取 croc 收到的文件信息
 func TestBug_ReceivePreviewNotImplemented(t *testing.T) {
-	// 这是 UI 相关的 bug，但影响测试
-	t.Log("⚠️  BUG 发现：接收端文件预览功能未实现")
-	t.Log("   当前实现返回硬编码的示例文件")
-	t.Log("   应该实际连接到发送方并获取真实文件列表")
+	client, err := croc.New(DefaultOptions(false, "test-preview"))
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+
+	// 模拟 croc 调用 OnFileInfo 时收到的发送方文件信息
+	client.TotalNumberFolders = 1
+	client.FilesToTransfer = []croc.FileInfo{
+		{Name: "a.txt", FolderRemote: "docs", Size: 100},
+		{Name: "b.txt", FolderRemote: "docs", Size: 200},
+	}
+	offer := readOffer(client)
+	if offer.NumFiles() != 2 || offer.TotalBytes != 300 || offer.NumFolders != 1 || offer.Files[0].Folder != "docs" {
+		t.Errorf("预览不正确: %+v", offer)
+	}
 }
 
-// TestBug_NoRealProgressUpdate 测试没有真实的进度更新
-// 根据 send.go:477-498，simulateProgress 只是模拟，没有真实传输进度
+// TestBug_NoRealProgressUpdate 测试进度来自真实的 croc 客户端
+// 之前 send.go 的 simulateProgress 只是模拟进度，现在改为读取客户端的进度快照
 func TestBug_NoRealProgressUpdate(t *testing.T) {
 	manager := NewManager()
 	defer manager.Close()
@@ -259,14 +265,20 @@ func TestBug_NoRealProgressUpdate(t *testing.T) {
 		t.Fatalf("创建客户端失败: %v", err)
 	}
 
-	// 当前的 simulateProgress 只是空循环
-	// 没有从 croc 客户端获取实际进度
-
-	t.Log("⚠️  BUG 发现：进度更新是模拟的，不是真实的")
-	t.Log("   simulateProgress 只是更新 UI，没有反映实际传输进度")
-	t.Log("   应该从 croc 客户端获取真实传输进度")
+	// 尚未连接时不应该报告任何进度
+	if p := ReadProgress(client); p.Connected || p.Fraction() != 0 {
+		t.Errorf("未连接的客户端不应有进度: %+v", p)
+	}
 
-	_ = client
+	// 模拟 croc 在传输过程中更新的进度快照
+	p := progressOf(croc.Progress{
+		ChannelSecured: true,
+		Files:          []croc.FileInfo{{Name: "a.txt", Size: 1000}},
+		CurrentSent:    400,
+	})
+	if p.Fraction() != 0.4 {
+		t.Errorf("进度 = %f, 期望 0.4", p.Fraction())
+	}
 }
 
 // TestBug_EmptyFileListSend 测试发送空文件列表
@@ -0,0 +1,195 @@
+package crocmgr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/schollz/croc/v10/src/utils"
+)
+
+// ConflictPolicy 接收的文件与保存目录中已有文件同名时的处理方式
+type ConflictPolicy string
+
+const (
+	ConflictRename    ConflictPolicy = "rename"    // 在文件名后加序号保存，不改动已有文件
+	ConflictOverwrite ConflictPolicy = "overwrite" // 删除已有文件后重新接收
+	ConflictSkip      ConflictPolicy = "skip"      // 不接收这个文件，保留已有文件
+	ConflictAsk       ConflictPolicy = "ask"       // 接收前逐个询问，由界面或命令行决定
+)
+
+// DefaultConflictPolicy 默认的处理方式，不会丢失已有文件
+const DefaultConflictPolicy = ConflictRename
+
+// ErrInvalidConflictPolicy 不支持的同名文件处理方式
+var ErrInvalidConflictPolicy = errors.New("不支持的同名文件处理方式")
+
+var conflictPolicies = []ConflictPolicy{ConflictRename, ConflictOverwrite, ConflictSkip, ConflictAsk}
+
+// ConflictPolicies 返回可以选择的处理方式，第一个是默认方式
+func ConflictPolicies() []ConflictPolicy {
+	return slices.Clone(conflictPolicies)
+}
+
+// ParseConflictPolicy 解析处理方式的名称
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	for _, p := range conflictPolicies {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidConflictPolicy, s)
+}
+
+// Description 返回处理方式的说明
+func (p ConflictPolicy) Description() string {
+	switch p {
+	case ConflictRename:
+		return "重命名保存"
+	case ConflictOverwrite:
+		return "覆盖已有文件"
+	case ConflictSkip:
+		return "跳过"
+	case ConflictAsk:
+		return "逐个询问"
+	}
+	return string(p)
+}
+
+// ConflictChoices 逐个文件选择的处理方式，键为文件相对保存目录的路径
+type ConflictChoices map[string]ConflictPolicy
+
+// ReceivedFile 接收的一个文件保存的位置
+type ReceivedFile struct {
+	Name     string         `json:"name"`               // 发送方的相对路径
+	Path     string         `json:"path,omitempty"`     // 保存的完整路径，跳过时为空
+	Conflict ConflictPolicy `json:"conflict,omitempty"` // 与已有文件同名时的处理方式
+}
+
+// Renamed 是否因为同名而换了文件名
+func (f ReceivedFile) Renamed() bool {
+	return f.Conflict == ConflictRename
+}
+
+// Skipped 是否因为同名而没有接收
+func (f ReceivedFile) Skipped() bool {
+	return f.Conflict == ConflictSkip
+}
+
+// ReceivedFiles 返回接收文件保存的位置，确认接收之前为空
+func (t *Transfer) ReceivedFiles() []ReceivedFile {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return slices.Clone(t.received)
+}
+
+// skipped 文件是否因为同名而没有接收
+func (t *Transfer) skipped(i int) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return i < len(t.received) && t.received[i].Skipped()
+}
+
+// hasConflict 保存目录中是否已有同名但内容不同的文件
+// 内容相同的文件 croc 会直接跳过，不算同名冲突。
+func hasConflict(dir, algorithm string, f croc.FileInfo) bool {
+	name := receivedPath(dir, path.Join(filepath.ToSlash(f.FolderRemote), f.Name))
+	info, err := os.Lstat(name)
+	if err != nil {
+		return false
+	}
+	if info.Mode().IsRegular() && info.Size() == f.Size {
+		if f.Size == 0 {
+			return false
+		}
+		if sum, err := utils.HashFile(name, algorithm); err == nil && bytes.Equal(sum, f.Hash) {
+			return false
+		}
+	}
+	return true
+}
+
+// markConflicts 标记文件列表中与保存目录里已有文件同名的文件
+func (t *Transfer) markConflicts(offer *Offer) {
+	if offer.IsText || t.dir == "" || t.Resumed() {
+		return
+	}
+	files := t.client.FilesToTransfer
+	for i := range offer.Files {
+		if i < len(files) {
+			offer.Files[i].Exists = hasConflict(t.dir, t.client.Options.HashAlgorithm, t.routed(i, files[i]))
+		}
+	}
+}
+
+// resolveConflicts 在 croc 写入之前处理与已有文件同名的文件，记录每个文件保存的位置
+// croc 此时在等待确认，可以安全地修改文件列表：先按保存位置规则把文件放到对应的文件夹；
+// 重命名的文件换成不存在的文件名；覆盖时先删除已有文件，避免 croc 把大小相同的文件当作未完成的文件续传；
+// 跳过的文件标记为已完成，croc 不会请求它。
+func (t *Transfer) resolveConflicts(policy ConflictPolicy, choices ConflictChoices) {
+	client := t.client
+	sources := make([]string, len(client.FilesToTransfer))
+	incoming := make(map[string]bool)
+	for i := range client.FilesToTransfer {
+		f := &client.FilesToTransfer[i]
+		sources[i] = path.Join(filepath.ToSlash(f.FolderRemote), f.Name)
+		*f = t.routed(i, *f)
+		incoming[path.Join(filepath.ToSlash(f.FolderRemote), f.Name)] = true
+	}
+
+	received := make([]ReceivedFile, len(client.FilesToTransfer))
+	for i := range client.FilesToTransfer {
+		f := &client.FilesToTransfer[i]
+		name := sources[i]
+		r := ReceivedFile{Name: name, Path: receivedPath(t.dir, path.Join(filepath.ToSlash(f.FolderRemote), f.Name))}
+		if hasConflict(t.dir, client.Options.HashAlgorithm, *f) {
+			r.Conflict = policy
+			if choice, ok := choices[name]; ok {
+				r.Conflict = choice
+			}
+			if r.Conflict != ConflictOverwrite && r.Conflict != ConflictSkip {
+				r.Conflict = ConflictRename
+			}
+			switch r.Conflict {
+			case ConflictOverwrite:
+				if err := os.Remove(r.Path); err != nil {
+					log.Printf("删除已有文件失败: %v\n", err)
+				}
+			case ConflictSkip:
+				client.FilesHasFinished[i] = struct{}{}
+				r.Path = ""
+			case ConflictRename:
+				f.Name = freeName(t.dir, filepath.ToSlash(f.FolderRemote), f.Name, incoming)
+				incoming[path.Join(filepath.ToSlash(f.FolderRemote), f.Name)] = true
+				r.Path = receivedPath(t.dir, path.Join(filepath.ToSlash(f.FolderRemote), f.Name))
+			}
+		}
+		received[i] = r
+	}
+
+	t.mu.Lock()
+	t.received = received
+	t.mu.Unlock()
+}
+
+// freeName 返回文件夹中不存在、也不会被其他接收文件使用的文件名，例如 "report (1).pdf"
+func freeName(dir, folder, name string, incoming map[string]bool) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		if incoming[path.Join(folder, candidate)] {
+			continue
+		}
+		if _, err := os.Lstat(receivedPath(dir, path.Join(folder, candidate))); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
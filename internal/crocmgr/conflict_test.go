@@ -0,0 +1,145 @@
+package crocmgr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	if ConflictPolicies()[0] != DefaultConflictPolicy {
+		t.Error("the default policy should be listed first")
+	}
+	for _, p := range ConflictPolicies() {
+		if got, err := ParseConflictPolicy(string(p)); err != nil || got != p {
+			t.Errorf("ParseConflictPolicy(%s) = %s, %v", p, got, err)
+		}
+		if p.Description() == string(p) {
+			t.Errorf("%s has no description", p)
+		}
+	}
+	if _, err := ParseConflictPolicy("merge"); !errors.Is(err, ErrInvalidConflictPolicy) {
+		t.Errorf("ParseConflictPolicy(merge) = %v", err)
+	}
+}
+
+func TestFreeName(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "report.pdf"), nil, 0o644)
+	os.WriteFile(filepath.Join(dir, "report (1).pdf"), nil, 0o644)
+	incoming := map[string]bool{"report.pdf": true, "report (2).pdf": true}
+	if got := freeName(dir, ".", "report.pdf", incoming); got != "report (3).pdf" {
+		t.Errorf("freeName = %q, want report (3).pdf", got)
+	}
+	if got := freeName(dir, "sub", "notes", nil); got != "notes (1)" {
+		t.Errorf("freeName without extension = %q", got)
+	}
+}
+
+// TestReceiveWithPreview_Conflicts 保存目录中已有同名文件时按选择的方式处理
+func TestReceiveWithPreview_Conflicts(t *testing.T) {
+	relay := startTestRelay(t)
+	srcDir := t.TempDir()
+	dstDir := chdirTemp(t)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "same.txt"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte("new "+name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// same.txt 与发送的内容相同，不算同名冲突
+	os.WriteFile(filepath.Join(dstDir, "a.txt"), []byte("old a"), 0o644)
+	os.WriteFile(filepath.Join(dstDir, "b.txt"), []byte("old b"), 0o644)
+	os.WriteFile(filepath.Join(dstDir, "c.txt"), []byte("old c"), 0o644)
+	os.WriteFile(filepath.Join(dstDir, "same.txt"), []byte("new same.txt"), 0o644)
+
+	m := NewManager()
+	defer m.Close()
+	events := make(chan Event, 10)
+	m.Events().Subscribe(func(e Event) {
+		if e.Direction == DirectionReceive && (e.Type == EventOffer || e.IsFinal()) {
+			events <- e
+		}
+	})
+
+	code := "conflict-" + strconv.FormatInt(time.Now().UnixNano()%100000, 10)
+	sendOptions := DefaultOptions(true, code)
+	sendOptions.DisableLocal = true
+	relay.Apply(&sendOptions)
+	var paths []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "same.txt"} {
+		paths = append(paths, filepath.Join(srcDir, name))
+	}
+	sender, err := m.StartSendPaths(sendOptions, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	receiveOptions := DefaultOptions(false, code)
+	receiveOptions.DisableLocal = true
+	relay.Apply(&receiveOptions)
+	receiver, err := m.StartReceiveWithPreview(receiveOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e Event
+	select {
+	case e = <-events:
+	case <-time.After(30 * time.Second):
+		sender.Cancel()
+		receiver.Cancel()
+		t.Fatal("no offer received")
+	}
+	conflicts := e.Offer.Conflicts()
+	if len(conflicts) != 3 || conflicts[0].Path() != "a.txt" || conflicts[2].Path() != "c.txt" {
+		t.Fatalf("conflicts = %+v", conflicts)
+	}
+	if err := receiver.AcceptWith(ConflictAsk, ConflictChoices{"b.txt": ConflictOverwrite, "c.txt": ConflictSkip}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e = <-events:
+	case <-time.After(30 * time.Second):
+		sender.Cancel()
+		receiver.Cancel()
+		t.Fatal("receive timed out")
+	}
+	if e.Type != EventCompleted {
+		t.Fatalf("receive finished with %s: %v", e.Type, e.Err)
+	}
+	sender.Wait()
+
+	for name, want := range map[string]string{
+		"a.txt":     "old a",
+		"a (1).txt": "new a.txt",
+		"b.txt":     "new b.txt",
+		"c.txt":     "old c",
+		"same.txt":  "new same.txt",
+	} {
+		if data, err := os.ReadFile(filepath.Join(dstDir, name)); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, want)
+		}
+	}
+
+	want := []ReceivedFile{
+		{Name: "a.txt", Path: filepath.Join(dstDir, "a (1).txt"), Conflict: ConflictRename},
+		{Name: "b.txt", Path: filepath.Join(dstDir, "b.txt"), Conflict: ConflictOverwrite},
+		{Name: "c.txt", Conflict: ConflictSkip},
+		{Name: "same.txt", Path: filepath.Join(dstDir, "same.txt")},
+	}
+	if len(e.Files) != len(want) {
+		t.Fatalf("files = %+v", e.Files)
+	}
+	for i := range want {
+		if e.Files[i] != want[i] {
+			t.Errorf("file %d = %+v, want %+v", i, e.Files[i], want[i])
+		}
+	}
+	// 跳过的文件没有接收，不参与校验
+	if e.Verification == nil || !e.Verification.Passed() || len(e.Verification.Files) != 3 {
+		t.Errorf("verification = %+v", e.Verification)
+	}
+}
@@ -0,0 +1,197 @@
+package crocmgr
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/schollz/croc/v10/src/tcp"
+)
+
+// DefaultProbeTimeout 检查单个中继的默认超时时间
+const DefaultProbeTimeout = 5 * time.Second
+
+// ErrNoHealthyRelay 没有可用的中继
+var ErrNoHealthyRelay = errors.New("没有可用的中继")
+
+// RelayStatus 一次中继检查的结果
+type RelayStatus struct {
+	Profile       string
+	Address       string
+	Reachable     bool          // TCP 可以连接
+	Authenticated bool          // 使用密码握手成功
+	Latency       time.Duration // TCP 连接往返延迟
+	Handshake     time.Duration // 握手耗时
+	Err           error
+	CheckedAt     time.Time
+}
+
+// Healthy 中继可以用于传输
+func (s RelayStatus) Healthy() bool {
+	return s.Reachable && s.Authenticated
+}
+
+// Summary 返回检查结果的简短说明
+func (s RelayStatus) Summary() string {
+	switch {
+	case s.Healthy():
+		return fmt.Sprintf("可用，延迟 %d ms，握手 %d ms", s.Latency.Milliseconds(), s.Handshake.Milliseconds())
+	case s.Err != nil:
+		return s.Err.Error()
+	default:
+		return "未检查"
+	}
+}
+
+// Diagnostics 中继诊断服务
+// 检查中继的连通性、密码和延迟，并保存每个配置最近一次的结果。
+type Diagnostics struct {
+	Timeout time.Duration
+
+	mu   sync.RWMutex
+	last map[string]RelayStatus
+}
+
+// NewDiagnostics 创建中继诊断服务
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{
+		Timeout: DefaultProbeTimeout,
+		last:    make(map[string]RelayStatus),
+	}
+}
+
+// Check 检查一个中继配置
+// 先测量 TCP 连接延迟，再用配置的密码完成与中继的握手。
+func (d *Diagnostics) Check(ctx context.Context, profile RelayProfile) RelayStatus {
+	status := d.check(ctx, profile)
+	status.CheckedAt = time.Now()
+
+	d.mu.Lock()
+	d.last[profile.Name] = status
+	d.mu.Unlock()
+	return status
+}
+
+func (d *Diagnostics) check(ctx context.Context, profile RelayProfile) RelayStatus {
+	status := RelayStatus{Profile: profile.Name}
+	if err := profile.Validate(); err != nil {
+		status.Err = err
+		return status
+	}
+	if profile.OnlyLocal {
+		status.Err = errors.New("仅使用局域网，不经过中继")
+		return status
+	}
+
+	status.Address = probeAddress(profile)
+	if profile.Embedded && !localRelayRunning(profile.Ports[0]) {
+		status.Err = errors.New("内置中继未启动，传输时自动启动")
+		return status
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", status.Address)
+	if err != nil {
+		status.Err = fmt.Errorf("连接中继失败: %w", err)
+		return status
+	}
+	status.Latency = time.Since(start)
+	status.Reachable = true
+	conn.Close()
+
+	start = time.Now()
+	c, _, _, err := tcp.ConnectToTCPServer(status.Address, profile.Password, probeRoom(), d.Timeout)
+	if err != nil {
+		status.Err = fmt.Errorf("中继握手失败: %w", err)
+		return status
+	}
+	status.Handshake = time.Since(start)
+	status.Authenticated = true
+	c.Close()
+	return status
+}
+
+// CheckAll 并发检查多个中继配置，结果顺序与配置一致
+func (d *Diagnostics) CheckAll(ctx context.Context, profiles []RelayProfile) []RelayStatus {
+	statuses := make([]RelayStatus, len(profiles))
+	var wg sync.WaitGroup
+	for i, p := range profiles {
+		wg.Add(1)
+		go func(i int, p RelayProfile) {
+			defer wg.Done()
+			statuses[i] = d.Check(ctx, p)
+		}(i, p)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// Last 返回配置最近一次的检查结果
+func (d *Diagnostics) Last(name string) (RelayStatus, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	status, ok := d.last[name]
+	return status, ok
+}
+
+// Fastest 检查所有远程中继，返回延迟最低的可用配置
+// 内置中继和仅局域网的配置需要双方约定，不参与自动选择。
+func (d *Diagnostics) Fastest(ctx context.Context, profiles []RelayProfile) (RelayProfile, RelayStatus, error) {
+	var candidates []RelayProfile
+	for _, p := range profiles {
+		if !p.Embedded && !p.OnlyLocal {
+			candidates = append(candidates, p)
+		}
+	}
+
+	best := -1
+	statuses := d.CheckAll(ctx, candidates)
+	for i, s := range statuses {
+		if s.Healthy() && (best < 0 || s.Latency < statuses[best].Latency) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return RelayProfile{}, RelayStatus{}, ErrNoHealthyRelay
+	}
+	return candidates[best], statuses[best], nil
+}
+
+// probeAddress 返回检查时连接的地址，与传输时 croc 使用的地址相同
+// 同时配置了 IPv4 和 IPv6 地址时检查 IPv4 地址。
+func probeAddress(profile RelayProfile) string {
+	address, address6 := profile.dialAddresses()
+	if address == "" {
+		return address6
+	}
+	return address
+}
+
+// probeRoom 返回检查用的随机房间名，连接关闭后中继会删除房间
+func probeRoom() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "mocroc-probe-" + hex.EncodeToString(b)
+}
+
+// localRelayRunning 端口上是否已经启动了内置中继
+func localRelayRunning(port string) bool {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return false
+	}
+	localRelaysMu.Lock()
+	defer localRelaysMu.Unlock()
+	_, ok := localRelays[n]
+	return ok
+}
@@ -0,0 +1,87 @@
+package crocmgr
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDiagnostics_Check(t *testing.T) {
+	relay := startTestRelay(t)
+	good := RelayProfile{Name: "good", Address: relay.Address(), Ports: relay.Ports, Password: relay.Password}
+	badPass := good
+	badPass.Name = "bad-pass"
+	badPass.Password = "wrong"
+	closed := RelayProfile{Name: "closed", Address: "127.0.0.1", Ports: []string{strconv.Itoa(freeRelayPort(t))}, Password: relay.Password}
+
+	d := NewDiagnostics()
+	d.Timeout = 2 * time.Second
+	statuses := d.CheckAll(context.Background(), []RelayProfile{good, badPass, closed})
+
+	if s := statuses[0]; !s.Healthy() || s.Err != nil || s.Latency <= 0 {
+		t.Errorf("good relay: %+v", s)
+	}
+	if s := statuses[1]; !s.Reachable || s.Authenticated || s.Err == nil {
+		t.Errorf("wrong password should be reachable but not authenticated: %+v", s)
+	}
+	if s := statuses[2]; s.Reachable || s.Err == nil {
+		t.Errorf("closed port should be unreachable: %+v", s)
+	}
+	if s, ok := d.Last("good"); !ok || !s.Healthy() || s.CheckedAt.IsZero() {
+		t.Errorf("Last(good) = %+v, %v", s, ok)
+	}
+
+	embedded := RelayProfile{Name: "embedded", Ports: []string{relay.Ports[0]}, Password: relay.Password, Embedded: true}
+	if s := d.Check(context.Background(), embedded); !s.Healthy() {
+		t.Errorf("running embedded relay: %+v", s)
+	}
+}
+
+func TestDiagnostics_Fastest(t *testing.T) {
+	relay := startTestRelay(t)
+	good := RelayProfile{Name: "good", Address: relay.Address(), Ports: relay.Ports, Password: relay.Password}
+	badPass := good
+	badPass.Name = "bad-pass"
+	badPass.Password = "wrong"
+	embedded := RelayProfile{Name: "embedded", Ports: []string{relay.Ports[0]}, Password: relay.Password, Embedded: true}
+
+	d := NewDiagnostics()
+	d.Timeout = 2 * time.Second
+	profile, status, err := d.Fastest(context.Background(), []RelayProfile{badPass, embedded, good})
+	if err != nil {
+		t.Fatalf("Fastest failed: %v", err)
+	}
+	if profile.Name != "good" || !status.Healthy() {
+		t.Errorf("Fastest = %s, %+v", profile.Name, status)
+	}
+
+	if _, _, err := d.Fastest(context.Background(), []RelayProfile{badPass, embedded}); !errors.Is(err, ErrNoHealthyRelay) {
+		t.Errorf("err = %v, want ErrNoHealthyRelay", err)
+	}
+}
+
+// TestProbeAddress_MatchesDialAddress 诊断检查的地址就是传输时 croc 连接的地址
+func TestProbeAddress_MatchesDialAddress(t *testing.T) {
+	relay := startTestRelay(t)
+	profiles := []RelayProfile{
+		{Name: "bare", Address: "relay.example.com", Ports: []string{"9109", "9110"}},
+		{Name: "with-port", Address: "relay.example.com:9200", Ports: []string{"9109"}},
+		{Name: "ipv6-only", Address6: "2001:db8::1", Ports: []string{"9109"}},
+		{Name: "embedded", Ports: []string{relay.Ports[0]}, Password: relay.Password, Embedded: true},
+	}
+	for _, p := range profiles {
+		options := DefaultOptions(true, "code")
+		if _, err := p.Apply(&options); err != nil {
+			t.Fatalf("%s: Apply failed: %v", p.Name, err)
+		}
+		dialled := options.RelayAddress
+		if dialled == "" {
+			dialled = options.RelayAddress6
+		}
+		if probed := probeAddress(p); probed != dialled {
+			t.Errorf("%s: probed %q, transfers dial %q", p.Name, probed, dialled)
+		}
+	}
+}
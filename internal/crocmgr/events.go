@@ -0,0 +1,188 @@
+package crocmgr
+
+import (
+	"sync"
+	"time"
+
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+// EventType 传输事件类型
+type EventType string
+
+const (
+	EventTransferStarted EventType = "transfer_started" // 任务已创建，等待对端连接
+	EventOffer           EventType = "offer"            // 收到发送方的文件列表，等待确认
+	EventPeerConnected   EventType = "peer_connected"   // 对端已连接，开始传输
+	EventFileStarted     EventType = "file_started"     // 开始传输新的文件
+	EventProgress        EventType = "progress"         // 传输进度变化
+	EventStateChanged    EventType = "state_changed"    // 其他状态变化，例如进入校验
+	EventCompleted       EventType = "completed"
+	EventFailed          EventType = "failed"
+	EventCancelled       EventType = "cancelled"
+)
+
+// Event 传输生命周期事件
+type Event struct {
+	Type       EventType
+	TransferID string // 任务创建之前就失败时为空
+	Direction  Direction
+	Code       string
+	State      lifecycle.State
+	Progress   Progress
+	Err        error  // 失败或取消的原因
+	Offer      *Offer // 等待确认的文件列表，只在 EventOffer 中设置
+	Text       string // 接收到的文本，只在文本传输的 EventCompleted 中设置
+	IsText     bool
+	Resume     *Resume // 中断的传输可以继续时的断点信息，只在 EventFailed 和 EventCancelled 中设置
+	// Relay 任务使用的中继，只在 EventTransferStarted 中设置
+	Relay *RelayProfile
+	// Files 接收文件保存的位置，只在确认过文件列表的接收任务的结束事件中设置
+	Files []ReceivedFile
+	// Manifest 文件清单，只在 EventOffer 和文件传输的结束事件中设置
+	Manifest *Manifest
+	// Verification 接收完成后的校验报告，只在校验过文件的接收任务的结束事件中设置
+	Verification *Verification
+	Time         time.Time
+}
+
+// IsFinal 是否为任务结束事件
+func (e Event) IsFinal() bool {
+	return e.Type == EventCompleted || e.Type == EventFailed || e.Type == EventCancelled
+}
+
+// subscription 一个订阅者
+type subscription struct {
+	handler  func(Event)
+	dispatch func(func())
+
+	mu     sync.Mutex
+	active bool
+}
+
+func (s *subscription) deliver(e Event) {
+	call := func() {
+		s.mu.Lock()
+		active := s.active
+		s.mu.Unlock()
+		if active {
+			s.handler(e)
+		}
+	}
+	if s.dispatch != nil {
+		s.dispatch(call)
+		return
+	}
+	call()
+}
+
+// EventBus 传输事件总线，支持任意数量的订阅者
+// Publish 不会阻塞，事件在后台按发布顺序逐个投递给所有订阅者，
+// 订阅者按订阅顺序收到同一个事件。
+type EventBus struct {
+	mu     sync.Mutex
+	subs   []*subscription
+	queue  []Event
+	wake   chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+// NewEventBus 创建事件总线并启动投递
+func NewEventBus() *EventBus {
+	b := &EventBus{
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Subscribe 订阅事件，handler 在事件总线的 goroutine 中调用
+// 返回的函数用于取消订阅，可以重复调用。
+func (b *EventBus) Subscribe(handler func(Event)) (unsubscribe func()) {
+	return b.SubscribeWith(nil, handler)
+}
+
+// SubscribeWith 订阅事件，通过 dispatch 调用 handler
+// 界面传入 fyne.Do 即可在 Fyne 主线程中处理事件。
+func (b *EventBus) SubscribeWith(dispatch func(func()), handler func(Event)) (unsubscribe func()) {
+	sub := &subscription{handler: handler, dispatch: dispatch, active: true}
+
+	b.mu.Lock()
+	b.subs = append(b.subs, sub)
+	b.mu.Unlock()
+
+	return func() {
+		sub.mu.Lock()
+		sub.active = false
+		sub.mu.Unlock()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, s := range b.subs {
+			if s == sub {
+				b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Publish 发布事件，总线关闭后的事件会被丢弃
+func (b *EventBus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.queue = append(b.queue, e)
+	b.mu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close 停止投递，尚未投递的事件会被丢弃
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	b.queue = nil
+	close(b.done)
+}
+
+func (b *EventBus) run() {
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-b.wake:
+		}
+
+		for {
+			b.mu.Lock()
+			if b.closed || len(b.queue) == 0 {
+				b.mu.Unlock()
+				break
+			}
+			e := b.queue[0]
+			b.queue = b.queue[1:]
+			subs := append([]*subscription(nil), b.subs...)
+			b.mu.Unlock()
+
+			for _, sub := range subs {
+				sub.deliver(e)
+			}
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package crocmgr
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+// eventRecorder 记录收到的事件
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+	notify chan struct{}
+}
+
+func newEventRecorder() *eventRecorder {
+	return &eventRecorder{notify: make(chan struct{}, 100)}
+}
+
+func (r *eventRecorder) handle(e Event) {
+	r.mu.Lock()
+	r.events = append(r.events, e)
+	r.mu.Unlock()
+	r.notify <- struct{}{}
+}
+
+func (r *eventRecorder) types() []EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var types []EventType
+	for _, e := range r.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+// waitFor 等待直到收到指定类型的事件
+func (r *eventRecorder) waitFor(t *testing.T, typ EventType) Event {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for {
+		r.mu.Lock()
+		for _, e := range r.events {
+			if e.Type == typ {
+				r.mu.Unlock()
+				return e
+			}
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-r.notify:
+		case <-deadline:
+			t.Fatalf("no %s event, got %v", typ, r.types())
+		}
+	}
+}
+
+func TestEventBus_DeliversInOrderToAllSubscribers(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	first, second := newEventRecorder(), newEventRecorder()
+	bus.Subscribe(first.handle)
+	bus.Subscribe(second.handle)
+
+	for _, typ := range []EventType{EventTransferStarted, EventPeerConnected, EventCompleted} {
+		bus.Publish(Event{Type: typ})
+	}
+
+	for _, r := range []*eventRecorder{first, second} {
+		r.waitFor(t, EventCompleted)
+		got := r.types()
+		want := []EventType{EventTransferStarted, EventPeerConnected, EventCompleted}
+		if len(got) != len(want) {
+			t.Fatalf("events = %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("events = %v, want %v", got, want)
+			}
+		}
+		if r.events[0].Time.IsZero() {
+			t.Error("event time not set")
+		}
+	}
+}
+
+func TestEventBus_Unsubscribe(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	removed, kept := newEventRecorder(), newEventRecorder()
+	unsubscribe := bus.Subscribe(removed.handle)
+	bus.Subscribe(kept.handle)
+
+	unsubscribe()
+	unsubscribe()
+	bus.Publish(Event{Type: EventProgress})
+	kept.waitFor(t, EventProgress)
+
+	if got := removed.types(); len(got) != 0 {
+		t.Fatalf("unsubscribed handler received %v", got)
+	}
+}
+
+func TestEventBus_SubscribeWithDispatch(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	var mu sync.Mutex
+	dispatched := 0
+	dispatch := func(fn func()) {
+		mu.Lock()
+		dispatched++
+		mu.Unlock()
+		fn()
+	}
+
+	r := newEventRecorder()
+	bus.SubscribeWith(dispatch, r.handle)
+	bus.Publish(Event{Type: EventFailed})
+	r.waitFor(t, EventFailed)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if dispatched != 1 {
+		t.Fatalf("dispatch called %d times, want 1", dispatched)
+	}
+}
+
+func TestEventBus_PublishAfterClose(t *testing.T) {
+	bus := NewEventBus()
+	r := newEventRecorder()
+	bus.Subscribe(r.handle)
+
+	bus.Close()
+	bus.Close()
+	bus.Publish(Event{Type: EventProgress})
+
+	time.Sleep(20 * time.Millisecond)
+	if got := r.types(); len(got) != 0 {
+		t.Fatalf("closed bus delivered %v", got)
+	}
+}
+
+func TestTransfer_PublishesLifecycleEvents(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	r := newEventRecorder()
+	m.Events().Subscribe(r.handle)
+
+	release := make(chan struct{})
+	tr, err := m.StartTransfer(DirectionReceive, testTransferOptions("test-events"), blockingRun(release, nil))
+	if err != nil {
+		t.Fatalf("StartTransfer failed: %v", err)
+	}
+
+	started := r.waitFor(t, EventTransferStarted)
+	if started.TransferID != tr.ID || started.Direction != DirectionReceive || started.Code != "test-events" {
+		t.Errorf("unexpected started event: %+v", started)
+	}
+	if started.State != lifecycle.Waiting {
+		t.Errorf("started state = %s, want waiting", started.State)
+	}
+	if started.Relay == nil || started.Relay.Password != "pass123" {
+		t.Errorf("started event relay = %+v, want the transfer's relay", started.Relay)
+	}
+
+	tr.observe(Progress{Connected: true, NumFiles: 2, TotalBytes: 200, BytesDone: 10, FileName: "a"})
+	tr.observe(Progress{Connected: true, NumFiles: 2, TotalBytes: 200, BytesDone: 150, FileIndex: 1, FileName: "b"})
+	close(release)
+	tr.Wait()
+
+	completed := r.waitFor(t, EventCompleted)
+	if completed.State != lifecycle.Completed {
+		t.Errorf("completed state = %s, want completed", completed.State)
+	}
+
+	want := []EventType{
+		EventTransferStarted,
+		EventPeerConnected, EventFileStarted, EventProgress,
+		EventFileStarted, EventProgress,
+		EventStateChanged, EventCompleted,
+	}
+	got := r.types()
+	if len(got) != len(want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("events = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestTransfer_PublishesFailureAndCancel(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	r := newEventRecorder()
+	m.Events().Subscribe(r.handle)
+
+	runErr := errors.New("boom")
+	release := make(chan struct{})
+	close(release)
+	failed, err := m.StartTransfer(DirectionSend, testTransferOptions("test-events-fail"), blockingRun(release, runErr))
+	if err != nil {
+		t.Fatalf("StartTransfer failed: %v", err)
+	}
+	e := r.waitFor(t, EventFailed)
+	if e.TransferID != failed.ID || !errors.Is(e.Err, runErr) {
+		t.Errorf("unexpected failed event: %+v", e)
+	}
+
+	blocked := make(chan struct{})
+	defer close(blocked)
+	cancelled, err := m.StartTransfer(DirectionSend, testTransferOptions("test-events-cancel"), blockingRun(blocked, nil))
+	if err != nil {
+		t.Fatalf("StartTransfer failed: %v", err)
+	}
+	cancelled.Cancel()
+	e = r.waitFor(t, EventCancelled)
+	if e.TransferID != cancelled.ID || !errors.Is(e.Err, ErrTransferCancelled) {
+		t.Errorf("unexpected cancelled event: %+v", e)
+	}
+}
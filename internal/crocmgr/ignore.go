@@ -0,0 +1,324 @@
+package crocmgr
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	ignore "github.com/sabhiram/go-gitignore"
+	"github.com/schollz/croc/v10/src/croc"
+)
+
+// SkippedRule 在文件列表中取消勾选而不发送的文件对应的规则
+const SkippedRule = "取消勾选"
+
+// ErrInvalidIgnoreRule 无效的忽略规则
+var ErrInvalidIgnoreRule = errors.New("无效的忽略规则")
+
+// IgnorePreset 内置的一组忽略规则
+type IgnorePreset struct {
+	Name        string
+	Description string
+	Patterns    []string
+}
+
+// ignorePresets 内置的忽略规则，写法与 .gitignore 相同
+var ignorePresets = []IgnorePreset{
+	{Name: "system", Description: "系统文件（.DS_Store、Thumbs.db 等）",
+		Patterns: []string{".DS_Store", "._*", ".Spotlight-V100/", ".Trashes/", "Thumbs.db", "ehthumbs.db", "desktop.ini"}},
+	{Name: "vcs", Description: "版本控制目录（.git、.svn、.hg）",
+		Patterns: []string{".git/", ".svn/", ".hg/"}},
+	{Name: "deps", Description: "依赖目录（node_modules、.venv 等）",
+		Patterns: []string{"node_modules/", "bower_components/", ".venv/", "__pycache__/", ".gradle/"}},
+	{Name: "build", Description: "构建输出（build、dist、target、*.o 等）",
+		Patterns: []string{"build/", "dist/", "target/", "*.o", "*.obj", "*.class", "*.pyc"}},
+}
+
+// IgnorePresets 返回内置的忽略规则
+func IgnorePresets() []IgnorePreset {
+	return ignorePresets
+}
+
+// IgnoreRules 发送文件夹时的忽略规则
+// 启用的内置规则和自定义规则的写法与 .gitignore 相同，匹配相对所选文件夹的路径；
+// 开启 GitIgnore 时还遵循所选文件夹及其子文件夹中的 .gitignore。
+type IgnoreRules struct {
+	Presets   []string `json:"presets,omitempty"`
+	Patterns  []string `json:"patterns,omitempty"`
+	GitIgnore bool     `json:"gitIgnore,omitempty"`
+}
+
+// DefaultIgnoreRules 默认忽略系统文件和版本控制目录
+func DefaultIgnoreRules() IgnoreRules {
+	return IgnoreRules{Presets: []string{"system", "vcs"}}
+}
+
+// Validate 检查内置规则是否存在、自定义规则是否有效
+func (r IgnoreRules) Validate() error {
+	for _, name := range r.Presets {
+		if !slices.ContainsFunc(ignorePresets, func(p IgnorePreset) bool { return p.Name == name }) {
+			return fmt.Errorf("%w: 未知的内置规则 %q", ErrInvalidIgnoreRule, name)
+		}
+	}
+	for _, p := range r.Patterns {
+		if err := validateIgnorePattern(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateIgnorePattern 检查通配符是否有效
+func validateIgnorePattern(p string) error {
+	if strings.TrimSpace(p) == "" || strings.ContainsAny(p, "\r\n") {
+		return fmt.Errorf("%w: %q", ErrInvalidIgnoreRule, p)
+	}
+	for _, part := range strings.Split(strings.TrimPrefix(p, "!"), "/") {
+		if _, err := path.Match(part, ""); err != nil {
+			return fmt.Errorf("%w: %q", ErrInvalidIgnoreRule, p)
+		}
+	}
+	return nil
+}
+
+// Exclude 返回启用的内置规则和自定义规则，用作 croc 的 Exclude 选项
+func (r IgnoreRules) Exclude() []string {
+	var patterns []string
+	for _, preset := range ignorePresets {
+		if slices.Contains(r.Presets, preset.Name) {
+			patterns = append(patterns, preset.Patterns...)
+		}
+	}
+	return append(patterns, r.Patterns...)
+}
+
+// Apply 把忽略规则写入 croc 配置
+func (r IgnoreRules) Apply(options *croc.Options) {
+	options.Exclude = r.Exclude()
+	options.GitIgnore = r.GitIgnore
+}
+
+// ParseIgnorePatterns 解析每行一条的自定义规则，# 开头的行是注释
+func ParseIgnorePatterns(text string) ([]string, error) {
+	var patterns []string
+	for _, line := range ruleLines(text) {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, IgnoreRules{Patterns: patterns}.Validate()
+}
+
+// ExcludedFile 按忽略规则不发送的文件
+type ExcludedFile struct {
+	Name string // 发送方的相对路径
+	Size int64
+	Rule string // 匹配的规则，来自 .gitignore 时附带文件位置
+}
+
+// SendPlan 按忽略规则筛选后要发送的文件
+type SendPlan struct {
+	Files        []croc.FileInfo
+	EmptyFolders []croc.FileInfo
+	NumFolders   int
+	Excluded     []ExcludedFile
+}
+
+// TotalBytes 返回要发送的字节数
+func (p SendPlan) TotalBytes() int64 {
+	var n int64
+	for _, f := range p.Files {
+		n += f.Size
+	}
+	return n
+}
+
+// ExcludedBytes 返回不发送的字节数
+func (p SendPlan) ExcludedBytes() int64 {
+	var n int64
+	for _, f := range p.Excluded {
+		n += f.Size
+	}
+	return n
+}
+
+// PlanSend 读取要发送的文件，排除 skip 中的文件和子文件夹，再按 options.Exclude 和 options.GitIgnore 排除文件
+// skip 是所选文件夹中取消勾选的绝对路径。预览和统计时调用，不论 options.ZipFolder 都不压缩文件夹，
+// 压缩发送时压缩文件中的内容与这里列出的文件相同。
+func PlanSend(paths, skip []string, options croc.Options) (SendPlan, error) {
+	return planSend(paths, skip, options, false)
+}
+
+// planSend 与 PlanSend 相同，zip 为 true 时把筛选后的每个所选文件夹压缩为一个文件，
+// 调用方负责用 removeArchives 删除压缩文件。
+func planSend(paths, skip []string, options croc.Options, zip bool) (SendPlan, error) {
+	plan, err := filterSend(paths, skip, options)
+	if err != nil || !zip {
+		return plan, err
+	}
+	return zipFolders(paths, plan)
+}
+
+// filterSend 读取所选的文件和文件夹，按取消勾选和忽略规则筛选
+func filterSend(paths, skip []string, options croc.Options) (SendPlan, error) {
+	files, emptyFolders, numFolders, err := croc.GetFilesInfo(paths, false, false, nil)
+	if err != nil {
+		return SendPlan{}, fmt.Errorf("获取文件信息失败: %w", err)
+	}
+	skipped := remoteSkips(paths, skip)
+	if len(skipped) == 0 && len(options.Exclude) == 0 && !options.GitIgnore {
+		return SendPlan{Files: files, EmptyFolders: emptyFolders, NumFolders: numFolders}, nil
+	}
+
+	m := newIgnoreMatcher(options.Exclude, options.GitIgnore)
+	var plan SendPlan
+	folders := make(map[string]bool)
+	for _, f := range files {
+		if !f.TempFile {
+			name := path.Join(f.FolderRemote, f.Name)
+			if isSkipped(skipped, name) {
+				plan.Excluded = append(plan.Excluded, ExcludedFile{Name: name, Size: f.Size, Rule: SkippedRule})
+				continue
+			}
+			if rule, ok := m.match(f.FolderSource, f.FolderRemote, f.Name); ok {
+				plan.Excluded = append(plan.Excluded, ExcludedFile{Name: name, Size: f.Size, Rule: rule})
+				continue
+			}
+		}
+		plan.Files = append(plan.Files, f)
+		addFolders(folders, f.FolderRemote)
+	}
+	for _, f := range emptyFolders {
+		if isSkipped(skipped, path.Clean(f.FolderRemote)) {
+			continue
+		}
+		if _, ok := m.match("", f.FolderRemote, ""); ok {
+			continue
+		}
+		plan.EmptyFolders = append(plan.EmptyFolders, f)
+		addFolders(folders, f.FolderRemote)
+	}
+	plan.NumFolders = len(folders)
+	return plan, nil
+}
+
+// removeArchives 删除发送前压缩文件夹生成的压缩文件和所在的临时目录
+// croc 只在发送成功时删除压缩文件，失败或取消时留在临时目录中。
+func removeArchives(files []croc.FileInfo) {
+	for _, f := range files {
+		if f.TempFile {
+			os.Remove(filepath.Join(f.FolderSource, f.Name))
+			os.Remove(f.FolderSource)
+		}
+	}
+}
+
+// remoteSkips 把所选文件夹中取消勾选的绝对路径换算为发送方的相对路径，与 FolderRemote 对应
+func remoteSkips(paths, skip []string) []string {
+	var remote []string
+	for _, p := range paths {
+		root, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		for _, s := range skip {
+			rel, err := filepath.Rel(root, s)
+			if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			remote = append(remote, path.Join(filepath.Base(root), filepath.ToSlash(rel)))
+		}
+	}
+	return remote
+}
+
+// isSkipped 路径是否为取消勾选的文件或在取消勾选的文件夹中
+func isSkipped(skipped []string, name string) bool {
+	for _, s := range skipped {
+		if name == s || strings.HasPrefix(name, s+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// addFolders 记录文件夹及其上级文件夹
+func addFolders(folders map[string]bool, folder string) {
+	for folder = path.Clean(folder); folder != "." && folder != "/"; folder = path.Dir(folder) {
+		folders[folder] = true
+	}
+}
+
+// ignoreMatcher 按忽略规则判断文件是否发送
+type ignoreMatcher struct {
+	patterns  *ignore.GitIgnore
+	gitIgnore bool
+	files     map[string]*ignore.GitIgnore // 文件夹中的 .gitignore，没有时为 nil
+}
+
+func newIgnoreMatcher(patterns []string, gitIgnore bool) *ignoreMatcher {
+	return &ignoreMatcher{
+		patterns:  ignore.CompileIgnoreLines(patterns...),
+		gitIgnore: gitIgnore,
+		files:     make(map[string]*ignore.GitIgnore),
+	}
+}
+
+// match 返回文件是否被忽略以及匹配的规则
+// folderRemote 以所选文件夹开头，单独选择的文件为 "./"；规则匹配相对所选文件夹的路径。
+// name 为空时匹配空文件夹 folderRemote，空文件夹不检查 .gitignore。
+func (m *ignoreMatcher) match(folderSource, folderRemote, name string) (string, bool) {
+	var segments []string
+	if folder := path.Clean(folderRemote); folder != "." {
+		segments = strings.Split(folder, "/")
+	}
+	rel := name
+	if len(segments) > 0 {
+		rel = relPath(segments[1:], name)
+	}
+	if ok, p := m.patterns.MatchesPathHow(rel); ok {
+		return p.Line, true
+	}
+	if !m.gitIgnore || len(segments) == 0 || name == "" {
+		return "", false
+	}
+
+	// 从所选文件夹开始逐级检查 .gitignore，规则匹配相对 .gitignore 所在文件夹的路径
+	base := folderSource
+	for range segments {
+		base = filepath.Dir(base)
+	}
+	for i := range segments {
+		gi := m.gitIgnoreFile(filepath.Join(base, filepath.Join(segments[:i+1]...)))
+		if gi == nil {
+			continue
+		}
+		if ok, p := gi.MatchesPathHow(relPath(segments[i+1:], name)); ok {
+			return fmt.Sprintf("%s (%s:%d)", p.Line, path.Join(path.Join(segments[:i+1]...), ".gitignore"), p.LineNo), true
+		}
+	}
+	return "", false
+}
+
+// relPath 拼接相对路径，name 为空时返回以 / 结尾的文件夹路径
+func relPath(folders []string, name string) string {
+	if name == "" {
+		return path.Join(folders...) + "/"
+	}
+	return path.Join(append(slices.Clone(folders), name)...)
+}
+
+// gitIgnoreFile 读取文件夹中的 .gitignore，没有时返回 nil，结果会缓存
+func (m *ignoreMatcher) gitIgnoreFile(dir string) *ignore.GitIgnore {
+	gi, ok := m.files[dir]
+	if !ok {
+		gi, _ = ignore.CompileIgnoreFile(filepath.Join(dir, ".gitignore"))
+		m.files[dir] = gi
+	}
+	return gi
+}
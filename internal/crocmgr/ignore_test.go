@@ -0,0 +1,292 @@
+package crocmgr
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rules := DefaultIgnoreRules()
+	rules.Patterns = []string{"*.log"}
+	if err := rules.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	exclude := rules.Exclude()
+	if !slices.Contains(exclude, ".DS_Store") || !slices.Contains(exclude, ".git/") || exclude[len(exclude)-1] != "*.log" {
+		t.Errorf("Exclude() = %v", exclude)
+	}
+	if slices.Contains(exclude, "node_modules/") {
+		t.Errorf("deps preset should be disabled by default: %v", exclude)
+	}
+
+	for _, r := range []IgnoreRules{{Presets: []string{"unknown"}}, {Patterns: []string{"[a-"}}, {Patterns: []string{" "}}} {
+		if err := r.Validate(); !errors.Is(err, ErrInvalidIgnoreRule) {
+			t.Errorf("Validate(%+v) = %v", r, err)
+		}
+	}
+
+	patterns, err := ParseIgnorePatterns("# 日志\n*.log\n\n  tmp/  \n!keep.log\n")
+	if err != nil || !slices.Equal(patterns, []string{"*.log", "tmp/", "!keep.log"}) {
+		t.Errorf("ParseIgnorePatterns = %v, %v", patterns, err)
+	}
+}
+
+func TestPlanSend(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "proj")
+	files := map[string]string{
+		"proj/main.go":                 "package main",
+		"proj/.DS_Store":               "x",
+		"proj/debug.log":               "log",
+		"proj/keep.log":                "log",
+		"proj/node_modules/a/index.js": "js",
+		"proj/web/.gitignore":          "*.tmp\n",
+		"proj/web/page.tmp":            "tmp",
+		"proj/web/page.html":           "html",
+		"notes.tmp":                    "notes",
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(root, "node_modules", "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultOptions(true, "test-code")
+	rules := IgnoreRules{Presets: []string{"system", "deps"}, Patterns: []string{"*.log", "!keep.log"}, GitIgnore: true}
+	rules.Apply(&options)
+	plan, err := PlanSend([]string{root, filepath.Join(dir, "notes.tmp")}, nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []string
+	for _, f := range plan.Files {
+		sent = append(sent, filepath.ToSlash(filepath.Join(f.FolderRemote, f.Name)))
+	}
+	slices.Sort(sent)
+	// 单独选择的文件不受 .gitignore 影响
+	want := []string{"notes.tmp", "proj/keep.log", "proj/main.go", "proj/web/.gitignore", "proj/web/page.html"}
+	if !slices.Equal(sent, want) {
+		t.Errorf("sent = %v, want %v", sent, want)
+	}
+	if len(plan.EmptyFolders) != 0 || plan.NumFolders != 2 {
+		t.Errorf("empty folders = %+v, folders = %d", plan.EmptyFolders, plan.NumFolders)
+	}
+
+	rulesByName := make(map[string]string)
+	for _, f := range plan.Excluded {
+		rulesByName[f.Name] = f.Rule
+	}
+	wantRules := map[string]string{
+		"proj/.DS_Store":               ".DS_Store",
+		"proj/debug.log":               "*.log",
+		"proj/node_modules/a/index.js": "node_modules/",
+		"proj/web/page.tmp":            "*.tmp (proj/web/.gitignore:1)",
+	}
+	if len(rulesByName) != len(wantRules) {
+		t.Errorf("excluded = %+v", plan.Excluded)
+	}
+	for name, rule := range wantRules {
+		if rulesByName[name] != rule {
+			t.Errorf("%s excluded by %q, want %q", name, rulesByName[name], rule)
+		}
+	}
+	if plan.ExcludedBytes() != 1+3+2+3 || plan.TotalBytes() != 5+3+12+6+4 {
+		t.Errorf("bytes = %d sent, %d excluded", plan.TotalBytes(), plan.ExcludedBytes())
+	}
+}
+
+// TestPlanSend_Skip 取消勾选的子文件夹不发送，保留嵌套结构和空文件夹
+func TestPlanSend_Skip(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "album")
+	for _, name := range []string{"2025/a.jpg", "2025/raw/a.cr2", "2026/b.jpg", "cover.jpg"} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"empty", "2026/skipped-empty"} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	skip := []string{filepath.Join(root, "2025", "raw"), filepath.Join(root, "2026", "skipped-empty"), filepath.Join(root, "cover.jpg")}
+	plan, err := PlanSend([]string{root}, skip, DefaultOptions(true, "test-code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent []string
+	for _, f := range plan.Files {
+		sent = append(sent, f.FolderRemote+f.Name)
+	}
+	slices.Sort(sent)
+	if want := []string{"album/2025/a.jpg", "album/2026/b.jpg"}; !slices.Equal(sent, want) {
+		t.Errorf("sent = %v, want %v", sent, want)
+	}
+	if len(plan.EmptyFolders) != 1 || plan.EmptyFolders[0].FolderRemote != "album/empty/" {
+		t.Errorf("empty folders = %+v", plan.EmptyFolders)
+	}
+	// album、album/2025、album/2026、album/empty
+	if plan.NumFolders != 4 {
+		t.Errorf("NumFolders = %d", plan.NumFolders)
+	}
+	if len(plan.Excluded) != 2 || plan.Excluded[0].Rule != SkippedRule {
+		t.Errorf("excluded = %+v", plan.Excluded)
+	}
+}
+
+// TestPlanSend_ZipFolder 压缩发送时预览不生成压缩文件，压缩文件只包含筛选后的文件
+func TestPlanSend_ZipFolder(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "docs")
+	for _, name := range []string{"a.txt", "node_modules/lib.js", "drafts/b.txt", "empty/"} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(p, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd := t.TempDir()
+	t.Chdir(wd)
+
+	options := DefaultOptions(true, "test-code")
+	options.ZipFolder = true
+	IgnoreRules{Presets: []string{"deps"}}.Apply(&options)
+	skip := []string{filepath.Join(root, "drafts")}
+	plan, err := PlanSend([]string{root}, skip, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Files) != 1 || plan.Files[0].TempFile || plan.Files[0].Name != "a.txt" {
+		t.Errorf("files = %+v", plan.Files)
+	}
+	if entries, _ := os.ReadDir(wd); len(entries) != 0 {
+		t.Errorf("预览在工作目录中留下了文件: %v", entries)
+	}
+
+	// 实际发送前压缩到临时目录，忽略和取消勾选的文件不在压缩文件中，结束后删除压缩文件
+	plan, err = planSend([]string{root}, skip, options, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Files) != 1 || !plan.Files[0].TempFile || plan.Files[0].Name != "docs.zip" || len(plan.EmptyFolders) != 0 {
+		t.Fatalf("files = %+v, empty folders = %+v", plan.Files, plan.EmptyFolders)
+	}
+	archive := filepath.Join(plan.Files[0].FolderSource, plan.Files[0].Name)
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	r.Close()
+	slices.Sort(names)
+	if want := []string{"docs/a.txt", "docs/empty/"}; !slices.Equal(names, want) {
+		t.Errorf("archive = %v, want %v", names, want)
+	}
+	if entries, _ := os.ReadDir(wd); len(entries) != 0 {
+		t.Errorf("压缩时在工作目录中留下了文件: %v", entries)
+	}
+	removeArchives(plan.Files)
+	if _, err := os.Stat(plan.Files[0].FolderSource); !os.IsNotExist(err) {
+		t.Errorf("压缩文件没有被删除: %v", err)
+	}
+}
+
+// TestSendSelection_ZipFolder 压缩发送时取消勾选的子文件夹和忽略的文件不在接收方解压的内容中
+func TestSendSelection_ZipFolder(t *testing.T) {
+	relay := startTestRelay(t)
+	root := filepath.Join(t.TempDir(), "album")
+	for _, name := range []string{"2025/a.jpg", "2025/raw/a.cr2", "cover.jpg", ".git/HEAD"} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(root, "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	wd := chdirTemp(t)
+	dstDir := t.TempDir()
+
+	m := NewManager()
+	defer m.Close()
+	code := "zipskip-" + strconv.FormatInt(time.Now().UnixNano()%100000, 10)
+	sendOptions := DefaultOptions(true, code)
+	sendOptions.DisableLocal = true
+	sendOptions.ZipFolder = true
+	DefaultIgnoreRules().Apply(&sendOptions)
+	relay.Apply(&sendOptions)
+	skip := []string{filepath.Join(root, "2025", "raw"), filepath.Join(root, "cover.jpg")}
+	sender, err := m.StartSendSelection(sendOptions, []string{root}, skip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	receiveOptions := DefaultOptions(false, code)
+	receiveOptions.DisableLocal = true
+	receiveOptions.Dir = dstDir
+	relay.Apply(&receiveOptions)
+	receiver, err := m.StartReceive(receiveOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-receiver.Done():
+	case <-time.After(30 * time.Second):
+		sender.Cancel()
+		receiver.Cancel()
+		t.Fatal("transfer timed out")
+	}
+	if err := receiver.Err(); err != nil {
+		t.Fatalf("receive failed: %v", err)
+	}
+	sender.Wait()
+
+	var received []string
+	filepath.WalkDir(dstDir, func(p string, d os.DirEntry, err error) error {
+		if err == nil && p != dstDir {
+			rel, _ := filepath.Rel(dstDir, p)
+			received = append(received, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	slices.Sort(received)
+	if want := []string{"album", "album/2025", "album/2025/a.jpg", "album/empty"}; !slices.Equal(received, want) {
+		t.Errorf("received = %v, want %v", received, want)
+	}
+	if entries, _ := os.ReadDir(wd); len(entries) != 0 {
+		t.Errorf("发送方在工作目录中留下了文件: %v", entries)
+	}
+}
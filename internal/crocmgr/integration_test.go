@@ -150,16 +150,14 @@ func TestSendReceive_Text(t *testing.T) {
 	defer senderManager.Close()
 	defer receiverManager.Close()
 
-	// 使用默认配置（设置 RelayAddress）
+	// 使用内置中继，不依赖公共中继
+	relay := startTestRelay(t)
 	senderOptions := croc.Options{
 		IsSender:      true,
 		SharedSecret:  codePhrase,
 		Debug:         true,
 		NoPrompt:      true,
 		Stdout:        false,
-		RelayAddress:  "croc.schollz.com",
-		RelayPorts:    []string{"9009", "9010", "9011", "9012", "9013"},
-		RelayPassword: "pass123",
 		Curve:         "p256",
 		HashAlgorithm: "xxhash",
 	}
@@ -170,13 +168,13 @@ func TestSendReceive_Text(t *testing.T) {
 		Debug:         true,
 		NoPrompt:      true,
 		Stdout:        false,
-		RelayAddress:  "croc.schollz.com",
-		RelayPorts:    []string{"9009", "9010", "9011", "9012", "9013"},
-		RelayPassword: "pass123",
 		Curve:         "p256",
 		HashAlgorithm: "xxhash",
 	}
 
+	relay.Apply(&senderOptions)
+	relay.Apply(&receiverOptions)
+
 	senderClient, err := senderManager.CreateCrocClient(senderOptions)
 	if err != nil {
 		t.Fatalf("创建发送端失败: %v", err)
@@ -300,16 +298,14 @@ func TestSendReceive_LocalFolder(t *testing.T) {
 	defer senderManager.Close()
 	defer receiverManager.Close()
 
-	// 使用默认配置（不压缩文件夹，避免 croc 库的 bug）
+	// 使用内置中继，不压缩文件夹，避免 croc 库的 bug
+	relay := startTestRelay(t)
 	senderOptions := croc.Options{
 		IsSender:      true,
 		SharedSecret:  codePhrase,
 		Debug:         true,
 		NoPrompt:      true,
 		Stdout:        false,
-		RelayAddress:  "croc.schollz.com",
-		RelayPorts:    []string{"9009", "9010", "9011", "9012", "9013"},
-		RelayPassword: "pass123",
 		Curve:         "p256",
 		HashAlgorithm: "xxhash",
 		// ZipFolder:      true, // 禁用压缩以避免 bug
@@ -321,13 +317,13 @@ func TestSendReceive_LocalFolder(t *testing.T) {
 		Debug:         true,
 		NoPrompt:      true,
 		Stdout:        false,
-		RelayAddress:  "croc.schollz.com",
-		RelayPorts:    []string{"9009", "9010", "9011", "9012", "9013"},
-		RelayPassword: "pass123",
 		Curve:         "p256",
 		HashAlgorithm: "xxhash",
 	}
 
+	relay.Apply(&senderOptions)
+	relay.Apply(&receiverOptions)
+
 	senderClient, err := senderManager.CreateCrocClient(senderOptions)
 	if err != nil {
 		t.Fatalf("创建发送端失败: %v", err)
@@ -3,22 +3,33 @@ package crocmgr
 import (
 	"context"
 	"log"
+	"sync"
 
 	"github.com/schollz/croc/v10/src/croc"
 )
 
-// Manager 封装 Croc 操作
+// Manager 封装 Croc 操作，管理多个并发的传输任务
 type Manager struct {
 	crocClient *croc.Client
 	ctx        context.Context
 	cancel     context.CancelFunc
+
+	mu        sync.RWMutex
+	transfers map[string]*Transfer // ID到传输任务的映射
+	order     []string             // 按创建顺序排列的任务ID
+
+	events      *EventBus
+	diagnostics *Diagnostics
 }
 
 func NewManager() *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Manager{
-		ctx:    ctx,
-		cancel: cancel,
+		ctx:         ctx,
+		cancel:      cancel,
+		transfers:   make(map[string]*Transfer),
+		events:      NewEventBus(),
+		diagnostics: NewDiagnostics(),
 	}
 }
 
@@ -26,34 +37,56 @@ func (m *Manager) GetContext() context.Context {
 	return m.ctx
 }
 
+// Events 返回传输事件总线
+func (m *Manager) Events() *EventBus {
+	return m.events
+}
+
+// Diagnostics 返回中继诊断服务
+func (m *Manager) Diagnostics() *Diagnostics {
+	return m.diagnostics
+}
+
+// Cancel 取消管理器的上下文，所有传输任务都会被取消
+// 只取消单个任务请使用 CancelTransfer
 func (m *Manager) Cancel() {
 	if m.cancel != nil {
 		m.cancel()
 	}
 }
 
+// CreateCrocClient 创建一个不受任务管理的 croc 客户端
 func (m *Manager) CreateCrocClient(options croc.Options) (*croc.Client, error) {
 	client, err := croc.New(options)
 	if err != nil {
 		return nil, err
 	}
+	m.mu.Lock()
 	m.crocClient = client
+	m.mu.Unlock()
 	return client, nil
 }
 
+// GetCrocClient 返回最近一次 CreateCrocClient 创建的客户端
 func (m *Manager) GetCrocClient() *croc.Client {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.crocClient
 }
 
 func (m *Manager) Close() {
-	// 取消上下文
+	// 取消上下文，所有传输任务随之取消
 	if m.cancel != nil {
 		m.cancel()
 	}
 	// 清理客户端
+	m.mu.Lock()
 	m.crocClient = nil
+	m.mu.Unlock()
+	// 停止事件投递
+	m.events.Close()
 }
 
 func (m *Manager) Log(msg string) {
 	log.Printf("[CrocMobile] %s", msg)
-}
\ No newline at end of file
+}
@@ -0,0 +1,89 @@
+package crocmgr
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+)
+
+// ManifestFile 文件清单中的一个文件
+type ManifestFile struct {
+	Path    string    `json:"path"` // 发送方的相对路径
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime,omitempty"` // 发送方文件的修改时间
+	Hash    string    `json:"hash,omitempty"`    // 发送方计算的校验值，发送方读取文件之前为空
+}
+
+// Manifest 传输的文件清单
+// 发送和接收使用发送方的相对路径，接收文件最终保存的位置见 ReceivedFile。
+type Manifest struct {
+	Files         []ManifestFile `json:"files"`
+	NumFolders    int            `json:"numFolders,omitempty"`
+	TotalBytes    int64          `json:"totalBytes"`
+	HashAlgorithm string         `json:"hashAlgorithm,omitempty"`
+	SavePath      string         `json:"savePath,omitempty"` // 接收目录
+}
+
+// NewManifest 根据 croc 的文件列表创建文件清单
+func NewManifest(files []croc.FileInfo, numFolders int, hashAlgorithm string) Manifest {
+	m := Manifest{Files: make([]ManifestFile, 0, len(files)), NumFolders: numFolders, HashAlgorithm: hashAlgorithm}
+	for _, f := range files {
+		file := ManifestFile{
+			Path:    path.Join(filepath.ToSlash(f.FolderRemote), f.Name),
+			Size:    f.Size,
+			ModTime: f.ModTime,
+		}
+		if len(f.Hash) > 0 {
+			file.Hash = hex.EncodeToString(f.Hash)
+		}
+		m.Files = append(m.Files, file)
+		m.TotalBytes += f.Size
+	}
+	return m
+}
+
+// Name 返回清单的显示名称：单个文件或文件夹时为它的名称，否则为文件数
+func (m Manifest) Name() string {
+	if len(m.Files) == 1 && !strings.Contains(m.Files[0].Path, "/") {
+		return m.Files[0].Path
+	}
+	folder := ""
+	for _, f := range m.Files {
+		top, _, ok := strings.Cut(f.Path, "/")
+		if !ok || (folder != "" && top != folder) {
+			folder = ""
+			break
+		}
+		folder = top
+	}
+	if folder == "" {
+		return fmt.Sprintf("%d 个文件", len(m.Files))
+	}
+	return folder
+}
+
+// Manifest 返回任务的文件清单，还没有文件列表或传输的是文本时返回 false
+// 接收任务的清单附带接收目录。
+func (t *Transfer) Manifest() (Manifest, bool) {
+	client := t.client
+	files := client.FilesToTransfer
+	if len(files) == 0 || isTextTransfer(client) {
+		return Manifest{}, false
+	}
+	m := NewManifest(files, client.TotalNumberFolders, client.Options.HashAlgorithm)
+	if t.Direction == DirectionReceive {
+		m.SavePath = t.dir
+		// 重命名或按保存位置规则换了文件夹后，croc 的文件列表中是保存的位置，清单中恢复发送方的路径
+		for i, f := range t.ReceivedFiles() {
+			if i < len(m.Files) {
+				m.Files[i].Path = f.Name
+			}
+		}
+	}
+	return m, true
+}
@@ -0,0 +1,46 @@
+package crocmgr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+)
+
+func TestNewManifest(t *testing.T) {
+	mod := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	m := NewManifest([]croc.FileInfo{
+		{Name: "a.jpg", FolderRemote: "album/", Size: 3, ModTime: mod, Hash: []byte{0xab, 0xcd}},
+		{Name: "b.jpg", FolderRemote: "album/2026/", Size: 4},
+	}, 2, HashXXHash)
+	if m.TotalBytes != 7 || m.NumFolders != 2 || m.HashAlgorithm != HashXXHash || len(m.Files) != 2 {
+		t.Fatalf("manifest = %+v", m)
+	}
+	if f := m.Files[0]; f.Path != "album/a.jpg" || f.Hash != "abcd" || !f.ModTime.Equal(mod) {
+		t.Errorf("file = %+v", f)
+	}
+	if m.Files[1].Path != "album/2026/b.jpg" || m.Files[1].Hash != "" {
+		t.Errorf("file = %+v", m.Files[1])
+	}
+
+	cases := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{"report.pdf"}, "report.pdf"},
+		{[]string{"album/a.jpg", "album/2026/b.jpg"}, "album"},
+		{[]string{"album/a.jpg"}, "album"},
+		{[]string{"a.txt", "b.txt"}, "2 个文件"},
+		{[]string{"album/a.jpg", "notes.txt"}, "2 个文件"},
+		{nil, "0 个文件"},
+	}
+	for _, c := range cases {
+		var files []ManifestFile
+		for _, p := range c.paths {
+			files = append(files, ManifestFile{Path: p})
+		}
+		if got := (Manifest{Files: files}).Name(); got != c.want {
+			t.Errorf("Name(%v) = %q, want %q", c.paths, got, c.want)
+		}
+	}
+}
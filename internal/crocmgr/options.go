@@ -0,0 +1,32 @@
+package crocmgr
+
+import "github.com/schollz/croc/v10/src/croc"
+
+// 默认中继服务器配置，界面和命令行共用
+const (
+	DefaultRelayAddress  = "croc.schollz.com"
+	DefaultRelayPassword = "pass123"
+)
+
+// DefaultRelayPorts 返回默认中继端口，每次返回新的切片
+func DefaultRelayPorts() []string {
+	return []string{"9009", "9010", "9011", "9012", "9013"}
+}
+
+// DefaultOptions 返回使用默认中继的 croc 配置
+// 接收端也必须设置中继服务器配置才能正常工作。
+func DefaultOptions(isSender bool, code string) croc.Options {
+	return croc.Options{
+		IsSender:      isSender,
+		SharedSecret:  code,
+		Debug:         false,
+		NoPrompt:      true, // 对应命令行的 --yes 参数
+		Stdout:        false,
+		HashAlgorithm: DefaultHashAlgorithm,
+		Curve:         "p256", // 必须小写，不是 "P-256"
+		Exclude:       []string{},
+		RelayAddress:  DefaultRelayAddress,
+		RelayPorts:    DefaultRelayPorts(),
+		RelayPassword: DefaultRelayPassword,
+	}
+}
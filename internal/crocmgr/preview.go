@@ -0,0 +1,260 @@
+package crocmgr
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/schollz/croc/v10/src/croc"
+)
+
+// ErrNoOffer 没有等待确认的文件列表
+var ErrNoOffer = errors.New("没有等待确认的文件")
+
+// ErrOfferRejected 接收方拒绝了发送方提供的文件
+var ErrOfferRejected = errors.New("已拒绝接收")
+
+// OfferFile 发送方提供的一个文件
+type OfferFile struct {
+	Name   string
+	Folder string // 发送方的相对目录
+	Size   int64
+	Exists bool   // 保存目录中已有同名但内容不同的文件
+	SaveTo string // 按保存位置规则放入的文件夹，相对保存目录或绝对路径，为空时按发送方的相对路径保存
+}
+
+// Path 返回发送方的相对路径
+func (f OfferFile) Path() string {
+	return path.Join(filepath.ToSlash(f.Folder), f.Name)
+}
+
+// Offer 发送方提供的文件列表，接收方确认后才开始传输数据
+type Offer struct {
+	Files      []OfferFile
+	NumFolders int
+	TotalBytes int64
+	IsText     bool // 发送的是文本
+}
+
+// NumFiles 返回文件数量
+func (o Offer) NumFiles() int {
+	return len(o.Files)
+}
+
+// Conflicts 返回与保存目录中已有文件同名的文件
+func (o Offer) Conflicts() []OfferFile {
+	var files []OfferFile
+	for _, f := range o.Files {
+		if f.Exists {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// readOffer 从 croc 客户端读取收到的文件列表，只能在 croc 调用 OnFileInfo 时调用
+func readOffer(client *croc.Client) Offer {
+	offer := Offer{
+		NumFolders: client.TotalNumberFolders,
+		IsText:     client.Options.SendingText,
+	}
+	for _, f := range client.FilesToTransfer {
+		offer.Files = append(offer.Files, OfferFile{Name: f.Name, Folder: f.FolderRemote, Size: f.Size})
+		offer.TotalBytes += f.Size
+	}
+	return offer
+}
+
+// offerPrompt 接收前等待确认的状态
+type offerPrompt struct {
+	mu       sync.Mutex
+	offer    *Offer
+	auto     bool // 收到文件列表后自动接受，用于已经确认过的接收
+	decided  bool
+	accepted bool
+	policy   ConflictPolicy
+	choices  ConflictChoices
+	rules    *SaveRules // 确认接收后按规则放到不同的文件夹
+	resume   *Resume    // 继续中断的接收时的断点信息，文件列表一致时才续传
+	decision chan bool
+}
+
+func newOfferPrompt() *offerPrompt {
+	return &offerPrompt{decision: make(chan bool, 1)}
+}
+
+// setOffer 保存收到的文件列表，只有第一次调用返回 true
+func (p *offerPrompt) setOffer(offer Offer) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.offer != nil {
+		return false
+	}
+	p.offer = &offer
+	return true
+}
+
+func (p *offerPrompt) decide(accept bool, policy ConflictPolicy, choices ConflictChoices) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.offer == nil || p.decided {
+		return ErrNoOffer
+	}
+	p.decided = true
+	p.accepted = accept
+	p.policy = policy
+	p.choices = choices
+	p.decision <- accept
+	return nil
+}
+
+// resolution 返回接受时选择的同名文件处理方式
+func (p *offerPrompt) resolution() (ConflictPolicy, ConflictChoices) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.policy, p.choices
+}
+
+func (p *offerPrompt) isAccepted() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.accepted
+}
+
+// StartReceiveWithPreview 在后台接收文件，收到文件列表后等待确认
+// 收到文件列表时发布 EventOffer，调用 Accept 后才开始传输数据，Reject 后任务取消。
+// 多个任务可以同时等待确认。
+func (m *Manager) StartReceiveWithPreview(options croc.Options) (*Transfer, error) {
+	return m.startTransfer(DirectionReceive, options, newOfferPrompt(), (*Transfer).receiveWithPreview)
+}
+
+// StartReceiveWithRules 与 StartReceiveWithPreview 相同，并按保存位置规则把文件放到不同的文件夹
+// rules.Dir 不为空时作为接收目录，代替 options.Dir。
+func (m *Manager) StartReceiveWithRules(options croc.Options, rules SaveRules) (*Transfer, error) {
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	if rules.Dir != "" {
+		options.Dir = rules.Dir
+	}
+	prompt := newOfferPrompt()
+	prompt.rules = &rules
+	return m.startTransfer(DirectionReceive, options, prompt, (*Transfer).receiveWithPreview)
+}
+
+// Offer 返回发送方提供的文件列表，尚未收到或不需要确认时返回 false
+func (t *Transfer) Offer() (Offer, bool) {
+	if t.prompt == nil {
+		return Offer{}, false
+	}
+	t.prompt.mu.Lock()
+	defer t.prompt.mu.Unlock()
+	if t.prompt.offer == nil {
+		return Offer{}, false
+	}
+	return *t.prompt.offer, true
+}
+
+// Accept 接受发送方提供的文件，开始接收，同名文件按默认方式处理
+func (t *Transfer) Accept() error {
+	return t.AcceptWith(DefaultConflictPolicy, nil)
+}
+
+// AcceptWith 接受发送方提供的文件，与保存目录中已有文件同名时按 policy 处理
+// choices 可以为单个文件指定处理方式；policy 为 ConflictAsk 时没有指定的文件按默认方式处理。
+func (t *Transfer) AcceptWith(policy ConflictPolicy, choices ConflictChoices) error {
+	if t.prompt == nil {
+		return ErrNoOffer
+	}
+	return t.prompt.decide(true, policy, choices)
+}
+
+// Reject 拒绝发送方提供的文件，任务进入取消状态
+func (t *Transfer) Reject() error {
+	if t.prompt == nil {
+		return ErrNoOffer
+	}
+	if err := t.prompt.decide(false, "", nil); err != nil {
+		return err
+	}
+	t.stop(ErrOfferRejected)
+	return nil
+}
+
+// receiveWithPreview 接收文件，croc 收到文件列表后在 onFileInfo 中等待确认
+func (t *Transfer) receiveWithPreview() error {
+	return t.client.Receive()
+}
+
+// onFileInfo 在 croc 收到文件列表后、写入任何文件之前调用，返回是否接收
+// 发布 EventOffer 后阻塞直到 Accept、Reject 或任务取消。调用时 croc 在等待回答，
+// 可以安全地读取和修改文件列表：按保存位置规则和同名文件的处理方式调整后再交给 croc。
+// 继续中断的接收时文件列表必须与断点信息一致，否则拒绝接收，不改动接收目录中的文件。
+func (t *Transfer) onFileInfo() bool {
+	offer := readOffer(t.client)
+	if r := t.prompt.resume; r != nil {
+		if !r.matches(offer) {
+			t.refuse(fmt.Errorf("%w: 发送方的文件与中断时不同", ErrNotResumable))
+			return false
+		}
+		t.mu.Lock()
+		t.resumed = true
+		t.mu.Unlock()
+	}
+	if err := t.routeOffer(&offer); err != nil {
+		t.refuse(err)
+		return false
+	}
+	t.markConflicts(&offer)
+	t.prompt.setOffer(offer)
+	if t.prompt.auto {
+		t.prompt.decide(true, DefaultConflictPolicy, nil)
+	} else {
+		t.publishOffer(offer)
+	}
+
+	select {
+	case accepted := <-t.prompt.decision:
+		if !accepted {
+			return false
+		}
+	case <-t.ctx.Done():
+		return false
+	}
+	switch {
+	case offer.IsText:
+		// 文本不保存为文件，croc 把内容写入 textOutput
+	case t.Resumed():
+		// 整理未完成的文件，沿用上次对同名文件的处理
+		r := *t.prompt.resume
+		r.Dir = t.dir
+		r.prepare()
+		t.client.Options.MissingChunks = r.missingChunks
+		t.applyResume(r)
+	default:
+		t.resolveConflicts(t.prompt.resolution())
+	}
+	return true
+}
+
+// publishOffer 发布等待确认的文件列表
+func (t *Transfer) publishOffer(offer Offer) {
+	if t.events == nil {
+		return
+	}
+	e := Event{
+		Type:       EventOffer,
+		TransferID: t.ID,
+		Direction:  t.Direction,
+		Code:       t.Code,
+		State:      t.machine.State(),
+		Progress:   t.Progress(),
+		Offer:      &offer,
+	}
+	if m, ok := t.Manifest(); ok {
+		e.Manifest = &m
+	}
+	t.events.Publish(e)
+}
@@ -0,0 +1,164 @@
+package crocmgr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+// startPreviewTransfer 通过内置中继发送 hello.txt，接收端等待确认
+// 返回发送任务、接收任务和收到的 EventOffer，接收端把文件保存到 dstDir。
+func startPreviewTransfer(t *testing.T, m *Manager, dstDir string) (*Transfer, *Transfer, Event) {
+	t.Helper()
+	relay := startTestRelay(t)
+
+	src := filepath.Join(t.TempDir(), "hello.txt")
+	if err := os.WriteFile(src, []byte("preview me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code := "preview-" + strconv.FormatInt(time.Now().UnixNano()%100000, 10)
+	offers := make(chan Event, 1)
+	m.Events().Subscribe(func(e Event) {
+		if e.Type == EventOffer && e.Code == code {
+			offers <- e
+		}
+	})
+
+	sendOptions := DefaultOptions(true, code)
+	sendOptions.DisableLocal = true
+	relay.Apply(&sendOptions)
+	receiveOptions := DefaultOptions(false, code)
+	receiveOptions.DisableLocal = true
+	receiveOptions.Dir = dstDir
+	relay.Apply(&receiveOptions)
+
+	filesInfo, emptyFolders, totalNumberFolders, err := croc.GetFilesInfo([]string{src}, false, false, []string{})
+	if err != nil {
+		t.Fatalf("GetFilesInfo failed: %v", err)
+	}
+	sender, err := m.StartSend(sendOptions, filesInfo, emptyFolders, totalNumberFolders)
+	if err != nil {
+		t.Fatalf("StartSend failed: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	receiver, err := m.StartReceiveWithPreview(receiveOptions)
+	if err != nil {
+		t.Fatalf("StartReceiveWithPreview failed: %v", err)
+	}
+
+	select {
+	case e := <-offers:
+		return sender, receiver, e
+	case <-time.After(30 * time.Second):
+		sender.Cancel()
+		receiver.Cancel()
+		t.Fatal("no offer received")
+	}
+	return nil, nil, Event{}
+}
+
+func TestReceiveWithPreview_Accept(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	dstDir := t.TempDir()
+
+	_, receiver, e := startPreviewTransfer(t, m, dstDir)
+	if e.Offer == nil || e.Offer.NumFiles() != 1 || e.Offer.Files[0].Name != "hello.txt" || e.Offer.TotalBytes != int64(len("preview me")) {
+		t.Fatalf("unexpected offer: %+v", e.Offer)
+	}
+	if e.State != lifecycle.Waiting || receiver.State() != lifecycle.Waiting {
+		t.Errorf("state before accept = %s/%s, want waiting", e.State, receiver.State())
+	}
+	// 确认前不写入文件
+	if _, err := os.Stat(filepath.Join(dstDir, "hello.txt")); !os.IsNotExist(err) {
+		t.Errorf("file written before accept: %v", err)
+	}
+
+	if err := receiver.Accept(); err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	if err := receiver.Accept(); !errors.Is(err, ErrNoOffer) {
+		t.Errorf("second Accept = %v, want ErrNoOffer", err)
+	}
+
+	select {
+	case <-receiver.Done():
+	case <-time.After(30 * time.Second):
+		t.Fatal("receive timed out")
+	}
+	if err := receiver.Err(); err != nil {
+		t.Fatalf("receive failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dstDir, "hello.txt"))
+	if err != nil || string(data) != "preview me" {
+		t.Errorf("received %q, %v", data, err)
+	}
+}
+
+func TestReceiveWithPreview_Reject(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	dstDir := t.TempDir()
+
+	sender, receiver, _ := startPreviewTransfer(t, m, dstDir)
+	if err := receiver.Reject(); err != nil {
+		t.Fatalf("Reject failed: %v", err)
+	}
+	if state := receiver.State(); state != lifecycle.Cancelled {
+		t.Errorf("receiver state = %s, want cancelled", state)
+	}
+	if !errors.Is(receiver.Err(), ErrOfferRejected) {
+		t.Errorf("receiver err = %v, want ErrOfferRejected", receiver.Err())
+	}
+
+	select {
+	case <-sender.Done():
+	case <-time.After(30 * time.Second):
+		t.Fatal("sender did not stop after reject")
+	}
+	if sender.State() == lifecycle.Completed {
+		t.Error("sender should not complete after reject")
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "hello.txt")); !os.IsNotExist(err) {
+		t.Errorf("rejected file was written: %v", err)
+	}
+}
+
+// TestReceiveWithPreview_Concurrent 两个接收任务同时等待确认，互不阻塞
+func TestReceiveWithPreview_Concurrent(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	dirs := []string{t.TempDir(), t.TempDir()}
+
+	// 第一个任务等待确认时，第二个任务也能收到文件列表
+	var receivers []*Transfer
+	for _, dir := range dirs {
+		_, receiver, _ := startPreviewTransfer(t, m, dir)
+		receivers = append(receivers, receiver)
+	}
+	for i := len(receivers) - 1; i >= 0; i-- {
+		if err := receivers[i].Accept(); err != nil {
+			t.Fatalf("Accept failed: %v", err)
+		}
+	}
+	for i, receiver := range receivers {
+		select {
+		case <-receiver.Done():
+		case <-time.After(30 * time.Second):
+			t.Fatal("receive timed out")
+		}
+		if err := receiver.Err(); err != nil {
+			t.Fatalf("receive failed: %v", err)
+		}
+		if data, err := os.ReadFile(filepath.Join(dirs[i], "hello.txt")); err != nil || string(data) != "preview me" {
+			t.Errorf("received %q, %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package crocmgr
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/schollz/croc/v10/src/croc"
+)
+
+// 内置的中继配置名称
+const (
+	PublicRelayProfileName = "公共中继"
+	LocalRelayProfileName  = "本机内置中继"
+)
+
+// ErrInvalidRelay 中继配置无效
+var ErrInvalidRelay = errors.New("中继配置无效")
+
+// RelayProfile 命名的中继配置，发送和接收共用
+type RelayProfile struct {
+	Name         string   `json:"name"`
+	Address      string   `json:"address"`            // 中继地址，可以带端口
+	Address6     string   `json:"address6,omitempty"` // IPv6 中继地址
+	Ports        []string `json:"ports"`              // 中继端口，第一个为主端口
+	Password     string   `json:"password"`
+	OnlyLocal    bool     `json:"onlyLocal,omitempty"`    // 仅使用局域网
+	DisableLocal bool     `json:"disableLocal,omitempty"` // 禁用局域网直连
+	Embedded     bool     `json:"embedded,omitempty"`     // 在本机启动内置中继，监听 Ports[0]
+}
+
+// DefaultRelayProfiles 返回内置的中继配置，第一个为默认配置
+func DefaultRelayProfiles() []RelayProfile {
+	return []RelayProfile{
+		{
+			Name:     PublicRelayProfileName,
+			Address:  DefaultRelayAddress,
+			Ports:    DefaultRelayPorts(),
+			Password: DefaultRelayPassword,
+		},
+		{
+			Name:     LocalRelayProfileName,
+			Ports:    []string{strconv.Itoa(DefaultLocalRelayPort)},
+			Password: DefaultRelayPassword,
+			Embedded: true,
+		},
+	}
+}
+
+// Validate 校验中继配置
+func (p RelayProfile) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("%w: 名称不能为空", ErrInvalidRelay)
+	}
+	options := croc.Options{}
+	p.applyFields(&options)
+	return ValidateRelayOptions(options)
+}
+
+// Apply 把中继配置写入 croc 配置
+// 使用内置中继时会先启动中继并返回它，否则返回 nil。
+func (p RelayProfile) Apply(options *croc.Options) (*LocalRelay, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	p.applyFields(options)
+	if !p.Embedded {
+		return nil, nil
+	}
+
+	port, _ := strconv.Atoi(p.Ports[0])
+	relay, err := StartLocalRelay(port, p.Password)
+	if err != nil {
+		return nil, err
+	}
+	relay.Apply(options)
+	return relay, nil
+}
+
+func (p RelayProfile) applyFields(options *croc.Options) {
+	options.RelayAddress, options.RelayAddress6 = p.dialAddresses()
+	options.RelayPorts = append([]string(nil), p.Ports...)
+	options.RelayPassword = p.Password
+	options.OnlyLocal = p.OnlyLocal
+	options.DisableLocal = p.DisableLocal
+}
+
+// dialAddresses 返回传输时连接的中继地址，网络诊断检查同样的地址
+// 内置中继监听本机的主端口。
+func (p RelayProfile) dialAddresses() (address, address6 string) {
+	if p.Embedded {
+		return RelayDialAddress("127.0.0.1", p.Ports), ""
+	}
+	return RelayDialAddress(p.Address, p.Ports), RelayDialAddress(p.Address6, p.Ports)
+}
+
+// RelayDialAddress 返回实际连接的中继地址，地址没有端口时加上主端口 ports[0]
+// croc 对不带端口的地址使用默认端口 9009，不会使用配置中的端口。
+func RelayDialAddress(address string, ports []string) string {
+	address = strings.TrimSpace(address)
+	if address == "" || len(ports) == 0 {
+		return address
+	}
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(strings.Trim(address, "[]"), ports[0])
+}
+
+// ValidateRelayOptions 校验 croc 配置中的中继设置，在创建客户端之前调用
+func ValidateRelayOptions(options croc.Options) error {
+	if options.OnlyLocal && options.DisableLocal {
+		return fmt.Errorf("%w: 不能同时仅使用局域网和禁用局域网", ErrInvalidRelay)
+	}
+	if len(options.RelayPorts) == 0 {
+		return fmt.Errorf("%w: 至少需要一个端口", ErrInvalidRelay)
+	}
+	for _, port := range options.RelayPorts {
+		if err := validatePort(port); err != nil {
+			return err
+		}
+	}
+
+	if options.OnlyLocal {
+		return nil
+	}
+	if options.RelayAddress == "" && options.RelayAddress6 == "" {
+		return fmt.Errorf("%w: 中继地址不能为空", ErrInvalidRelay)
+	}
+	for _, address := range []string{options.RelayAddress, options.RelayAddress6} {
+		if address == "" {
+			continue
+		}
+		if err := validateRelayAddress(address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseRelayPorts 解析逗号分隔的端口列表
+func ParseRelayPorts(s string) []string {
+	var ports []string
+	for _, port := range strings.Split(s, ",") {
+		if port = strings.TrimSpace(port); port != "" {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+func validatePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("%w: 无效的端口 %q", ErrInvalidRelay, port)
+	}
+	return nil
+}
+
+// validateRelayAddress 校验中继地址，支持 host、host:port 和 [ipv6]:port
+func validateRelayAddress(address string) error {
+	host := address
+	if h, port, err := net.SplitHostPort(address); err == nil {
+		if err := validatePort(port); err != nil {
+			return err
+		}
+		host = h
+	} else if strings.Count(address, ":") == 1 {
+		return fmt.Errorf("%w: 无效的地址 %q", ErrInvalidRelay, address)
+	}
+	if host == "" || strings.ContainsAny(host, " \t/") {
+		return fmt.Errorf("%w: 无效的地址 %q", ErrInvalidRelay, address)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package crocmgr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/schollz/croc/v10/src/croc"
+)
+
+func TestValidateRelayOptions(t *testing.T) {
+	valid := func(mod func(o *croc.Options)) croc.Options {
+		o := DefaultOptions(true, "code")
+		if mod != nil {
+			mod(&o)
+		}
+		return o
+	}
+
+	cases := []struct {
+		name    string
+		options croc.Options
+		wantErr bool
+	}{
+		{"default", valid(nil), false},
+		{"host with port", valid(func(o *croc.Options) { o.RelayAddress = "relay.example.com:9109" }), false},
+		{"ipv6 only", valid(func(o *croc.Options) { o.RelayAddress = ""; o.RelayAddress6 = "[::1]:9009" }), false},
+		{"only local without address", valid(func(o *croc.Options) { o.RelayAddress = ""; o.OnlyLocal = true }), false},
+		{"no address", valid(func(o *croc.Options) { o.RelayAddress = "" }), true},
+		{"bad address port", valid(func(o *croc.Options) { o.RelayAddress = "relay.example.com:abc" }), true},
+		{"address with space", valid(func(o *croc.Options) { o.RelayAddress = "relay example.com" }), true},
+		{"no ports", valid(func(o *croc.Options) { o.RelayPorts = nil }), true},
+		{"bad port", valid(func(o *croc.Options) { o.RelayPorts = []string{"9009", "70000"} }), true},
+		{"only and disable local", valid(func(o *croc.Options) { o.OnlyLocal = true; o.DisableLocal = true }), true},
+	}
+	for _, tc := range cases {
+		err := ValidateRelayOptions(tc.options)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidRelay) {
+			t.Errorf("%s: err = %v, want ErrInvalidRelay", tc.name, err)
+		}
+	}
+}
+
+func TestRelayProfile_Apply(t *testing.T) {
+	profile := RelayProfile{
+		Name:         "private",
+		Address:      "relay.example.com:9109",
+		Address6:     "[2001:db8::1]:9109",
+		Ports:        []string{"9109", "9110"},
+		Password:     "secret",
+		DisableLocal: true,
+	}
+	options := DefaultOptions(false, "code")
+	relay, err := profile.Apply(&options)
+	if err != nil || relay != nil {
+		t.Fatalf("Apply = %v, %v", relay, err)
+	}
+	if options.RelayAddress != profile.Address || options.RelayAddress6 != profile.Address6 ||
+		options.RelayPassword != "secret" || !options.DisableLocal || len(options.RelayPorts) != 2 {
+		t.Errorf("options not applied: %+v", options)
+	}
+
+	// 地址没有端口时使用主端口，而不是 croc 的默认端口 9009
+	bare := RelayProfile{Name: "bare", Address: "relay.example.com", Address6: "2001:db8::1", Ports: []string{"9109", "9110"}}
+	if _, err := bare.Apply(&options); err != nil {
+		t.Fatalf("Apply bare address: %v", err)
+	}
+	if options.RelayAddress != "relay.example.com:9109" || options.RelayAddress6 != "[2001:db8::1]:9109" {
+		t.Errorf("bare address not joined with main port: %q, %q", options.RelayAddress, options.RelayAddress6)
+	}
+
+	if _, err := (RelayProfile{Address: "relay.example.com", Ports: []string{"9009"}}).Apply(&options); !errors.Is(err, ErrInvalidRelay) {
+		t.Errorf("profile without name: err = %v", err)
+	}
+
+	for _, p := range DefaultRelayProfiles() {
+		if err := p.Validate(); err != nil {
+			t.Errorf("default profile %s invalid: %v", p.Name, err)
+		}
+	}
+}
+
+func TestStartTransfer_RejectsInvalidRelay(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	options := testTransferOptions("test-invalid-relay")
+	options.RelayPorts = nil
+	if _, err := m.StartTransfer(DirectionSend, options, blockingRun(nil, nil)); !errors.Is(err, ErrInvalidRelay) {
+		t.Fatalf("err = %v, want ErrInvalidRelay", err)
+	}
+	if got := len(m.ListTransfers()); got != 0 {
+		t.Errorf("transfers = %d, want 0", got)
+	}
+}
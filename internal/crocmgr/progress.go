@@ -0,0 +1,176 @@
+package crocmgr
+
+import (
+	"context"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/schollz/croc/v10/src/models"
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+// ProgressInterval 默认的进度轮询间隔
+const ProgressInterval = 200 * time.Millisecond
+
+// Progress 一次传输的实时进度快照
+type Progress struct {
+	Connected     bool   // 是否已与对端建立加密通道
+	BytesDone     int64  // 已传输字节数（包含之前已完成的文件）
+	TotalBytes    int64  // 所有文件的总字节数
+	FileIndex     int    // 当前文件序号（从 0 开始）
+	NumFiles      int    // 文件总数
+	FileName      string // 当前文件名
+	FileBytesDone int64  // 当前文件已传输字节数
+	FileSize      int64  // 当前文件大小
+}
+
+// Fraction 返回整体进度（0.0 - 1.0）
+func (p Progress) Fraction() float64 {
+	if p.TotalBytes <= 0 {
+		return 0
+	}
+	return clampFraction(float64(p.BytesDone) / float64(p.TotalBytes))
+}
+
+// FileFraction 返回当前文件进度（0.0 - 1.0）
+func (p Progress) FileFraction() float64 {
+	if p.FileSize <= 0 {
+		return 0
+	}
+	return clampFraction(float64(p.FileBytesDone) / float64(p.FileSize))
+}
+
+// State 根据进度推断传输状态
+// 通道建立并拿到文件列表后为传输中，所有字节传完后为等待校验。
+func (p Progress) State() lifecycle.State {
+	if !p.Connected || p.NumFiles == 0 {
+		return lifecycle.Waiting
+	}
+	if p.TotalBytes > 0 && p.BytesDone >= p.TotalBytes {
+		return lifecycle.Verifying
+	}
+	return lifecycle.Transferring
+}
+
+func clampFraction(f float64) float64 {
+	if f < 0 {
+		return 0
+	}
+	if f > 1 {
+		return 1
+	}
+	return f
+}
+
+// ReadProgress 从 croc 客户端读取当前进度
+// 读取的是 croc 在锁中更新的进度快照（见 third_party/croc/PATCHES.md），
+// 可以在传输过程中从任意 goroutine 调用。
+func ReadProgress(client *croc.Client) Progress {
+	if client == nil {
+		return Progress{}
+	}
+	return progressOf(client.Progress())
+}
+
+// stoppedProgress 从客户端的传输字段读取进度快照
+// croc 在传输过程中不加锁地修改这些字段，只能在 Send 或 Receive 返回后调用。
+func stoppedProgress(client *croc.Client) croc.Progress {
+	return croc.Progress{
+		ChannelSecured: client.Step1ChannelSecured,
+		Files:          client.FilesToTransfer,
+		CurrentFile:    client.FilesToTransferCurrentNum,
+		CurrentSent:    client.TotalSent,
+		CurrentChunks:  len(client.CurrentFileChunks),
+		// 接收方连续写入的位置只在快照中记录
+		CurrentReceived: client.Progress().CurrentReceived,
+	}
+}
+
+// progressOf 根据 croc 的进度快照计算进度
+// 当前文件之前的文件视为已完成，当前文件取本次已传输的字节数，
+// 续传时还要加上对端已有的分块。
+func progressOf(snapshot croc.Progress) Progress {
+	files := snapshot.Files
+	p := Progress{
+		Connected: snapshot.ChannelSecured,
+		NumFiles:  len(files),
+		FileIndex: snapshot.CurrentFile,
+	}
+	if len(files) == 0 {
+		return p
+	}
+	if p.FileIndex < 0 {
+		p.FileIndex = 0
+	}
+	if p.FileIndex >= len(files) {
+		p.FileIndex = len(files) - 1
+	}
+
+	for i, f := range files {
+		p.TotalBytes += f.Size
+		if i < p.FileIndex {
+			p.BytesDone += f.Size
+		}
+	}
+
+	current := files[p.FileIndex]
+	p.FileName = current.Name
+	p.FileSize = current.Size
+
+	// CurrentSent 在每个文件开始时清零，只统计当前文件
+	done := snapshot.CurrentSent
+	if chunks := int64(snapshot.CurrentChunks); chunks > 0 {
+		// 续传：只请求缺失的分块，其余部分已经在接收端
+		if already := current.Size - chunks*int64(models.TCP_BUFFER_SIZE/2); already > 0 {
+			done += already
+		}
+	}
+	if done > current.Size {
+		done = current.Size
+	}
+	p.FileBytesDone = done
+	p.BytesDone += done
+
+	return p
+}
+
+// WatchProgress 按 interval 轮询客户端进度，进度变化时调用 onProgress
+// 在 ctx 结束或调用返回的 stop 后停止，stop 可以重复调用。
+func WatchProgress(ctx context.Context, client *croc.Client, interval time.Duration, onProgress func(Progress)) (stop func()) {
+	return watchProgress(ctx, func() Progress { return ReadProgress(client) }, interval, onProgress)
+}
+
+func watchProgress(ctx context.Context, read func() Progress, interval time.Duration, onProgress func(Progress)) (stop func()) {
+	if interval <= 0 {
+		interval = ProgressInterval
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var last Progress
+		first := true
+		for {
+			select {
+			case <-watchCtx.Done():
+				return
+			case <-ticker.C:
+				p := read()
+				if first || p != last {
+					first = false
+					last = p
+					onProgress(p)
+				}
+			}
+		}
+	}()
+
+	return cancel
+}
+
+// WatchProgress 在管理器的上下文中监控客户端进度，管理器取消时自动停止
+func (m *Manager) WatchProgress(client *croc.Client, onProgress func(Progress)) (stop func()) {
+	return WatchProgress(m.ctx, client, ProgressInterval, onProgress)
+}
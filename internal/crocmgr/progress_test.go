@@ -0,0 +1,230 @@
+package crocmgr
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/schollz/croc/v10/src/models"
+)
+
+func TestReadProgress_NilClient(t *testing.T) {
+	p := ReadProgress(nil)
+	if p != (Progress{}) {
+		t.Fatalf("expected zero progress, got %+v", p)
+	}
+	if p.Fraction() != 0 {
+		t.Fatalf("expected 0 fraction, got %f", p.Fraction())
+	}
+}
+
+func TestReadProgress_NoFilesYet(t *testing.T) {
+	p := progressOf(croc.Progress{ChannelSecured: true})
+	if !p.Connected {
+		t.Error("expected Connected to be true")
+	}
+	if p.NumFiles != 0 || p.TotalBytes != 0 {
+		t.Errorf("expected no files, got %+v", p)
+	}
+}
+
+func TestReadProgress_MultipleFiles(t *testing.T) {
+	p := progressOf(croc.Progress{
+		Files: []croc.FileInfo{
+			{Name: "a.bin", Size: 100},
+			{Name: "b.bin", Size: 200},
+			{Name: "c.bin", Size: 300},
+		},
+		CurrentFile: 1,
+		CurrentSent: 50,
+	})
+	if p.NumFiles != 3 {
+		t.Errorf("NumFiles = %d, want 3", p.NumFiles)
+	}
+	if p.TotalBytes != 600 {
+		t.Errorf("TotalBytes = %d, want 600", p.TotalBytes)
+	}
+	if p.FileIndex != 1 || p.FileName != "b.bin" {
+		t.Errorf("current file = %d %q, want 1 b.bin", p.FileIndex, p.FileName)
+	}
+	if p.BytesDone != 150 {
+		t.Errorf("BytesDone = %d, want 150", p.BytesDone)
+	}
+	if p.FileBytesDone != 50 || p.FileSize != 200 {
+		t.Errorf("file progress = %d/%d, want 50/200", p.FileBytesDone, p.FileSize)
+	}
+	if got := p.Fraction(); got != 0.25 {
+		t.Errorf("Fraction = %f, want 0.25", got)
+	}
+	if got := p.FileFraction(); got != 0.25 {
+		t.Errorf("FileFraction = %f, want 0.25", got)
+	}
+}
+
+func TestReadProgress_ClampsOutOfRange(t *testing.T) {
+	p := progressOf(croc.Progress{
+		Files: []croc.FileInfo{
+			{Name: "only.bin", Size: 10},
+		},
+		CurrentFile: 5,
+		CurrentSent: 999,
+	})
+	if p.FileIndex != 0 {
+		t.Errorf("FileIndex = %d, want 0", p.FileIndex)
+	}
+	if p.BytesDone != 10 {
+		t.Errorf("BytesDone = %d, want 10", p.BytesDone)
+	}
+	if p.Fraction() != 1 {
+		t.Errorf("Fraction = %f, want 1", p.Fraction())
+	}
+}
+
+func TestReadProgress_ResumedFile(t *testing.T) {
+	chunk := int64(models.TCP_BUFFER_SIZE / 2)
+	size := chunk * 10
+	p := progressOf(croc.Progress{
+		Files: []croc.FileInfo{
+			{Name: "big.bin", Size: size},
+		},
+		// 只缺 4 个分块，已经接收了一个
+		CurrentChunks: 4,
+		CurrentSent:   chunk,
+	})
+	want := size - 4*chunk + chunk
+	if p.FileBytesDone != want {
+		t.Errorf("FileBytesDone = %d, want %d", p.FileBytesDone, want)
+	}
+}
+
+func TestWatchProgress_StopsOnCancel(t *testing.T) {
+	read := func() Progress { return Progress{TotalBytes: 100} }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan Progress, 10)
+	watchProgress(ctx, read, 10*time.Millisecond, func(p Progress) {
+		updates <- p
+	})
+
+	select {
+	case p := <-updates:
+		if p.TotalBytes != 100 {
+			t.Errorf("TotalBytes = %d, want 100", p.TotalBytes)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no progress update received")
+	}
+
+	// 进度不变时不应该重复通知
+	select {
+	case p := <-updates:
+		t.Fatalf("unexpected duplicate update: %+v", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case p := <-updates:
+		t.Fatalf("update after cancel: %+v", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestManager_WatchProgress_Stop(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	client, err := croc.New(DefaultOptions(false, "test-watch"))
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+
+	updates := make(chan Progress, 10)
+	stop := m.WatchProgress(client, func(p Progress) {
+		updates <- p
+	})
+
+	select {
+	case <-updates:
+	case <-time.After(time.Second):
+		t.Fatal("no progress update received")
+	}
+
+	stop()
+	stop() // 重复调用应该安全
+}
+
+// TestWatchProgress_DuringTransfer 在真实传输过程中从其他 goroutine 读取进度
+// 进度来自 croc 在锁中更新的快照，使用 -race 运行时不应报告进度读取的数据竞争。
+func TestWatchProgress_DuringTransfer(t *testing.T) {
+	relay := startTestRelay(t)
+
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	src := filepath.Join(srcDir, "big.bin")
+	data := make([]byte, 3*models.TCP_BUFFER_SIZE)
+	rand.Read(data)
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager()
+	defer m.Close()
+
+	code := "progress-" + strconv.FormatInt(time.Now().UnixNano()%10000, 10)
+	sendOptions := DefaultOptions(true, code)
+	sendOptions.DisableLocal = true
+	relay.Apply(&sendOptions)
+	receiveOptions := DefaultOptions(false, code)
+	receiveOptions.DisableLocal = true
+	receiveOptions.Dir = dstDir
+	relay.Apply(&receiveOptions)
+
+	filesInfo, emptyFolders, totalNumberFolders, err := croc.GetFilesInfo([]string{src}, false, false, []string{})
+	if err != nil {
+		t.Fatalf("GetFilesInfo failed: %v", err)
+	}
+	sender, err := m.StartSend(sendOptions, filesInfo, emptyFolders, totalNumberFolders)
+	if err != nil {
+		t.Fatalf("StartSend failed: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	receiver, err := m.StartReceive(receiveOptions)
+	if err != nil {
+		t.Fatalf("StartReceive failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	var sent, received Progress
+	defer sender.WatchProgress(func(p Progress) { mu.Lock(); sent = p; mu.Unlock() })()
+	defer receiver.WatchProgress(func(p Progress) { mu.Lock(); received = p; mu.Unlock() })()
+
+	select {
+	case <-receiver.Done():
+	case <-time.After(30 * time.Second):
+		sender.Cancel()
+		receiver.Cancel()
+		t.Fatal("transfer timed out")
+	}
+	if err := receiver.Err(); err != nil {
+		t.Fatalf("receive failed: %v", err)
+	}
+	sender.Wait()
+
+	// 传输结束后进度为 100%，轮询到的进度不超过文件大小
+	if p := receiver.Progress(); p.Fraction() != 1 || p.FileName != "big.bin" {
+		t.Errorf("receiver progress = %+v", p)
+	}
+	if p := sender.Progress(); p.Fraction() != 1 {
+		t.Errorf("sender progress = %+v", p)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if sent.BytesDone > int64(len(data)) || received.BytesDone > int64(len(data)) {
+		t.Errorf("progress exceeds file size: sent %+v, received %+v", sent, received)
+	}
+}
@@ -0,0 +1,146 @@
+package crocmgr
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/schollz/croc/v10/src/tcp"
+)
+
+// DefaultLocalRelayPort 内置中继默认端口，与公共中继一致
+const DefaultLocalRelayPort = 9009
+
+// localRelayTransferPorts 内置中继除主端口外用于传输数据的端口数
+const localRelayTransferPorts = 4
+
+// relayStartTimeout 等待内置中继开始监听的最长时间
+const relayStartTimeout = 3 * time.Second
+
+// ErrRelayPasswordMismatch 端口上已有使用其他密码的内置中继
+var ErrRelayPasswordMismatch = errors.New("内置中继已使用其他密码启动")
+
+// LocalRelay 进程内运行的 croc 中继服务器
+// 用于局域网或离线环境，发送端和接收端都连接到这个中继。
+// croc 的中继无法停止，启动后一直运行到进程退出。
+type LocalRelay struct {
+	Port     int
+	Ports    []string // 主端口和传输端口
+	Password string
+}
+
+var (
+	localRelaysMu sync.Mutex
+	localRelays   = make(map[int]*LocalRelay)
+)
+
+// StartLocalRelay 在指定端口启动内置中继，监听所有网卡
+// 同一端口已经启动过中继时直接返回，密码不同时返回 ErrRelayPasswordMismatch。
+func StartLocalRelay(port int, password string) (*LocalRelay, error) {
+	if port <= 0 || port+localRelayTransferPorts > 65535 {
+		return nil, fmt.Errorf("无效的中继端口: %d", port)
+	}
+
+	localRelaysMu.Lock()
+	defer localRelaysMu.Unlock()
+
+	if r, ok := localRelays[port]; ok {
+		if r.Password != password {
+			return nil, fmt.Errorf("%w: 端口 %d", ErrRelayPasswordMismatch, port)
+		}
+		return r, nil
+	}
+
+	r := &LocalRelay{Port: port, Password: password}
+	for i := 0; i <= localRelayTransferPorts; i++ {
+		r.Ports = append(r.Ports, strconv.Itoa(port+i))
+	}
+
+	// 先检查端口是否可用，中继启动失败只能异步得知
+	for _, p := range r.Ports {
+		ln, err := net.Listen("tcp", net.JoinHostPort("", p))
+		if err != nil {
+			return nil, fmt.Errorf("中继端口 %s 不可用: %w", p, err)
+		}
+		ln.Close()
+	}
+
+	errCh := make(chan error, len(r.Ports))
+	banner := strings.Join(r.Ports[1:], ",")
+	for i, p := range r.Ports {
+		// 主端口通过 banner 告诉客户端可用的传输端口
+		portBanner := ""
+		if i == 0 {
+			portBanner = banner
+		}
+		go func(p, portBanner string) {
+			errCh <- tcp.Run("warn", "", p, password, portBanner)
+		}(p, portBanner)
+	}
+
+	if err := waitRelayReady(r.Address(), errCh); err != nil {
+		return nil, err
+	}
+
+	localRelays[port] = r
+	return r, nil
+}
+
+// waitRelayReady 等待中继响应 ping，或者启动失败
+func waitRelayReady(address string, errCh <-chan error) error {
+	deadline := time.Now().Add(relayStartTimeout)
+	for {
+		select {
+		case err := <-errCh:
+			return fmt.Errorf("启动内置中继失败: %w", err)
+		default:
+		}
+		if tcp.PingServer(address) == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("启动内置中继超时: %s", address)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Address 本机连接中继使用的地址
+func (r *LocalRelay) Address() string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(r.Port))
+}
+
+// LANAddresses 局域网内其他设备连接中继可以使用的地址
+func (r *LocalRelay) LANAddresses() []string {
+	return LANAddresses(r.Port)
+}
+
+// LANAddresses 返回本机局域网 IPv4 地址加上端口
+func LANAddresses(port int) []string {
+	var addresses []string
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.To4() == nil {
+			continue
+		}
+		addresses = append(addresses, net.JoinHostPort(ipNet.IP.String(), strconv.Itoa(port)))
+	}
+	return addresses
+}
+
+// Apply 让传输使用内置中继
+func (r *LocalRelay) Apply(options *croc.Options) {
+	options.RelayAddress = r.Address()
+	options.RelayAddress6 = ""
+	options.RelayPorts = append([]string(nil), r.Ports...)
+	options.RelayPassword = r.Password
+}
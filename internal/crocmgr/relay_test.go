@@ -0,0 +1,196 @@
+package crocmgr
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+// freeRelayPort 找到一段连续可用的端口作为内置中继端口
+func freeRelayPort(t *testing.T) int {
+	t.Helper()
+	for base := 41000; base < 60000; base += 10 {
+		free := true
+		for i := 0; i <= localRelayTransferPorts; i++ {
+			ln, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(base+i)))
+			if err != nil {
+				free = false
+				break
+			}
+			ln.Close()
+		}
+		if free {
+			return base
+		}
+	}
+	t.Fatal("no free relay ports")
+	return 0
+}
+
+// startTestRelay 启动测试用的内置中继
+func startTestRelay(t *testing.T) *LocalRelay {
+	t.Helper()
+	relay, err := StartLocalRelay(freeRelayPort(t), DefaultRelayPassword)
+	if err != nil {
+		t.Fatalf("StartLocalRelay failed: %v", err)
+	}
+	return relay
+}
+
+func TestStartLocalRelay_Reuse(t *testing.T) {
+	port := freeRelayPort(t)
+	relay, err := StartLocalRelay(port, "test-pass")
+	if err != nil {
+		t.Fatalf("StartLocalRelay failed: %v", err)
+	}
+	if len(relay.Ports) != localRelayTransferPorts+1 || relay.Ports[0] != strconv.Itoa(port) {
+		t.Errorf("unexpected ports: %v", relay.Ports)
+	}
+
+	again, err := StartLocalRelay(port, "test-pass")
+	if err != nil || again != relay {
+		t.Errorf("second start should reuse relay, got %v, %v", again, err)
+	}
+	if _, err := StartLocalRelay(port, "other-pass"); !errors.Is(err, ErrRelayPasswordMismatch) {
+		t.Errorf("err = %v, want ErrRelayPasswordMismatch", err)
+	}
+	if _, err := StartLocalRelay(0, "test-pass"); err == nil {
+		t.Error("expected error for invalid port")
+	}
+
+	options := DefaultOptions(true, "code")
+	relay.Apply(&options)
+	if options.RelayAddress != relay.Address() || options.RelayPassword != "test-pass" {
+		t.Errorf("Apply did not target local relay: %+v", options)
+	}
+}
+
+// TestSendReceive_LocalRelay 通过内置中继传输文本，不依赖公共中继
+func TestSendReceive_LocalRelay(t *testing.T) {
+	relay := startTestRelay(t)
+
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	src := filepath.Join(srcDir, "hello.txt")
+	if err := os.WriteFile(src, []byte("Hello, 内置中继!"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager()
+	defer m.Close()
+
+	code := "local-relay-" + strconv.FormatInt(time.Now().UnixNano()%10000, 10)
+	sendOptions := DefaultOptions(true, code)
+	sendOptions.DisableLocal = true
+	relay.Apply(&sendOptions)
+	receiveOptions := DefaultOptions(false, code)
+	receiveOptions.DisableLocal = true
+	receiveOptions.Dir = dstDir
+	relay.Apply(&receiveOptions)
+
+	filesInfo, emptyFolders, totalNumberFolders, err := croc.GetFilesInfo([]string{src}, false, false, []string{})
+	if err != nil {
+		t.Fatalf("GetFilesInfo failed: %v", err)
+	}
+	sender, err := m.StartSend(sendOptions, filesInfo, emptyFolders, totalNumberFolders)
+	if err != nil {
+		t.Fatalf("StartSend failed: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	receiver, err := m.StartReceive(receiveOptions)
+	if err != nil {
+		t.Fatalf("StartReceive failed: %v", err)
+	}
+
+	select {
+	case <-receiver.Done():
+	case <-time.After(30 * time.Second):
+		sender.Cancel()
+		receiver.Cancel()
+		t.Fatal("transfer through local relay timed out")
+	}
+	if err := receiver.Err(); err != nil {
+		t.Fatalf("receive failed: %v", err)
+	}
+	sender.Wait()
+	if state := receiver.State(); state != lifecycle.Completed {
+		t.Errorf("receiver state = %s, want completed", state)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dstDir, "hello.txt"))
+	if err != nil {
+		t.Fatalf("received file missing: %v", err)
+	}
+	if string(data) != "Hello, 内置中继!" {
+		t.Errorf("received %q", data)
+	}
+}
+
+// TestStartReceive_SeparateDirs 同时进行的两个接收任务各自写入自己的接收目录，不使用工作目录
+func TestStartReceive_SeparateDirs(t *testing.T) {
+	relay := startTestRelay(t)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager()
+	defer m.Close()
+
+	var receivers []*Transfer
+	var dirs []string
+	for i, name := range []string{"first.txt", "second.txt"} {
+		srcDir, dstDir := t.TempDir(), t.TempDir()
+		src := filepath.Join(srcDir, name)
+		if err := os.WriteFile(src, []byte("data "+name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		// croc 按接收码的前 4 个字符分配房间，两个任务使用不同的前缀
+		code := strconv.Itoa(1000+i) + "-dirs-" + strconv.FormatInt(time.Now().UnixNano()%10000, 10)
+		sendOptions := DefaultOptions(true, code)
+		sendOptions.DisableLocal = true
+		relay.Apply(&sendOptions)
+		receiveOptions := DefaultOptions(false, code)
+		receiveOptions.DisableLocal = true
+		receiveOptions.Dir = dstDir
+		relay.Apply(&receiveOptions)
+
+		sender, err := m.StartSendPaths(sendOptions, []string{src})
+		if err != nil {
+			t.Fatalf("StartSendPaths failed: %v", err)
+		}
+		defer sender.Cancel()
+		time.Sleep(500 * time.Millisecond)
+		receiver, err := m.StartReceive(receiveOptions)
+		if err != nil {
+			t.Fatalf("StartReceive failed: %v", err)
+		}
+		defer receiver.Cancel()
+		receivers = append(receivers, receiver)
+		dirs = append(dirs, dstDir)
+	}
+
+	for i, name := range []string{"first.txt", "second.txt"} {
+		select {
+		case <-receivers[i].Done():
+		case <-time.After(30 * time.Second):
+			t.Fatalf("receive of %s timed out", name)
+		}
+		if err := receivers[i].Err(); err != nil {
+			t.Fatalf("receive of %s failed: %v", name, err)
+		}
+		if data, err := os.ReadFile(filepath.Join(dirs[i], name)); err != nil || string(data) != "data "+name {
+			t.Errorf("%s = %q, %v", name, data, err)
+		}
+		if _, err := os.Stat(filepath.Join(wd, name)); err == nil {
+			t.Errorf("%s written to the working directory", name)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package crocmgr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/schollz/croc/v10/src/models"
+)
+
+// ResumeRelayProfileName 继续传输时使用的中继配置名称
+const ResumeRelayProfileName = "继续传输"
+
+// resumeFilePrefix 接收目录中断点清单的文件名前缀
+const resumeFilePrefix = ".mocroc-resume-"
+
+// minResumeChunks 续传时文件末尾至少重新接收的分块数，不少于 croc 的并行连接数
+const minResumeChunks = 16
+
+// resumeChunkSize croc 续传时的分块大小
+const resumeChunkSize = models.TCP_BUFFER_SIZE / 2
+
+// ErrNotResumable 中断的传输无法继续
+var ErrNotResumable = errors.New("无法继续传输")
+
+// ResumeFile 中断的传输中的一个文件
+type ResumeFile struct {
+	Name      string `json:"name"` // 相对接收目录的路径，按保存位置规则放到绝对路径时为绝对路径
+	Size      int64  `json:"size"`
+	BytesDone int64  `json:"bytesDone"`          // 中断时已完成的字节数
+	Received  int64  `json:"received,omitempty"` // 接收方从文件开头起连续写入的字节数，继续接收时只请求之后的分块
+	Source    string `json:"source,omitempty"`   // 重命名或按保存位置规则换了文件夹时，发送方的相对路径
+	Skipped   bool   `json:"skipped,omitempty"`  // 与已有文件同名而跳过
+}
+
+// Done 文件是否已经传完，跳过的文件不需要再传
+func (f ResumeFile) Done() bool {
+	return f.Skipped || f.BytesDone >= f.Size
+}
+
+// Resume 中断的传输的断点信息
+// 使用相同的接收码和中继重新连接后，croc 跳过接收方已有的完整文件，
+// 未完成的文件只请求缺少的分块。接收方同时把它保存为接收目录中的断点清单。
+type Resume struct {
+	Direction Direction    `json:"direction"`
+	Code      string       `json:"code"`
+	Relay     RelayProfile `json:"relay"`
+	Dir       string       `json:"dir,omitempty"`       // 接收目录
+	Paths     []string     `json:"paths,omitempty"`     // 发送的文件和文件夹
+	Skip      []string     `json:"skip,omitempty"`      // 所选文件夹中取消勾选的文件和子文件夹
+	ZipFolder bool         `json:"zipFolder,omitempty"` // 发送前压缩文件夹
+	Exclude   []string     `json:"exclude,omitempty"`   // 发送时的忽略规则，继续发送相同的文件
+	GitIgnore bool         `json:"gitIgnore,omitempty"` // 发送时遵循 .gitignore
+	Hash      string       `json:"hash,omitempty"`      // 发送时选择的校验算法
+	Files     []ResumeFile `json:"files"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
+
+// BytesDone 返回中断时已完成的字节数
+func (r Resume) BytesDone() int64 {
+	var n int64
+	for _, f := range r.Files {
+		n += f.BytesDone
+	}
+	return n
+}
+
+// TotalBytes 返回所有文件的总字节数
+func (r Resume) TotalBytes() int64 {
+	var n int64
+	for _, f := range r.Files {
+		n += f.Size
+	}
+	return n
+}
+
+// FilesDone 返回已经传完的文件数
+func (r Resume) FilesDone() int {
+	n := 0
+	for _, f := range r.Files {
+		if f.Done() {
+			n++
+		}
+	}
+	return n
+}
+
+// ResumePath 返回接收目录中使用该接收码的断点清单路径
+// 文件名只包含接收码的摘要，不会泄露接收码。
+func ResumePath(dir, code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return filepath.Join(dir, resumeFilePrefix+hex.EncodeToString(sum[:4])+".json")
+}
+
+// LoadResume 读取接收目录中使用该接收码中断的接收任务
+func LoadResume(dir, code string) (Resume, error) {
+	data, err := os.ReadFile(ResumePath(dir, code))
+	if err != nil {
+		return Resume{}, fmt.Errorf("读取断点清单失败: %w", err)
+	}
+	var r Resume
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Resume{}, fmt.Errorf("解析断点清单失败: %w", err)
+	}
+	if r.Code != code {
+		return Resume{}, fmt.Errorf("%w: 断点清单的接收码不一致", ErrNotResumable)
+	}
+	return r, nil
+}
+
+// save 把接收任务的断点清单写入接收目录
+func (r Resume) save() error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("编码断点清单失败: %w", err)
+	}
+	// 清单中包含接收码，只允许当前用户读取
+	if err := os.WriteFile(ResumePath(r.Dir, r.Code), data, 0o600); err != nil {
+		return fmt.Errorf("保存断点清单失败: %w", err)
+	}
+	return nil
+}
+
+// matches 收到的文件列表是否就是中断的接收中的文件，按发送方的相对路径和大小比较
+func (r Resume) matches(offer Offer) bool {
+	if offer.IsText || len(offer.Files) != len(r.Files) {
+		return false
+	}
+	for i, f := range offer.Files {
+		last := r.Files[i]
+		name := last.Name
+		if last.Source != "" {
+			name = last.Source
+		}
+		if f.Path() != name || f.Size != last.Size {
+			return false
+		}
+	}
+	return true
+}
+
+// prepare 在继续接收之前删除没有可保留内容的未完成文件
+// 只能在确认收到的文件列表与断点信息一致后调用。
+func (r Resume) prepare() {
+	for _, f := range r.Files {
+		// 跳过的文件是接收之前就有的文件，不能改动
+		if f.Done() {
+			continue
+		}
+		// 没有连续收到的内容或校验失败的文件整个重新接收
+		if f.Received == 0 {
+			os.Remove(receivedPath(r.Dir, f.Name))
+		}
+	}
+}
+
+// missingChunks 返回继续接收未完成的文件时请求的分块，用作 croc 的 Options.MissingChunks
+// croc 默认把全零的分块当作缺少的分块，内容本来为零的分块会被重新接收，写坏的非零内容却会被保留，
+// 所以按断点信息中连续收到的字节数请求之后的全部分块，文件内容最终由校验决定。
+// 发送方并行发送时，请求的分块发完后会把其余分块也发出来，接收方收到多余的分块会崩溃，
+// 只有请求的分块在文件末尾且不少于并行连接数时才安全，因此至少请求最后 minResumeChunks 个分块。
+// 不在断点信息中的文件返回 nil，由 croc 按全零分块判断。
+func (r Resume) missingChunks(name string, size int64) []int64 {
+	name = filepath.Clean(filepath.FromSlash(name))
+	for _, f := range r.Files {
+		if f.Done() || f.Size != size || filepath.Clean(receivedPath(r.Dir, f.Name)) != name {
+			continue
+		}
+		chunk := int64(resumeChunkSize)
+		chunks := (size + chunk - 1) / chunk
+		first := min(f.Received/chunk, max(chunks-minResumeChunks, 0))
+		return []int64{chunk, first * chunk, chunks - first}
+	}
+	return nil
+}
+
+// removeResume 接收完成后删除断点清单
+func removeResume(dir, code string) {
+	os.Remove(ResumePath(dir, code))
+}
+
+// relayProfileFromOptions 根据任务使用的 croc 配置还原中继配置
+// 本机地址是进程内启动的内置中继，继续传输时需要重新启动。
+func relayProfileFromOptions(options croc.Options) RelayProfile {
+	p := RelayProfile{
+		Name:         ResumeRelayProfileName,
+		Address:      RelayDialAddress(options.RelayAddress, options.RelayPorts),
+		Address6:     RelayDialAddress(options.RelayAddress6, options.RelayPorts),
+		Ports:        slices.Clone(options.RelayPorts),
+		Password:     options.RelayPassword,
+		OnlyLocal:    options.OnlyLocal,
+		DisableLocal: options.DisableLocal,
+	}
+	if host, port, err := net.SplitHostPort(options.RelayAddress); err == nil {
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			p.Address, p.Address6 = "", ""
+			p.Ports = []string{port}
+			p.Embedded = true
+		}
+	}
+	return p
+}
+
+// Resume 返回中断时记录的断点信息，任务未中断或无法继续时返回 false
+func (t *Transfer) Resume() (Resume, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.resume == nil {
+		return Resume{}, false
+	}
+	return *t.resume, true
+}
+
+// Resumed 是否在继续之前中断的接收，收到文件列表之前为 false
+func (t *Transfer) Resumed() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.resumed
+}
+
+func (t *Transfer) setPaths(paths, skip []string) {
+	t.mu.Lock()
+	t.paths = paths
+	t.skip = skip
+	t.mu.Unlock()
+}
+
+// recordResume 在传输中断时记录断点信息，无法继续时返回 nil
+// 文本传输不记录；接收方还没开始接收文件时重新接收即可，也不记录。
+// 接收方同时把断点清单保存到接收目录，命令行再次接收时据此继续接收。
+func (t *Transfer) recordResume() *Resume {
+	client := t.client
+	files := client.FilesToTransfer
+	if len(files) == 0 || isTextTransfer(client) {
+		return nil
+	}
+
+	r := &Resume{
+		Direction: t.Direction,
+		Code:      t.Code,
+		Relay:     relayProfileFromOptions(client.Options),
+		UpdatedAt: time.Now(),
+	}
+	switch t.Direction {
+	case DirectionSend:
+		t.mu.RLock()
+		r.Paths = slices.Clone(t.paths)
+		r.Skip = slices.Clone(t.skip)
+		t.mu.RUnlock()
+		if len(r.Paths) == 0 {
+			return nil
+		}
+		r.ZipFolder = client.Options.ZipFolder
+		r.Exclude = slices.Clone(client.Options.Exclude)
+		r.GitIgnore = client.Options.GitIgnore
+		r.Hash = client.Options.HashAlgorithm
+	case DirectionReceive:
+		if !client.Step2FileInfoTransferred || t.dir == "" {
+			return nil
+		}
+		r.Dir = t.dir
+	}
+
+	// 当前文件之前的文件已经完成，当前文件按已传输的字节计算
+	snapshot := stoppedProgress(client)
+	p := progressOf(snapshot)
+	received := t.ReceivedFiles()
+	for i, f := range files {
+		file := ResumeFile{Name: path.Join(f.FolderRemote, f.Name), Size: f.Size}
+		switch {
+		case i < p.FileIndex:
+			file.BytesDone = f.Size
+			file.Received = f.Size
+		case i == p.FileIndex:
+			file.BytesDone = p.FileBytesDone
+			file.Received = snapshot.CurrentReceived
+		}
+		if i < len(received) {
+			if received[i].Name != file.Name {
+				file.Source = received[i].Name
+			}
+			if received[i].Skipped() {
+				file.Skipped = true
+				file.BytesDone = 0
+				file.Received = 0
+			}
+		}
+		r.Files = append(r.Files, file)
+	}
+	// 校验失败的文件内容有误，继续接收时不能保留
+	if v, ok := t.Verification(); ok {
+		for _, failed := range v.Failures() {
+			for i := range r.Files {
+				if r.Files[i].Name == failed.Name {
+					r.Files[i].BytesDone = 0
+					r.Files[i].Received = 0
+				}
+			}
+		}
+	}
+
+	if r.Direction == DirectionReceive {
+		if err := r.save(); err != nil {
+			log.Printf("%v\n", err)
+		}
+	}
+	return r
+}
+
+// applyResume 继续接收时沿用上次对同名文件的处理和保存位置
+// 重命名或换了文件夹的文件继续写入上次的位置，跳过的文件仍然跳过，不再检查同名文件和保存位置规则。
+func (t *Transfer) applyResume(r Resume) {
+	client := t.client
+	previous := make(map[string]ResumeFile)
+	for _, f := range r.Files {
+		if f.Source != "" {
+			previous[f.Source] = f
+		} else {
+			previous[f.Name] = f
+		}
+	}
+
+	received := make([]ReceivedFile, len(client.FilesToTransfer))
+	for i := range client.FilesToTransfer {
+		f := &client.FilesToTransfer[i]
+		name := path.Join(filepath.ToSlash(f.FolderRemote), f.Name)
+		received[i] = ReceivedFile{Name: name, Path: receivedPath(t.dir, name)}
+		switch last := previous[name]; {
+		case last.Skipped:
+			client.FilesHasFinished[i] = struct{}{}
+			received[i].Path = ""
+			received[i].Conflict = ConflictSkip
+		case last.Source != "":
+			f.FolderRemote = filepath.FromSlash(path.Dir(last.Name))
+			f.Name = path.Base(last.Name)
+			received[i].Path = receivedPath(t.dir, last.Name)
+			if path.Base(last.Name) != path.Base(last.Source) {
+				received[i].Conflict = ConflictRename
+			}
+		}
+	}
+
+	t.mu.Lock()
+	t.received = received
+	t.mu.Unlock()
+}
+
+// StartSendPaths 读取文件信息并按忽略规则筛选后在后台发送，中断时记录路径以便继续发送
+func (m *Manager) StartSendPaths(options croc.Options, paths []string) (*Transfer, error) {
+	return m.StartSendSelection(options, paths, nil)
+}
+
+// StartSendSelection 与 StartSendPaths 相同，但不发送所选文件夹中 skip 列出的文件和子文件夹
+// 压缩发送时在开始前压缩文件夹，任务结束后删除压缩文件。
+func (m *Manager) StartSendSelection(options croc.Options, paths, skip []string) (*Transfer, error) {
+	plan, err := planSend(paths, skip, options, options.ZipFolder)
+	if err != nil {
+		return nil, err
+	}
+	// 记录绝对路径，继续发送时不受工作目录影响
+	abs := make([]string, len(paths))
+	for i, p := range paths {
+		if abs[i], err = filepath.Abs(p); err != nil {
+			abs[i] = p
+		}
+	}
+	options.IsSender = true
+	t, err := m.startTransfer(DirectionSend, options, nil, func(t *Transfer) error {
+		t.setPaths(abs, skip)
+		return t.client.Send(plan.Files, plan.EmptyFolders, plan.NumFolders)
+	})
+	if err != nil {
+		removeArchives(plan.Files)
+		return nil, err
+	}
+	go func() {
+		<-t.Done()
+		removeArchives(plan.Files)
+	}()
+	return t, nil
+}
+
+// Resume 使用相同的接收码和中继继续中断的传输
+// 发送时重新读取文件后发送；接收时写入原来的接收目录，见 StartReceiveResume。
+func (m *Manager) Resume(r Resume) (*Transfer, error) {
+	var options croc.Options
+	switch r.Direction {
+	case DirectionSend:
+		if len(r.Paths) == 0 {
+			return nil, fmt.Errorf("%w: 没有记录发送的文件", ErrNotResumable)
+		}
+		options = DefaultOptions(true, r.Code)
+		options.ZipFolder = r.ZipFolder
+		options.Exclude = r.Exclude
+		options.GitIgnore = r.GitIgnore
+		if r.Hash != "" {
+			options.HashAlgorithm = r.Hash
+		}
+	case DirectionReceive:
+		if r.Dir == "" {
+			return nil, fmt.Errorf("%w: 没有记录接收目录", ErrNotResumable)
+		}
+		options = DefaultOptions(false, r.Code)
+		options.Dir = r.Dir
+	default:
+		return nil, fmt.Errorf("%w: 未知的传输方向 %q", ErrNotResumable, r.Direction)
+	}
+	if _, err := r.Relay.Apply(&options); err != nil {
+		return nil, err
+	}
+
+	if r.Direction == DirectionSend {
+		return m.StartSendSelection(options, r.Paths, r.Skip)
+	}
+	return m.StartReceiveResume(options, r)
+}
+
+// StartReceiveResume 使用 options 连接，继续 r 记录的中断的接收
+// 已经确认过文件列表，收到后自动接受：文件列表与断点信息一致时整理未完成的文件，
+// croc 跳过已经完整的文件，只请求缺少的分块，并沿用上次对同名文件的处理；
+// 不一致时拒绝接收，任务以 ErrNotResumable 失败。options.Dir 为空时写入 r.Dir。
+func (m *Manager) StartReceiveResume(options croc.Options, r Resume) (*Transfer, error) {
+	if r.Direction != DirectionReceive {
+		return nil, fmt.Errorf("%w: 不是中断的接收", ErrNotResumable)
+	}
+	if options.Dir == "" {
+		options.Dir = r.Dir
+	}
+	prompt := newOfferPrompt()
+	prompt.auto = true
+	prompt.resume = &r
+	return m.startTransfer(DirectionReceive, options, prompt, (*Transfer).receiveWithPreview)
+}
@@ -0,0 +1,440 @@
+package crocmgr
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/schollz/croc/v10/src/models"
+)
+
+// chdirTemp 切换到临时目录，测试结束后恢复
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(originalDir) })
+	return dir
+}
+
+func TestTransfer_RecordsResumeOnFailure(t *testing.T) {
+	dir := chdirTemp(t)
+	m := NewManager()
+	defer m.Close()
+	events := newEventRecorder()
+	m.Events().Subscribe(events.handle)
+
+	chunk := int64(models.TCP_BUFFER_SIZE / 2)
+	lost := errors.New("connection lost")
+	release := make(chan struct{})
+	tr, err := m.StartTransfer(DirectionReceive, testTransferOptions("resume-record"), blockingRun(release, lost))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟收到两个文件，第一个已完成，第二个接收了 3 个分块
+	client := tr.Client()
+	client.FilesToTransfer = []croc.FileInfo{
+		{Name: "a.bin", FolderRemote: ".", Size: 5 * chunk},
+		{Name: "b.bin", FolderRemote: "sub", Size: 10 * chunk},
+	}
+	client.Step1ChannelSecured = true
+	client.Step2FileInfoTransferred = true
+	client.FilesToTransferCurrentNum = 1
+	client.TotalSent = 3 * chunk
+	close(release)
+
+	if err := tr.Wait(); !errors.Is(err, lost) {
+		t.Fatalf("Wait = %v", err)
+	}
+	r, ok := tr.Resume()
+	if !ok {
+		t.Fatal("no resume info recorded")
+	}
+	want := []ResumeFile{
+		{Name: "a.bin", Size: 5 * chunk, BytesDone: 5 * chunk, Received: 5 * chunk},
+		{Name: "sub/b.bin", Size: 10 * chunk, BytesDone: 3 * chunk},
+	}
+	if len(r.Files) != len(want) || r.Files[0] != want[0] || r.Files[1] != want[1] {
+		t.Fatalf("files = %+v, want %+v", r.Files, want)
+	}
+	if r.FilesDone() != 1 || r.BytesDone() != 8*chunk || r.TotalBytes() != 15*chunk {
+		t.Errorf("summary = %d files, %d/%d bytes", r.FilesDone(), r.BytesDone(), r.TotalBytes())
+	}
+	if !r.Relay.Embedded || r.Relay.Ports[0] != "9009" || r.Relay.Validate() != nil {
+		t.Errorf("relay = %+v, want embedded relay on 9009", r.Relay)
+	}
+	if e := events.waitFor(t, EventFailed); e.Resume == nil || e.Resume.Code != "resume-record" {
+		t.Errorf("failed event resume = %+v", e.Resume)
+	}
+
+	saved, err := LoadResume(dir, "resume-record")
+	if err != nil {
+		t.Fatalf("manifest not saved: %v", err)
+	}
+	if saved.Dir != dir || len(saved.Files) != 2 {
+		t.Errorf("manifest = %+v", saved)
+	}
+	if _, err := LoadResume(dir, "other-code"); err == nil {
+		t.Error("manifest should be per code")
+	}
+
+	// 接收目录中有断点清单时，使用相同接收码的普通接收不续传，也不改动未完成的文件
+	partial := bytes.Repeat([]byte{1}, int(10*chunk))
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "b.bin"), partial, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	again := make(chan struct{})
+	close(again)
+	next, err := m.StartTransfer(DirectionReceive, testTransferOptions("resume-record"), blockingRun(again, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := next.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if next.Resumed() {
+		t.Error("receive without an explicit resume should not resume")
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "sub", "b.bin")); !bytes.Equal(got, partial) {
+		t.Error("partial file changed without an explicit resume")
+	}
+	if _, err := os.Stat(ResumePath(dir, "resume-record")); !os.IsNotExist(err) {
+		t.Errorf("manifest should be removed after completion: %v", err)
+	}
+}
+
+func TestTransfer_NoResumeBeforeFiles(t *testing.T) {
+	dir := chdirTemp(t)
+	m := NewManager()
+	defer m.Close()
+
+	release := make(chan struct{})
+	close(release)
+	tr, err := m.StartTransfer(DirectionReceive, testTransferOptions("resume-none"), blockingRun(release, errors.New("no peer")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Wait()
+	if _, ok := tr.Resume(); ok {
+		t.Error("transfer without files should not be resumable")
+	}
+	if _, err := LoadResume(dir, "resume-none"); err == nil {
+		t.Error("manifest should not be saved")
+	}
+}
+
+func TestManager_ResumeErrors(t *testing.T) {
+	chdirTemp(t)
+	m := NewManager()
+	defer m.Close()
+
+	relay := DefaultRelayProfiles()[0]
+	cases := []Resume{
+		{Direction: DirectionSend, Code: "resume-errors", Relay: relay},
+		{Direction: DirectionReceive, Code: "resume-errors", Relay: relay},
+		{Direction: "sideways", Code: "resume-errors", Relay: relay},
+	}
+	for _, r := range cases {
+		if _, err := m.Resume(r); !errors.Is(err, ErrNotResumable) {
+			t.Errorf("Resume(%s) = %v, want ErrNotResumable", r.Direction, err)
+		}
+	}
+}
+
+// TestManager_ResumeReceive 接收目录中已有部分文件时只补全缺少的分块
+func TestManager_ResumeReceive(t *testing.T) {
+	relay := startTestRelay(t)
+	srcDir := t.TempDir()
+	dstDir := chdirTemp(t)
+
+	chunk := models.TCP_BUFFER_SIZE / 2
+	data := make([]byte, 40*chunk)
+	rand.Read(data)
+	src := filepath.Join(srcDir, "big.bin")
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 上次中断时并行接收的分块不连续，中间有空洞
+	partial := make([]byte, len(data))
+	copy(partial, data[:20*chunk])
+	clear(partial[10*chunk : 11*chunk])
+	if err := os.WriteFile(filepath.Join(dstDir, "big.bin"), partial, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code := "resume-" + strconv.FormatInt(time.Now().UnixNano()%100000, 10)
+	r := Resume{
+		Direction: DirectionReceive,
+		Code:      code,
+		Relay:     RelayProfile{Name: ResumeRelayProfileName, Ports: []string{strconv.Itoa(relay.Port)}, Password: relay.Password, Embedded: true, DisableLocal: true},
+		Dir:       dstDir,
+		Files:     []ResumeFile{{Name: "big.bin", Size: int64(len(data)), BytesDone: int64(19 * chunk), Received: int64(10 * chunk)}},
+	}
+	m := NewManager()
+	defer m.Close()
+	sendOptions := DefaultOptions(true, code)
+	sendOptions.DisableLocal = true
+	relay.Apply(&sendOptions)
+	sender, err := m.StartSendPaths(sendOptions, []string{src})
+	if err != nil {
+		t.Fatalf("StartSendPaths failed: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	receiver, err := m.Resume(r)
+	if err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+
+	select {
+	case <-receiver.Done():
+	case <-time.After(30 * time.Second):
+		sender.Cancel()
+		receiver.Cancel()
+		t.Fatal("resumed transfer timed out")
+	}
+	if err := receiver.Err(); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	sender.Wait()
+
+	got, err := os.ReadFile(filepath.Join(dstDir, "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("resumed file differs from the source")
+	}
+	if _, err := os.Stat(ResumePath(dstDir, code)); !os.IsNotExist(err) {
+		t.Errorf("manifest should be removed after completion: %v", err)
+	}
+}
+
+// TestManager_ResumeReceiveZeroChunks 按断点信息中连续收到的位置续传，
+// 内容本来为零的分块不重新接收，之后写坏的非零内容不保留
+func TestManager_ResumeReceiveZeroChunks(t *testing.T) {
+	relay := startTestRelay(t)
+	srcDir := t.TempDir()
+	dstDir := chdirTemp(t)
+
+	chunk := models.TCP_BUFFER_SIZE / 2
+	data := make([]byte, 60*chunk)
+	rand.Read(data)
+	clear(data[20*chunk : 24*chunk])
+	clear(data[59*chunk:])
+	src := filepath.Join(srcDir, "zeros.bin")
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 上次连续收到前 50 个分块，之后的内容已经写坏
+	partial := make([]byte, len(data))
+	copy(partial, data[:50*chunk])
+	rand.Read(partial[50*chunk:])
+	if err := os.WriteFile(filepath.Join(dstDir, "zeros.bin"), partial, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code := "zero-" + strconv.FormatInt(time.Now().UnixNano()%100000, 10)
+	r := Resume{
+		Direction: DirectionReceive,
+		Code:      code,
+		Relay:     RelayProfile{Name: ResumeRelayProfileName, Ports: []string{strconv.Itoa(relay.Port)}, Password: relay.Password, Embedded: true, DisableLocal: true},
+		Dir:       dstDir,
+		Files:     []ResumeFile{{Name: "zeros.bin", Size: int64(len(data)), BytesDone: int64(55 * chunk), Received: int64(50 * chunk)}},
+	}
+	m := NewManager()
+	defer m.Close()
+	sendOptions := DefaultOptions(true, code)
+	sendOptions.DisableLocal = true
+	relay.Apply(&sendOptions)
+	sender, err := m.StartSendPaths(sendOptions, []string{src})
+	if err != nil {
+		t.Fatalf("StartSendPaths failed: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	receiver, err := m.Resume(r)
+	if err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+
+	select {
+	case <-receiver.Done():
+	case <-time.After(30 * time.Second):
+		sender.Cancel()
+		receiver.Cancel()
+		t.Fatal("resumed transfer timed out")
+	}
+	if err := receiver.Err(); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	sender.Wait()
+
+	got, err := os.ReadFile(filepath.Join(dstDir, "zeros.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("resumed file differs from the source")
+	}
+	// 只请求最后 minResumeChunks 个分块
+	progress := receiver.client.Progress()
+	if progress.CurrentChunks != minResumeChunks {
+		t.Errorf("requested %d chunks, want %d", progress.CurrentChunks, minResumeChunks)
+	}
+	if progress.CurrentReceived != int64(len(data)) {
+		t.Errorf("CurrentReceived = %d, want %d", progress.CurrentReceived, len(data))
+	}
+}
+
+// TestManager_ResumeReceiveDifferentFiles 发送方的文件与中断时不同时拒绝接收，不改动未完成的文件
+func TestManager_ResumeReceiveDifferentFiles(t *testing.T) {
+	relay := startTestRelay(t)
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+
+	chunk := models.TCP_BUFFER_SIZE / 2
+	data := make([]byte, 20*chunk)
+	rand.Read(data)
+	src := filepath.Join(srcDir, "big.bin")
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	partial := make([]byte, 30*chunk)
+	rand.Read(partial[:10*chunk])
+	if err := os.WriteFile(filepath.Join(dstDir, "big.bin"), partial, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code := "diff-" + strconv.FormatInt(time.Now().UnixNano()%100000, 10)
+	r := Resume{
+		Direction: DirectionReceive,
+		Code:      code,
+		Relay:     RelayProfile{Name: ResumeRelayProfileName, Ports: []string{strconv.Itoa(relay.Port)}, Password: relay.Password, Embedded: true, DisableLocal: true},
+		Dir:       dstDir,
+		Files:     []ResumeFile{{Name: "big.bin", Size: int64(len(partial)), BytesDone: int64(10 * chunk), Received: int64(10 * chunk)}},
+	}
+	m := NewManager()
+	defer m.Close()
+	sendOptions := DefaultOptions(true, code)
+	sendOptions.DisableLocal = true
+	relay.Apply(&sendOptions)
+	sender, err := m.StartSendPaths(sendOptions, []string{src})
+	if err != nil {
+		t.Fatalf("StartSendPaths failed: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	receiver, err := m.Resume(r)
+	if err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+
+	select {
+	case <-receiver.Done():
+	case <-time.After(30 * time.Second):
+		sender.Cancel()
+		receiver.Cancel()
+		t.Fatal("resumed transfer timed out")
+	}
+	sender.Cancel()
+	if err := receiver.Err(); !errors.Is(err, ErrNotResumable) {
+		t.Fatalf("Err = %v, want ErrNotResumable", err)
+	}
+	if receiver.Resumed() {
+		t.Error("transfer with different files should not resume")
+	}
+	if _, ok := receiver.Resume(); ok {
+		t.Error("refused transfer should not keep the resume info")
+	}
+	if got, _ := os.ReadFile(filepath.Join(dstDir, "big.bin")); !bytes.Equal(got, partial) {
+		t.Error("partial file changed although the files differ")
+	}
+}
+
+func TestResumeMissingChunks(t *testing.T) {
+	chunk := int64(models.TCP_BUFFER_SIZE / 2)
+	size := 40*chunk + 100
+	r := Resume{Dir: "dst", Files: []ResumeFile{
+		{Name: "done.bin", Size: 10, BytesDone: 10, Received: 10},
+		{Name: "sub/big.bin", Size: size, BytesDone: 30 * chunk, Received: 10*chunk + 5},
+		{Name: "tail.bin", Size: size, BytesDone: 39 * chunk, Received: 39 * chunk},
+	}}
+
+	// 从连续收到的位置所在的分块起请求到文件末尾
+	got := r.missingChunks(filepath.Join("dst", "sub", "big.bin"), size)
+	if want := []int64{chunk, 10 * chunk, 31}; !slices.Equal(got, want) {
+		t.Errorf("missingChunks = %v, want %v", got, want)
+	}
+	// 至少请求最后 minResumeChunks 个分块
+	got = r.missingChunks(filepath.Join("dst", "tail.bin"), size)
+	if want := []int64{chunk, (41 - minResumeChunks) * chunk, minResumeChunks}; !slices.Equal(got, want) {
+		t.Errorf("missingChunks = %v, want %v", got, want)
+	}
+	// 其他文件由 croc 判断
+	for _, name := range []string{"done.bin", "other.bin"} {
+		if got := r.missingChunks(filepath.Join("dst", name), 10); got != nil {
+			t.Errorf("missingChunks(%s) = %v, want nil", name, got)
+		}
+	}
+	if got := r.missingChunks(filepath.Join("dst", "tail.bin"), 1); got != nil {
+		t.Errorf("size mismatch: %v", got)
+	}
+}
+
+func TestTransfer_ApplyResume(t *testing.T) {
+	dir := chdirTemp(t)
+	m := NewManager()
+	defer m.Close()
+	release := make(chan struct{})
+	defer close(release)
+	tr, err := m.StartTransfer(DirectionReceive, testTransferOptions("resume-apply"), blockingRun(release, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := tr.Client()
+	client.FilesToTransfer = []croc.FileInfo{
+		{Name: "a.txt", FolderRemote: ".", Size: 10},
+		{Name: "b.txt", FolderRemote: "sub", Size: 10},
+		{Name: "c.txt", FolderRemote: ".", Size: 10},
+	}
+
+	// 上次接收时 a.txt 重命名保存，b.txt 跳过
+	tr.applyResume(Resume{Files: []ResumeFile{
+		{Name: "a (1).txt", Source: "a.txt", Size: 10, BytesDone: 10},
+		{Name: "sub/b.txt", Size: 10, Skipped: true},
+		{Name: "c.txt", Size: 10, BytesDone: 3},
+	}})
+	if client.FilesToTransfer[0].Name != "a (1).txt" {
+		t.Errorf("renamed file written to %q", client.FilesToTransfer[0].Name)
+	}
+	if _, ok := client.FilesHasFinished[1]; !ok {
+		t.Error("skipped file should stay skipped")
+	}
+	want := []ReceivedFile{
+		{Name: "a.txt", Path: filepath.Join(dir, "a (1).txt"), Conflict: ConflictRename},
+		{Name: "sub/b.txt", Conflict: ConflictSkip},
+		{Name: "c.txt", Path: filepath.Join(dir, "c.txt")},
+	}
+	for i, f := range tr.ReceivedFiles() {
+		if f != want[i] {
+			t.Errorf("file %d = %+v, want %+v", i, f, want[i])
+		}
+	}
+	if !(ResumeFile{Skipped: true, Size: 10}).Done() {
+		t.Error("skipped files need no resume")
+	}
+}
@@ -0,0 +1,216 @@
+package crocmgr
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+)
+
+// DateFolderLayout 按日期分目录时的目录名格式
+const DateFolderLayout = "2006-01-02"
+
+// ErrInvalidSaveRule 无效的保存位置规则
+var ErrInvalidSaveRule = errors.New("无效的保存位置规则")
+
+// SaveRules 接收文件的保存位置规则
+// 文件保存在 Dir 中；扩展名匹配 TypeRules 时放到规则的文件夹，否则接收码前缀匹配 CodeRules 时放到规则的文件夹，
+// 文件夹可以是绝对路径、~/ 开头的主目录路径，也可以是相对 Dir 的子目录。开启 DateFolders 时再按接收日期分目录。
+type SaveRules struct {
+	Dir         string     `json:"dir,omitempty"`
+	DateFolders bool       `json:"dateFolders,omitempty"`
+	CodeRules   []CodeRule `json:"codeRules,omitempty"`
+	TypeRules   []TypeRule `json:"typeRules,omitempty"`
+}
+
+// CodeRule 接收码以 Prefix 开头时保存到 Folder
+type CodeRule struct {
+	Prefix string `json:"prefix"`
+	Folder string `json:"folder"`
+}
+
+// TypeRule 扩展名是 Extensions 之一时保存到 Folder
+type TypeRule struct {
+	Extensions []string `json:"extensions"` // 不带点，不区分大小写
+	Folder     string   `json:"folder"`
+}
+
+// Validate 检查规则是否完整
+func (r SaveRules) Validate() error {
+	for _, rule := range r.CodeRules {
+		if rule.Prefix == "" || rule.Folder == "" {
+			return fmt.Errorf("%w: 接收码前缀和文件夹不能为空", ErrInvalidSaveRule)
+		}
+	}
+	for _, rule := range r.TypeRules {
+		if len(rule.Extensions) == 0 || rule.Folder == "" {
+			return fmt.Errorf("%w: 扩展名和文件夹不能为空", ErrInvalidSaveRule)
+		}
+		for _, ext := range rule.Extensions {
+			if ext == "" || strings.ContainsAny(ext, `./\`) {
+				return fmt.Errorf("%w: 扩展名 %q", ErrInvalidSaveRule, ext)
+			}
+		}
+	}
+	return nil
+}
+
+// Folder 返回文件应该保存的文件夹，为空时直接保存在 Dir 中
+// 规则的文件夹以 ~/ 开头但无法确定主目录时返回错误。
+func (r SaveRules) Folder(code, name string, date time.Time) (string, error) {
+	folder := ""
+	matched := false
+	if ext := strings.TrimPrefix(path.Ext(name), "."); ext != "" {
+		for _, rule := range r.TypeRules {
+			if containsFold(rule.Extensions, ext) {
+				folder, matched = rule.Folder, true
+				break
+			}
+		}
+	}
+	if !matched {
+		for _, rule := range r.CodeRules {
+			if strings.HasPrefix(code, rule.Prefix) {
+				folder = rule.Folder
+				break
+			}
+		}
+	}
+	if rest, ok := strings.CutPrefix(folder, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("%w: 无法确定主目录: %w", ErrInvalidSaveRule, err)
+		}
+		folder = filepath.Join(home, rest)
+	}
+	if r.DateFolders {
+		folder = filepath.Join(folder, date.Format(DateFolderLayout))
+	}
+	return folder, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCodeRules 解析每行一条的接收码规则，格式为 "前缀 = 文件夹"
+func ParseCodeRules(text string) ([]CodeRule, error) {
+	var rules []CodeRule
+	for _, line := range ruleLines(text) {
+		prefix, folder, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q 缺少 =", ErrInvalidSaveRule, line)
+		}
+		rules = append(rules, CodeRule{Prefix: strings.TrimSpace(prefix), Folder: strings.TrimSpace(folder)})
+	}
+	return rules, SaveRules{CodeRules: rules}.Validate()
+}
+
+// ParseTypeRules 解析每行一条的扩展名规则，格式为 "jpg,png = 文件夹"
+func ParseTypeRules(text string) ([]TypeRule, error) {
+	var rules []TypeRule
+	for _, line := range ruleLines(text) {
+		exts, folder, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q 缺少 =", ErrInvalidSaveRule, line)
+		}
+		rule := TypeRule{Folder: strings.TrimSpace(folder)}
+		for _, ext := range strings.FieldsFunc(exts, func(r rune) bool { return r == ',' || r == ' ' || r == '，' }) {
+			rule.Extensions = append(rule.Extensions, strings.ToLower(strings.TrimPrefix(ext, ".")))
+		}
+		rules = append(rules, rule)
+	}
+	return rules, SaveRules{TypeRules: rules}.Validate()
+}
+
+// FormatCodeRules 把接收码规则格式化为 ParseCodeRules 可以解析的文本
+func FormatCodeRules(rules []CodeRule) string {
+	var lines []string
+	for _, rule := range rules {
+		lines = append(lines, rule.Prefix+" = "+rule.Folder)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// FormatTypeRules 把扩展名规则格式化为 ParseTypeRules 可以解析的文本
+func FormatTypeRules(rules []TypeRule) string {
+	var lines []string
+	for _, rule := range rules {
+		lines = append(lines, strings.Join(rule.Extensions, ",")+" = "+rule.Folder)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ruleLines 返回非空的规则行
+func ruleLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// routeOffer 按保存位置规则计算每个文件保存的文件夹，记录在文件列表中
+// 相对路径的文件夹在接收目录中，绝对路径的文件夹保持不变，croc 直接写入这个路径。
+// 压缩发送的文件夹由 croc 解压到接收目录，不能移动；文本不保存为文件。无法确定文件夹时返回错误。
+func (t *Transfer) routeOffer(offer *Offer) error {
+	rules := t.prompt.rules
+	if rules == nil || offer.IsText || t.dir == "" || t.Resumed() {
+		return nil
+	}
+	now := time.Now()
+	files := t.client.FilesToTransfer
+	routes := make([]string, len(files))
+	for i, f := range files {
+		if f.TempFile {
+			continue
+		}
+		folder, err := rules.Folder(t.Code, f.Name, now)
+		if err != nil {
+			return err
+		}
+		if folder = filepath.ToSlash(folder); folder == "." {
+			folder = ""
+		}
+		routes[i] = folder
+		if i < len(offer.Files) {
+			offer.Files[i].SaveTo = folder
+		}
+	}
+
+	t.mu.Lock()
+	t.routes = routes
+	t.mu.Unlock()
+	return nil
+}
+
+// routed 返回按保存位置规则放到对应文件夹后的文件信息
+func (t *Transfer) routed(i int, f croc.FileInfo) croc.FileInfo {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if i < len(t.routes) && t.routes[i] != "" {
+		f.FolderRemote = filepath.Join(filepath.FromSlash(t.routes[i]), f.FolderRemote)
+	}
+	return f
+}
+
+// receivedPath 返回接收的文件在本机的路径，name 是相对 dir 或按保存位置规则放到绝对路径中的文件名
+func receivedPath(dir, name string) string {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,175 @@
+package crocmgr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSaveRules_Folder(t *testing.T) {
+	date := time.Date(2026, 10, 16, 9, 0, 0, 0, time.Local)
+	rules := SaveRules{
+		CodeRules: []CodeRule{{Prefix: "work-", Folder: "Work"}},
+		TypeRules: []TypeRule{{Extensions: []string{"jpg", "png"}, Folder: "/home/me/Pictures/mocroc"}},
+	}
+	cases := []struct {
+		code, name, want string
+	}{
+		{"work-1234", "photo.JPG", "/home/me/Pictures/mocroc"}, // 扩展名规则优先
+		{"work-1234", "report.pdf", "Work"},
+		{"home-1234", "report.pdf", ""},
+		{"home-1234", "Makefile", ""},
+	}
+	for _, c := range cases {
+		if got, err := rules.Folder(c.code, c.name, date); err != nil || got != filepath.FromSlash(c.want) {
+			t.Errorf("Folder(%s, %s) = %q, want %q", c.code, c.name, got, c.want)
+		}
+	}
+	home, _ := os.UserHomeDir()
+	rules.CodeRules[0].Folder = "~/Work"
+	if got, err := rules.Folder("work-1", "a.pdf", date); err != nil || got != filepath.Join(home, "Work") {
+		t.Errorf("Folder in home = %q, %v", got, err)
+	}
+	// 无法确定主目录时返回错误，不能把 ~ 当作普通的文件夹名
+	t.Setenv("HOME", "")
+	t.Setenv("USERPROFILE", "")
+	if got, err := rules.Folder("work-1", "a.pdf", date); !errors.Is(err, ErrInvalidSaveRule) {
+		t.Errorf("Folder without home = %q, %v", got, err)
+	}
+	rules.CodeRules[0].Folder = "Work"
+	rules.DateFolders = true
+	if got, _ := rules.Folder("work-1", "a.pdf", date); got != filepath.Join("Work", "2026-10-16") {
+		t.Errorf("Folder with date = %q", got)
+	}
+	if got, _ := rules.Folder("home-1", "a.pdf", date); got != "2026-10-16" {
+		t.Errorf("Folder with date only = %q", got)
+	}
+}
+
+func TestParseSaveRules(t *testing.T) {
+	codeRules, err := ParseCodeRules("work- = Work\n\n  phone-=Phone/Inbox  \n")
+	if err != nil || len(codeRules) != 2 || codeRules[1] != (CodeRule{Prefix: "phone-", Folder: "Phone/Inbox"}) {
+		t.Fatalf("ParseCodeRules = %+v, %v", codeRules, err)
+	}
+	typeRules, err := ParseTypeRules(".JPG, png，heic = Pictures/mocroc")
+	if err != nil || len(typeRules) != 1 || len(typeRules[0].Extensions) != 3 || typeRules[0].Extensions[0] != "jpg" {
+		t.Fatalf("ParseTypeRules = %+v, %v", typeRules, err)
+	}
+	// 格式化后可以重新解析
+	if again, _ := ParseCodeRules(FormatCodeRules(codeRules)); len(again) != 2 || again[0] != codeRules[0] {
+		t.Errorf("code rules round trip = %+v", again)
+	}
+	if again, _ := ParseTypeRules(FormatTypeRules(typeRules)); len(again) != 1 || again[0].Folder != "Pictures/mocroc" {
+		t.Errorf("type rules round trip = %+v", again)
+	}
+
+	for _, text := range []string{"work-", "= Work", "work- ="} {
+		if _, err := ParseCodeRules(text); !errors.Is(err, ErrInvalidSaveRule) {
+			t.Errorf("ParseCodeRules(%q) = %v", text, err)
+		}
+	}
+	for _, text := range []string{"jpg", "= Pictures", "a/b = Pictures"} {
+		if _, err := ParseTypeRules(text); !errors.Is(err, ErrInvalidSaveRule) {
+			t.Errorf("ParseTypeRules(%q) = %v", text, err)
+		}
+	}
+}
+
+// TestReceiveWithRules 按扩展名、接收码前缀和日期把接收的文件放到不同的文件夹
+func TestReceiveWithRules(t *testing.T) {
+	relay := startTestRelay(t)
+	// 保存目录不是工作目录，文件只按规则写入保存目录
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	pictures := t.TempDir()
+	for _, name := range []string{"photo.jpg", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte("data "+name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewManager()
+	defer m.Close()
+	events := make(chan Event, 10)
+	m.Events().Subscribe(func(e Event) {
+		if e.Direction == DirectionReceive && (e.Type == EventOffer || e.IsFinal()) {
+			events <- e
+		}
+	})
+
+	code := "work-" + strconv.FormatInt(time.Now().UnixNano()%100000, 10)
+	rules := SaveRules{
+		Dir:         dstDir,
+		DateFolders: true,
+		CodeRules:   []CodeRule{{Prefix: "work-", Folder: "Work"}},
+		TypeRules:   []TypeRule{{Extensions: []string{"jpg"}, Folder: pictures}},
+	}
+	receiveOptions := DefaultOptions(false, code)
+	receiveOptions.DisableLocal = true
+	relay.Apply(&receiveOptions)
+
+	sendOptions := DefaultOptions(true, code)
+	sendOptions.DisableLocal = true
+	relay.Apply(&sendOptions)
+	sender, err := m.StartSendPaths(sendOptions, []string{filepath.Join(srcDir, "photo.jpg"), filepath.Join(srcDir, "notes.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	receiver, err := m.StartReceiveWithRules(receiveOptions, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e Event
+	select {
+	case e = <-events:
+	case <-time.After(30 * time.Second):
+		sender.Cancel()
+		receiver.Cancel()
+		t.Fatal("no offer received")
+	}
+	today := time.Now().Format(DateFolderLayout)
+	// 绝对路径的文件夹保持不变，不换算为相对保存目录的路径
+	if e.Offer.Files[0].SaveTo != filepath.ToSlash(filepath.Join(pictures, today)) ||
+		e.Offer.Files[1].SaveTo != "Work/"+today || e.Offer.Files[1].Path() != "notes.txt" {
+		t.Errorf("offer = %+v", e.Offer.Files)
+	}
+	if err := receiver.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e = <-events:
+	case <-time.After(30 * time.Second):
+		sender.Cancel()
+		receiver.Cancel()
+		t.Fatal("receive timed out")
+	}
+	if e.Type != EventCompleted {
+		t.Fatalf("receive finished with %s: %v", e.Type, e.Err)
+	}
+	sender.Wait()
+
+	want := []ReceivedFile{
+		{Name: "photo.jpg", Path: filepath.Join(pictures, today, "photo.jpg")},
+		{Name: "notes.txt", Path: filepath.Join(dstDir, "Work", today, "notes.txt")},
+	}
+	for i := range want {
+		if i >= len(e.Files) || e.Files[i] != want[i] {
+			t.Fatalf("files = %+v, want %+v", e.Files, want)
+		}
+		if data, err := os.ReadFile(want[i].Path); err != nil || string(data) != "data "+want[i].Name {
+			t.Errorf("%s = %q, %v", want[i].Path, data, err)
+		}
+	}
+	if e.Verification == nil || !e.Verification.Passed() || len(e.Verification.Files) != 2 {
+		t.Errorf("verification = %+v", e.Verification)
+	}
+	// 清单使用发送方的相对路径，附带接收目录和发送方的校验值
+	if m := e.Manifest; m == nil || m.SavePath != dstDir || len(m.Files) != 2 || m.Files[1].Path != "notes.txt" ||
+		m.Files[1].Hash != e.Verification.Files[1].Expected || m.TotalBytes != int64(len("data photo.jpgdata notes.txt")) {
+		t.Errorf("manifest = %+v", e.Manifest)
+	}
+}
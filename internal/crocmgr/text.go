@@ -0,0 +1,107 @@
+package crocmgr
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/schollz/croc/v10/src/croc"
+)
+
+// textFilePrefix croc 发送文本时使用的临时文件名前缀，接收端据此识别文本
+const textFilePrefix = "croc-stdin-"
+
+// StartSendText 使用 croc 的文本模式发送文本
+// 接收端把文本显示出来而不是保存为文件，临时文件在任务结束后删除。
+func (m *Manager) StartSendText(options croc.Options, text string) (*Transfer, error) {
+	path, err := createTextFile(text)
+	if err != nil {
+		return nil, err
+	}
+	filesInfo, emptyFolders, totalNumberFolders, err := croc.GetFilesInfo([]string{path}, false, false, []string{})
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("获取文件信息失败: %w", err)
+	}
+
+	options.SendingText = true
+	t, err := m.StartSend(options, filesInfo, emptyFolders, totalNumberFolders)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	go func() {
+		<-t.Done()
+		os.Remove(path)
+	}()
+	return t, nil
+}
+
+// createTextFile 把文本写入临时文件，返回文件路径
+func createTextFile(text string) (string, error) {
+	f, err := os.CreateTemp("", textFilePrefix)
+	if err != nil {
+		return "", fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(text); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("写入临时文件失败: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// isTextTransfer 是否为文本传输，接收方根据临时文件名识别
+func isTextTransfer(client *croc.Client) bool {
+	files := client.FilesToTransfer
+	return client.Options.SendingText || (len(files) > 0 && strings.HasPrefix(files[0].Name, textFilePrefix))
+}
+
+// Text 返回接收到的文本，不是文本传输或尚未完成时返回 false
+func (t *Transfer) Text() (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.text, t.isText
+}
+
+func (t *Transfer) setText(text string) {
+	t.mu.Lock()
+	t.text = text
+	t.isText = true
+	t.mu.Unlock()
+}
+
+// textOutput 保存 croc 接收文本时输出的内容
+// croc 接收文本时不保留文件，只把内容写入 Options.TextOutput，每个接收任务使用自己的 textOutput。
+type textOutput struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	written bool
+}
+
+func (o *textOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.written = true
+	return o.buf.Write(p)
+}
+
+// text 返回接收到的文本，croc 没有输出文本时返回 false
+func (o *textOutput) text() (string, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String(), o.written
+}
+
+// keepText 接收成功后保存 croc 输出的文本
+func (t *Transfer) keepText() {
+	if t.textOut == nil {
+		return
+	}
+	if text, ok := t.textOut.text(); ok {
+		t.setText(text)
+	}
+}
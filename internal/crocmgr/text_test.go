@@ -0,0 +1,115 @@
+package crocmgr
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStartSendText_ReceiveAsText(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	relay := startTestRelay(t)
+
+	workDir := chdirTemp(t)
+	dstDir := t.TempDir()
+
+	events := make(chan Event, 4)
+	m.Events().Subscribe(func(e Event) {
+		if e.Direction == DirectionReceive && (e.Type == EventOffer || e.IsFinal()) {
+			events <- e
+		}
+	})
+
+	code := "text-" + strconv.FormatInt(time.Now().UnixNano()%100000, 10)
+	sendOptions := DefaultOptions(true, code)
+	sendOptions.DisableLocal = true
+	relay.Apply(&sendOptions)
+	receiveOptions := DefaultOptions(false, code)
+	receiveOptions.DisableLocal = true
+	receiveOptions.Dir = dstDir
+	relay.Apply(&receiveOptions)
+
+	const message = "你好，mocroc\n第二行"
+	sender, err := m.StartSendText(sendOptions, message)
+	if err != nil {
+		t.Fatalf("StartSendText failed: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	receiver, err := m.StartReceiveWithPreview(receiveOptions)
+	if err != nil {
+		t.Fatalf("StartReceiveWithPreview failed: %v", err)
+	}
+
+	var e Event
+	select {
+	case e = <-events:
+	case <-time.After(30 * time.Second):
+		t.Fatal("no offer received")
+	}
+	if e.Type != EventOffer || !e.Offer.IsText {
+		t.Fatalf("unexpected event %s, offer %+v", e.Type, e.Offer)
+	}
+	if err := receiver.Accept(); err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+
+	select {
+	case e = <-events:
+	case <-time.After(30 * time.Second):
+		t.Fatal("receive timed out")
+	}
+	if e.Type != EventCompleted {
+		t.Fatalf("final event = %s, err %v", e.Type, e.Err)
+	}
+	if !e.IsText || e.Text != message {
+		t.Errorf("event text = %q (%v), want %q", e.Text, e.IsText, message)
+	}
+	if text, ok := receiver.Text(); !ok || text != message {
+		t.Errorf("Text() = %q, %v", text, ok)
+	}
+
+	// 接收端不留下文件，发送端删除临时文件
+	entries, _ := os.ReadDir(dstDir)
+	if len(entries) != 0 {
+		t.Errorf("receiver left %d files", len(entries))
+	}
+	if entries, _ := os.ReadDir(workDir); len(entries) != 0 {
+		t.Errorf("receiver left %d files in the working directory", len(entries))
+	}
+	select {
+	case <-sender.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("sender did not finish")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := sender.Text(); ok {
+		t.Error("sender should not report text")
+	}
+}
+
+func TestCreateTextFile(t *testing.T) {
+	path, err := createTextFile("hello")
+	if err != nil {
+		t.Fatalf("createTextFile failed: %v", err)
+	}
+	defer os.Remove(path)
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "hello" {
+		t.Errorf("file content %q, %v", data, err)
+	}
+}
+
+// TestTextOutput 接收的文本写入任务自己的缓冲区，没有写入时不算文本
+func TestTextOutput(t *testing.T) {
+	var out textOutput
+	if _, ok := out.text(); ok {
+		t.Error("empty output should not be text")
+	}
+	out.Write([]byte("第一行\n"))
+	out.Write([]byte("第二行"))
+	if text, ok := out.text(); !ok || text != "第一行\n第二行" {
+		t.Errorf("text() = %q, %v", text, ok)
+	}
+}
@@ -0,0 +1,494 @@
+package crocmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+// Direction 传输方向
+type Direction string
+
+const (
+	DirectionSend    Direction = "send"
+	DirectionReceive Direction = "receive"
+)
+
+// ErrTransferNotFound 指定 ID 的传输任务不存在
+var ErrTransferNotFound = errors.New("传输任务不存在")
+
+// ErrTransferCancelled 传输任务被取消
+var ErrTransferCancelled = errors.New("传输已取消")
+
+// Transfer 一次发送或接收任务，拥有独立的上下文和 croc 客户端
+type Transfer struct {
+	ID        string
+	Direction Direction
+	Code      string
+	CreatedAt time.Time
+
+	client *croc.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	machine *lifecycle.Machine
+	events  *EventBus
+	prompt  *offerPrompt // 接收前需要确认时不为空
+	textOut *textOutput  // 接收方 croc 输出的文本
+
+	lastProgress Progress // 只在状态 goroutine 中访问
+
+	mu        sync.RWMutex
+	err       error
+	stopErr   error  // Cancel 或 Reject 给出的取消原因
+	refuseErr error  // onFileInfo 拒绝文件列表的原因，代替 croc 返回的错误
+	text      string // 接收到的文本，只在文本传输中设置
+	isText    bool
+
+	dir     string   // 接收目录的绝对路径，croc 把文件写入 options.Dir
+	paths   []string // 发送的文件和文件夹，用于继续发送
+	skip    []string // 所选文件夹中不发送的文件和子文件夹
+	resume  *Resume  // 中断时记录的断点信息
+	resumed bool     // 继续之前中断的接收，收到的文件列表与断点信息一致时设置
+
+	routes       []string       // 按保存位置规则计算的每个文件的文件夹，相对接收目录或绝对路径
+	received     []ReceivedFile // 接收文件保存的位置，确认接收时记录
+	verification *Verification  // 接收完成后的校验报告
+}
+
+// Client 返回任务使用的 croc 客户端
+func (t *Transfer) Client() *croc.Client {
+	return t.client
+}
+
+// Context 返回任务的上下文，任务取消或管理器关闭时结束
+func (t *Transfer) Context() context.Context {
+	return t.ctx
+}
+
+// Done 任务结束时关闭
+func (t *Transfer) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait 阻塞直到任务结束，返回任务的错误
+func (t *Transfer) Wait() error {
+	<-t.done
+	return t.Err()
+}
+
+// State 返回任务当前状态
+func (t *Transfer) State() lifecycle.State {
+	return t.machine.State()
+}
+
+// Transitions 返回任务的状态转换记录
+func (t *Transfer) Transitions() []lifecycle.Transition {
+	return t.machine.Transitions()
+}
+
+// OnTransition 注册状态转换监听
+func (t *Transfer) OnTransition(fn func(lifecycle.Transition)) {
+	t.machine.OnTransition(fn)
+}
+
+// Err 返回任务失败或取消的原因
+func (t *Transfer) Err() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.err
+}
+
+// FinishedAt 返回任务结束时间，未结束时为零值
+func (t *Transfer) FinishedAt() time.Time {
+	state := t.machine.State()
+	if !state.IsFinished() {
+		return time.Time{}
+	}
+	at, _ := t.machine.EnteredAt(state)
+	return at
+}
+
+// Progress 返回任务当前的传输进度
+func (t *Transfer) Progress() Progress {
+	return ReadProgress(t.client)
+}
+
+// WatchProgress 监控任务进度，任务结束时自动停止
+func (t *Transfer) WatchProgress(onProgress func(Progress)) (stop func()) {
+	return WatchProgress(t.ctx, t.client, ProgressInterval, onProgress)
+}
+
+// Cancel 取消任务，返回时任务已经结束
+// 取消时关闭 croc 的连接，等 croc 停止后才结束任务，断点信息不会与 croc 同时读写。
+func (t *Transfer) Cancel() {
+	t.stop(ErrTransferCancelled)
+}
+
+// stop 以 err 为原因取消任务并等待状态 goroutine 结束任务，任务已经结束时不做任何事
+func (t *Transfer) stop(err error) {
+	t.mu.Lock()
+	if t.stopErr == nil {
+		t.stopErr = err
+	}
+	t.mu.Unlock()
+	t.cancel()
+	<-t.done
+}
+
+// loop 是唯一推进任务状态的 goroutine
+// 按间隔读取进度推进状态，run 返回后校验并结束任务；
+// 上下文取消时关闭 croc 客户端，等 run 返回后以取消原因结束任务。
+func (t *Transfer) loop(result <-chan error) {
+	ticker := time.NewTicker(ProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.observe(t.Progress())
+		case <-t.ctx.Done():
+			t.client.Close()
+			<-result
+			t.finishCancelled()
+			return
+		case err := <-result:
+			if refused := t.refused(); refused != nil {
+				err = refused
+			}
+			if err == nil {
+				t.keepText()
+				err = t.verify()
+			}
+			switch {
+			case t.ctx.Err() != nil:
+				t.finishCancelled()
+			case err != nil:
+				t.finish(lifecycle.Failed, err)
+			default:
+				t.finish(lifecycle.Completed, nil)
+			}
+			return
+		}
+	}
+}
+
+// finishCancelled 以 Cancel 或 Reject 给出的原因结束任务，管理器关闭时原因为 ErrTransferCancelled
+func (t *Transfer) finishCancelled() {
+	t.mu.RLock()
+	err := t.stopErr
+	t.mu.RUnlock()
+	if err == nil {
+		err = ErrTransferCancelled
+	}
+	t.finish(lifecycle.Cancelled, err)
+}
+
+// refuse 记录拒绝文件列表的原因，在 croc 的 goroutine 中调用
+func (t *Transfer) refuse(err error) {
+	t.mu.Lock()
+	t.refuseErr = err
+	t.mu.Unlock()
+}
+
+func (t *Transfer) refused() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.refuseErr
+}
+
+// observe 根据传输进度推进任务状态并发布进度事件
+// 需要确认的任务在接受之前保持等待状态。
+func (t *Transfer) observe(p Progress) {
+	if t.prompt != nil && !t.prompt.isAccepted() {
+		return
+	}
+	state := p.State()
+	if state == lifecycle.Waiting {
+		return
+	}
+	t.machine.Advance(state, "")
+	if t.machine.State().IsFinished() {
+		return
+	}
+
+	last := t.lastProgress
+	t.lastProgress = p
+	state = t.machine.State()
+	if p.FileIndex != last.FileIndex || p.FileName != last.FileName {
+		t.publish(EventFileStarted, state, p, nil)
+	}
+	t.publish(EventProgress, state, p, nil)
+}
+
+// onTransition 把状态转换转换为事件
+func (t *Transfer) onTransition(tr lifecycle.Transition) {
+	switch tr.To {
+	case lifecycle.Waiting:
+		t.publish(EventTransferStarted, tr.To, Progress{}, nil)
+	case lifecycle.Transferring:
+		t.publish(EventPeerConnected, tr.To, t.Progress(), nil)
+	case lifecycle.Completed:
+		t.publish(EventCompleted, tr.To, t.Progress(), nil)
+	case lifecycle.Failed:
+		t.publish(EventFailed, tr.To, t.Progress(), t.Err())
+	case lifecycle.Cancelled:
+		t.publish(EventCancelled, tr.To, t.Progress(), t.Err())
+	default:
+		t.publish(EventStateChanged, tr.To, t.Progress(), nil)
+	}
+}
+
+// publish 向事件总线发布任务事件
+func (t *Transfer) publish(typ EventType, state lifecycle.State, p Progress, err error) {
+	if t.events == nil {
+		return
+	}
+	e := Event{
+		Type:       typ,
+		TransferID: t.ID,
+		Direction:  t.Direction,
+		Code:       t.Code,
+		State:      state,
+		Progress:   p,
+		Err:        err,
+	}
+	switch typ {
+	case EventTransferStarted:
+		relay := relayProfileFromOptions(t.client.Options)
+		e.Relay = &relay
+	case EventCompleted:
+		e.Text, e.IsText = t.Text()
+	case EventFailed, EventCancelled:
+		if r, ok := t.Resume(); ok {
+			e.Resume = &r
+		}
+	}
+	if e.State.IsFinished() {
+		if m, ok := t.Manifest(); ok {
+			e.Manifest = &m
+		}
+		e.Files = t.ReceivedFiles()
+		if v, ok := t.Verification(); ok {
+			e.Verification = &v
+		}
+	}
+	t.events.Publish(e)
+}
+
+// finish 将任务设置为结束状态，只在状态 goroutine 中调用一次
+// 完成时会依次经过尚未观察到的传输中和校验状态。
+func (t *Transfer) finish(state lifecycle.State, err error) {
+	t.mu.Lock()
+	t.err = err
+	t.mu.Unlock()
+
+	switch state {
+	case lifecycle.Failed, lifecycle.Cancelled:
+		resume := t.recordResume()
+		if resume == nil && t.prompt != nil && t.prompt.resume != nil && t.refused() == nil {
+			// 继续接收没有收到文件列表时保留原来的断点信息，之后还可以再试
+			resume = t.prompt.resume
+		}
+		t.mu.Lock()
+		t.resume = resume
+		t.mu.Unlock()
+	case lifecycle.Completed:
+		if t.dir != "" {
+			removeResume(t.dir, t.Code)
+		}
+	}
+
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	t.machine.Advance(state, message)
+
+	t.cancel()
+	close(t.done)
+}
+
+var transferCounter int64
+
+// newTransferID 生成新的传输任务ID
+func newTransferID() string {
+	n := atomic.AddInt64(&transferCounter, 1)
+	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), n)
+}
+
+// StartTransfer 校验中继设置后创建 croc 客户端并在后台运行 run
+// 任务创建后处于等待对端状态，对端连接后根据进度进入传输中和校验状态；
+// run 返回后接收任务校验收到的文件，然后进入完成或失败状态；管理器或任务被取消时关闭 croc 客户端，
+// run 返回后进入取消状态，因此 run 需要在客户端关闭后尽快返回。
+func (m *Manager) StartTransfer(direction Direction, options croc.Options, run func(client *croc.Client) error) (*Transfer, error) {
+	return m.startTransfer(direction, options, nil, func(t *Transfer) error {
+		return run(t.client)
+	})
+}
+
+func (m *Manager) startTransfer(direction Direction, options croc.Options, prompt *offerPrompt, run func(t *Transfer) error) (*Transfer, error) {
+	options.IsSender = direction == DirectionSend
+	if err := ValidateRelayOptions(options); err != nil {
+		return nil, err
+	}
+	if options.HashAlgorithm != "" {
+		if err := ValidateHashAlgorithm(options.HashAlgorithm); err != nil {
+			return nil, err
+		}
+	}
+	var dir string
+	if direction == DirectionReceive {
+		var err error
+		if dir, err = receiveDir(options.Dir); err != nil {
+			return nil, err
+		}
+		options.Dir = dir
+	}
+	client, err := croc.New(options)
+	if err != nil {
+		return nil, fmt.Errorf("创建客户端失败: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	t := &Transfer{
+		ID:        newTransferID(),
+		Direction: direction,
+		Code:      options.SharedSecret,
+		CreatedAt: time.Now(),
+		client:    client,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		machine:   lifecycle.NewMachine(),
+		events:    m.events,
+		prompt:    prompt,
+		dir:       dir,
+	}
+	t.machine.OnTransition(t.onTransition)
+	if prompt != nil {
+		// croc 收到文件列表后调用，代替从标准输入读取确认
+		client.Options.OnFileInfo = t.onFileInfo
+	}
+	if direction == DirectionReceive {
+		// 接收的文本写入任务自己的缓冲区，不打印到标准输出
+		t.textOut = &textOutput{}
+		client.Options.TextOutput = t.textOut
+	}
+
+	m.mu.Lock()
+	m.transfers[t.ID] = t
+	m.order = append(m.order, t.ID)
+	m.mu.Unlock()
+
+	t.machine.To(lifecycle.Waiting, "")
+
+	result := make(chan error, 1)
+	go func() {
+		result <- run(t)
+	}()
+	go t.loop(result)
+
+	return t, nil
+}
+
+// receiveDir 返回接收目录的绝对路径，为空时使用当前工作目录，目录不存在时创建
+func receiveDir(dir string) (string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("获取保存目录失败: %w", err)
+	}
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return "", fmt.Errorf("创建保存目录失败: %w", err)
+	}
+	return abs, nil
+}
+
+// StartSend 在后台发送文件
+// 需要继续中断的发送时使用 StartSendPaths。
+func (m *Manager) StartSend(options croc.Options, filesInfo []croc.FileInfo, emptyFolders []croc.FileInfo, totalNumberFolders int) (*Transfer, error) {
+	return m.StartTransfer(DirectionSend, options, func(client *croc.Client) error {
+		return client.Send(filesInfo, emptyFolders, totalNumberFolders)
+	})
+}
+
+// StartReceive 在后台接收文件
+func (m *Manager) StartReceive(options croc.Options) (*Transfer, error) {
+	return m.StartTransfer(DirectionReceive, options, func(client *croc.Client) error {
+		return client.Receive()
+	})
+}
+
+// GetTransfer 根据 ID 获取传输任务
+func (m *Manager) GetTransfer(id string) (*Transfer, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.transfers[id]
+	return t, ok
+}
+
+// ListTransfers 按创建顺序返回所有传输任务
+func (m *Manager) ListTransfers() []*Transfer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]*Transfer, 0, len(m.order))
+	for _, id := range m.order {
+		result = append(result, m.transfers[id])
+	}
+	return result
+}
+
+// ActiveTransfers 返回所有尚未结束的传输任务
+func (m *Manager) ActiveTransfers() []*Transfer {
+	var result []*Transfer
+	for _, t := range m.ListTransfers() {
+		if !t.State().IsFinished() {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// CancelTransfer 取消指定的传输任务
+func (m *Manager) CancelTransfer(id string) error {
+	t, ok := m.GetTransfer(id)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTransferNotFound, id)
+	}
+	t.Cancel()
+	return nil
+}
+
+// RemoveTransfer 移除已结束的传输任务
+func (m *Manager) RemoveTransfer(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.transfers[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTransferNotFound, id)
+	}
+	if !t.State().IsFinished() {
+		return fmt.Errorf("传输任务 %s 尚未结束", id)
+	}
+
+	delete(m.transfers, id)
+	for i, oid := range m.order {
+		if oid == id {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
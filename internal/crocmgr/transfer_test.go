@@ -0,0 +1,328 @@
+package crocmgr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+func testTransferOptions(secret string) croc.Options {
+	return croc.Options{
+		SharedSecret:  secret,
+		RelayAddress:  "127.0.0.1:9009",
+		RelayPorts:    []string{"9009"},
+		RelayPassword: "pass123",
+		Curve:         "p256",
+		NoPrompt:      true,
+	}
+}
+
+// blockingRun 返回一个阻塞到 release 关闭的 run 函数，与 croc 一样在客户端关闭后返回
+func blockingRun(release chan struct{}, err error) func(*croc.Client) error {
+	return func(client *croc.Client) error {
+		select {
+		case <-release:
+			return err
+		case <-client.Closed():
+			return errors.New("connection closed")
+		}
+	}
+}
+
+func waitDone(t *testing.T, tr *Transfer) {
+	t.Helper()
+	select {
+	case <-tr.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("transfer %s did not finish", tr.ID)
+	}
+}
+
+func TestStartTransfer_Completes(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	release := make(chan struct{})
+	tr, err := m.StartTransfer(DirectionSend, testTransferOptions("test-complete"), blockingRun(release, nil))
+	if err != nil {
+		t.Fatalf("StartTransfer failed: %v", err)
+	}
+	if tr.Client() == nil || !tr.Client().Options.IsSender {
+		t.Fatal("expected a sender client")
+	}
+	if tr.State() != lifecycle.Waiting {
+		t.Fatalf("state = %s, want waiting", tr.State())
+	}
+
+	close(release)
+	if err := tr.Wait(); err != nil {
+		t.Fatalf("Wait returned error: %v", err)
+	}
+	if tr.State() != lifecycle.Completed {
+		t.Fatalf("state = %s, want completed", tr.State())
+	}
+	if tr.FinishedAt().IsZero() {
+		t.Error("FinishedAt not set")
+	}
+
+	// 没有观察到传输过程时，完成会依次经过中间状态
+	var path []lifecycle.State
+	for _, transition := range tr.Transitions() {
+		path = append(path, transition.To)
+	}
+	want := []lifecycle.State{lifecycle.Preparing, lifecycle.Waiting, lifecycle.Transferring, lifecycle.Verifying, lifecycle.Completed}
+	if len(path) != len(want) {
+		t.Fatalf("transitions = %v, want %v", path, want)
+	}
+	for i := range want {
+		if path[i] != want[i] {
+			t.Fatalf("transitions = %v, want %v", path, want)
+		}
+	}
+	if tr.Context().Err() == nil {
+		t.Error("context should be done after finish")
+	}
+}
+
+func TestStartTransfer_Fails(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	runErr := errors.New("boom")
+	release := make(chan struct{})
+	close(release)
+	tr, err := m.StartTransfer(DirectionReceive, testTransferOptions("test-fail"), blockingRun(release, runErr))
+	if err != nil {
+		t.Fatalf("StartTransfer failed: %v", err)
+	}
+	if tr.Client().Options.IsSender {
+		t.Fatal("expected a receiver client")
+	}
+
+	if err := tr.Wait(); !errors.Is(err, runErr) {
+		t.Fatalf("Wait = %v, want %v", err, runErr)
+	}
+	if tr.State() != lifecycle.Failed {
+		t.Fatalf("state = %s, want failed", tr.State())
+	}
+}
+
+func TestCancelTransfer_OnlyAffectsOne(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	send, err := m.StartTransfer(DirectionSend, testTransferOptions("test-send"), blockingRun(release, nil))
+	if err != nil {
+		t.Fatalf("StartTransfer send failed: %v", err)
+	}
+	recv, err := m.StartTransfer(DirectionReceive, testTransferOptions("test-recv"), blockingRun(release, nil))
+	if err != nil {
+		t.Fatalf("StartTransfer receive failed: %v", err)
+	}
+
+	if err := m.CancelTransfer(send.ID); err != nil {
+		t.Fatalf("CancelTransfer failed: %v", err)
+	}
+	waitDone(t, send)
+
+	if send.State() != lifecycle.Cancelled {
+		t.Errorf("send state = %s, want cancelled", send.State())
+	}
+	if !errors.Is(send.Err(), ErrTransferCancelled) {
+		t.Errorf("send err = %v, want ErrTransferCancelled", send.Err())
+	}
+	if recv.State() != lifecycle.Waiting {
+		t.Errorf("receive state = %s, want waiting", recv.State())
+	}
+
+	active := m.ActiveTransfers()
+	if len(active) != 1 || active[0] != recv {
+		t.Errorf("ActiveTransfers = %v, want only the receive", active)
+	}
+}
+
+func TestCancelTransfer_NotFound(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	if err := m.CancelTransfer("missing"); !errors.Is(err, ErrTransferNotFound) {
+		t.Fatalf("err = %v, want ErrTransferNotFound", err)
+	}
+}
+
+func TestManagerCancel_CancelsAllTransfers(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	var transfers []*Transfer
+	for _, secret := range []string{"test-all-1", "test-all-2", "test-all-3"} {
+		tr, err := m.StartTransfer(DirectionSend, testTransferOptions(secret), blockingRun(release, nil))
+		if err != nil {
+			t.Fatalf("StartTransfer failed: %v", err)
+		}
+		transfers = append(transfers, tr)
+	}
+
+	m.Cancel()
+	for _, tr := range transfers {
+		waitDone(t, tr)
+		if tr.State() != lifecycle.Cancelled {
+			t.Errorf("transfer %s state = %s, want cancelled", tr.ID, tr.State())
+		}
+	}
+}
+
+func TestResultAfterCancelIsIgnored(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	release := make(chan struct{})
+	tr, err := m.StartTransfer(DirectionSend, testTransferOptions("test-late"), blockingRun(release, errors.New("late")))
+	if err != nil {
+		t.Fatalf("StartTransfer failed: %v", err)
+	}
+
+	tr.Cancel()
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+
+	if tr.State() != lifecycle.Cancelled {
+		t.Fatalf("state = %s, want cancelled", tr.State())
+	}
+}
+
+// TestCancel_WaitsForCroc 取消时关闭 croc 的连接，Cancel 返回时 croc 已经停止
+func TestCancel_WaitsForCroc(t *testing.T) {
+	relay := startTestRelay(t)
+	m := NewManager()
+	defer m.Close()
+
+	src := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(src, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	filesInfo, emptyFolders, totalNumberFolders, err := croc.GetFilesInfo([]string{src}, false, false, []string{})
+	if err != nil {
+		t.Fatalf("GetFilesInfo failed: %v", err)
+	}
+	options := DefaultOptions(true, "wait-"+strconv.FormatInt(time.Now().UnixNano()%100000, 10))
+	options.DisableLocal = true
+	relay.Apply(&options)
+	var stopped atomic.Bool
+	tr, err := m.StartTransfer(DirectionSend, options, func(client *croc.Client) error {
+		defer stopped.Store(true)
+		return client.Send(filesInfo, emptyFolders, totalNumberFolders)
+	})
+	if err != nil {
+		t.Fatalf("StartTransfer failed: %v", err)
+	}
+	// 没有接收方，croc 在中继的房间中等待
+	time.Sleep(500 * time.Millisecond)
+
+	cancelled := make(chan struct{})
+	go func() {
+		tr.Cancel()
+		close(cancelled)
+	}()
+	select {
+	case <-cancelled:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Cancel did not return")
+	}
+	if !stopped.Load() {
+		t.Error("croc still running after Cancel returned")
+	}
+	if tr.State() != lifecycle.Cancelled || !errors.Is(tr.Err(), ErrTransferCancelled) {
+		t.Errorf("state = %s, err = %v", tr.State(), tr.Err())
+	}
+}
+
+func TestListGetRemoveTransfers(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	release := make(chan struct{})
+	first, err := m.StartTransfer(DirectionSend, testTransferOptions("test-list-1"), blockingRun(release, nil))
+	if err != nil {
+		t.Fatalf("StartTransfer failed: %v", err)
+	}
+	second, err := m.StartTransfer(DirectionReceive, testTransferOptions("test-list-2"), blockingRun(release, nil))
+	if err != nil {
+		t.Fatalf("StartTransfer failed: %v", err)
+	}
+
+	list := m.ListTransfers()
+	if len(list) != 2 || list[0] != first || list[1] != second {
+		t.Fatalf("ListTransfers returned wrong order: %v", list)
+	}
+	if got, ok := m.GetTransfer(second.ID); !ok || got != second {
+		t.Fatal("GetTransfer did not return the second transfer")
+	}
+	if second.Code != "test-list-2" {
+		t.Errorf("Code = %q, want test-list-2", second.Code)
+	}
+
+	// 运行中的任务不能移除
+	if err := m.RemoveTransfer(first.ID); err == nil {
+		t.Fatal("expected error removing a running transfer")
+	}
+
+	close(release)
+	waitDone(t, first)
+	if err := m.RemoveTransfer(first.ID); err != nil {
+		t.Fatalf("RemoveTransfer failed: %v", err)
+	}
+	if _, ok := m.GetTransfer(first.ID); ok {
+		t.Fatal("transfer still present after remove")
+	}
+	if len(m.ListTransfers()) != 1 {
+		t.Fatalf("expected 1 transfer left, got %d", len(m.ListTransfers()))
+	}
+}
+
+func TestTransfer_StateFollowsProgress(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	tr, err := m.StartTransfer(DirectionSend, testTransferOptions("test-observe"), blockingRun(release, nil))
+	if err != nil {
+		t.Fatalf("StartTransfer failed: %v", err)
+	}
+
+	tr.observe(Progress{Connected: true, NumFiles: 1, TotalBytes: 100, BytesDone: 10})
+	if tr.State() != lifecycle.Transferring {
+		t.Fatalf("state = %s, want transferring", tr.State())
+	}
+
+	// 进度回退不会让状态后退
+	tr.observe(Progress{})
+	if tr.State() != lifecycle.Transferring {
+		t.Fatalf("state = %s, want transferring", tr.State())
+	}
+
+	tr.observe(Progress{Connected: true, NumFiles: 1, TotalBytes: 100, BytesDone: 100})
+	if tr.State() != lifecycle.Verifying {
+		t.Fatalf("state = %s, want verifying", tr.State())
+	}
+
+	tr.Cancel()
+	tr.observe(Progress{Connected: true, NumFiles: 1, TotalBytes: 100, BytesDone: 50})
+	if tr.State() != lifecycle.Cancelled {
+		t.Fatalf("state = %s, want cancelled", tr.State())
+	}
+}
@@ -0,0 +1,176 @@
+package crocmgr
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/schollz/croc/v10/src/utils"
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+// 校验算法，由发送方选择，接收方使用发送方的算法
+const (
+	HashXXHash  = "xxhash"
+	HashIMOHash = "imohash"
+	HashHighway = "highway"
+)
+
+// DefaultHashAlgorithm 默认的校验算法，与 croc 命令行一致
+const DefaultHashAlgorithm = HashXXHash
+
+// ErrInvalidHashAlgorithm 不支持的校验算法
+var ErrInvalidHashAlgorithm = errors.New("不支持的校验算法")
+
+// ErrVerificationFailed 接收的文件与发送方的校验值不一致
+var ErrVerificationFailed = errors.New("文件校验失败")
+
+// HashAlgorithm 可以选择的校验算法
+type HashAlgorithm struct {
+	Name        string
+	Description string
+}
+
+var hashAlgorithms = []HashAlgorithm{
+	{Name: HashXXHash, Description: "xxhash（完整校验，速度快）"},
+	{Name: HashIMOHash, Description: "imohash（抽样校验，大文件最快）"},
+	{Name: HashHighway, Description: "highway（完整校验，更难碰撞）"},
+}
+
+// HashAlgorithms 返回可以选择的校验算法，第一个是默认算法
+func HashAlgorithms() []HashAlgorithm {
+	return slices.Clone(hashAlgorithms)
+}
+
+// ValidateHashAlgorithm 检查校验算法是否受支持
+func ValidateHashAlgorithm(name string) error {
+	for _, a := range hashAlgorithms {
+		if a.Name == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidHashAlgorithm, name)
+}
+
+// FileCheck 一个接收文件的校验结果
+type FileCheck struct {
+	Name     string `json:"name"` // 相对接收目录的路径，按保存位置规则放到绝对路径时为绝对路径
+	Size     int64  `json:"size"`
+	Expected string `json:"expected"`         // 发送方计算的校验值
+	Actual   string `json:"actual,omitempty"` // 接收后重新计算的校验值
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"` // 无法读取文件时的原因
+}
+
+// Verification 接收完成后的校验报告
+type Verification struct {
+	Algorithm  string      `json:"algorithm"`
+	Files      []FileCheck `json:"files"`
+	Skipped    int         `json:"skipped,omitempty"` // 接收后已解压的压缩文件夹，无法校验
+	VerifiedAt time.Time   `json:"verifiedAt"`
+}
+
+// Passed 是否所有文件都校验通过
+func (v Verification) Passed() bool {
+	return len(v.Failures()) == 0
+}
+
+// Failures 返回校验失败的文件
+func (v Verification) Failures() []FileCheck {
+	var failed []FileCheck
+	for _, f := range v.Files {
+		if !f.OK {
+			failed = append(failed, f)
+		}
+	}
+	return failed
+}
+
+// Summary 返回校验结论，例如 "全部 3 个文件校验通过（xxhash）"
+func (v Verification) Summary() string {
+	var s string
+	if failed := len(v.Failures()); failed > 0 {
+		s = fmt.Sprintf("%d/%d 个文件校验失败（%s）", failed, len(v.Files), v.Algorithm)
+	} else {
+		s = fmt.Sprintf("全部 %d 个文件校验通过（%s）", len(v.Files), v.Algorithm)
+	}
+	if v.Skipped > 0 {
+		s += fmt.Sprintf("，%d 个压缩文件夹已解压，未校验", v.Skipped)
+	}
+	return s
+}
+
+// verifyFiles 用发送方的算法重新计算接收目录中的文件的校验值，与发送方的校验值比较
+// 压缩发送的文件夹在接收后已经解压并删除，只计入 Skipped；skip 返回 true 的文件没有接收，不校验。
+func verifyFiles(ctx context.Context, dir, algorithm string, files []croc.FileInfo, skip func(i int) bool) (Verification, error) {
+	if algorithm == "" {
+		algorithm = DefaultHashAlgorithm
+	}
+	v := Verification{Algorithm: algorithm}
+	for i, f := range files {
+		if err := ctx.Err(); err != nil {
+			return v, ErrTransferCancelled
+		}
+		if skip != nil && skip(i) {
+			continue
+		}
+		if f.TempFile {
+			v.Skipped++
+			continue
+		}
+		check := FileCheck{
+			Name:     path.Join(filepath.ToSlash(f.FolderRemote), f.Name),
+			Size:     f.Size,
+			Expected: hex.EncodeToString(f.Hash),
+		}
+		sum, err := utils.HashFile(receivedPath(dir, check.Name), algorithm)
+		if err != nil {
+			check.Error = err.Error()
+		} else {
+			check.Actual = hex.EncodeToString(sum)
+			check.OK = bytes.Equal(sum, f.Hash)
+		}
+		v.Files = append(v.Files, check)
+	}
+	v.VerifiedAt = time.Now()
+	return v, nil
+}
+
+// Verification 返回接收完成后的校验报告，没有校验时返回 false
+func (t *Transfer) Verification() (Verification, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.verification == nil {
+		return Verification{}, false
+	}
+	return *t.verification, true
+}
+
+// verify 接收完成后进入校验状态，校验写入接收目录的文件
+// croc 只在开始接收前比较已有文件的校验值，不校验接收到的内容。
+// 文本传输不需要校验；有文件不一致时返回 ErrVerificationFailed，报告同时保存在任务中。
+func (t *Transfer) verify() error {
+	client := t.client
+	if t.Direction != DirectionReceive || t.dir == "" || isTextTransfer(client) || t.machine.State().IsFinished() {
+		return nil
+	}
+	t.machine.Advance(lifecycle.Verifying, "正在校验文件")
+	v, err := verifyFiles(t.ctx, t.dir, client.Options.HashAlgorithm, client.FilesToTransfer, t.skipped)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.verification = &v
+	t.mu.Unlock()
+	if !v.Passed() {
+		return fmt.Errorf("%w: %s", ErrVerificationFailed, v.Summary())
+	}
+	return nil
+}
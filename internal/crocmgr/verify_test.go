@@ -0,0 +1,209 @@
+package crocmgr
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/schollz/croc/v10/src/utils"
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+// writeHashedFile 写入文件并返回发送方会记录的文件信息
+func writeHashedFile(t *testing.T, dir, folder, name, content, algorithm string) croc.FileInfo {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, folder), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, folder, name)
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := utils.HashFile(file, algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return croc.FileInfo{Name: name, FolderRemote: folder, Size: int64(len(content)), Hash: sum}
+}
+
+func TestVerifyFiles(t *testing.T) {
+	for _, a := range HashAlgorithms() {
+		dir := t.TempDir()
+		files := []croc.FileInfo{
+			writeHashedFile(t, dir, ".", "a.txt", "hello", a.Name),
+			writeHashedFile(t, dir, "sub", "b.txt", "world", a.Name),
+			{Name: "folder.zip", FolderRemote: ".", TempFile: true},
+		}
+		v, err := verifyFiles(context.Background(), dir, a.Name, files, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !v.Passed() || len(v.Files) != 2 || v.Skipped != 1 || v.Files[1].Name != "sub/b.txt" {
+			t.Fatalf("%s: verification = %+v", a.Name, v)
+		}
+		if want := "全部 2 个文件校验通过（" + a.Name + "），1 个压缩文件夹已解压，未校验"; v.Summary() != want {
+			t.Errorf("Summary() = %q, want %q", v.Summary(), want)
+		}
+
+		// 内容被改动或文件缺失时校验失败
+		os.WriteFile(filepath.Join(dir, "a.txt"), []byte("HELLO"), 0o644)
+		os.Remove(filepath.Join(dir, "sub", "b.txt"))
+		v, _ = verifyFiles(context.Background(), dir, a.Name, files, nil)
+		failed := v.Failures()
+		if v.Passed() || len(failed) != 2 || failed[0].Actual == failed[0].Expected || failed[1].Error == "" {
+			t.Errorf("%s: failures = %+v", a.Name, failed)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := verifyFiles(ctx, t.TempDir(), "", []croc.FileInfo{{Name: "a"}}, nil); !errors.Is(err, ErrTransferCancelled) {
+		t.Errorf("cancelled verification = %v", err)
+	}
+}
+
+func TestValidateHashAlgorithm(t *testing.T) {
+	if HashAlgorithms()[0].Name != DefaultHashAlgorithm {
+		t.Error("the default algorithm should be listed first")
+	}
+	for _, a := range HashAlgorithms() {
+		if err := ValidateHashAlgorithm(a.Name); err != nil {
+			t.Errorf("ValidateHashAlgorithm(%s) = %v", a.Name, err)
+		}
+	}
+	if err := ValidateHashAlgorithm("crc32"); !errors.Is(err, ErrInvalidHashAlgorithm) {
+		t.Errorf("ValidateHashAlgorithm(crc32) = %v", err)
+	}
+
+	m := NewManager()
+	defer m.Close()
+	options := testTransferOptions("hash-invalid")
+	options.HashAlgorithm = "crc32"
+	if _, err := m.StartTransfer(DirectionSend, options, blockingRun(nil, nil)); !errors.Is(err, ErrInvalidHashAlgorithm) {
+		t.Errorf("StartTransfer = %v, want ErrInvalidHashAlgorithm", err)
+	}
+}
+
+func TestTransfer_VerifiesReceivedFiles(t *testing.T) {
+	dir := chdirTemp(t)
+	m := NewManager()
+	defer m.Close()
+	events := newEventRecorder()
+	m.Events().Subscribe(events.handle)
+
+	good := writeHashedFile(t, dir, ".", "good.txt", "hello", HashHighway)
+	bad := writeHashedFile(t, dir, ".", "bad.txt", "world", HashHighway)
+	os.WriteFile(filepath.Join(dir, "bad.txt"), []byte("w0rld"), 0o644)
+
+	release := make(chan struct{})
+	tr, err := m.StartTransfer(DirectionReceive, testTransferOptions("verify-files"), blockingRun(release, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟接收完两个文件，croc 使用发送方的校验算法
+	client := tr.Client()
+	client.Options.HashAlgorithm = HashHighway
+	client.FilesToTransfer = []croc.FileInfo{good, bad}
+	client.Step1ChannelSecured = true
+	client.Step2FileInfoTransferred = true
+	client.FilesToTransferCurrentNum = 1
+	client.TotalSent = bad.Size
+	close(release)
+
+	if err := tr.Wait(); !errors.Is(err, ErrVerificationFailed) {
+		t.Fatalf("Wait = %v, want ErrVerificationFailed", err)
+	}
+	verifying := false
+	for _, transition := range tr.Transitions() {
+		verifying = verifying || transition.To == lifecycle.Verifying
+	}
+	if !verifying {
+		t.Error("transfer should pass through verifying")
+	}
+	e := events.waitFor(t, EventFailed)
+	if e.Verification == nil || e.Verification.Algorithm != HashHighway || len(e.Verification.Failures()) != 1 {
+		t.Fatalf("failed event verification = %+v", e.Verification)
+	}
+	// 继续接收时重新接收校验失败的文件
+	r, ok := tr.Resume()
+	if !ok || !r.Files[0].Done() || r.Files[1].BytesDone != 0 {
+		t.Fatalf("resume = %+v", r)
+	}
+	r.Dir = dir
+	r.prepare()
+	if _, err := os.Stat(filepath.Join(dir, "bad.txt")); !os.IsNotExist(err) {
+		t.Errorf("failed file should be removed before resuming: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "good.txt")); err != nil {
+		t.Errorf("verified file should be kept: %v", err)
+	}
+}
+
+// TestManager_VerifyReceive 通过本机中继传输后接收方使用发送方选择的算法校验
+func TestManager_VerifyReceive(t *testing.T) {
+	relay := startTestRelay(t)
+	srcDir := t.TempDir()
+	dstDir := chdirTemp(t)
+	src := filepath.Join(srcDir, "data.txt")
+	if err := os.WriteFile(src, []byte("verify me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code := "verify-" + strconv.FormatInt(time.Now().UnixNano()%100000, 10)
+	m := NewManager()
+	defer m.Close()
+	events := newEventRecorder()
+	m.Events().Subscribe(func(e Event) {
+		if e.Direction == DirectionReceive {
+			events.handle(e)
+		}
+	})
+
+	sendOptions := DefaultOptions(true, code)
+	sendOptions.DisableLocal = true
+	sendOptions.HashAlgorithm = HashIMOHash
+	relay.Apply(&sendOptions)
+	sender, err := m.StartSendPaths(sendOptions, []string{src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	receiveOptions := DefaultOptions(false, code)
+	receiveOptions.DisableLocal = true
+	relay.Apply(&receiveOptions)
+	receiver, err := m.StartReceive(receiveOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-receiver.Done():
+	case <-time.After(30 * time.Second):
+		sender.Cancel()
+		receiver.Cancel()
+		t.Fatal("transfer timed out")
+	}
+	if err := receiver.Err(); err != nil {
+		t.Fatalf("receive failed: %v", err)
+	}
+	sender.Wait()
+
+	v, ok := receiver.Verification()
+	if !ok || !v.Passed() || v.Algorithm != HashIMOHash || len(v.Files) != 1 || v.Files[0].Name != "data.txt" {
+		t.Fatalf("verification = %+v", v)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "data.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if e := events.waitFor(t, EventCompleted); e.Verification == nil || !e.Verification.Passed() {
+		t.Errorf("completed event verification = %+v", e.Verification)
+	}
+	if _, ok := sender.Verification(); ok {
+		t.Error("sender should not verify")
+	}
+}
@@ -0,0 +1,147 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrInvalidTransition 不允许的状态转换
+var ErrInvalidTransition = errors.New("非法的状态转换")
+
+// Transition 一次状态转换事件
+type Transition struct {
+	From    State     `json:"from,omitempty"` // 初始状态的 From 为空
+	To      State     `json:"to"`
+	At      time.Time `json:"at"`
+	Message string    `json:"message,omitempty"`
+}
+
+// Machine 传输状态机，记录每次转换及其时间，可以被多个 goroutine 使用
+type Machine struct {
+	mu          sync.Mutex
+	state       State
+	transitions []Transition
+	listeners   []func(Transition)
+}
+
+// NewMachine 创建处于准备状态的状态机
+func NewMachine() *Machine {
+	return &Machine{
+		state:       Preparing,
+		transitions: []Transition{{To: Preparing, At: time.Now()}},
+	}
+}
+
+// Restore 根据保存的状态和转换记录恢复状态机
+func Restore(state State, transitions []Transition) *Machine {
+	m := &Machine{
+		state:       state,
+		transitions: append([]Transition(nil), transitions...),
+	}
+	if len(m.transitions) == 0 {
+		m.transitions = []Transition{{To: state, At: time.Now()}}
+	}
+	return m
+}
+
+// State 返回当前状态
+func (m *Machine) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Transitions 返回所有转换记录的副本，第一条为初始状态
+func (m *Machine) Transitions() []Transition {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Transition(nil), m.transitions...)
+}
+
+// EnteredAt 返回最近一次进入 state 的时间
+func (m *Machine) EnteredAt(state State) (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.transitions) - 1; i >= 0; i-- {
+		if m.transitions[i].To == state {
+			return m.transitions[i].At, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// OnTransition 注册转换监听，每次转换成功后在调用方的 goroutine 中调用
+func (m *Machine) OnTransition(fn func(Transition)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// To 直接转换到 to，不允许的转换返回 ErrInvalidTransition
+func (m *Machine) To(to State, message string) error {
+	m.mu.Lock()
+	tr, err := m.step(to, message)
+	listeners := m.listeners
+	m.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	notify(listeners, tr)
+	return nil
+}
+
+// Advance 沿正常传输路径前进到 to，逐个记录中间状态
+// 例如传输太快没有观察到传输中时，可以从等待直接前进到完成。
+// to 与当前状态相同时什么也不做；失败和取消直接转换；
+// 后退或从结束状态离开都会返回 ErrInvalidTransition。
+func (m *Machine) Advance(to State, message string) error {
+	m.mu.Lock()
+	if m.state == to {
+		m.mu.Unlock()
+		return nil
+	}
+
+	var done []Transition
+	from, target := pathIndex(m.state), pathIndex(to)
+	if from >= 0 && target > from {
+		for _, next := range happyPath[from+1 : target] {
+			tr, err := m.step(next, "")
+			if err != nil {
+				m.mu.Unlock()
+				return err
+			}
+			done = append(done, tr)
+		}
+	}
+	tr, err := m.step(to, message)
+	if err == nil {
+		done = append(done, tr)
+	}
+	listeners := m.listeners
+	m.mu.Unlock()
+
+	for _, tr := range done {
+		notify(listeners, tr)
+	}
+	return err
+}
+
+// step 执行一次转换，调用方必须持有锁
+func (m *Machine) step(to State, message string) (Transition, error) {
+	if !m.state.CanTransition(to) {
+		return Transition{}, fmt.Errorf("%w: %s → %s", ErrInvalidTransition, m.state, to)
+	}
+	tr := Transition{From: m.state, To: to, At: time.Now(), Message: message}
+	m.state = to
+	m.transitions = append(m.transitions, tr)
+	return tr, nil
+}
+
+func notify(listeners []func(Transition), tr Transition) {
+	for _, fn := range listeners {
+		fn(tr)
+	}
+}
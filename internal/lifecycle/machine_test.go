@@ -0,0 +1,179 @@
+package lifecycle
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestMachine_HappyPath(t *testing.T) {
+	m := NewMachine()
+	if m.State() != Preparing {
+		t.Fatalf("initial state = %s, want preparing", m.State())
+	}
+
+	for _, to := range []State{Waiting, Transferring, Verifying, Completed} {
+		if err := m.To(to, ""); err != nil {
+			t.Fatalf("To(%s) failed: %v", to, err)
+		}
+	}
+	if m.State() != Completed {
+		t.Fatalf("state = %s, want completed", m.State())
+	}
+
+	transitions := m.Transitions()
+	if len(transitions) != 5 {
+		t.Fatalf("len(transitions) = %d, want 5", len(transitions))
+	}
+	if transitions[0].From != "" || transitions[0].To != Preparing {
+		t.Errorf("first transition = %+v, want initial preparing", transitions[0])
+	}
+	for _, s := range []State{Preparing, Waiting, Transferring, Verifying, Completed} {
+		if at, ok := m.EnteredAt(s); !ok || at.IsZero() {
+			t.Errorf("EnteredAt(%s) missing", s)
+		}
+	}
+	if _, ok := m.EnteredAt(Failed); ok {
+		t.Error("EnteredAt(failed) should be missing")
+	}
+}
+
+func TestMachine_RejectsIllegalTransitions(t *testing.T) {
+	tests := []struct {
+		name string
+		path []State
+		to   State
+	}{
+		{"completed to transferring", []State{Waiting, Transferring, Verifying, Completed}, Transferring},
+		{"completed to failed", []State{Waiting, Transferring, Verifying, Completed}, Failed},
+		{"cancelled to waiting", []State{Cancelled}, Waiting},
+		{"failed to cancelled", []State{Waiting, Failed}, Cancelled},
+		{"skip waiting", nil, Transferring},
+		{"skip verifying", []State{Waiting, Transferring}, Completed},
+		{"transferring back to waiting", []State{Waiting, Transferring}, Waiting},
+		{"same state", []State{Waiting}, Waiting},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMachine()
+			for _, s := range tt.path {
+				if err := m.To(s, ""); err != nil {
+					t.Fatalf("To(%s) failed: %v", s, err)
+				}
+			}
+			before := m.State()
+			err := m.To(tt.to, "")
+			if !errors.Is(err, ErrInvalidTransition) {
+				t.Fatalf("To(%s) = %v, want ErrInvalidTransition", tt.to, err)
+			}
+			if m.State() != before {
+				t.Errorf("state changed to %s after rejected transition", m.State())
+			}
+		})
+	}
+}
+
+func TestMachine_Advance(t *testing.T) {
+	m := NewMachine()
+	if err := m.To(Waiting, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var seen []State
+	m.OnTransition(func(tr Transition) {
+		seen = append(seen, tr.To)
+	})
+
+	if err := m.Advance(Completed, "done"); err != nil {
+		t.Fatalf("Advance(completed) failed: %v", err)
+	}
+	want := []State{Transferring, Verifying, Completed}
+	if len(seen) != len(want) {
+		t.Fatalf("seen = %v, want %v", seen, want)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("seen = %v, want %v", seen, want)
+		}
+	}
+
+	transitions := m.Transitions()
+	if last := transitions[len(transitions)-1]; last.Message != "done" {
+		t.Errorf("last message = %q, want done", last.Message)
+	}
+
+	// 相同状态不做任何事
+	if err := m.Advance(Completed, ""); err != nil {
+		t.Errorf("Advance to current state returned %v", err)
+	}
+	if len(seen) != 3 {
+		t.Errorf("no-op advance notified listeners: %v", seen)
+	}
+
+	// 结束后不能再转换
+	if err := m.Advance(Cancelled, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Advance(cancelled) after completed = %v, want ErrInvalidTransition", err)
+	}
+}
+
+func TestMachine_AdvanceBackwardsRejected(t *testing.T) {
+	m := NewMachine()
+	if err := m.Advance(Verifying, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Advance(Transferring, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Advance backwards = %v, want ErrInvalidTransition", err)
+	}
+	if m.State() != Verifying {
+		t.Fatalf("state = %s, want verifying", m.State())
+	}
+}
+
+func TestRestore(t *testing.T) {
+	m := NewMachine()
+	if err := m.Advance(Transferring, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := Restore(m.State(), m.Transitions())
+	if restored.State() != Transferring {
+		t.Fatalf("restored state = %s, want transferring", restored.State())
+	}
+	if len(restored.Transitions()) != len(m.Transitions()) {
+		t.Fatal("restored transitions differ")
+	}
+	if err := restored.To(Waiting, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("restored machine accepted illegal transition: %v", err)
+	}
+
+	empty := Restore(Waiting, nil)
+	if _, ok := empty.EnteredAt(Waiting); !ok {
+		t.Error("Restore without transitions should record the current state")
+	}
+}
+
+func TestState_UnmarshalLegacy(t *testing.T) {
+	tests := map[string]State{
+		`"in_progress"`: Transferring,
+		`"sending"`:     Transferring,
+		`"receiving"`:   Transferring,
+		`"connecting"`:  Waiting,
+		`"waiting"`:     Waiting,
+		`"completed"`:   Completed,
+		`"whatever"`:    State("whatever"),
+	}
+	for input, want := range tests {
+		var s State
+		if err := json.Unmarshal([]byte(input), &s); err != nil {
+			t.Fatalf("Unmarshal(%s) failed: %v", input, err)
+		}
+		if s != want {
+			t.Errorf("Unmarshal(%s) = %s, want %s", input, s, want)
+		}
+	}
+
+	if _, err := ParseState("whatever"); err == nil {
+		t.Error("ParseState should reject unknown states")
+	}
+}
@@ -0,0 +1,98 @@
+// Package lifecycle 定义发送、接收和历史记录共用的传输状态机
+package lifecycle
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// State 传输状态
+type State string
+
+const (
+	Preparing    State = "preparing"    // 准备中：生成接收码、读取文件信息
+	Waiting      State = "waiting"      // 等待对端连接
+	Transferring State = "transferring" // 正在传输数据
+	Verifying    State = "verifying"    // 数据已传完，等待校验结果
+	Completed    State = "completed"
+	Failed       State = "failed"
+	Cancelled    State = "cancelled"
+)
+
+// allowed 每个状态允许转换到的下一个状态，结束状态不能再转换
+var allowed = map[State][]State{
+	Preparing:    {Waiting, Failed, Cancelled},
+	Waiting:      {Transferring, Failed, Cancelled},
+	Transferring: {Verifying, Failed, Cancelled},
+	Verifying:    {Completed, Failed, Cancelled},
+}
+
+// happyPath 正常传输依次经过的状态
+var happyPath = []State{Preparing, Waiting, Transferring, Verifying, Completed}
+
+// legacyStates 旧版本历史记录中使用的状态字符串
+var legacyStates = map[string]State{
+	"in_progress": Transferring,
+	"sending":     Transferring,
+	"receiving":   Transferring,
+	"connecting":  Waiting,
+}
+
+// IsValid 是否为已知状态
+func (s State) IsValid() bool {
+	switch s {
+	case Preparing, Waiting, Transferring, Verifying, Completed, Failed, Cancelled:
+		return true
+	}
+	return false
+}
+
+// IsFinished 是否已经结束（完成、失败或取消）
+func (s State) IsFinished() bool {
+	return s == Completed || s == Failed || s == Cancelled
+}
+
+// CanTransition 是否允许从 s 直接转换到 to
+func (s State) CanTransition(to State) bool {
+	for _, next := range allowed[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// pathIndex 返回状态在正常传输路径上的位置，不在路径上时返回 -1
+func pathIndex(s State) int {
+	for i, p := range happyPath {
+		if p == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseState 解析状态字符串，兼容旧版本的状态名
+func ParseState(s string) (State, error) {
+	if state := State(s); state.IsValid() {
+		return state, nil
+	}
+	if state, ok := legacyStates[s]; ok {
+		return state, nil
+	}
+	return "", fmt.Errorf("未知的传输状态: %q", s)
+}
+
+// UnmarshalJSON 读取时把旧版本的状态名转换为新状态，未知的值原样保留
+func (s *State) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if state, err := ParseState(raw); err == nil {
+		*s = state
+	} else {
+		*s = State(raw)
+	}
+	return nil
+}
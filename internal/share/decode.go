@@ -0,0 +1,53 @@
+package share
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // 支持识别 JPEG 截图和照片
+	_ "image/png"
+	"io"
+	"os"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// ErrNoQRCode 图片中没有可以识别的二维码
+var ErrNoQRCode = errors.New("没有识别到二维码")
+
+// DecodeQRCode 识别图片中的二维码并解析为接收信息
+// 图片可以来自文件，也可以是摄像头的一帧画面。
+func DecodeQRCode(img image.Image) (Invite, error) {
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return Invite{}, fmt.Errorf("%w: %v", ErrNoQRCode, err)
+	}
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	}
+	result, err := qrcode.NewQRCodeReader().Decode(bitmap, hints)
+	if err != nil {
+		return Invite{}, fmt.Errorf("%w: %v", ErrNoQRCode, err)
+	}
+	return ParseInvite(result.GetText())
+}
+
+// DecodeQRCodeReader 从 PNG 或 JPEG 图片数据中识别接收信息
+func DecodeQRCodeReader(r io.Reader) (Invite, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return Invite{}, fmt.Errorf("读取图片失败: %w", err)
+	}
+	return DecodeQRCode(img)
+}
+
+// DecodeQRCodeFile 从图片文件中识别接收信息
+func DecodeQRCodeFile(path string) (Invite, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Invite{}, fmt.Errorf("打开图片失败: %w", err)
+	}
+	defer f.Close()
+	return DecodeQRCodeReader(f)
+}
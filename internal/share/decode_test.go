@@ -0,0 +1,96 @@
+package share
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// testInvite 使用内置中继时的接收信息，覆盖所有字段
+var testInvite = Invite{
+	Code:     "1234-red-fox-moon",
+	Relay:    "192.168.1.10:9009",
+	Ports:    []string{"9009", "9010", "9011"},
+	Password: "lan-secret",
+}
+
+func equalInvite(a, b Invite) bool {
+	return a.Code == b.Code && a.Relay == b.Relay && a.Relay6 == b.Relay6 &&
+		slices.Equal(a.Ports, b.Ports) && a.Password == b.Password && a.OnlyLocal == b.OnlyLocal
+}
+
+func TestDecodeQRCode_RoundTrip(t *testing.T) {
+	data, err := testInvite.QRCode(QRCodeSize)
+	if err != nil {
+		t.Fatalf("QRCode failed: %v", err)
+	}
+	got, err := DecodeQRCodeReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeQRCodeReader failed: %v", err)
+	}
+	if !equalInvite(got, testInvite) {
+		t.Errorf("decoded %+v, want %+v", got, testInvite)
+	}
+}
+
+// TestDecodeQRCodeFile_Fixture 识别发送端生成并保存的二维码图片
+func TestDecodeQRCodeFile_Fixture(t *testing.T) {
+	got, err := DecodeQRCodeFile(filepath.Join("testdata", "invite.png"))
+	if err != nil {
+		t.Fatalf("DecodeQRCodeFile failed: %v", err)
+	}
+	if !equalInvite(got, testInvite) {
+		t.Errorf("decoded %+v, want %+v", got, testInvite)
+	}
+}
+
+// TestDecodeQRCode_Screenshot 二维码只占截图的一部分，并经过 JPEG 压缩
+func TestDecodeQRCode_Screenshot(t *testing.T) {
+	data, err := testInvite.QRCode(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qr, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	screen := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	draw.Draw(screen, screen.Bounds(), &image.Uniform{color.RGBA{0xee, 0xee, 0xf0, 0xff}}, image.Point{}, draw.Src)
+	draw.Draw(screen, qr.Bounds().Add(image.Pt(300, 200)), qr, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, screen, &jpeg.Options{Quality: 80}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeQRCodeReader(&buf)
+	if err != nil {
+		t.Fatalf("DecodeQRCodeReader failed: %v", err)
+	}
+	if !equalInvite(got, testInvite) {
+		t.Errorf("decoded %+v, want %+v", got, testInvite)
+	}
+}
+
+func TestDecodeQRCode_Errors(t *testing.T) {
+	blank := image.NewGray(image.Rect(0, 0, 200, 200))
+	draw.Draw(blank, blank.Bounds(), image.White, image.Point{}, draw.Src)
+	if _, err := DecodeQRCode(blank); !errors.Is(err, ErrNoQRCode) {
+		t.Errorf("blank image = %v, want ErrNoQRCode", err)
+	}
+
+	if _, err := DecodeQRCodeReader(bytes.NewReader([]byte("not an image"))); err == nil {
+		t.Error("expected error for invalid image data")
+	}
+	if _, err := DecodeQRCodeFile(filepath.Join(t.TempDir(), "missing.png")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file = %v", err)
+	}
+}
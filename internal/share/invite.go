@@ -0,0 +1,189 @@
+// Package share 把接收码和中继设置编码为可以分享的链接和二维码
+package share
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+// Scheme mocroc 链接的协议名
+const Scheme = "mocroc"
+
+// receiveHost 接收链接的主机部分: mocroc://receive?code=...
+const receiveHost = "receive"
+
+// ErrInvalidInvite 无法识别的接收信息
+var ErrInvalidInvite = errors.New("无效的接收信息")
+
+// Invite 接收方需要的全部信息：接收码和发送方使用的中继
+// 编码为 mocroc://receive?code=...&relay=...&ports=...&pass=...，
+// 与默认值相同的中继设置不写入链接。
+type Invite struct {
+	Code      string
+	Relay     string   // 中继地址，可以带端口
+	Relay6    string   // IPv6 中继地址
+	Ports     []string // 中继端口
+	Password  string   // 中继密码
+	OnlyLocal bool     // 仅使用局域网
+}
+
+// NewInvite 从发送方的 croc 配置创建接收信息
+// 内置中继的本机地址对接收方没有意义，替换为本机的局域网地址。
+func NewInvite(options croc.Options) Invite {
+	inv := Invite{
+		Code:      options.SharedSecret,
+		Relay:     options.RelayAddress,
+		Relay6:    options.RelayAddress6,
+		Ports:     append([]string(nil), options.RelayPorts...),
+		Password:  options.RelayPassword,
+		OnlyLocal: options.OnlyLocal,
+	}
+	if host, port, err := net.SplitHostPort(inv.Relay); err == nil && isLoopback(host) {
+		if n, err := strconv.Atoi(port); err == nil {
+			if addresses := crocmgr.LANAddresses(n); len(addresses) > 0 {
+				inv.Relay = addresses[0]
+			}
+		}
+	}
+	return inv
+}
+
+// IsInviteURI 判断文本是否为 mocroc 链接，不校验内容
+// 系统打开链接时把它作为启动参数传给 mocroc。
+func IsInviteURI(s string) bool {
+	prefix := Scheme + "://"
+	s = strings.TrimSpace(s)
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// ParseInvite 解析 mocroc 链接，也接受只有接收码的文本
+// 链接中没有的中继设置使用默认值。
+func ParseInvite(s string) (Invite, error) {
+	s = strings.TrimSpace(s)
+	inv := Invite{
+		Relay:    crocmgr.DefaultRelayAddress,
+		Ports:    crocmgr.DefaultRelayPorts(),
+		Password: crocmgr.DefaultRelayPassword,
+	}
+	if s == "" {
+		return inv, fmt.Errorf("%w: 内容为空", ErrInvalidInvite)
+	}
+
+	if !strings.Contains(s, "://") {
+		if strings.ContainsAny(s, " \t\r\n") {
+			return inv, fmt.Errorf("%w: %q", ErrInvalidInvite, s)
+		}
+		inv.Code = s
+		return inv, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return inv, fmt.Errorf("%w: %v", ErrInvalidInvite, err)
+	}
+	if !strings.EqualFold(u.Scheme, Scheme) || u.Host != receiveHost {
+		return inv, fmt.Errorf("%w: 不支持的链接 %s", ErrInvalidInvite, s)
+	}
+
+	q := u.Query()
+	inv.Code = strings.TrimSpace(q.Get("code"))
+	if inv.Code == "" {
+		return inv, fmt.Errorf("%w: 缺少接收码", ErrInvalidInvite)
+	}
+	if q.Has("relay") {
+		inv.Relay = q.Get("relay")
+	}
+	inv.Relay6 = q.Get("relay6")
+	if q.Has("ports") {
+		inv.Ports = crocmgr.ParseRelayPorts(q.Get("ports"))
+	}
+	if q.Has("pass") {
+		inv.Password = q.Get("pass")
+	}
+	inv.OnlyLocal = q.Get("local") == "1"
+
+	options := croc.Options{}
+	inv.Apply(&options)
+	if err := crocmgr.ValidateRelayOptions(options); err != nil {
+		return inv, fmt.Errorf("%w: %v", ErrInvalidInvite, err)
+	}
+	return inv, nil
+}
+
+// URI 返回 mocroc 链接
+func (inv Invite) URI() string {
+	q := url.Values{}
+	q.Set("code", inv.Code)
+	if inv.Relay != crocmgr.DefaultRelayAddress {
+		q.Set("relay", inv.Relay)
+	}
+	if inv.Relay6 != "" {
+		q.Set("relay6", inv.Relay6)
+	}
+	if !slices.Equal(inv.Ports, crocmgr.DefaultRelayPorts()) {
+		q.Set("ports", strings.Join(inv.Ports, ","))
+	}
+	if inv.Password != crocmgr.DefaultRelayPassword {
+		q.Set("pass", inv.Password)
+	}
+	if inv.OnlyLocal {
+		q.Set("local", "1")
+	}
+	u := url.URL{Scheme: Scheme, Host: receiveHost, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// Apply 把接收码和中继设置写入接收方的 croc 配置
+func (inv Invite) Apply(options *croc.Options) {
+	options.SharedSecret = inv.Code
+	options.RelayAddress = crocmgr.RelayDialAddress(inv.Relay, inv.Ports)
+	options.RelayAddress6 = crocmgr.RelayDialAddress(inv.Relay6, inv.Ports)
+	options.RelayPorts = append([]string(nil), inv.Ports...)
+	options.RelayPassword = inv.Password
+	options.OnlyLocal = inv.OnlyLocal
+	if inv.OnlyLocal {
+		options.DisableLocal = false
+	}
+}
+
+// Profile 返回接收信息中的中继设置，可以在中继设置中显示或保存
+func (inv Invite) Profile(name string) crocmgr.RelayProfile {
+	return crocmgr.RelayProfile{
+		Name:      name,
+		Address:   inv.Relay,
+		Address6:  inv.Relay6,
+		Ports:     append([]string(nil), inv.Ports...),
+		Password:  inv.Password,
+		OnlyLocal: inv.OnlyLocal,
+	}
+}
+
+// RelayDescription 返回中继设置的简短说明
+func (inv Invite) RelayDescription() string {
+	switch {
+	case inv.OnlyLocal:
+		return "仅局域网"
+	case inv.Relay == crocmgr.DefaultRelayAddress && inv.Relay6 == "":
+		return crocmgr.PublicRelayProfileName
+	case inv.Relay == "":
+		return inv.Relay6
+	default:
+		return inv.Relay
+	}
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
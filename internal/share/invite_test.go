@@ -0,0 +1,168 @@
+package share
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+func TestInvite_URIRoundTrip(t *testing.T) {
+	cases := []Invite{
+		{
+			Code:     "1234-red-fox-moon",
+			Relay:    crocmgr.DefaultRelayAddress,
+			Ports:    crocmgr.DefaultRelayPorts(),
+			Password: crocmgr.DefaultRelayPassword,
+		},
+		{
+			Code:     "5678-blue-cat-sun",
+			Relay:    "192.168.1.10:9009",
+			Relay6:   "[fe80::1]:9009",
+			Ports:    []string{"9009", "9010"},
+			Password: "p&ss word",
+		},
+		{
+			Code:      "9012-green-owl-star",
+			Ports:     []string{"9009"},
+			Password:  crocmgr.DefaultRelayPassword,
+			OnlyLocal: true,
+		},
+	}
+	for _, want := range cases {
+		uri := want.URI()
+		if !strings.HasPrefix(uri, "mocroc://receive?") {
+			t.Errorf("URI() = %q", uri)
+		}
+		got, err := ParseInvite(uri)
+		if err != nil {
+			t.Errorf("ParseInvite(%q) failed: %v", uri, err)
+			continue
+		}
+		if got.Code != want.Code || got.Relay != want.Relay || got.Relay6 != want.Relay6 ||
+			!slices.Equal(got.Ports, want.Ports) || got.Password != want.Password || got.OnlyLocal != want.OnlyLocal {
+			t.Errorf("round trip of %q = %+v, want %+v", uri, got, want)
+		}
+	}
+}
+
+func TestInvite_URIOmitsDefaults(t *testing.T) {
+	inv := Invite{
+		Code:     "1234-red-fox-moon",
+		Relay:    crocmgr.DefaultRelayAddress,
+		Ports:    crocmgr.DefaultRelayPorts(),
+		Password: crocmgr.DefaultRelayPassword,
+	}
+	if uri := inv.URI(); uri != "mocroc://receive?code=1234-red-fox-moon" {
+		t.Errorf("URI() = %q", uri)
+	}
+	if desc := inv.RelayDescription(); desc != crocmgr.PublicRelayProfileName {
+		t.Errorf("RelayDescription() = %q", desc)
+	}
+}
+
+func TestParseInvite(t *testing.T) {
+	inv, err := ParseInvite("  1234-red-fox-moon \n")
+	if err != nil || inv.Code != "1234-red-fox-moon" || inv.Relay != crocmgr.DefaultRelayAddress {
+		t.Errorf("bare code = %+v, %v", inv, err)
+	}
+
+	for _, s := range []string{
+		"",
+		"two words",
+		"https://example.com/?code=x",
+		"mocroc://send?code=x",
+		"mocroc://receive?relay=1.2.3.4",
+		"mocroc://receive?code=x&ports=abc",
+		"mocroc://receive?code=x&relay=",
+	} {
+		if _, err := ParseInvite(s); !errors.Is(err, ErrInvalidInvite) {
+			t.Errorf("ParseInvite(%q) = %v, want ErrInvalidInvite", s, err)
+		}
+	}
+}
+
+func TestIsInviteURI(t *testing.T) {
+	for s, want := range map[string]bool{
+		"mocroc://receive?code=1234-red-fox-moon": true,
+		" MoCroc://receive?code=x\n":              true,
+		"mocroc://send":                           true,
+		"1234-red-fox-moon":                       false,
+		"https://example.com/?code=x":             false,
+		"mocroc:":                                 false,
+		"":                                        false,
+	} {
+		if got := IsInviteURI(s); got != want {
+			t.Errorf("IsInviteURI(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+// TestParseInvite_Encoded 系统打开链接时参数可能经过转义，大小写也可能被改写
+func TestParseInvite_Encoded(t *testing.T) {
+	inv, err := ParseInvite("MOCROC://receive?code=1234-red-fox-moon&relay=10.0.0.2%3A9009&ports=9009%2C9010&pass=a%26b&local=1")
+	if err != nil {
+		t.Fatalf("ParseInvite failed: %v", err)
+	}
+	want := Invite{
+		Code:      "1234-red-fox-moon",
+		Relay:     "10.0.0.2:9009",
+		Ports:     []string{"9009", "9010"},
+		Password:  "a&b",
+		OnlyLocal: true,
+	}
+	if !equalInvite(inv, want) {
+		t.Errorf("ParseInvite = %+v, want %+v", inv, want)
+	}
+}
+
+func TestNewInvite_LocalRelay(t *testing.T) {
+	options := crocmgr.DefaultOptions(true, "1234-red-fox-moon")
+	options.RelayAddress = "127.0.0.1:9009"
+	options.RelayPorts = []string{"9009", "9010"}
+
+	inv := NewInvite(options)
+	if inv.Code != "1234-red-fox-moon" || !slices.Equal(inv.Ports, options.RelayPorts) {
+		t.Errorf("NewInvite = %+v", inv)
+	}
+	// 有局域网地址时替换本机地址
+	if lan := crocmgr.LANAddresses(9009); len(lan) > 0 && inv.Relay != lan[0] {
+		t.Errorf("relay = %q, want %q", inv.Relay, lan[0])
+	}
+}
+
+func TestInvite_QRCode(t *testing.T) {
+	inv := Invite{Code: "1234-red-fox-moon", Relay: "192.168.1.10:9009", Ports: []string{"9009"}}
+	data, err := inv.QRCode(256)
+	if err != nil {
+		t.Fatalf("QRCode failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("not a PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 256 || b.Dy() != 256 {
+		t.Errorf("image size = %v", b)
+	}
+}
+
+// TestInvite_ApplyJoinsMainPort 链接中的中继地址没有端口时连接主端口
+func TestInvite_ApplyJoinsMainPort(t *testing.T) {
+	inv := Invite{Code: "1234-red-fox-moon", Relay: "relay.example.com", Ports: []string{"9109", "9110"}, Password: "secret"}
+	var options croc.Options
+	inv.Apply(&options)
+	if options.RelayAddress != "relay.example.com:9109" {
+		t.Errorf("RelayAddress = %q, want relay.example.com:9109", options.RelayAddress)
+	}
+
+	inv.Relay = "relay.example.com:9200"
+	inv.Apply(&options)
+	if options.RelayAddress != "relay.example.com:9200" {
+		t.Errorf("RelayAddress = %q, want the explicit port", options.RelayAddress)
+	}
+}
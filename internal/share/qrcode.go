@@ -0,0 +1,19 @@
+package share
+
+import (
+	"fmt"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// QRCodeSize 二维码图片的默认边长（像素）
+const QRCodeSize = 512
+
+// QRCode 把接收信息编码为二维码 PNG 图片
+func (inv Invite) QRCode(size int) ([]byte, error) {
+	png, err := qrcode.Encode(inv.URI(), qrcode.Medium, size)
+	if err != nil {
+		return nil, fmt.Errorf("生成二维码失败: %w", err)
+	}
+	return png, nil
+}
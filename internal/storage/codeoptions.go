@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"github.com/shapled/mocroc/internal/codephrase"
+)
+
+// preferences 键
+const (
+	codeWordlistKey = "code_wordlist"
+	codeWordsKey    = "code_words"
+)
+
+// CodeOptions 读取接收码生成设置，没有保存过或设置已失效时使用默认设置
+func CodeOptions(prefs Preferences) codephrase.Options {
+	options := codephrase.Options{
+		Wordlist: prefs.String(codeWordlistKey),
+		Words:    prefs.Int(codeWordsKey),
+	}
+	if options.Validate() != nil {
+		return codephrase.DefaultOptions()
+	}
+	return options
+}
+
+// SetCodeOptions 保存接收码生成设置
+func SetCodeOptions(prefs Preferences, options codephrase.Options) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	prefs.SetString(codeWordlistKey, options.Wordlist)
+	prefs.SetInt(codeWordsKey, options.Words)
+	return nil
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/shapled/mocroc/internal/codephrase"
+)
+
+func TestCodeOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preferences.json")
+	prefs, err := OpenFilePreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := CodeOptions(prefs); got != codephrase.DefaultOptions() {
+		t.Errorf("CodeOptions() = %+v, want defaults", got)
+	}
+
+	want := codephrase.Options{Wordlist: codephrase.WordlistShort, Words: 5}
+	if err := SetCodeOptions(prefs, want); err != nil {
+		t.Fatalf("SetCodeOptions failed: %v", err)
+	}
+	if err := SetCodeOptions(prefs, codephrase.Options{Wordlist: "klingon", Words: 3}); !errors.Is(err, codephrase.ErrInvalidOptions) {
+		t.Errorf("invalid options = %v", err)
+	}
+
+	// 重新打开后读到保存的设置
+	prefs, err = OpenFilePreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := CodeOptions(prefs); got != want {
+		t.Errorf("CodeOptions() = %+v, want %+v", got, want)
+	}
+
+	// 词表被移除等情况下回到默认设置
+	prefs.SetString(codeWordlistKey, "removed")
+	if got := CodeOptions(prefs); got != codephrase.DefaultOptions() {
+		t.Errorf("CodeOptions() = %+v, want defaults", got)
+	}
+}
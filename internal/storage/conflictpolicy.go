@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+// conflictPolicyKey 接收时同名文件处理方式的 preferences 键
+const conflictPolicyKey = "receive_conflict_policy"
+
+// ConflictPolicy 读取同名文件的处理方式，没有保存过或设置已失效时使用默认方式
+func ConflictPolicy(prefs Preferences) crocmgr.ConflictPolicy {
+	policy, err := crocmgr.ParseConflictPolicy(prefs.String(conflictPolicyKey))
+	if err != nil {
+		return crocmgr.DefaultConflictPolicy
+	}
+	return policy
+}
+
+// SetConflictPolicy 保存同名文件的处理方式
+func SetConflictPolicy(prefs Preferences, policy crocmgr.ConflictPolicy) error {
+	if _, err := crocmgr.ParseConflictPolicy(string(policy)); err != nil {
+		return err
+	}
+	prefs.SetString(conflictPolicyKey, string(policy))
+	return nil
+}
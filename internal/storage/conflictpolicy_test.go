@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+func TestConflictPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preferences.json")
+	prefs, err := OpenFilePreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ConflictPolicy(prefs); got != crocmgr.DefaultConflictPolicy {
+		t.Errorf("ConflictPolicy() = %s, want default", got)
+	}
+	if err := SetConflictPolicy(prefs, crocmgr.ConflictAsk); err != nil {
+		t.Fatalf("SetConflictPolicy failed: %v", err)
+	}
+	if err := SetConflictPolicy(prefs, "merge"); !errors.Is(err, crocmgr.ErrInvalidConflictPolicy) {
+		t.Errorf("invalid policy = %v", err)
+	}
+
+	// 重新打开后读到保存的设置
+	prefs, err = OpenFilePreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ConflictPolicy(prefs); got != crocmgr.ConflictAsk {
+		t.Errorf("ConflictPolicy() = %s, want ask", got)
+	}
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+// Get 返回指定 ID 的记录
+func (hs *HistoryStorage) Get(id string) (HistoryItem, bool) {
+	hs.refresh()
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+	item, ok := hs.cache[id]
+	return item, ok
+}
+
+// ErrorMessage 返回失败或取消的原因，没有记录原因时为空
+func (item HistoryItem) ErrorMessage() string {
+	if item.Status != lifecycle.Failed && item.Status != lifecycle.Cancelled {
+		return ""
+	}
+	for i := len(item.Transitions) - 1; i >= 0; i-- {
+		if t := item.Transitions[i]; t.To == item.Status {
+			return t.Message
+		}
+	}
+	return ""
+}
+
+// TransferTime 返回实际传输数据的时间，从开始传输到结束
+// 没有状态转换记录时使用包括等待对端在内的总耗时。
+func (item HistoryItem) TransferTime() time.Duration {
+	total := time.Duration(item.Duration) * time.Second
+	if !item.Status.IsFinished() || len(item.Transitions) == 0 {
+		return total
+	}
+	end := item.Transitions[len(item.Transitions)-1].At
+	for _, t := range item.Transitions {
+		if t.To == lifecycle.Transferring {
+			return end.Sub(t.At)
+		}
+	}
+	return total
+}
+
+// AverageSpeed 返回平均速度（字节每秒），只有传输完成的记录才能计算
+func (item HistoryItem) AverageSpeed() float64 {
+	d := item.TransferTime()
+	if item.Status != lifecycle.Completed || d <= 0 {
+		return 0
+	}
+	return float64(item.TotalBytes()) / d.Seconds()
+}
+
+// SendPaths 返回发送时选择的文件和取消勾选的文件，旧记录从断点信息中读取
+func (item HistoryItem) SendPaths() (paths, skip []string) {
+	if len(item.Paths) > 0 {
+		return item.Paths, item.Skip
+	}
+	if item.Resume != nil {
+		return item.Resume.Paths, item.Resume.Skip
+	}
+	return nil, nil
+}
+
+// Folder 返回文件所在的文件夹：接收的保存位置或发送的第一个文件所在的文件夹，未知时为空
+func (item HistoryItem) Folder() string {
+	if item.Type == "send" {
+		if paths, _ := item.SendPaths(); len(paths) > 0 {
+			return filepath.Dir(paths[0])
+		}
+		return ""
+	}
+	if item.Manifest != nil && item.Manifest.SavePath != "" {
+		return item.Manifest.SavePath
+	}
+	if item.Resume != nil && item.Resume.Dir != "" {
+		return item.Resume.Dir
+	}
+	for _, f := range item.ReceivedFiles {
+		if f.Path != "" {
+			return filepath.Dir(f.Path)
+		}
+	}
+	return ""
+}
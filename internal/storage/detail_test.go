@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+// TestHistoryItemDetails 测试详情页使用的错误原因、传输时间、平均速度和所在文件夹
+func TestHistoryItemDetails(t *testing.T) {
+	start := time.Date(2026, 10, 13, 9, 0, 0, 0, time.UTC)
+	completed := HistoryItem{
+		Type:     "receive",
+		Status:   lifecycle.Completed,
+		Duration: 30,
+		Manifest: &crocmgr.Manifest{TotalBytes: 100 << 20, SavePath: filepath.Join("data", "downloads")},
+		Transitions: []lifecycle.Transition{
+			{To: lifecycle.Waiting, At: start},
+			{From: lifecycle.Waiting, To: lifecycle.Transferring, At: start.Add(20 * time.Second)},
+			{From: lifecycle.Transferring, To: lifecycle.Verifying, At: start.Add(28 * time.Second)},
+			{From: lifecycle.Verifying, To: lifecycle.Completed, At: start.Add(30 * time.Second)},
+		},
+	}
+	// 等待对端的时间不计入传输时间
+	if d := completed.TransferTime(); d != 10*time.Second {
+		t.Errorf("传输时间为 %v，期望 10s", d)
+	}
+	if speed := completed.AverageSpeed(); speed != 10<<20 {
+		t.Errorf("平均速度为 %v，期望 10 MB/s", speed)
+	}
+	if dir := completed.Folder(); dir != completed.Manifest.SavePath {
+		t.Errorf("所在文件夹为 %q，期望保存位置", dir)
+	}
+	if msg := completed.ErrorMessage(); msg != "" {
+		t.Errorf("完成的记录不应有错误原因: %q", msg)
+	}
+
+	failed := HistoryItem{
+		Type:     "send",
+		Status:   lifecycle.Failed,
+		Duration: 5,
+		Resume:   &crocmgr.Resume{Paths: []string{filepath.Join("home", "a.txt")}},
+		Transitions: []lifecycle.Transition{
+			{To: lifecycle.Waiting, At: start},
+			{From: lifecycle.Waiting, To: lifecycle.Failed, At: start.Add(5 * time.Second), Message: "连接中继失败"},
+		},
+	}
+	if msg := failed.ErrorMessage(); msg != "连接中继失败" {
+		t.Errorf("错误原因为 %q", msg)
+	}
+	if speed := failed.AverageSpeed(); speed != 0 {
+		t.Errorf("失败的记录不应计算速度: %v", speed)
+	}
+	// 没有开始传输时使用总耗时
+	if d := failed.TransferTime(); d != 5*time.Second {
+		t.Errorf("传输时间为 %v，期望 5s", d)
+	}
+	// 旧记录从断点信息中读取发送的文件
+	if dir := failed.Folder(); dir != "home" {
+		t.Errorf("所在文件夹为 %q，期望 home", dir)
+	}
+}
+
+// TestGet 测试按 ID 读取记录
+func TestGet(t *testing.T) {
+	storage := setupTestStorage(t)
+	id, err := storage.Add(HistoryItem{Type: "send", FileName: "a.txt", Paths: []string{"/tmp/a.txt"}})
+	if err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+	item, ok := storage.Get(id)
+	if !ok || item.FileName != "a.txt" || len(item.Paths) != 1 {
+		t.Errorf("读取的记录不正确: %+v, %v", item, ok)
+	}
+	if _, ok := storage.Get("missing"); ok {
+		t.Error("不存在的记录应返回 false")
+	}
+}
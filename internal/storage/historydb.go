@@ -0,0 +1,473 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// HistoryFileName 历史记录文件的名称，位于应用数据目录中
+const HistoryFileName = "history.jsonl"
+
+// HistoryBackend 历史记录的持久化存储
+// Load 按添加顺序返回所有记录；Put 添加记录或替换相同 ID 的记录，替换时保持原来的顺序。
+// Refresh 读取其他进程写入的修改，有修改时返回 true，之后 Load 返回最新的记录。
+type HistoryBackend interface {
+	Load() ([]HistoryItem, error)
+	Refresh() (bool, error)
+	Put(item HistoryItem) error
+	Delete(id string) error
+	Clear() error
+	Close() error
+	// Owner 返回本进程写入传输中的记录时使用的所有者标识，Alive 判断标识对应的进程是否仍在运行
+	Owner() string
+	Alive(owner string) bool
+}
+
+// historyOp 历史记录文件中的一行
+type historyOp struct {
+	Op     string          `json:"op"` // put 或 delete
+	ID     string          `json:"id"`
+	Record json.RawMessage `json:"record,omitempty"`
+}
+
+// compactMinOps 文件中的操作数超过记录数的两倍并且不少于该值时压缩
+const compactMinOps = 64
+
+// FileBackend 以 JSON Lines 格式追加写入的历史记录文件
+// 每次修改追加一行并立即同步到磁盘；中途退出留下的不完整的行在下次打开时截掉，
+// 无法解析的行被跳过。记录的顺序由文件重放得到，不单独保存索引。
+// 修改积累到一定数量后把当前记录写入临时文件再替换原文件。
+// 界面和命令行可能同时打开同一个文件，追加和压缩都在锁文件的排他锁中进行；
+// 每个进程在文件旁的 .owners 目录中持有自己的所有者文件，其他进程据此判断传输中的记录是否已经中断。
+type FileBackend struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	lock    *os.File          // 锁文件，与历史记录文件在同一目录
+	owner   *ownerLock        // 本进程的所有者文件
+	stat    os.FileInfo       // 最后一次读取或写入后的文件信息，用于发现其他进程的修改
+	ops     int               // 文件中的行数
+	records map[string][]byte // 记录 ID 到文件中 put 行的映射
+	order   []string          // 记录的添加顺序
+}
+
+// OpenFileBackend 打开历史记录文件，文件不存在时创建
+func OpenFileBackend(path string) (*FileBackend, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("创建数据目录失败: %w", err)
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("打开历史记录锁文件失败: %w", err)
+	}
+	b := &FileBackend{path: path, lock: lock}
+	if b.owner, err = openOwnerLock(path + ".owners"); err != nil {
+		b.Close()
+		return nil, err
+	}
+	err = b.locked(func() error {
+		dirty, err := b.replay()
+		if err != nil {
+			return err
+		}
+		if dirty || b.needsCompact() {
+			if err := b.compact(); err != nil {
+				return err
+			}
+		}
+		if b.file == nil {
+			if err := b.openFile(); err != nil {
+				return err
+			}
+			// 文件不存在时刚刚创建
+			b.remember()
+		}
+		return nil
+	})
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// locked 在锁文件的排他锁中执行 fn，其他进程持有锁时等待
+func (b *FileBackend) locked(fn func() error) error {
+	if err := lockFile(b.lock); err != nil {
+		return fmt.Errorf("锁定历史记录失败: %w", err)
+	}
+	defer unlockFile(b.lock)
+	return fn()
+}
+
+// replay 读取文件并重放其中的修改，返回文件中是否有需要清理的内容
+func (b *FileBackend) replay() (dirty bool, err error) {
+	b.records = make(map[string][]byte)
+	b.order = nil
+	b.ops = 0
+
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+
+	invalid := 0
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			// 写入时中途退出，最后一行不完整
+			log.Printf("历史记录文件末尾有不完整的记录，已丢弃 %d 字节\n", len(data))
+			dirty = true
+			break
+		}
+		line := data[:i+1]
+		data = data[i+1:]
+		b.ops++
+		if !b.apply(line) {
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		log.Printf("跳过了历史记录文件中 %d 行无法解析的内容\n", invalid)
+		dirty = true
+	}
+	b.remember()
+	return dirty, nil
+}
+
+// remember 记录文件当前的状态，调用时必须持有锁文件的锁
+func (b *FileBackend) remember() {
+	b.stat, _ = os.Stat(b.path)
+}
+
+// changed 文件在上次读取或写入之后是否被其他进程修改或替换
+// 其他进程只追加或替换文件，比较大小、修改时间和是否为同一个文件即可。
+func (b *FileBackend) changed() bool {
+	info, err := os.Stat(b.path)
+	if err != nil || b.stat == nil {
+		return (err == nil) != (b.stat != nil)
+	}
+	return !os.SameFile(info, b.stat) || info.Size() != b.stat.Size() || !info.ModTime().Equal(b.stat.ModTime())
+}
+
+// catchUp 文件被其他进程修改过时重新读取，调用时必须持有锁文件的锁
+func (b *FileBackend) catchUp() error {
+	if !b.changed() {
+		return nil
+	}
+	_, err := b.replay()
+	return err
+}
+
+// Refresh 读取其他进程（界面或命令行）写入的修改
+func (b *FileBackend) Refresh() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.changed() {
+		return false, nil
+	}
+	return true, b.locked(b.catchUp)
+}
+
+// apply 应用文件中的一行，无法解析时返回 false
+func (b *FileBackend) apply(line []byte) bool {
+	var op historyOp
+	if err := json.Unmarshal(line, &op); err != nil || op.ID == "" {
+		return false
+	}
+	switch op.Op {
+	case "put":
+		if len(op.Record) == 0 {
+			return false
+		}
+		if _, exists := b.records[op.ID]; !exists {
+			b.order = append(b.order, op.ID)
+		}
+		b.records[op.ID] = slices.Clone(line)
+	case "delete":
+		if _, exists := b.records[op.ID]; exists {
+			delete(b.records, op.ID)
+			b.order = slices.DeleteFunc(b.order, func(id string) bool { return id == op.ID })
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// openFile 以追加方式打开文件
+func (b *FileBackend) openFile() error {
+	f, err := os.OpenFile(b.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("打开历史记录失败: %w", err)
+	}
+	b.file = f
+	return nil
+}
+
+// Load 按添加顺序返回所有记录
+func (b *FileBackend) Load() ([]HistoryItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	items := make([]HistoryItem, 0, len(b.order))
+	for _, id := range b.order {
+		var op struct {
+			Record HistoryItem `json:"record"`
+		}
+		if err := json.Unmarshal(b.records[id], &op); err != nil {
+			log.Printf("解析历史记录 %s 失败: %v\n", id, err)
+			continue
+		}
+		items = append(items, op.Record)
+	}
+	return items, nil
+}
+
+// Put 保存记录
+func (b *FileBackend) Put(item HistoryItem) error {
+	record, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("编码JSON失败: %w", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.locked(func() error {
+		if err := b.catchUp(); err != nil {
+			return err
+		}
+		return b.appendOp(historyOp{Op: "put", ID: item.ID, Record: record})
+	})
+}
+
+// Delete 删除记录，记录不存在时不做任何事
+// 先读取其他进程的修改，可以删除其他进程打开文件之后添加的记录。
+func (b *FileBackend) Delete(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.locked(func() error {
+		if err := b.catchUp(); err != nil {
+			return err
+		}
+		if _, exists := b.records[id]; !exists {
+			return nil
+		}
+		return b.appendOp(historyOp{Op: "delete", ID: id})
+	})
+}
+
+// Clear 删除所有记录
+func (b *FileBackend) Clear() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.records = make(map[string][]byte)
+	b.order = nil
+	return b.locked(b.writeFile)
+}
+
+// Close 关闭文件和锁文件
+func (b *FileBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var err error
+	if b.file != nil {
+		err = b.file.Close()
+		b.file = nil
+	}
+	if b.lock != nil {
+		b.lock.Close()
+		b.lock = nil
+	}
+	if b.owner != nil {
+		b.owner.close()
+		b.owner = nil
+	}
+	return err
+}
+
+// Owner 返回本进程的所有者标识
+func (b *FileBackend) Owner() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.owner == nil {
+		return ""
+	}
+	return b.owner.name
+}
+
+// Alive 判断写入记录的进程是否仍在运行，没有所有者标识的旧记录按已经退出处理
+func (b *FileBackend) Alive(owner string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.owner != nil && b.owner.alive(owner)
+}
+
+// appendOp 追加一行并同步到磁盘，写入失败时截掉写了一半的内容
+// 调用时必须持有锁文件的锁。
+func (b *FileBackend) appendOp(op historyOp) error {
+	line, err := json.Marshal(op)
+	if err != nil {
+		return fmt.Errorf("编码JSON失败: %w", err)
+	}
+	line = append(line, '\n')
+	if err := b.reopenIfReplaced(); err != nil {
+		return err
+	}
+	// 另一个进程可能追加过内容，以写入前的实际长度为准
+	info, err := b.file.Stat()
+	if err != nil {
+		return fmt.Errorf("读取历史记录失败: %w", err)
+	}
+
+	if _, err := b.file.Write(line); err != nil {
+		b.file.Truncate(info.Size())
+		return fmt.Errorf("写入历史记录失败: %w", err)
+	}
+	if err := b.file.Sync(); err != nil {
+		return fmt.Errorf("写入历史记录失败: %w", err)
+	}
+	b.ops++
+	b.apply(line)
+	b.remember()
+
+	if b.needsCompact() {
+		if err := b.compact(); err != nil {
+			// 修改已经写入，压缩失败不影响这次保存
+			log.Printf("压缩历史记录失败: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// reopenIfReplaced 文件被另一个进程（界面或命令行）压缩替换后重新打开
+func (b *FileBackend) reopenIfReplaced() error {
+	if b.file == nil {
+		return b.openFile()
+	}
+	opened, err := b.file.Stat()
+	if err != nil {
+		return fmt.Errorf("读取历史记录失败: %w", err)
+	}
+	current, err := os.Stat(b.path)
+	if err == nil && os.SameFile(opened, current) {
+		return nil
+	}
+	b.file.Close()
+	b.file = nil
+	return b.openFile()
+}
+
+func (b *FileBackend) needsCompact() bool {
+	return b.ops >= compactMinOps && b.ops > 2*len(b.records)
+}
+
+// compact 重新读取文件，包括其他进程追加的修改，然后只保留每条记录的最新内容
+func (b *FileBackend) compact() error {
+	if _, err := b.replay(); err != nil {
+		return err
+	}
+	return b.writeFile()
+}
+
+// writeFile 把当前记录写入临时文件再替换原文件，然后重新打开
+func (b *FileBackend) writeFile() error {
+	var buf bytes.Buffer
+	for _, id := range b.order {
+		buf.Write(b.records[id])
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), ".history-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("写入历史记录失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入历史记录失败: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入历史记录失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入历史记录失败: %w", err)
+	}
+
+	if b.file != nil {
+		b.file.Close()
+		b.file = nil
+	}
+	if err := os.Rename(tmp.Name(), b.path); err != nil {
+		return fmt.Errorf("替换历史记录文件失败: %w", err)
+	}
+	syncDir(filepath.Dir(b.path))
+	b.remember()
+
+	b.ops = len(b.order)
+	return b.openFile()
+}
+
+// syncDir 同步目录，确保替换文件后目录项已经写入磁盘；部分系统不支持，忽略错误
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// memoryBackend 只保存在内存中的历史记录，无法打开历史记录文件时使用
+type memoryBackend struct {
+	mu    sync.Mutex
+	items []HistoryItem
+}
+
+func (m *memoryBackend) Load() ([]HistoryItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.items), nil
+}
+
+// Refresh 内存中的记录只有本进程修改
+func (m *memoryBackend) Refresh() (bool, error) { return false, nil }
+
+func (m *memoryBackend) Put(item HistoryItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := slices.IndexFunc(m.items, func(it HistoryItem) bool { return it.ID == item.ID }); i >= 0 {
+		m.items[i] = item
+	} else {
+		m.items = append(m.items, item)
+	}
+	return nil
+}
+
+func (m *memoryBackend) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items = slices.DeleteFunc(m.items, func(it HistoryItem) bool { return it.ID == id })
+	return nil
+}
+
+func (m *memoryBackend) Clear() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items = nil
+	return nil
+}
+
+func (m *memoryBackend) Close() error { return nil }
+
+// Owner 内存中的记录只属于本进程，不需要标识
+func (m *memoryBackend) Owner() string { return "" }
+
+func (m *memoryBackend) Alive(owner string) bool { return false }
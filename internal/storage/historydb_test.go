@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// loadIDs 返回按顺序加载的记录 ID
+func loadIDs(t *testing.T, b HistoryBackend) []string {
+	t.Helper()
+	items, err := b.Load()
+	if err != nil {
+		t.Fatalf("加载记录失败: %v", err)
+	}
+	var ids []string
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+// TestFileBackendRecovery 测试中途退出留下的不完整内容在打开时被清理
+func TestFileBackendRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", HistoryFileName)
+	b, err := OpenFileBackend(path)
+	if err != nil {
+		t.Fatalf("打开历史记录失败: %v", err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if err := b.Put(HistoryItem{ID: id, FileName: id + ".txt"}); err != nil {
+			t.Fatalf("保存记录失败: %v", err)
+		}
+	}
+	// 替换记录时保持原来的顺序
+	if err := b.Put(HistoryItem{ID: "a", FileName: "a2.txt"}); err != nil {
+		t.Fatalf("保存记录失败: %v", err)
+	}
+	if err := b.Delete("b"); err != nil {
+		t.Fatalf("删除记录失败: %v", err)
+	}
+	b.Close()
+
+	// 一行损坏的内容和一条写了一半的记录
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("not json\n")
+	f.WriteString(`{"op":"put","id":"d","record":{"id":"d","fileNa`)
+	f.Close()
+
+	b, err = OpenFileBackend(path)
+	if err != nil {
+		t.Fatalf("重新打开历史记录失败: %v", err)
+	}
+	defer b.Close()
+	items, _ := b.Load()
+	if len(items) != 2 || items[0].ID != "a" || items[0].FileName != "a2.txt" || items[1].ID != "c" {
+		t.Fatalf("恢复的记录不正确: %+v", items)
+	}
+
+	// 清理后的文件只包含有效的记录，可以继续追加
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("not json")) || !bytes.HasSuffix(data, []byte("\n")) {
+		t.Errorf("损坏的内容没有被清理: %s", data)
+	}
+	if err := b.Put(HistoryItem{ID: "e"}); err != nil {
+		t.Fatalf("保存记录失败: %v", err)
+	}
+	reopened, err := OpenFileBackend(path)
+	if err != nil {
+		t.Fatalf("重新打开历史记录失败: %v", err)
+	}
+	defer reopened.Close()
+	if ids := loadIDs(t, reopened); len(ids) != 3 || ids[2] != "e" {
+		t.Errorf("追加的记录没有被保存: %v", ids)
+	}
+}
+
+// TestFileBackendCompact 测试修改积累后压缩文件，另一个进程追加的记录不会丢失
+func TestFileBackendCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HistoryFileName)
+	b, err := OpenFileBackend(path)
+	if err != nil {
+		t.Fatalf("打开历史记录失败: %v", err)
+	}
+	defer b.Close()
+	// 模拟命令行同时打开同一个文件
+	other, err := OpenFileBackend(path)
+	if err != nil {
+		t.Fatalf("打开历史记录失败: %v", err)
+	}
+	defer other.Close()
+
+	if err := other.Put(HistoryItem{ID: "cli"}); err != nil {
+		t.Fatalf("保存记录失败: %v", err)
+	}
+	// 写入前先读取另一个进程追加的一行，再追加 compactMinOps-1 行时压缩
+	for i := 0; i < compactMinOps-1; i++ {
+		if err := b.Put(HistoryItem{ID: "gui", Duration: int64(i)}); err != nil {
+			t.Fatalf("保存记录失败: %v", err)
+		}
+	}
+	if b.ops != 2 {
+		t.Errorf("期望压缩后文件中有 2 行，实际为 %d", b.ops)
+	}
+
+	// 压缩替换文件后另一个进程追加到新文件
+	if err := other.Put(HistoryItem{ID: "cli2"}); err != nil {
+		t.Fatalf("保存记录失败: %v", err)
+	}
+	reopened, err := OpenFileBackend(path)
+	if err != nil {
+		t.Fatalf("重新打开历史记录失败: %v", err)
+	}
+	defer reopened.Close()
+	items, _ := reopened.Load()
+	if len(items) != 3 || items[0].ID != "cli" || items[1].ID != "gui" || items[1].Duration != compactMinOps-2 || items[2].ID != "cli2" {
+		t.Errorf("压缩后的记录不正确: %+v", items)
+	}
+
+	if err := reopened.Clear(); err != nil {
+		t.Fatalf("清除记录失败: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("清除后文件应为空: %v, %v", info, err)
+	}
+}
+
+// TestFileBackendConcurrentWriters 测试两个进程同时追加和压缩时不丢失记录
+func TestFileBackendConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HistoryFileName)
+	const perWriter = 5 * compactMinOps
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, name := range []string{"gui", "cli"} {
+		// 每个后端单独打开文件，与两个进程一样各自持有锁文件
+		b, err := OpenFileBackend(path)
+		if err != nil {
+			t.Fatalf("打开历史记录失败: %v", err)
+		}
+		defer b.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				// 每添加一条记录更新两次状态记录，让修改积累到需要压缩
+				for _, item := range []HistoryItem{
+					{ID: fmt.Sprintf("%s-%d", name, i)},
+					{ID: name, Duration: int64(i)},
+					{ID: name, Duration: int64(i) + 1},
+				} {
+					if err := b.Put(item); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("保存记录失败: %v", err)
+	}
+
+	reopened, err := OpenFileBackend(path)
+	if err != nil {
+		t.Fatalf("重新打开历史记录失败: %v", err)
+	}
+	defer reopened.Close()
+	if ids := loadIDs(t, reopened); len(ids) != 2*perWriter+2 {
+		t.Errorf("期望 %d 条记录，实际为 %d", 2*perWriter+2, len(ids))
+	}
+}
+
+// TestFileBackendRefresh 测试读取和删除前看到另一个进程在打开文件之后添加的记录
+func TestFileBackendRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HistoryFileName)
+	gui, err := OpenFileBackend(path)
+	if err != nil {
+		t.Fatalf("打开历史记录失败: %v", err)
+	}
+	defer gui.Close()
+	cli, err := OpenFileBackend(path)
+	if err != nil {
+		t.Fatalf("打开历史记录失败: %v", err)
+	}
+	defer cli.Close()
+
+	if changed, err := gui.Refresh(); changed || err != nil {
+		t.Errorf("文件没有修改时 Refresh = %v, %v", changed, err)
+	}
+	if err := cli.Put(HistoryItem{ID: "cli"}); err != nil {
+		t.Fatalf("保存记录失败: %v", err)
+	}
+	if changed, err := gui.Refresh(); !changed || err != nil {
+		t.Errorf("另一个进程追加后 Refresh = %v, %v", changed, err)
+	}
+	if ids := loadIDs(t, gui); len(ids) != 1 || ids[0] != "cli" {
+		t.Errorf("没有读取到另一个进程的记录: %v", ids)
+	}
+
+	// 删除另一个进程刚添加的记录时先读取文件，不会因为内存中没有而什么都不做
+	if err := cli.Put(HistoryItem{ID: "cli2"}); err != nil {
+		t.Fatalf("保存记录失败: %v", err)
+	}
+	if err := gui.Delete("cli2"); err != nil {
+		t.Fatalf("删除记录失败: %v", err)
+	}
+	cli.Refresh()
+	if ids := loadIDs(t, cli); len(ids) != 1 || ids[0] != "cli" {
+		t.Errorf("删除后的记录不正确: %v", ids)
+	}
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"encoding/json"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+// ignoreRulesKey 发送文件夹时忽略规则的 preferences 键
+const ignoreRulesKey = "send_ignore_rules"
+
+// IgnoreRules 读取忽略规则，没有保存过或设置已失效时使用默认规则
+func IgnoreRules(prefs Preferences) crocmgr.IgnoreRules {
+	data := prefs.String(ignoreRulesKey)
+	if data == "" {
+		return crocmgr.DefaultIgnoreRules()
+	}
+	var rules crocmgr.IgnoreRules
+	if err := json.Unmarshal([]byte(data), &rules); err != nil || rules.Validate() != nil {
+		return crocmgr.DefaultIgnoreRules()
+	}
+	return rules
+}
+
+// SetIgnoreRules 保存忽略规则
+func SetIgnoreRules(prefs Preferences, rules crocmgr.IgnoreRules) error {
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	prefs.SetString(ignoreRulesKey, string(data))
+	return nil
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preferences.json")
+	prefs, err := OpenFilePreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := IgnoreRules(prefs); !slices.Equal(got.Presets, crocmgr.DefaultIgnoreRules().Presets) {
+		t.Errorf("IgnoreRules() = %+v, want default rules", got)
+	}
+	// 关闭所有内置规则后不能回到默认规则
+	rules := crocmgr.IgnoreRules{Patterns: []string{"*.log"}, GitIgnore: true}
+	if err := SetIgnoreRules(prefs, rules); err != nil {
+		t.Fatalf("SetIgnoreRules failed: %v", err)
+	}
+	if err := SetIgnoreRules(prefs, crocmgr.IgnoreRules{Presets: []string{"unknown"}}); !errors.Is(err, crocmgr.ErrInvalidIgnoreRule) {
+		t.Errorf("invalid rules = %v", err)
+	}
+
+	prefs, err = OpenFilePreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := IgnoreRules(prefs)
+	if len(got.Presets) != 0 || !slices.Equal(got.Patterns, rules.Patterns) || !got.GitIgnore {
+		t.Errorf("IgnoreRules() = %+v, want %+v", got, rules)
+	}
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// 旧版本把历史记录保存在偏好设置中：每条记录一个键，另有记录 ID 列表和 ID 计数器
+const (
+	legacyKeysKey      = "history_keys"
+	legacyRecordPrefix = "history_"
+	legacyCounterKey   = "history_id_counter"
+)
+
+// legacyHistory 偏好设置中的旧版本历史记录，只在迁移到历史记录文件时读取
+type legacyHistory struct {
+	prefs Preferences
+}
+
+// ids 返回偏好设置中记录的 ID，没有旧版本的历史记录时返回 nil
+func (l legacyHistory) ids() []string {
+	data := l.prefs.String(legacyKeysKey)
+	if data == "" {
+		return nil
+	}
+	var ids []string
+	if err := json.Unmarshal([]byte(data), &ids); err != nil {
+		log.Printf("解析旧版本的记录key列表失败: %v\n", err)
+		return nil
+	}
+	return ids
+}
+
+// load 按添加顺序读取记录，跳过无法解析的记录
+func (l legacyHistory) load() []HistoryItem {
+	var items []HistoryItem
+	for _, id := range l.ids() {
+		data := l.prefs.String(legacyRecordPrefix + id)
+		if data == "" {
+			continue
+		}
+		var item HistoryItem
+		if err := json.Unmarshal([]byte(data), &item); err != nil {
+			log.Printf("解析旧版本的记录 %s 失败: %v\n", id, err)
+			continue
+		}
+		if item.ID == "" {
+			item.ID = id
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// remove 从偏好设置中删除旧版本的历史记录，其他设置保持不变
+func (l legacyHistory) remove() {
+	for _, id := range l.ids() {
+		l.prefs.RemoveValue(legacyRecordPrefix + id)
+	}
+	l.prefs.RemoveValue(legacyKeysKey)
+	l.prefs.RemoveValue(legacyCounterKey)
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+// HistoryVersion 当前历史记录的格式版本
+// 0 是只记录显示用的文件名、大小和文件数的旧记录，1 增加了文件清单 Manifest。
+const HistoryVersion = 1
+
+// SetManifest 记录文件清单，同时更新显示用的大小、文件数和文件夹数
+func (item *HistoryItem) SetManifest(m crocmgr.Manifest) {
+	item.Manifest = &m
+	item.FileSize = FormatFileSize(m.TotalBytes)
+	item.NumFiles = len(m.Files)
+	item.NumFolders = m.NumFolders
+}
+
+// TotalBytes 返回传输的字节数，旧记录没有清单时从显示的大小估算
+func (item HistoryItem) TotalBytes() int64 {
+	if item.Manifest != nil {
+		return item.Manifest.TotalBytes
+	}
+	n, _ := ParseFileSize(item.FileSize)
+	return n
+}
+
+// migrate 把旧版本的记录升级到当前版本，返回记录是否有改动
+func (item *HistoryItem) migrate() bool {
+	if item.Version >= HistoryVersion {
+		return false
+	}
+	// 文本传输没有清单，旧记录只能从显示的文件名判断
+	if item.Manifest == nil && item.Text == "" && item.FileName != "文本内容" {
+		item.Manifest = legacyManifest(*item)
+	}
+	item.Version = HistoryVersion
+	return true
+}
+
+// legacyManifest 根据旧记录中的校验报告、断点信息和接收位置重建文件清单
+// 旧记录没有修改时间；只有显示的大小时清单中没有文件，无法得知大小时返回 nil。
+func legacyManifest(item HistoryItem) *crocmgr.Manifest {
+	m := &crocmgr.Manifest{NumFolders: item.NumFolders}
+	switch {
+	case item.Verification != nil && len(item.Verification.Files) > 0:
+		m.HashAlgorithm = item.Verification.Algorithm
+		for _, f := range item.Verification.Files {
+			m.Files = append(m.Files, crocmgr.ManifestFile{Path: f.Name, Size: f.Size, Hash: f.Expected})
+		}
+	case item.Resume != nil && len(item.Resume.Files) > 0:
+		for _, f := range item.Resume.Files {
+			name := f.Name
+			if f.Source != "" {
+				name = f.Source
+			}
+			m.Files = append(m.Files, crocmgr.ManifestFile{Path: name, Size: f.Size})
+		}
+	}
+	for _, f := range m.Files {
+		m.TotalBytes += f.Size
+	}
+	if len(m.Files) == 0 {
+		n, ok := ParseFileSize(item.FileSize)
+		if !ok {
+			return nil
+		}
+		m.TotalBytes = n
+	}
+
+	if item.Resume != nil && item.Resume.Dir != "" {
+		m.SavePath = item.Resume.Dir
+	} else if len(item.ReceivedFiles) > 0 {
+		// 按发送方路径保存的文件去掉相对路径就是接收目录
+		f := item.ReceivedFiles[0]
+		if p := filepath.ToSlash(f.Path); strings.HasSuffix(p, "/"+f.Name) {
+			m.SavePath = filepath.FromSlash(strings.TrimSuffix(p, "/"+f.Name))
+		}
+	}
+	return m
+}
+
+// fileSizeUnits FormatFileSize 使用的单位对应的 1024 的幂
+var fileSizeUnits = map[string]int{"B": 0, "KB": 1, "MB": 2, "GB": 3, "TB": 4, "PB": 5, "EB": 6}
+
+// ParseFileSize 解析 FormatFileSize 格式化的大小，例如 "1.5 MB"
+// 格式化时保留一位小数，解析结果是近似值。
+func ParseFileSize(s string) (int64, bool) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i <= 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	exp, ok := fileSizeUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if err != nil || !ok {
+		return 0, false
+	}
+	for ; exp > 0; exp-- {
+		n *= 1024
+	}
+	return int64(n), true
+}
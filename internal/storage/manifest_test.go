@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+// TestMigrateHistory 测试旧版本记录升级时重建文件清单
+func TestMigrateHistory(t *testing.T) {
+	storage := setupTestStorage(t)
+
+	records := map[string]string{
+		"verified": `{"id":"verified","type":"receive","status":"completed","fileSize":"300 B","numFiles":2,` +
+			`"verification":{"algorithm":"xxhash","files":[{"name":"a.bin","size":100,"expected":"00ff"},{"name":"sub/b.bin","size":200,"expected":"ff00"}]},` +
+			`"receivedFiles":[{"name":"a.bin","path":"/tmp/downloads/a.bin"}]}`,
+		"resume": `{"id":"resume","type":"receive","status":"failed","fileSize":"1.0 KB",` +
+			`"resume":{"direction":"receive","dir":"/tmp/in","files":[{"name":"a (1).bin","source":"a.bin","size":1024}]}}`,
+		"sized": `{"id":"sized","type":"send","status":"completed","fileName":"a.iso","fileSize":"1.5 MB","numFiles":1}`,
+		"text":  `{"id":"text","type":"receive","status":"completed","fileName":"文本内容","fileSize":"6 B"}`,
+	}
+	keys, _ := json.Marshal([]string{"verified", "resume", "sized", "text"})
+	storage.prefs.SetString(legacyKeysKey, string(keys))
+	for id, data := range records {
+		storage.prefs.SetString(legacyRecordPrefix+id, data)
+	}
+	storage.loadAll()
+
+	for id := range records {
+		if v := storage.cache[id].Version; v != HistoryVersion {
+			t.Errorf("%s: 期望版本为 %d，实际为 %d", id, HistoryVersion, v)
+		}
+	}
+
+	m := storage.cache["verified"].Manifest
+	if m == nil || len(m.Files) != 2 || m.TotalBytes != 300 || m.HashAlgorithm != "xxhash" ||
+		m.Files[1].Path != "sub/b.bin" || m.Files[1].Hash != "ff00" || m.SavePath != "/tmp/downloads" {
+		t.Errorf("从校验报告重建的清单不正确: %+v", m)
+	}
+	if m := storage.cache["resume"].Manifest; m == nil || len(m.Files) != 1 || m.Files[0].Path != "a.bin" || m.TotalBytes != 1024 || m.SavePath != "/tmp/in" {
+		t.Errorf("从断点信息重建的清单不正确: %+v", m)
+	}
+	if m := storage.cache["sized"].Manifest; m == nil || len(m.Files) != 0 || m.TotalBytes != 1572864 {
+		t.Errorf("从显示的大小重建的清单不正确: %+v", m)
+	}
+	if m := storage.cache["text"].Manifest; m != nil {
+		t.Errorf("文本记录不应有清单: %+v", m)
+	}
+
+	// 升级后的记录已经写回
+	items, err := storage.backend.Load()
+	if err != nil || len(items) != 4 || items[0].Version != HistoryVersion || items[0].Manifest == nil {
+		t.Errorf("升级的记录没有被保存: %+v, %v", items, err)
+	}
+}
+
+// TestSetManifest 测试新记录的版本和文件清单
+func TestSetManifest(t *testing.T) {
+	storage := setupTestStorage(t)
+
+	item := HistoryItem{Type: "send", FileName: "proj", Timestamp: time.Now()}
+	item.SetManifest(crocmgr.Manifest{
+		Files:      []crocmgr.ManifestFile{{Path: "proj/a.go", Size: 1024}, {Path: "proj/sub/b.go", Size: 512}},
+		NumFolders: 2,
+		TotalBytes: 1536,
+	})
+	if item.FileSize != "1.5 KB" || item.NumFiles != 2 || item.NumFolders != 2 || item.TotalBytes() != 1536 {
+		t.Errorf("显示信息没有被更新: %+v", item)
+	}
+
+	id, err := storage.Add(item)
+	if err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+	storage.loadAll()
+	saved := storage.cache[id]
+	if saved.Version != HistoryVersion || saved.Manifest == nil || saved.Manifest.Files[1].Path != "proj/sub/b.go" {
+		t.Errorf("文件清单没有被保存: %+v", saved)
+	}
+}
+
+func TestParseFileSize(t *testing.T) {
+	tests := map[string]int64{"0 B": 0, "512 B": 512, "1.5 KB": 1536, "2.0 MB": 2 << 20, "1GB": 1 << 30}
+	for s, want := range tests {
+		if n, ok := ParseFileSize(s); !ok || n != want {
+			t.Errorf("ParseFileSize(%q) = %d, %v，期望 %d", s, n, ok, want)
+		}
+	}
+	for _, s := range []string{"", "KB", "1.5 XB", "abc"} {
+		if _, ok := ParseFileSize(s); ok {
+			t.Errorf("ParseFileSize(%q) 应失败", s)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ownerLock 本进程在历史记录中的所有者标识
+// 每个打开历史记录文件的进程在所有者目录中创建以标识命名的文件，并在关闭前一直持有它的排他锁；
+// 传输中的记录写入这个标识。其他进程能锁定这个文件或文件已经不存在时，说明写入记录的进程已经退出。
+type ownerLock struct {
+	dir  string
+	name string
+	file *os.File
+}
+
+// openOwnerLock 在 dir 中创建并锁定本进程的所有者文件，同时清理已经退出的进程留下的文件
+func openOwnerLock(dir string) (*ownerLock, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("创建历史记录所有者目录失败: %w", err)
+	}
+	o := &ownerLock{dir: dir, name: fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())}
+	f, err := os.OpenFile(filepath.Join(dir, o.name), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("创建历史记录所有者文件失败: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("锁定历史记录所有者文件失败: %w", err)
+	}
+	o.file = f
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, e := range entries {
+			o.alive(e.Name())
+		}
+	}
+	return o, nil
+}
+
+// alive 标识对应的进程是否仍在运行，已经退出时删除它的所有者文件
+// 无法确定时按仍在运行处理，不把其他进程的记录当作中断的记录。
+func (o *ownerLock) alive(name string) bool {
+	if name == o.name {
+		return true
+	}
+	if name == "" || name != filepath.Base(name) {
+		return false
+	}
+	path := filepath.Join(o.dir, name)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	locked, err := tryLockFile(f)
+	if err != nil || !locked {
+		f.Close()
+		return true
+	}
+	unlockFile(f)
+	f.Close()
+	os.Remove(path)
+	return false
+}
+
+// close 释放锁并删除本进程的所有者文件
+func (o *ownerLock) close() {
+	unlockFile(o.file)
+	o.file.Close()
+	os.Remove(filepath.Join(o.dir, o.name))
+}
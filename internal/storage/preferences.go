@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// Preferences 历史记录使用的键值存储，fyne.Preferences 满足该接口
+type Preferences interface {
+	String(key string) string
+	SetString(key string, value string)
+	Int(key string) int
+	SetInt(key string, value int)
+	RemoveValue(key string)
+}
+
+// FilePreferences 直接读写 Fyne 的 preferences.json
+// 供命令行模式使用，不需要启动 Fyne 应用即可与界面共享历史记录。
+// 每次修改都会立即写回文件，文件中的其他键保持不变。
+type FilePreferences struct {
+	mu     sync.Mutex
+	path   string
+	values map[string]any
+}
+
+// DataDir 返回 Fyne 桌面端指定应用的数据目录，偏好设置和历史记录都保存在其中
+func DataDir(appID string) (string, error) {
+	var root string
+	switch runtime.GOOS {
+	case "darwin":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("获取用户主目录失败: %w", err)
+		}
+		root = filepath.Join(home, "Library", "Preferences")
+	case "windows":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("获取用户主目录失败: %w", err)
+		}
+		root = filepath.Join(home, "AppData", "Roaming")
+	default:
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("获取配置目录失败: %w", err)
+		}
+		root = dir
+	}
+	return filepath.Join(root, "fyne", appID), nil
+}
+
+// PreferencesPath 返回 Fyne 桌面端保存指定应用偏好设置的文件路径
+func PreferencesPath(appID string) (string, error) {
+	dir, err := DataDir(appID)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "preferences.json"), nil
+}
+
+// HistoryPath 返回指定应用的历史记录文件路径，与界面使用的路径相同
+func HistoryPath(appID string) (string, error) {
+	dir, err := DataDir(appID)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, HistoryFileName), nil
+}
+
+// OpenFilePreferences 打开偏好设置文件，文件不存在时视为空
+func OpenFilePreferences(path string) (*FilePreferences, error) {
+	p := &FilePreferences{path: path, values: make(map[string]any)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取偏好设置失败: %w", err)
+	}
+	if len(data) == 0 {
+		return p, nil
+	}
+	if err := json.Unmarshal(data, &p.values); err != nil {
+		return nil, fmt.Errorf("解析偏好设置失败: %w", err)
+	}
+	return p, nil
+}
+
+// String 读取字符串值，不存在时返回空字符串
+func (p *FilePreferences) String(key string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, _ := p.values[key].(string)
+	return s
+}
+
+// SetString 保存字符串值
+func (p *FilePreferences) SetString(key string, value string) {
+	p.set(key, value)
+}
+
+// Int 读取整数值，JSON 中的数字统一解析为 float64
+func (p *FilePreferences) Int(key string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch v := p.values[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// SetInt 保存整数值
+func (p *FilePreferences) SetInt(key string, value int) {
+	p.set(key, value)
+}
+
+// RemoveValue 删除指定键
+func (p *FilePreferences) RemoveValue(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.values, key)
+	p.saveLocked()
+}
+
+func (p *FilePreferences) set(key string, value any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.values[key] = value
+	p.saveLocked()
+}
+
+// saveLocked 写回文件，Preferences 接口没有错误返回，失败时只记录日志
+func (p *FilePreferences) saveLocked() {
+	if err := p.writeFile(); err != nil {
+		log.Printf("保存偏好设置失败: %v\n", err)
+	}
+}
+
+// writeFile 先写临时文件再替换，避免中途退出损坏偏好设置
+func (p *FilePreferences) writeFile() error {
+	data, err := json.Marshal(p.values)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), ".preferences-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.path)
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+// TestFilePreferencesMigratesHistory 测试命令行打开时把偏好设置文件中的旧历史记录迁移到历史记录文件
+func TestFilePreferencesMigratesHistory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "fyne", "com.test.mocroc")
+	path := filepath.Join(dir, "preferences.json")
+
+	// 模拟旧版本界面写入的偏好设置和历史记录
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	legacy := `{"theme":"dark","history_store_text":1,"history_id_counter":1,"history_keys":"[\"record_1\"]",` +
+		`"history_record_1":"{\"id\":\"record_1\",\"type\":\"send\",\"fileName\":\"cli.txt\",\"code\":\"cli-code-1234\",\"status\":\"waiting\"}"}`
+	if err := os.WriteFile(path, []byte(legacy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	prefs, err := OpenFilePreferences(path)
+	if err != nil {
+		t.Fatalf("打开偏好设置失败: %v", err)
+	}
+	hs, err := OpenHistoryStorage(filepath.Join(dir, HistoryFileName), prefs)
+	if err != nil {
+		t.Fatalf("打开历史记录失败: %v", err)
+	}
+	// 旧版本退出时没有结束的记录标记为失败
+	if item, ok := hs.Get("record_1"); !ok || item.Status != lifecycle.Failed {
+		t.Fatalf("迁移的记录状态不正确: %+v", item)
+	}
+	id, err := hs.Add(HistoryItem{Type: "receive", Code: "cli-code-5678", Status: lifecycle.Preparing, Timestamp: time.Now()})
+	if err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+	hs.Close()
+
+	// 旧记录从偏好设置中删除，其他设置保持不变
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		t.Fatalf("偏好设置文件格式错误: %v", err)
+	}
+	if values["theme"] != "dark" || values["history_store_text"] != float64(1) {
+		t.Errorf("其他偏好设置被覆盖: %v", values)
+	}
+	for _, key := range []string{"history_keys", "history_record_1", "history_id_counter"} {
+		if _, ok := values[key]; ok {
+			t.Errorf("旧历史记录 %s 没有被删除", key)
+		}
+	}
+
+	// 重新打开后从历史记录文件读到记录，不会再次迁移
+	reopened, err := OpenFilePreferences(path)
+	if err != nil {
+		t.Fatalf("重新打开偏好设置失败: %v", err)
+	}
+	hs, err = OpenHistoryStorage(filepath.Join(dir, HistoryFileName), reopened)
+	if err != nil {
+		t.Fatalf("重新打开历史记录失败: %v", err)
+	}
+	defer hs.Close()
+	items, _ := hs.GetAll()
+	if len(items) != 2 || items[0].ID != id || items[1].Code != "cli-code-1234" || items[1].Status != lifecycle.Failed {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+	if !hs.StoreText() {
+		t.Error("文本保存开关应保留在偏好设置中")
+	}
+}
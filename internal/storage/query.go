@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+// ErrInvalidHistoryQuery 查询条件无效
+var ErrInvalidHistoryQuery = errors.New("无效的查询条件")
+
+// HistorySort 历史记录的排序字段
+type HistorySort string
+
+const (
+	SortByTime     HistorySort = "time"     // 创建时间
+	SortBySize     HistorySort = "size"     // 传输的字节数
+	SortByDuration HistorySort = "duration" // 传输耗时
+)
+
+// HistoryQuery 历史记录的查询条件，零值返回全部记录，最新的在前
+type HistoryQuery struct {
+	Type     string            // send 或 receive，为空时不限
+	Statuses []lifecycle.State // 为空时不限
+	Since    time.Time         // 创建时间不早于 Since，零值表示不限
+	Until    time.Time         // 创建时间早于 Until，零值表示不限
+	Code     string            // 接收码包含的内容，不区分大小写
+	Name     string            // 文件名或清单中的路径包含的内容，不区分大小写
+	Keyword  string            // 文件名、清单中的路径或接收码包含的内容，用于搜索框
+	MinSize  int64             // 字节数下限
+	MaxSize  int64             // 字节数上限，0 表示不限
+
+	Sort      HistorySort // 为空时按创建时间
+	Ascending bool        // 默认从大到小，即最新、最大、最久的在前
+
+	Offset int // 跳过的记录数
+	Limit  int // 最多返回的记录数，0 表示不限
+}
+
+// HistoryResult 查询结果
+type HistoryResult struct {
+	Items []HistoryItem
+	Total int // 符合条件的记录数，不受分页影响
+}
+
+// Validate 检查查询条件
+func (q HistoryQuery) Validate() error {
+	switch q.Type {
+	case "", "send", "receive":
+	default:
+		return fmt.Errorf("%w: 未知的传输类型 %q", ErrInvalidHistoryQuery, q.Type)
+	}
+	switch q.Sort {
+	case "", SortByTime, SortBySize, SortByDuration:
+	default:
+		return fmt.Errorf("%w: 未知的排序字段 %q", ErrInvalidHistoryQuery, q.Sort)
+	}
+	if q.MinSize < 0 || q.MaxSize < 0 || (q.MaxSize > 0 && q.MinSize > q.MaxSize) {
+		return fmt.Errorf("%w: 大小范围 %d-%d", ErrInvalidHistoryQuery, q.MinSize, q.MaxSize)
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return fmt.Errorf("%w: 开始时间不早于结束时间", ErrInvalidHistoryQuery)
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		return fmt.Errorf("%w: 分页 %d/%d", ErrInvalidHistoryQuery, q.Offset, q.Limit)
+	}
+	return nil
+}
+
+// Match 记录是否符合筛选条件
+func (q HistoryQuery) Match(item HistoryItem) bool {
+	if q.Type != "" && item.Type != q.Type {
+		return false
+	}
+	if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, item.Status) {
+		return false
+	}
+	if !q.Since.IsZero() && item.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !item.Timestamp.Before(q.Until) {
+		return false
+	}
+	if q.Code != "" && !containsFold(item.Code, q.Code) {
+		return false
+	}
+	if q.Name != "" && !matchName(item, q.Name) {
+		return false
+	}
+	if q.Keyword != "" && !containsFold(item.Code, q.Keyword) && !matchName(item, q.Keyword) {
+		return false
+	}
+	if q.MinSize > 0 || q.MaxSize > 0 {
+		size := item.TotalBytes()
+		if size < q.MinSize || (q.MaxSize > 0 && size > q.MaxSize) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchName 文件名或清单中任一文件的路径是否包含 name
+func matchName(item HistoryItem, name string) bool {
+	if containsFold(item.FileName, name) {
+		return true
+	}
+	if item.Manifest == nil {
+		return false
+	}
+	return slices.ContainsFunc(item.Manifest.Files, func(f crocmgr.ManifestFile) bool {
+		return containsFold(f.Path, name)
+	})
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// compare 按排序字段比较两条记录，结果为从小到大
+func (q HistoryQuery) compare(a, b HistoryItem) int {
+	switch q.Sort {
+	case SortBySize:
+		return cmp.Compare(a.TotalBytes(), b.TotalBytes())
+	case SortByDuration:
+		return cmp.Compare(a.Duration, b.Duration)
+	default:
+		return a.Timestamp.Compare(b.Timestamp)
+	}
+}
+
+// Query 按条件筛选、排序并分页返回历史记录
+// 排序字段相同的记录按添加顺序排列，最新添加的在前。
+func (hs *HistoryStorage) Query(q HistoryQuery) (HistoryResult, error) {
+	if err := q.Validate(); err != nil {
+		return HistoryResult{}, err
+	}
+	items, err := hs.GetAll()
+	if err != nil {
+		return HistoryResult{}, err
+	}
+
+	items = slices.DeleteFunc(items, func(item HistoryItem) bool { return !q.Match(item) })
+	slices.SortStableFunc(items, func(a, b HistoryItem) int {
+		if q.Ascending {
+			return q.compare(a, b)
+		}
+		return q.compare(b, a)
+	})
+
+	result := HistoryResult{Total: len(items)}
+	start := min(q.Offset, len(items))
+	end := len(items)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, end)
+	}
+	result.Items = items[start:end]
+	return result, nil
+}
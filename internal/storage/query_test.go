@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
+)
+
+// TestQuery 测试历史记录的筛选、排序和分页
+func TestQuery(t *testing.T) {
+	storage := setupTestStorage(t)
+
+	day := time.Date(2026, 10, 13, 9, 0, 0, 0, time.Local)
+	records := []HistoryItem{
+		{ID: "a", Type: "send", FileName: "report.pdf", FileSize: "2.0 MB", Code: "1111-alpha", Status: lifecycle.Completed, Timestamp: day, Duration: 30},
+		{ID: "b", Type: "receive", FileName: "build", Code: "2222-bravo", Status: lifecycle.Failed, Timestamp: day.Add(24 * time.Hour), Duration: 5,
+			Manifest: &crocmgr.Manifest{Files: []crocmgr.ManifestFile{{Path: "build/app-v1.2.tar.gz", Size: 5 << 20}}, TotalBytes: 5 << 20}},
+		{ID: "c", Type: "send", FileName: "文本内容", FileSize: "5 B", Code: "3333-ALPHA", Status: lifecycle.Completed, Timestamp: day.Add(48 * time.Hour), Duration: 1},
+		{ID: "d", Type: "receive", FileName: "photo.jpg", FileSize: "1.0 MB", Code: "4444-delta", Status: lifecycle.Cancelled, Timestamp: day.Add(48 * time.Hour), Duration: 30},
+	}
+	for _, item := range records {
+		if _, err := storage.Add(item); err != nil {
+			t.Fatalf("添加记录失败: %v", err)
+		}
+	}
+
+	ids := func(r HistoryResult) []string {
+		var ids []string
+		for _, item := range r.Items {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+	tests := []struct {
+		name  string
+		query HistoryQuery
+		want  []string
+	}{
+		{"默认最新的在前", HistoryQuery{}, []string{"d", "c", "b", "a"}},
+		{"类型", HistoryQuery{Type: "receive"}, []string{"d", "b"}},
+		{"状态", HistoryQuery{Statuses: []lifecycle.State{lifecycle.Failed, lifecycle.Cancelled}}, []string{"d", "b"}},
+		{"日期范围", HistoryQuery{Since: day.Add(24 * time.Hour), Until: day.Add(48 * time.Hour)}, []string{"b"}},
+		{"接收码不区分大小写", HistoryQuery{Code: "alpha"}, []string{"c", "a"}},
+		{"清单中的路径", HistoryQuery{Name: "APP-V1"}, []string{"b"}},
+		{"关键字匹配接收码", HistoryQuery{Keyword: "DELTA"}, []string{"d"}},
+		{"关键字匹配文件名", HistoryQuery{Keyword: "pdf"}, []string{"a"}},
+		{"大小范围", HistoryQuery{MinSize: 1 << 20, MaxSize: 3 << 20}, []string{"d", "a"}},
+		{"按大小", HistoryQuery{Sort: SortBySize}, []string{"b", "a", "d", "c"}},
+		{"按耗时从小到大，相同时最新的在前", HistoryQuery{Sort: SortByDuration, Ascending: true}, []string{"c", "b", "d", "a"}},
+		{"分页", HistoryQuery{Offset: 1, Limit: 2}, []string{"c", "b"}},
+		{"超出范围的分页", HistoryQuery{Offset: 10}, nil},
+	}
+	for _, tt := range tests {
+		r, err := storage.Query(tt.query)
+		if err != nil {
+			t.Errorf("%s: 查询失败: %v", tt.name, err)
+			continue
+		}
+		if got := ids(r); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: 结果为 %v，期望 %v", tt.name, got, tt.want)
+		}
+	}
+
+	if r, _ := storage.Query(HistoryQuery{Type: "send", Limit: 1}); r.Total != 2 || len(r.Items) != 1 {
+		t.Errorf("分页时的总数为 %d，返回 %d 条", r.Total, len(r.Items))
+	}
+
+	for _, q := range []HistoryQuery{
+		{Type: "upload"},
+		{Sort: "name"},
+		{MinSize: 10, MaxSize: 5},
+		{Since: day, Until: day},
+		{Limit: -1},
+	} {
+		if _, err := storage.Query(q); !errors.Is(err, ErrInvalidHistoryQuery) {
+			t.Errorf("Query(%+v) = %v，期望无效的查询条件", q, err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+// preferences 键
+const (
+	relayProfilesKey       = "relay_profiles"
+	relayDefaultProfileKey = "relay_default_profile"
+	relayAutoSelectKey     = "relay_auto_select"
+)
+
+// RelayProfileStore 中继配置存储
+// 没有保存过任何配置时使用内置的公共中继和本机内置中继。
+type RelayProfileStore struct {
+	mu        sync.Mutex
+	prefs     Preferences
+	profiles  []crocmgr.RelayProfile
+	listeners []func()
+}
+
+// NewRelayProfileStore 创建中继配置存储
+func NewRelayProfileStore(prefs Preferences) *RelayProfileStore {
+	s := &RelayProfileStore{prefs: prefs}
+	s.load()
+	return s
+}
+
+// load 加载保存的配置，解析失败时使用内置配置
+func (s *RelayProfileStore) load() {
+	s.profiles = crocmgr.DefaultRelayProfiles()
+
+	data := s.prefs.String(relayProfilesKey)
+	if data == "" {
+		return
+	}
+	var profiles []crocmgr.RelayProfile
+	if err := json.Unmarshal([]byte(data), &profiles); err != nil {
+		log.Printf("解析中继配置失败: %v\n", err)
+		return
+	}
+	if len(profiles) > 0 {
+		s.profiles = profiles
+	}
+}
+
+// saveLocked 保存配置列表，调用时持有锁
+func (s *RelayProfileStore) saveLocked() error {
+	data, err := json.Marshal(s.profiles)
+	if err != nil {
+		return fmt.Errorf("编码中继配置失败: %w", err)
+	}
+	s.prefs.SetString(relayProfilesKey, string(data))
+	return nil
+}
+
+// OnChange 注册配置变化的监听函数，在修改配置的 goroutine 中调用
+func (s *RelayProfileStore) OnChange(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+func (s *RelayProfileStore) notify() {
+	s.mu.Lock()
+	listeners := append([]func(){}, s.listeners...)
+	s.mu.Unlock()
+	for _, fn := range listeners {
+		fn()
+	}
+}
+
+// List 返回所有中继配置
+func (s *RelayProfileStore) List() []crocmgr.RelayProfile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]crocmgr.RelayProfile(nil), s.profiles...)
+}
+
+// Names 返回所有中继配置的名称
+func (s *RelayProfileStore) Names() []string {
+	var names []string
+	for _, p := range s.List() {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// Get 根据名称获取中继配置
+func (s *RelayProfileStore) Get(name string) (crocmgr.RelayProfile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return crocmgr.RelayProfile{}, false
+}
+
+// Save 校验并保存中继配置，同名配置会被替换
+func (s *RelayProfileStore) Save(profile crocmgr.RelayProfile) error {
+	profile.Name = strings.TrimSpace(profile.Name)
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	replaced := false
+	for i, p := range s.profiles {
+		if p.Name == profile.Name {
+			s.profiles[i] = profile
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		s.profiles = append(s.profiles, profile)
+	}
+	err := s.saveLocked()
+	s.mu.Unlock()
+
+	if err == nil {
+		s.notify()
+	}
+	return err
+}
+
+// Delete 删除中继配置，至少保留一个配置
+func (s *RelayProfileStore) Delete(name string) error {
+	s.mu.Lock()
+	index := -1
+	for i, p := range s.profiles {
+		if p.Name == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		s.mu.Unlock()
+		return fmt.Errorf("未找到中继配置 %s", name)
+	}
+	if len(s.profiles) == 1 {
+		s.mu.Unlock()
+		return fmt.Errorf("至少需要保留一个中继配置")
+	}
+	s.profiles = append(s.profiles[:index], s.profiles[index+1:]...)
+	if s.prefs.String(relayDefaultProfileKey) == name {
+		s.prefs.RemoveValue(relayDefaultProfileKey)
+	}
+	err := s.saveLocked()
+	s.mu.Unlock()
+
+	if err == nil {
+		s.notify()
+	}
+	return err
+}
+
+// Default 返回默认中继配置，未设置时为第一个配置
+func (s *RelayProfileStore) Default() crocmgr.RelayProfile {
+	if p, ok := s.Get(s.prefs.String(relayDefaultProfileKey)); ok {
+		return p
+	}
+	return s.List()[0]
+}
+
+// SetDefault 设置默认中继配置
+func (s *RelayProfileStore) SetDefault(name string) error {
+	if _, ok := s.Get(name); !ok {
+		return fmt.Errorf("未找到中继配置 %s", name)
+	}
+	s.prefs.SetString(relayDefaultProfileKey, name)
+	s.notify()
+	return nil
+}
+
+// AutoSelect 新的传输是否自动选择延迟最低的中继
+func (s *RelayProfileStore) AutoSelect() bool {
+	return s.prefs.Int(relayAutoSelectKey) == 1
+}
+
+// SetAutoSelect 设置是否自动选择延迟最低的中继
+func (s *RelayProfileStore) SetAutoSelect(enabled bool) {
+	value := 0
+	if enabled {
+		value = 1
+	}
+	s.prefs.SetInt(relayAutoSelectKey, value)
+	s.notify()
+}
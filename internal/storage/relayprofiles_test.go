@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+// openTestRelayProfiles 打开指定偏好设置文件中的中继配置
+func openTestRelayProfiles(t *testing.T, path string) *RelayProfileStore {
+	t.Helper()
+	prefs, err := OpenFilePreferences(path)
+	if err != nil {
+		t.Fatalf("打开偏好设置失败: %v", err)
+	}
+	return NewRelayProfileStore(prefs)
+}
+
+// TestRelayProfileStoreDefaults 测试未保存配置时使用内置配置
+func TestRelayProfileStoreDefaults(t *testing.T) {
+	store := openTestRelayProfiles(t, filepath.Join(t.TempDir(), "preferences.json"))
+
+	names := store.Names()
+	if len(names) != 2 || names[0] != crocmgr.PublicRelayProfileName || names[1] != crocmgr.LocalRelayProfileName {
+		t.Fatalf("期望内置配置，实际为 %v", names)
+	}
+	if store.Default().Name != crocmgr.PublicRelayProfileName {
+		t.Errorf("期望默认配置为 %s，实际为 %s", crocmgr.PublicRelayProfileName, store.Default().Name)
+	}
+	if store.AutoSelect() {
+		t.Error("期望默认不自动选择中继")
+	}
+}
+
+// TestRelayProfileStorePersistence 测试保存、替换、删除和默认配置的持久化
+func TestRelayProfileStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preferences.json")
+	store := openTestRelayProfiles(t, path)
+
+	changes := 0
+	store.OnChange(func() { changes++ })
+
+	profile := crocmgr.RelayProfile{
+		Name:     " 公司中继 ",
+		Address:  "relay.example.com:9109",
+		Ports:    []string{"9109", "9110"},
+		Password: "secret",
+	}
+	if err := store.Save(profile); err != nil {
+		t.Fatalf("保存配置失败: %v", err)
+	}
+	profile.Name = "公司中继"
+	profile.Password = "changed"
+	if err := store.Save(profile); err != nil {
+		t.Fatalf("替换配置失败: %v", err)
+	}
+	if err := store.SetDefault("公司中继"); err != nil {
+		t.Fatalf("设置默认配置失败: %v", err)
+	}
+	store.SetAutoSelect(true)
+	if changes != 4 {
+		t.Errorf("期望通知 4 次，实际为 %d", changes)
+	}
+
+	// 无效配置不保存
+	if err := store.Save(crocmgr.RelayProfile{Name: "无效"}); err == nil {
+		t.Error("期望无效配置保存失败")
+	}
+
+	reopened := openTestRelayProfiles(t, path)
+	if got := len(reopened.List()); got != 3 {
+		t.Fatalf("期望 3 个配置，实际为 %d", got)
+	}
+	if !reopened.AutoSelect() {
+		t.Error("期望保存自动选择中继")
+	}
+	def := reopened.Default()
+	if def.Name != "公司中继" || def.Password != "changed" {
+		t.Errorf("默认配置不正确: %+v", def)
+	}
+
+	// 删除默认配置后回退到第一个配置
+	if err := reopened.Delete("公司中继"); err != nil {
+		t.Fatalf("删除配置失败: %v", err)
+	}
+	if reopened.Default().Name != crocmgr.PublicRelayProfileName {
+		t.Errorf("期望回退到 %s，实际为 %s", crocmgr.PublicRelayProfileName, reopened.Default().Name)
+	}
+	if err := reopened.Delete("不存在"); err == nil {
+		t.Error("期望删除不存在的配置失败")
+	}
+	if err := reopened.SetDefault("不存在"); err == nil {
+		t.Error("期望设置不存在的默认配置失败")
+	}
+}
+
+// TestRelayProfileStoreKeepsOne 测试至少保留一个配置
+func TestRelayProfileStoreKeepsOne(t *testing.T) {
+	store := openTestRelayProfiles(t, filepath.Join(t.TempDir(), "preferences.json"))
+
+	if err := store.Delete(crocmgr.LocalRelayProfileName); err != nil {
+		t.Fatalf("删除配置失败: %v", err)
+	}
+	if err := store.Delete(crocmgr.PublicRelayProfileName); err == nil {
+		t.Error("期望删除最后一个配置失败")
+	}
+	if got := len(store.List()); got != 1 {
+		t.Errorf("期望保留 1 个配置，实际为 %d", got)
+	}
+}
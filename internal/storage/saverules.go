@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+// saveRulesKey 接收文件保存位置规则的 preferences 键
+const saveRulesKey = "receive_save_rules"
+
+// SaveRules 读取保存位置规则，没有保存过或设置已失效时保存到默认目录
+func SaveRules(prefs Preferences) crocmgr.SaveRules {
+	var rules crocmgr.SaveRules
+	if data := prefs.String(saveRulesKey); data != "" {
+		if err := json.Unmarshal([]byte(data), &rules); err != nil || rules.Validate() != nil {
+			rules = crocmgr.SaveRules{}
+		}
+	}
+	if rules.Dir == "" {
+		rules.Dir = DefaultSaveDir()
+	}
+	return rules
+}
+
+// SetSaveRules 保存保存位置规则
+func SetSaveRules(prefs Preferences, rules crocmgr.SaveRules) error {
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	prefs.SetString(saveRulesKey, string(data))
+	return nil
+}
+
+// DefaultSaveDir 返回默认的保存目录：下载目录，没有时使用主目录或临时目录
+func DefaultSaveDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		// 如果获取用户主目录失败，使用临时目录
+		if runtime.GOOS == "windows" {
+			return os.Getenv("TEMP")
+		}
+		return "/tmp"
+	}
+
+	downloads := filepath.Join(home, "Downloads")
+	if _, err := os.Stat(downloads); os.IsNotExist(err) {
+		// 如果 Downloads 目录不存在，使用主目录
+		return home
+	}
+
+	return downloads
+}
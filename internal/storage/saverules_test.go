@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/shapled/mocroc/internal/crocmgr"
+)
+
+func TestSaveRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preferences.json")
+	prefs, err := OpenFilePreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := SaveRules(prefs); got.Dir != DefaultSaveDir() || got.DateFolders {
+		t.Errorf("SaveRules() = %+v, want default directory", got)
+	}
+	rules := crocmgr.SaveRules{
+		Dir:         t.TempDir(),
+		DateFolders: true,
+		CodeRules:   []crocmgr.CodeRule{{Prefix: "work-", Folder: "Work"}},
+		TypeRules:   []crocmgr.TypeRule{{Extensions: []string{"jpg"}, Folder: "Pictures/mocroc"}},
+	}
+	if err := SetSaveRules(prefs, rules); err != nil {
+		t.Fatalf("SetSaveRules failed: %v", err)
+	}
+	invalid := crocmgr.SaveRules{CodeRules: []crocmgr.CodeRule{{Prefix: "work-"}}}
+	if err := SetSaveRules(prefs, invalid); !errors.Is(err, crocmgr.ErrInvalidSaveRule) {
+		t.Errorf("invalid rules = %v", err)
+	}
+
+	// 重启后读到保存的目录和规则
+	prefs, err = OpenFilePreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := SaveRules(prefs)
+	if got.Dir != rules.Dir || !got.DateFolders || len(got.CodeRules) != 1 || got.TypeRules[0].Folder != "Pictures/mocroc" {
+		t.Errorf("SaveRules() = %+v, want %+v", got, rules)
+	}
+}
@@ -3,152 +3,316 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
 )
 
 // HistoryItem 传输历史记录项
 type HistoryItem struct {
-	ID         string    `json:"id"`
-	Type       string    `json:"type"`       // "send" or "receive"
-	FileName   string    `json:"fileName"`   // 主要文件名
-	FileSize   string    `json:"fileSize"`   // 文件大小
-	Code       string    `json:"code"`       // 接收码
-	Status     string    `json:"status"`     // "completed", "failed", "in_progress"
-	Timestamp  time.Time `json:"timestamp"`  // 创建时间
-	Duration   int64     `json:"duration"`   // 传输耗时（秒）
-	ClientInfo string    `json:"clientInfo"` // 客户端信息
-	NumFiles   int       `json:"numFiles"`   // 文件数量
+	Version    int             `json:"version"` // 记录格式版本，见 HistoryVersion
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`                 // "send" or "receive"
+	FileName   string          `json:"fileName"`             // 主要文件名
+	FileSize   string          `json:"fileSize"`             // 文件大小
+	Code       string          `json:"code"`                 // 接收码
+	Status     lifecycle.State `json:"status"`               // 传输状态
+	Timestamp  time.Time       `json:"timestamp"`            // 创建时间
+	Duration   int64           `json:"duration"`             // 传输耗时（秒）
+	ClientInfo string          `json:"clientInfo"`           // 客户端信息
+	NumFiles   int             `json:"numFiles"`             // 文件数量
+	NumFolders int             `json:"numFolders,omitempty"` // 文件夹数量，包括空文件夹
+
+	Text string `json:"text,omitempty"` // 文本传输的内容，开启保存文本时才记录
+
+	Transitions []lifecycle.Transition `json:"transitions,omitempty"` // 状态转换记录
+
+	Resume        *crocmgr.Resume        `json:"resume,omitempty"`        // 中断的传输的断点信息，完成后清除
+	Verification  *crocmgr.Verification  `json:"verification,omitempty"`  // 接收完成后的校验报告
+	ReceivedFiles []crocmgr.ReceivedFile `json:"receivedFiles,omitempty"` // 接收文件保存的位置，包括重命名和跳过的文件
+	Manifest      *crocmgr.Manifest      `json:"manifest,omitempty"`      // 文件清单，文本传输没有清单
+
+	Relay *crocmgr.RelayProfile `json:"relay,omitempty"` // 任务使用的中继，任务开始时记录
+	Paths []string              `json:"paths,omitempty"` // 发送时选择的文件和文件夹，用于重新发送
+	Skip  []string              `json:"skip,omitempty"`  // 发送时取消勾选的文件和文件夹
+
+	Owner string `json:"owner,omitempty"` // 写入未结束的记录的进程，见 HistoryBackend.Owner；结束后清除
 }
 
+// Resumable 是否为可以继续的中断传输
+func (item HistoryItem) Resumable() bool {
+	return item.Resume != nil && (item.Status == lifecycle.Failed || item.Status == lifecycle.Cancelled)
+}
+
+// SetSendPlan 按发送计划记录发送的文件名、大小、文件数和文件夹数
+// 只选择了一项时使用它的名称，否则显示文件数。
+func (item *HistoryItem) SetSendPlan(paths []string, plan crocmgr.SendPlan) {
+	item.SetManifest(crocmgr.NewManifest(plan.Files, plan.NumFolders, ""))
+	item.Paths = slices.Clone(paths)
+	if len(paths) == 1 {
+		item.FileName = filepath.Base(paths[0])
+	} else {
+		item.FileName = fmt.Sprintf("%d 个文件", len(plan.Files))
+	}
+}
+
+// storeTextKey 是否在历史记录中保存文本内容
+const storeTextKey = "history_store_text"
+
+// FormatFileSize 格式化文件大小，用于 HistoryItem.FileSize
+func FormatFileSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// maxHistoryRecords 最多保存的记录数，超出时删除最旧的记录
+const maxHistoryRecords = 500
+
+// interruptedMessage 上次运行时没有结束的记录的失败原因
+const interruptedMessage = "程序退出时传输未结束"
+
 // HistoryStorage 历史记录存储管理器
+// 记录保存在 HistoryBackend 中，内存中保留全部记录用于查询；文本保存开关仍在偏好设置中。
 type HistoryStorage struct {
 	mu         sync.RWMutex
-	app        fyne.App
-	prefs      fyne.Preferences
+	backend    HistoryBackend
+	prefs      Preferences
 	cache      map[string]HistoryItem // ID到记录的映射
-	prefix     string                 // preferences 键前缀
 	idCounter  int64                  // ID计数器
 	maxRecords int                    // 最大记录数限制
 	recordKeys []string               // 所有记录的key列表（按时间顺序）
 }
 
-// NewHistoryStorage 创建历史记录存储管理器
+// NewHistoryStorage 创建历史记录存储管理器，记录保存在应用数据目录的历史记录文件中
+// 无法打开历史记录文件时记录只保存在内存中。
 func NewHistoryStorage(a fyne.App) *HistoryStorage {
+	path := filepath.Join(a.Storage().RootURI().Path(), HistoryFileName)
+	hs, err := OpenHistoryStorage(path, a.Preferences())
+	if err != nil {
+		log.Printf("打开历史记录失败，本次运行的记录不会保存: %v\n", err)
+		return newHistoryStorage(&memoryBackend{}, a.Preferences())
+	}
+	return hs
+}
+
+// OpenHistoryStorage 打开指定路径的历史记录文件
+// 命令行模式使用与界面相同的路径，共享同一份历史记录。prefs 中有旧版本的历史记录时迁移到文件中。
+func OpenHistoryStorage(path string, prefs Preferences) (*HistoryStorage, error) {
+	backend, err := OpenFileBackend(path)
+	if err != nil {
+		return nil, err
+	}
+	return newHistoryStorage(backend, prefs), nil
+}
+
+func newHistoryStorage(backend HistoryBackend, prefs Preferences) *HistoryStorage {
 	hs := &HistoryStorage{
-		app:        a,
-		prefs:      a.Preferences(),
+		backend:    backend,
+		prefs:      prefs,
 		cache:      make(map[string]HistoryItem),
-		prefix:     "history_",
-		maxRecords: 500, // 最多保存500条记录
+		maxRecords: maxHistoryRecords,
 		recordKeys: []string{},
 	}
 
 	// 加载现有数据
 	hs.loadAll()
+	hs.failInterrupted()
 
 	return hs
 }
 
-// getKey 根据记录ID获取 preferences 键
-func (hs *HistoryStorage) getKey(id string) string {
-	return hs.prefix + id
-}
-
 // generateID 生成新的记录ID
 func (hs *HistoryStorage) generateID() string {
 	hs.idCounter++
 	return fmt.Sprintf("record_%d_%d", hs.idCounter, time.Now().UnixNano())
 }
 
-// loadRecord 加载单个记录
-func (hs *HistoryStorage) loadRecord(id string) (HistoryItem, error) {
-	key := hs.getKey(id)
-	dataStr := hs.prefs.String(key)
-
-	if dataStr == "" {
-		return HistoryItem{}, fmt.Errorf("记录不存在")
-	}
-
-	var item HistoryItem
-	if err := json.Unmarshal([]byte(dataStr), &item); err != nil {
-		return HistoryItem{}, fmt.Errorf("解析JSON失败: %v", err)
-	}
-
-	return item, nil
-}
-
 // saveRecord 保存单个记录
 func (hs *HistoryStorage) saveRecord(item HistoryItem) error {
-	key := hs.getKey(item.ID)
-
-	data, err := json.Marshal(item)
-	if err != nil {
-		return fmt.Errorf("编码JSON失败: %v", err)
+	if err := hs.backend.Put(item); err != nil {
+		return fmt.Errorf("保存记录失败: %w", err)
 	}
-
-	hs.prefs.SetString(key, string(data))
 	return nil
 }
 
-// saveRecordKeys 保存记录key列表
-func (hs *HistoryStorage) saveRecordKeys() error {
-	data, err := json.Marshal(hs.recordKeys)
-	if err != nil {
-		return fmt.Errorf("编码key列表失败: %v", err)
-	}
-
-	hs.prefs.SetString("history_keys", string(data))
-	return nil
+// refresh 其他进程修改了历史记录时重新加载，可以看到命令行在界面打开之后添加或删除的记录
+func (hs *HistoryStorage) refresh() {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.refreshLocked()
 }
 
-// loadRecordKeys 加载记录key列表
-func (hs *HistoryStorage) loadRecordKeys() error {
-	dataStr := hs.prefs.String("history_keys")
-	if dataStr == "" {
-		hs.recordKeys = []string{}
-		return nil
+// refreshLocked 与 refresh 相同，调用时必须持有 hs.mu
+func (hs *HistoryStorage) refreshLocked() {
+	changed, err := hs.backend.Refresh()
+	if err != nil {
+		log.Printf("读取历史记录的修改失败: %v\n", err)
+		return
 	}
-
-	var keys []string
-	if err := json.Unmarshal([]byte(dataStr), &keys); err != nil {
-		hs.recordKeys = []string{}
-		return fmt.Errorf("解析key列表失败: %v", err)
+	if !changed {
+		return
+	}
+	items, err := hs.backend.Load()
+	if err != nil {
+		log.Printf("加载历史记录失败: %v\n", err)
+		return
+	}
+	hs.cache = make(map[string]HistoryItem, len(items))
+	hs.recordKeys = make([]string, 0, len(items))
+	for _, item := range items {
+		hs.cache[item.ID] = item
+		hs.recordKeys = append(hs.recordKeys, item.ID)
 	}
+}
 
-	hs.recordKeys = keys
-	return nil
+// own 把未结束的记录标记为属于本进程，结束的记录清除所有者
+func (hs *HistoryStorage) own(item *HistoryItem) {
+	item.Owner = ""
+	if !item.Status.IsFinished() {
+		item.Owner = hs.backend.Owner()
+	}
 }
 
-// loadAll 加载所有历史记录
+// loadAll 加载所有历史记录，迁移偏好设置中旧版本的记录并升级旧格式
 func (hs *HistoryStorage) loadAll() {
 	hs.mu.Lock()
 	defer hs.mu.Unlock()
 
 	hs.cache = make(map[string]HistoryItem)
-	hs.idCounter = 0
+	hs.recordKeys = []string{}
 
-	// 加载记录key列表
-	if err := hs.loadRecordKeys(); err != nil {
-		fmt.Printf("加载记录key列表失败: %v\n", err)
-		hs.recordKeys = []string{}
+	items, err := hs.backend.Load()
+	if err != nil {
+		log.Printf("加载历史记录失败: %v\n", err)
 	}
+	for _, item := range items {
+		hs.cache[item.ID] = item
+		hs.recordKeys = append(hs.recordKeys, item.ID)
+	}
+	hs.migrateLegacy()
 
-	// 加载ID计数器
-	hs.idCounter = int64(hs.prefs.Int("history_id_counter"))
+	// 旧版本的记录升级后写回
+	migrated := 0
+	for _, id := range hs.recordKeys {
+		item := hs.cache[id]
+		if !item.migrate() {
+			continue
+		}
+		if err := hs.saveRecord(item); err != nil {
+			log.Printf("保存升级的记录 %s 失败: %v\n", id, err)
+		}
+		hs.cache[id] = item
+		migrated++
+	}
+	if migrated > 0 {
+		log.Printf("升级了 %d 条旧版本的历史记录\n", migrated)
+	}
+	hs.idCounter = int64(len(hs.recordKeys))
 
-	// 加载所有记录
-	loadedCount := 0
+	log.Printf("加载了 %d 条历史记录\n", len(hs.recordKeys))
+}
+
+// failInterrupted 把写入它的进程已经退出、但没有结束的记录标记为失败
+// 程序退出或崩溃时传输中的记录不会再更新，标记后可以删除或重试。界面和命令行同时打开历史记录时，
+// 另一个仍在运行的进程的传输不受影响。结束时间取记录最后一次更新的时间。
+func (hs *HistoryStorage) failInterrupted() {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	failed := 0
 	for _, id := range hs.recordKeys {
-		if item, err := hs.loadRecord(id); err == nil {
-			hs.cache[id] = item
-			loadedCount++
+		item := hs.cache[id]
+		if item.Status.IsFinished() || hs.backend.Alive(item.Owner) {
+			continue
+		}
+		transitions, err := advanceStatus(item.Status, item.Transitions, lifecycle.Failed, interruptedMessage)
+		if err != nil {
+			log.Printf("标记未结束的记录 %s 失败: %v\n", id, err)
+			continue
+		}
+		end := item.Timestamp.Add(time.Duration(item.Duration) * time.Second)
+		if n := len(item.Transitions); n > 0 && item.Transitions[n-1].At.After(end) {
+			end = item.Transitions[n-1].At
 		}
+		transitions[len(transitions)-1].At = end
+		item.Status = lifecycle.Failed
+		item.Transitions = transitions
+		item.Owner = ""
+		if err := hs.saveRecord(item); err != nil {
+			log.Printf("保存未结束的记录 %s 失败: %v\n", id, err)
+			continue
+		}
+		hs.cache[id] = item
+		failed++
+	}
+	if failed > 0 {
+		log.Printf("%d 条上次运行时没有结束的记录标记为失败\n", failed)
+	}
+}
+
+// migrateLegacy 把偏好设置中的记录移到历史记录文件中
+// 全部写入后才从偏好设置中删除，中途退出时下次启动继续迁移，已经迁移的记录不会重复。
+func (hs *HistoryStorage) migrateLegacy() {
+	if hs.prefs == nil {
+		return
+	}
+	legacy := legacyHistory{hs.prefs}
+	items := legacy.load()
+	if len(items) == 0 {
+		if legacy.ids() != nil {
+			legacy.remove()
+		}
+		return
+	}
+
+	moved := 0
+	for _, item := range items {
+		if _, exists := hs.cache[item.ID]; exists {
+			continue
+		}
+		if err := hs.saveRecord(item); err != nil {
+			log.Printf("迁移旧版本的记录 %s 失败: %v\n", item.ID, err)
+			return
+		}
+		hs.cache[item.ID] = item
+		hs.recordKeys = append(hs.recordKeys, item.ID)
+		moved++
 	}
+	legacy.remove()
+	log.Printf("从偏好设置迁移了 %d 条历史记录\n", moved)
+}
+
+// Close 关闭历史记录文件
+func (hs *HistoryStorage) Close() error {
+	return hs.backend.Close()
+}
 
-	fmt.Printf("加载了 %d 条历史记录\n", loadedCount)
+// StoreText 文本传输是否在历史记录中保存文本内容，默认不保存
+func (hs *HistoryStorage) StoreText() bool {
+	return hs.prefs.Int(storeTextKey) == 1
+}
+
+// SetStoreText 设置是否在历史记录中保存文本内容
+func (hs *HistoryStorage) SetStoreText(enabled bool) {
+	value := 0
+	if enabled {
+		value = 1
+	}
+	hs.prefs.SetInt(storeTextKey, value)
 }
 
 // Add 添加历史记录
@@ -160,46 +324,45 @@ func (hs *HistoryStorage) Add(item HistoryItem) (string, error) {
 	if item.ID == "" {
 		item.ID = hs.generateID()
 	}
+	if item.Version == 0 {
+		item.Version = HistoryVersion
+	}
 
 	recordID := item.ID
 
+	// 按文件中的最新记录计算记录数，包括其他进程添加的记录
+	hs.refreshLocked()
+
 	// 检查是否超出最大记录数限制
 	if len(hs.recordKeys) >= hs.maxRecords {
 		// 删除最旧的记录
 		oldestID := hs.recordKeys[0]
+		if err := hs.backend.Delete(oldestID); err != nil {
+			log.Printf("删除最旧的记录 %s 失败: %v\n", oldestID, err)
+			return "", err
+		}
 		hs.recordKeys = hs.recordKeys[1:]
 		delete(hs.cache, oldestID)
-
-		// 从 preferences 中删除最旧的记录
-		oldestKey := hs.getKey(oldestID)
-		hs.prefs.RemoveValue(oldestKey)
-	}
-
-	// 添加到记录key列表
-	hs.recordKeys = append(hs.recordKeys, recordID)
-
-	// 保存到缓存
-	hs.cache[recordID] = item
-
-	// 保存ID计数器
-	hs.prefs.SetInt("history_id_counter", int(hs.idCounter))
-
-	// 保存记录key列表
-	if err := hs.saveRecordKeys(); err != nil {
-		fmt.Printf("保存记录key列表失败: %v\n", err)
-		return "", err
 	}
 
 	// 同步保存记录
+	hs.own(&item)
 	if err := hs.saveRecord(item); err != nil {
-		fmt.Printf("保存记录 %s 失败: %v\n", recordID, err)
+		log.Printf("保存记录 %s 失败: %v\n", recordID, err)
 		return "", err
 	}
 
+	// 添加到记录key列表和缓存
+	if _, exists := hs.cache[recordID]; !exists {
+		hs.recordKeys = append(hs.recordKeys, recordID)
+	}
+	hs.cache[recordID] = item
+
 	return recordID, nil
 }
 
 // Update 更新历史记录
+// updater 修改 Status 时按状态机校验，不允许的状态转换会被拒绝。
 func (hs *HistoryStorage) Update(id string, updater func(*HistoryItem)) error {
 	hs.mu.Lock()
 	defer hs.mu.Unlock()
@@ -210,20 +373,70 @@ func (hs *HistoryStorage) Update(id string, updater func(*HistoryItem)) error {
 	}
 
 	// 更新记录
+	oldStatus, oldTransitions := item.Status, item.Transitions
 	updater(&item)
+	if item.Status != oldStatus {
+		transitions, err := advanceStatus(oldStatus, oldTransitions, item.Status, "")
+		if err != nil {
+			return err
+		}
+		item.Transitions = transitions
+	}
+
+	// 先保存，保存成功后才更新缓存，避免内存中的记录与文件不一致
+	hs.own(&item)
+	if err := hs.saveRecord(item); err != nil {
+		log.Printf("保存记录 %s 失败: %v\n", id, err)
+		return err
+	}
 	hs.cache[id] = item
 
-	// 同步保存
+	return nil
+}
+
+// Transition 将记录转换到新状态并保存，附带状态说明
+// 可以沿正常传输路径跳过中间状态，状态相同时不做任何事。
+func (hs *HistoryStorage) Transition(id string, to lifecycle.State, message string) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	item, exists := hs.cache[id]
+	if !exists {
+		return fmt.Errorf("未找到ID为 %s 的记录", id)
+	}
+	if item.Status == to {
+		return nil
+	}
+
+	transitions, err := advanceStatus(item.Status, item.Transitions, to, message)
+	if err != nil {
+		return err
+	}
+	item.Status = to
+	item.Transitions = transitions
+	hs.own(&item)
+
 	if err := hs.saveRecord(item); err != nil {
-		fmt.Printf("保存记录 %s 失败: %v\n", id, err)
+		log.Printf("保存记录 %s 失败: %v\n", id, err)
 		return err
 	}
+	hs.cache[id] = item
 
 	return nil
 }
 
+// advanceStatus 校验状态转换并返回新的转换记录
+func advanceStatus(from lifecycle.State, transitions []lifecycle.Transition, to lifecycle.State, message string) ([]lifecycle.Transition, error) {
+	machine := lifecycle.Restore(from, transitions)
+	if err := machine.Advance(to, message); err != nil {
+		return nil, fmt.Errorf("记录状态更新失败: %w", err)
+	}
+	return machine.Transitions(), nil
+}
+
 // GetAll 获取所有历史记录
 func (hs *HistoryStorage) GetAll() ([]HistoryItem, error) {
+	hs.refresh()
 	hs.mu.RLock()
 	defer hs.mu.RUnlock()
 
@@ -263,17 +476,12 @@ func (hs *HistoryStorage) Clear() error {
 	defer hs.mu.Unlock()
 
 	// 删除所有记录
-	for id := range hs.cache {
-		key := hs.getKey(id)
-		hs.prefs.RemoveValue(key)
+	if err := hs.backend.Clear(); err != nil {
+		return fmt.Errorf("清除记录失败: %w", err)
 	}
 
 	// 清除记录key列表
 	hs.recordKeys = []string{}
-	hs.prefs.RemoveValue("history_keys")
-
-	// 重置计数器
-	hs.prefs.SetInt("history_id_counter", 0)
 
 	hs.cache = make(map[string]HistoryItem)
 	hs.idCounter = 0
@@ -283,17 +491,18 @@ func (hs *HistoryStorage) Clear() error {
 
 // GetStats 获取统计信息
 func (hs *HistoryStorage) GetStats() (total, completed, failed, inProgress int, err error) {
+	hs.refresh()
 	hs.mu.RLock()
 	defer hs.mu.RUnlock()
 
 	total = len(hs.cache)
 	for _, item := range hs.cache {
-		switch item.Status {
-		case "completed":
+		switch {
+		case item.Status == lifecycle.Completed:
 			completed++
-		case "failed":
+		case item.Status == lifecycle.Failed:
 			failed++
-		case "in_progress":
+		case !item.Status.IsFinished():
 			inProgress++
 		}
 	}
@@ -303,19 +512,19 @@ func (hs *HistoryStorage) GetStats() (total, completed, failed, inProgress int,
 
 // GetStorageInfo 获取存储信息
 func (hs *HistoryStorage) GetStorageInfo() (recordCount int, totalSize int64, err error) {
+	hs.refresh()
 	hs.mu.RLock()
 	defer hs.mu.RUnlock()
 
 	recordCount = len(hs.cache)
 
 	// 计算总大小
-	for id, item := range hs.cache {
+	for _, item := range hs.cache {
 		data, jsonErr := json.Marshal(item)
 		if jsonErr != nil {
 			continue
 		}
 		totalSize += int64(len(data))
-		totalSize += int64(len(hs.getKey(id))) // 键的大小
 	}
 
 	return recordCount, totalSize, nil
@@ -325,11 +534,17 @@ func (hs *HistoryStorage) GetStorageInfo() (recordCount int, totalSize int64, er
 func (hs *HistoryStorage) Delete(id string) error {
 	hs.mu.Lock()
 	defer hs.mu.Unlock()
+	hs.refreshLocked()
 
 	if _, exists := hs.cache[id]; !exists {
 		return fmt.Errorf("记录不存在")
 	}
 
+	if err := hs.backend.Delete(id); err != nil {
+		log.Printf("删除记录 %s 失败: %v\n", id, err)
+		return err
+	}
+
 	// 从缓存中删除
 	delete(hs.cache, id)
 
@@ -341,16 +556,6 @@ func (hs *HistoryStorage) Delete(id string) error {
 		}
 	}
 
-	// 保存更新后的记录key列表
-	if err := hs.saveRecordKeys(); err != nil {
-		fmt.Printf("保存记录key列表失败: %v\n", err)
-		return err
-	}
-
-	// 从 preferences 中删除
-	key := hs.getKey(id)
-	hs.prefs.RemoveValue(key)
-
 	return nil
 }
 
@@ -381,8 +586,9 @@ func (hs *HistoryStorage) Import(jsonData string) error {
 		return fmt.Errorf("清除现有数据失败: %v", err)
 	}
 
-	// 添加导入的数据
+	// 添加导入的数据，旧版本导出的记录先升级
 	for _, item := range items {
+		item.migrate()
 		if _, err := hs.Add(item); err != nil {
 			return fmt.Errorf("添加记录失败: %v", err)
 		}
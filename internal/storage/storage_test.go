@@ -1,19 +1,34 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
-	"fyne.io/fyne/v2/app"
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
 )
 
 // setupTestStorage 创建测试用的历史存储
-func setupTestStorage(t *testing.T) *HistoryStorage {
-	// 为每个测试使用唯一的ID，避免数据冲突
-	testApp := app.NewWithID(fmt.Sprintf("com.test.mocroc.%d", time.Now().UnixNano()))
+func setupTestStorage(t testing.TB) *HistoryStorage {
+	return openTestStorage(t, t.TempDir())
+}
 
-	storage := NewHistoryStorage(testApp)
+// openTestStorage 打开 dir 中的偏好设置和历史记录文件，用同一目录再次打开可以模拟应用重启
+func openTestStorage(t testing.TB, dir string) *HistoryStorage {
+	t.Helper()
+	prefs, err := OpenFilePreferences(filepath.Join(dir, "preferences.json"))
+	if err != nil {
+		t.Fatalf("打开偏好设置失败: %v", err)
+	}
+	storage, err := OpenHistoryStorage(filepath.Join(dir, HistoryFileName), prefs)
+	if err != nil {
+		t.Fatalf("打开历史记录失败: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
 	return storage
 }
 
@@ -139,16 +154,9 @@ func TestClear(t *testing.T) {
 // TestMaxRecordsLimit 测试最大记录数限制
 func TestMaxRecordsLimit(t *testing.T) {
 	// 创建一个限制较小的存储用于测试
-	testApp := app.NewWithID(fmt.Sprintf("com.test.mocroc.limit.%d", time.Now().UnixNano()))
-
-	storage := &HistoryStorage{
-		app:        testApp,
-		prefs:      testApp.Preferences(),
-		cache:      make(map[string]HistoryItem),
-		prefix:     "history_",
-		maxRecords: 3, // 设置最大记录数为3
-		recordKeys: []string{},
-	}
+	dir := t.TempDir()
+	storage := openTestStorage(t, dir)
+	storage.maxRecords = 3 // 设置最大记录数为3
 
 	// 添加5条记录
 	var ids []string
@@ -174,6 +182,13 @@ func TestMaxRecordsLimit(t *testing.T) {
 	if len(storage.cache) != 3 {
 		t.Errorf("期望缓存中有 3 条记录，实际为 %d", len(storage.cache))
 	}
+
+	// 删除的记录不会在重启后出现
+	storage.Close()
+	reopened := openTestStorage(t, dir)
+	if len(reopened.recordKeys) != 3 || reopened.recordKeys[0] != ids[2] {
+		t.Errorf("重新加载的记录不正确: %v，期望从 %s 开始", reopened.recordKeys, ids[2])
+	}
 }
 
 // TestGetStats 测试获取统计信息
@@ -182,12 +197,12 @@ func TestGetStats(t *testing.T) {
 
 	// 添加不同状态的记录
 	records := []struct {
-		status string
+		status lifecycle.State
 	}{
 		{"completed"},
 		{"completed"},
 		{"failed"},
-		{"in_progress"},
+		{lifecycle.Transferring},
 		{"completed"},
 	}
 
@@ -280,12 +295,9 @@ func TestExportImport(t *testing.T) {
 
 // TestPersistenceWrite 测试数据确实被写入Preferences
 func TestPersistenceWrite(t *testing.T) {
-	// 使用固定的应用ID，确保数据可以持久化
-	testApp := app.NewWithID("com.test.mocroc.persistence.test")
-	storage := NewHistoryStorage(testApp)
-
-	// 清除可能存在的旧数据
-	storage.Clear()
+	// 使用同一个目录，确保数据可以持久化
+	dir := t.TempDir()
+	storage := openTestStorage(t, dir)
 
 	// 添加一些记录
 	expectedRecords := 3
@@ -315,7 +327,8 @@ func TestPersistenceWrite(t *testing.T) {
 	}
 
 	// 创建新的存储实例，模拟应用重启
-	storage2 := NewHistoryStorage(testApp)
+	storage.Close()
+	storage2 := openTestStorage(t, dir)
 
 	// 验证数据被重新加载
 	allItems, err := storage2.GetAll()
@@ -341,9 +354,304 @@ func TestPersistenceWrite(t *testing.T) {
 	storage2.Clear()
 }
 
+// TestTransition 测试状态转换的校验
+func TestTransition(t *testing.T) {
+	storage := setupTestStorage(t)
+
+	id, err := storage.Add(HistoryItem{
+		Type:      "send",
+		FileName:  "state.txt",
+		Status:    lifecycle.Preparing,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+
+	if err := storage.Transition(id, lifecycle.Waiting, "等待接收方连接..."); err != nil {
+		t.Fatalf("转换到等待状态失败: %v", err)
+	}
+	// 传输太快时可以直接从等待前进到完成
+	if err := storage.Transition(id, lifecycle.Completed, "发送完成！"); err != nil {
+		t.Fatalf("转换到完成状态失败: %v", err)
+	}
+
+	// 完成后不能再回到传输中
+	if err := storage.Transition(id, lifecycle.Transferring, ""); err == nil {
+		t.Error("期望拒绝 completed → transferring")
+	}
+	err = storage.Update(id, func(item *HistoryItem) {
+		item.Status = lifecycle.Failed
+	})
+	if err == nil {
+		t.Error("期望 Update 拒绝 completed → failed")
+	}
+
+	item := storage.cache[id]
+	if item.Status != lifecycle.Completed {
+		t.Errorf("期望状态为 completed，实际为 %s", item.Status)
+	}
+	var path []lifecycle.State
+	for _, tr := range item.Transitions {
+		path = append(path, tr.To)
+	}
+	want := []lifecycle.State{lifecycle.Waiting, lifecycle.Transferring, lifecycle.Verifying, lifecycle.Completed}
+	if fmt.Sprint(path[len(path)-len(want):]) != fmt.Sprint(want) {
+		t.Errorf("状态转换记录不正确: %v", path)
+	}
+}
+
+// TestFailInterrupted 测试重新打开时把上次没有结束的记录标记为失败
+func TestFailInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	storage := openTestStorage(t, dir)
+
+	start := time.Now().Add(-time.Hour)
+	running, err := storage.Add(HistoryItem{Type: "receive", Code: "1234-crash", Status: lifecycle.Preparing, Timestamp: start})
+	if err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+	if err := storage.Transition(running, lifecycle.Waiting, ""); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := storage.Get(running)
+	lastUpdate := before.Transitions[len(before.Transitions)-1].At
+	done, err := storage.Add(HistoryItem{Type: "send", Status: lifecycle.Completed, Timestamp: start})
+	if err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+	storage.Close()
+	time.Sleep(10 * time.Millisecond)
+
+	// 模拟程序崩溃后重新启动
+	reopened := openTestStorage(t, dir)
+	item, _ := reopened.Get(running)
+	if item.Status != lifecycle.Failed || item.ErrorMessage() != interruptedMessage {
+		t.Errorf("未结束的记录应标记为失败: %s %q", item.Status, item.ErrorMessage())
+	}
+	// 结束时间是最后一次更新的时间，不是重新打开的时间
+	if at := item.Transitions[len(item.Transitions)-1].At; !at.Equal(lastUpdate) {
+		t.Errorf("结束时间为 %v，期望 %v", at, lastUpdate)
+	}
+	if item, _ := reopened.Get(done); item.Status != lifecycle.Completed {
+		t.Errorf("已结束的记录不应改变: %s", item.Status)
+	}
+	if err := reopened.Delete(running); err != nil {
+		t.Errorf("标记为失败的记录应可以删除: %v", err)
+	}
+}
+
+// TestFailInterrupted_OtherProcess 测试另一个进程（如命令行）打开历史记录时不影响仍在运行的传输
+func TestFailInterrupted_OtherProcess(t *testing.T) {
+	dir := t.TempDir()
+	gui := openTestStorage(t, dir)
+	id, err := gui.Add(HistoryItem{Type: "send", Code: "1234-live", Status: lifecycle.Waiting, Timestamp: time.Now()})
+	if err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+
+	cli := openTestStorage(t, dir)
+	if item, _ := cli.Get(id); item.Status != lifecycle.Waiting {
+		t.Errorf("仍在运行的传输不应标记为失败: %s %q", item.Status, item.ErrorMessage())
+	}
+	cli.Close()
+
+	// 界面退出后再打开时标记为失败
+	gui.Close()
+	reopened := openTestStorage(t, dir)
+	if item, _ := reopened.Get(id); item.Status != lifecycle.Failed || item.Owner != "" {
+		t.Errorf("进程退出后的记录应标记为失败: %s %q", item.Status, item.Owner)
+	}
+	reopened.Close()
+	if entries, _ := os.ReadDir(filepath.Join(dir, HistoryFileName+".owners")); len(entries) != 0 {
+		t.Errorf("关闭后留下了所有者文件: %v", entries)
+	}
+}
+
+// TestSharedHistory 测试界面看到命令行在它打开之后添加的记录，可以删除这些记录，记录数限制也包括它们
+func TestSharedHistory(t *testing.T) {
+	dir := t.TempDir()
+	gui := openTestStorage(t, dir)
+	gui.maxRecords = 2
+	first, err := gui.Add(HistoryItem{Type: "send", FileName: "gui.txt", Status: lifecycle.Completed})
+	if err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+
+	cli := openTestStorage(t, dir)
+	id, err := cli.Add(HistoryItem{Type: "send", FileName: "cli.txt", Status: lifecycle.Completed})
+	if err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+	items, _ := gui.GetAll()
+	if len(items) != 2 || items[0].ID != id {
+		t.Fatalf("界面没有看到命令行添加的记录: %+v", items)
+	}
+	if err := gui.Delete(id); err != nil {
+		t.Fatalf("删除记录失败: %v", err)
+	}
+	if _, ok := cli.Get(id); ok {
+		t.Error("删除的记录在命令行中仍然存在")
+	}
+
+	// 命令行再添加一条后界面添加记录时超出限制，删除最旧的记录
+	if _, err := cli.Add(HistoryItem{Type: "send", FileName: "cli2.txt", Status: lifecycle.Completed}); err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+	if _, err := gui.Add(HistoryItem{Type: "send", FileName: "gui2.txt", Status: lifecycle.Completed}); err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+	items, _ = cli.GetAll()
+	if len(items) != 2 || items[0].FileName != "gui2.txt" || items[1].FileName != "cli2.txt" {
+		t.Errorf("超出限制后的记录不正确: %+v", items)
+	}
+	if _, ok := gui.Get(first); ok {
+		t.Error("最旧的记录应被删除")
+	}
+}
+
+// failingBackend 写入总是失败的存储后端
+type failingBackend struct {
+	memoryBackend
+	fail bool
+}
+
+func (b *failingBackend) Put(item HistoryItem) error {
+	if b.fail {
+		return errors.New("磁盘已满")
+	}
+	return b.memoryBackend.Put(item)
+}
+
+// TestUpdateSaveFailure 测试保存失败时缓存保持原样
+func TestUpdateSaveFailure(t *testing.T) {
+	backend := &failingBackend{}
+	storage := newHistoryStorage(backend, nil)
+	id, err := storage.Add(HistoryItem{Type: "send", FileName: "a.txt", Status: lifecycle.Waiting})
+	if err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+
+	backend.fail = true
+	if err := storage.Update(id, func(item *HistoryItem) { item.FileName = "b.txt" }); err == nil {
+		t.Error("期望 Update 返回保存失败")
+	}
+	if err := storage.Transition(id, lifecycle.Transferring, ""); err == nil {
+		t.Error("期望 Transition 返回保存失败")
+	}
+	item, _ := storage.Get(id)
+	if item.FileName != "a.txt" || item.Status != lifecycle.Waiting {
+		t.Errorf("保存失败后缓存被修改: %+v", item)
+	}
+}
+
+// TestLegacyStatus 测试旧版本状态的兼容
+func TestLegacyStatus(t *testing.T) {
+	storage := setupTestStorage(t)
+
+	storage.prefs.SetString(legacyKeysKey, `["old"]`)
+	storage.prefs.SetString(legacyRecordPrefix+"old", `{"id":"old","type":"receive","status":"in_progress"}`)
+	storage.loadAll()
+
+	item, ok := storage.cache["old"]
+	if !ok {
+		t.Fatal("旧记录没有被加载")
+	}
+	if item.Status != lifecycle.Transferring {
+		t.Errorf("期望 in_progress 被转换为 transferring，实际为 %s", item.Status)
+	}
+	if err := storage.Transition("old", lifecycle.Failed, "中断"); err != nil {
+		t.Errorf("旧记录转换到失败状态失败: %v", err)
+	}
+}
+
+// TestStoreText 测试保存文本内容的开关
+func TestStoreText(t *testing.T) {
+	storage := setupTestStorage(t)
+
+	if storage.StoreText() {
+		t.Error("默认不应保存文本内容")
+	}
+	storage.SetStoreText(true)
+	if !storage.StoreText() {
+		t.Error("开启后应保存文本内容")
+	}
+
+	id, err := storage.Add(HistoryItem{Type: "receive", FileName: "文本内容", Text: "你好", Timestamp: time.Now()})
+	if err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+	storage.loadAll()
+	if item := storage.cache[id]; item.Text != "你好" {
+		t.Errorf("期望保存文本 你好，实际为 %q", item.Text)
+	}
+
+	storage.SetStoreText(false)
+	if storage.StoreText() {
+		t.Error("关闭后不应保存文本内容")
+	}
+}
+
+// TestResumeInfo 测试中断传输的断点信息
+func TestResumeInfo(t *testing.T) {
+	storage := setupTestStorage(t)
+
+	resume := &crocmgr.Resume{
+		Direction: crocmgr.DirectionReceive,
+		Code:      "1234-bravo-lemon",
+		Dir:       "/tmp/downloads",
+		Files:     []crocmgr.ResumeFile{{Name: "a.bin", Size: 100, BytesDone: 40}},
+	}
+	id, err := storage.Add(HistoryItem{Type: "receive", Status: lifecycle.Transferring, Timestamp: time.Now(), Resume: resume})
+	if err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+	if storage.cache[id].Resumable() {
+		t.Error("进行中的记录不能继续")
+	}
+	if err := storage.Transition(id, lifecycle.Failed, "连接断开"); err != nil {
+		t.Fatalf("转换到失败状态失败: %v", err)
+	}
+
+	storage.loadAll()
+	item := storage.cache[id]
+	if !item.Resumable() || item.Resume.Dir != "/tmp/downloads" || item.Resume.BytesDone() != 40 {
+		t.Errorf("断点信息没有被保存: %+v", item.Resume)
+	}
+
+	if err := storage.Update(id, func(item *HistoryItem) { item.Resume = nil }); err != nil {
+		t.Fatalf("清除断点信息失败: %v", err)
+	}
+	if storage.cache[id].Resumable() {
+		t.Error("清除后不能继续")
+	}
+}
+
+func TestVerificationReport(t *testing.T) {
+	storage := setupTestStorage(t)
+
+	report := &crocmgr.Verification{
+		Algorithm: crocmgr.HashHighway,
+		Files: []crocmgr.FileCheck{
+			{Name: "a.bin", Size: 100, Expected: "00ff", Actual: "00ff", OK: true},
+			{Name: "sub/b.bin", Size: 200, Expected: "00ff", Actual: "ff00"},
+		},
+	}
+	id, err := storage.Add(HistoryItem{Type: "receive", Status: lifecycle.Failed, Timestamp: time.Now(), Verification: report})
+	if err != nil {
+		t.Fatalf("添加记录失败: %v", err)
+	}
+
+	storage.loadAll()
+	v := storage.cache[id].Verification
+	if v == nil || v.Algorithm != crocmgr.HashHighway || len(v.Files) != 2 || v.Passed() || v.Files[1].Actual != "ff00" {
+		t.Errorf("校验报告没有被保存: %+v", v)
+	}
+}
+
 // BenchmarkAddRecord 性能测试：添加记录
 func BenchmarkAddRecord(b *testing.B) {
-	storage := setupTestStorage(&testing.T{})
+	storage := setupTestStorage(b)
 
 	item := HistoryItem{
 		Type:       "send",
@@ -365,7 +673,7 @@ func BenchmarkAddRecord(b *testing.B) {
 
 // BenchmarkGetAll 性能测试：获取所有记录
 func BenchmarkGetAll(b *testing.B) {
-	storage := setupTestStorage(&testing.T{})
+	storage := setupTestStorage(b)
 
 	// 预先添加一些记录
 	for i := 0; i < 100; i++ {
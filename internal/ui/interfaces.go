@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/schollz/croc/v10/src/croc"
+	"github.com/shapled/mocroc/internal/crocmgr"
 )
 
 // CrocManager 定义 Croc 操作接口
@@ -14,4 +15,25 @@ type CrocManager interface {
 	GetCrocClient() *croc.Client
 	Close()
 	Log(msg string)
+
+	// 传输任务
+	StartSend(options croc.Options, filesInfo []croc.FileInfo, emptyFolders []croc.FileInfo, totalNumberFolders int) (*crocmgr.Transfer, error)
+	StartSendPaths(options croc.Options, paths []string) (*crocmgr.Transfer, error)
+	StartSendSelection(options croc.Options, paths, skip []string) (*crocmgr.Transfer, error)
+	StartSendText(options croc.Options, text string) (*crocmgr.Transfer, error)
+	StartReceive(options croc.Options) (*crocmgr.Transfer, error)
+	StartReceiveWithPreview(options croc.Options) (*crocmgr.Transfer, error)
+	StartReceiveWithRules(options croc.Options, rules crocmgr.SaveRules) (*crocmgr.Transfer, error)
+	Resume(r crocmgr.Resume) (*crocmgr.Transfer, error)
+	GetTransfer(id string) (*crocmgr.Transfer, bool)
+	ListTransfers() []*crocmgr.Transfer
+	CancelTransfer(id string) error
+
+	// 传输事件
+	Events() *crocmgr.EventBus
+
+	// 中继诊断
+	Diagnostics() *crocmgr.Diagnostics
 }
+
+var _ CrocManager = (*crocmgr.Manager)(nil)
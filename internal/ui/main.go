@@ -5,7 +5,9 @@ import (
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/share"
 	"github.com/shapled/mocroc/internal/storage"
 	"github.com/shapled/mocroc/internal/ui/components"
 	"github.com/shapled/mocroc/internal/ui/pages"
@@ -20,6 +22,8 @@ const (
 	PageTypeReceive
 	PageTypeReceiveDetail
 	PageTypeHistory
+	PageTypeHistoryDetail
+	PageTypeDiagnostics
 )
 
 type MainUI struct {
@@ -29,6 +33,7 @@ type MainUI struct {
 	// Croc 管理器和存储
 	crocManager    *crocmgr.Manager
 	historyStorage *storage.HistoryStorage
+	relayProfiles  *storage.RelayProfileStore
 
 	// 公共属性
 	currentPage PageType
@@ -41,22 +46,27 @@ type MainUI struct {
 	sendPage          *pages.SendPage
 	receivePage       *pages.ReceivePage
 	historyPage       *pages.HistoryPage
+	historyDetailPage *pages.HistoryDetailPage
 	sendDetailPage    *pages.SendDetailPage
 	receiveDetailPage *pages.ReceiveDetailPage
+	diagnosticsPage   *pages.DiagnosticsPage
 }
 
-func NewMainUI(a fyne.App, w fyne.Window) fyne.CanvasObject {
+// NewMainUI 创建主界面，args 中的 mocroc 链接直接打开接收页
+func NewMainUI(a fyne.App, w fyne.Window, args []string) fyne.CanvasObject {
 	mainUI := &MainUI{
 		app:            a,
 		window:         w,
 		crocManager:    crocmgr.NewManager(),
 		historyStorage: storage.NewHistoryStorage(a),
+		relayProfiles:  storage.NewRelayProfileStore(a.Preferences()),
 		currentPage:    PageTypeHome,
 	}
 
 	// 初始化页面
 	mainUI.createPages()
 	mainUI.buildMainWindow()
+	mainUI.openLinks(args)
 
 	// 创建布局：顶部导航栏 + 内容 + 底部导航栏
 	return container.NewBorder(mainUI.topBar.Container, mainUI.bottomNav.Container(), nil, nil, mainUI.content)
@@ -86,6 +96,7 @@ func (ui *MainUI) createPages() {
 		func() { ui.navigateTo(PageTypeSend) },
 		func() { ui.navigateTo(PageTypeReceive) },
 		func() { ui.navigateTo(PageTypeHistory) },
+		func() { ui.navigateTo(PageTypeDiagnostics) },
 	)
 
 	// 创建详情页面
@@ -107,96 +118,78 @@ func (ui *MainUI) createPages() {
 				ui.receivePage.Cancel()
 			}
 		},
+		func(choices crocmgr.ConflictChoices) {
+			// 接受发送方提供的文件，同名文件按选择的方式处理
+			if ui.receivePage != nil {
+				ui.receivePage.Accept(choices)
+			}
+		},
+		func() {
+			// 拒绝发送方提供的文件
+			if ui.receivePage != nil {
+				ui.receivePage.Reject()
+			}
+		},
 	)
 
 	// 创建功能页面
-	ui.sendPage = pages.NewSendTab(ui.crocManager, ui.window, ui.app)
-	ui.receivePage = pages.NewReceiveTab(ui.crocManager, ui.window, ui.historyStorage)
+	ui.sendPage = pages.NewSendTab(ui.crocManager, ui.window, ui.historyStorage, ui.relayProfiles, ui.app.Preferences())
+	ui.receivePage = pages.NewReceiveTab(ui.crocManager, ui.window, ui.historyStorage, ui.relayProfiles, ui.app.Preferences())
 	ui.historyPage = pages.NewHistoryPage(ui.historyStorage)
+	ui.historyDetailPage = pages.NewHistoryDetailPage(ui.historyStorage, ui.window)
+	ui.diagnosticsPage = pages.NewDiagnosticsPage(ui.crocManager.Diagnostics(), ui.relayProfiles)
 
 	// 设置导航回调
 	ui.sendPage.SetOnNavigateToDetail(func() {
-		// 设置详情页数据
+		// 设置详情页数据，后续状态由传输事件更新
 		if ui.sendDetailPage != nil {
 			fileName, code, _ := ui.sendPage.GetSendData()
+			ui.sendDetailPage.Reset()
 			ui.sendDetailPage.SetFileName(fileName)
 			ui.sendDetailPage.SetCode(code)
-			ui.sendDetailPage.SetState(pages.SendDetailStateWaiting)
-			ui.sendDetailPage.SetStatusMessage("等待接收端连接...")
 		}
 		ui.NavigateToSendDetail()
 	})
 
-	// 设置详情页更新回调
-	ui.sendPage.SetOnUpdateDetail(func(state string, progress float64, message string) {
-		fyne.Do(func() {
-			if ui.sendDetailPage != nil {
-				switch state {
-				case "waiting":
-					ui.sendDetailPage.SetStateAndMessage(pages.SendDetailStateWaiting, message)
-				case "sending":
-					ui.sendDetailPage.SetStateAndMessage(pages.SendDetailStateSending, message)
-					ui.sendDetailPage.SetProgress(progress)
-				case "completed":
-					ui.sendDetailPage.SetStateAndMessage(pages.SendDetailStateCompleted, message)
-					ui.sendDetailPage.SetProgress(1.0)
-				case "failed":
-					ui.sendDetailPage.SetStateAndMessage(pages.SendDetailStateFailed, message)
-				case "cancelled":
-					ui.sendDetailPage.SetStateAndMessage(pages.SendDetailStateCancelled, message)
-				}
-				// 刷新详情页显示
-				ui.content.Refresh()
-			}
-		})
+	// 中继确定后在发送详情页显示二维码
+	ui.sendPage.SetOnInvite(func(invite share.Invite) {
+		ui.sendDetailPage.SetInvite(invite)
+		if ui.currentPage == PageTypeSendDetail {
+			ui.updateContent()
+		}
 	})
 
 	// 设置接收页面导航回调
 	ui.receivePage.SetOnNavigateToDetail(func() {
-		// 设置详情页数据
+		// 设置详情页数据，后续状态由传输事件更新
 		if ui.receiveDetailPage != nil {
 			code, savePath := ui.receivePage.GetReceiveData()
+			ui.receiveDetailPage.Reset()
 			ui.receiveDetailPage.SetFileName("获取文件信息中...")
+			ui.receiveDetailPage.SetCode(code)
 			ui.receiveDetailPage.SetSenderInfo("发送方 (" + code + ")")
 			ui.receiveDetailPage.SetSavePath(savePath)
-			ui.receiveDetailPage.SetState(pages.ReceiveDetailStateConnecting)
-			ui.receiveDetailPage.SetStatusMessage("正在连接发送方...")
+			ui.receiveDetailPage.SetConflictPolicy(ui.receivePage.ConflictPolicy())
 		}
 		ui.NavigateToReceiveDetail()
 	})
 
-	// 设置接收详情页更新回调
-	ui.receivePage.SetOnUpdateDetail(func(state string, progress float64, message string) {
-		fyne.Do(func() {
-			if ui.receiveDetailPage != nil {
-				switch state {
-				case "connecting":
-					ui.receiveDetailPage.SetState(pages.ReceiveDetailStateConnecting)
-					ui.receiveDetailPage.SetStatusMessage(message)
-					ui.receiveDetailPage.SetProgress(0.0)
-				case "receiving":
-					ui.receiveDetailPage.SetState(pages.ReceiveDetailStateReceiving)
-					ui.receiveDetailPage.SetStatusMessage(message)
-					ui.receiveDetailPage.SetProgress(progress)
-				case "completed":
-					ui.receiveDetailPage.SetState(pages.ReceiveDetailStateCompleted)
-					ui.receiveDetailPage.SetStatusMessage(message)
-					ui.receiveDetailPage.SetProgress(1.0)
-				case "failed":
-					ui.receiveDetailPage.SetState(pages.ReceiveDetailStateFailed)
-					ui.receiveDetailPage.SetStatusMessage(message)
-					ui.receiveDetailPage.SetProgress(0.0)
-				case "cancelled":
-					ui.receiveDetailPage.SetState(pages.ReceiveDetailStateCancelled)
-					ui.receiveDetailPage.SetStatusMessage(message)
-					ui.receiveDetailPage.SetProgress(0.0)
-				}
-				// 刷新详情页显示
-				ui.content.Refresh()
-			}
-		})
+	// 历史记录中继续中断的传输，由发送页或接收页接管
+	ui.historyPage.SetOnResume(ui.window, ui.ResumeTransfer)
+
+	// 点击历史记录打开详情页，重新传输由发送页或接收页接管
+	ui.historyPage.SetOnOpen(func(item storage.HistoryItem) {
+		ui.historyDetailPage.SetItem(item.ID)
+		ui.navigateTo(PageTypeHistoryDetail)
+	})
+	ui.historyDetailPage.SetActions(ui.sendPage.Resend, ui.receivePage.Retry, func() {
+		ui.navigateTo(PageTypeHistory)
 	})
 
+	// 订阅传输事件，在主线程中更新详情页和历史页
+	// 功能页面先于这里订阅，收到事件时历史记录已经更新
+	ui.crocManager.Events().SubscribeWith(fyne.Do, ui.onTransferEvent)
+
 	// 创建内容容器 - 使用滚动容器让内容可以填满空间
 	ui.content = container.NewScroll(ui.homePage.Build())
 }
@@ -251,6 +244,17 @@ func (ui *MainUI) updateContent() {
 		ui.bottomNav.SetActivePage("history")
 		content = ui.historyPage.Build()
 		ui.historyPage.Refresh()
+	case PageTypeHistoryDetail:
+		ui.topBar.SetTitle("记录详情")
+		ui.topBar.Show()
+		ui.bottomNav.Hide() // 详情页隐藏底部导航
+		content = ui.historyDetailPage.Build()
+	case PageTypeDiagnostics:
+		ui.topBar.SetTitle("网络诊断")
+		ui.topBar.Show()
+		ui.bottomNav.Show()
+		ui.bottomNav.SetActivePage("home")
+		content = ui.diagnosticsPage.Build()
 	case PageTypeHome:
 		fallthrough
 	default:
@@ -265,14 +269,39 @@ func (ui *MainUI) updateContent() {
 	ui.content.Refresh()
 }
 
+// onTransferEvent 把传输事件分发给详情页和历史页
+func (ui *MainUI) onTransferEvent(e crocmgr.Event) {
+	switch e.Direction {
+	case crocmgr.DirectionSend:
+		if ui.sendDetailPage.HandleEvent(e) && ui.currentPage == PageTypeSendDetail {
+			ui.updateContent()
+		}
+	case crocmgr.DirectionReceive:
+		if ui.receiveDetailPage.HandleEvent(e) && ui.currentPage == PageTypeReceiveDetail {
+			ui.updateContent()
+		}
+	}
+
+	// 进度事件不影响历史记录列表
+	if e.Type == crocmgr.EventProgress || e.Type == crocmgr.EventFileStarted {
+		return
+	}
+	ui.historyPage.Refresh()
+	if ui.currentPage == PageTypeHistory || ui.currentPage == PageTypeHistoryDetail {
+		ui.updateContent()
+	}
+}
+
 func (ui *MainUI) goBack() {
 	switch ui.currentPage {
-	case PageTypeSend, PageTypeReceive, PageTypeHistory:
+	case PageTypeSend, PageTypeReceive, PageTypeHistory, PageTypeDiagnostics:
 		ui.navigateTo(PageTypeHome)
 	case PageTypeSendDetail:
 		ui.navigateTo(PageTypeSend)
 	case PageTypeReceiveDetail:
 		ui.navigateTo(PageTypeReceive)
+	case PageTypeHistoryDetail:
+		ui.navigateTo(PageTypeHistory)
 	default:
 		ui.navigateTo(PageTypeHome)
 	}
@@ -288,6 +317,39 @@ func (ui *MainUI) NavigateToReceiveDetail() {
 	ui.navigateTo(PageTypeReceiveDetail)
 }
 
+// OpenInvite 打开接收页并填入链接中的接收码和中继设置
+func (ui *MainUI) OpenInvite(invite share.Invite) {
+	ui.navigateTo(PageTypeReceive)
+	ui.receivePage.ApplyInvite(invite)
+}
+
+// ResumeTransfer 使用相同的接收码继续历史记录中中断的传输
+func (ui *MainUI) ResumeTransfer(item storage.HistoryItem) error {
+	if !item.Resumable() {
+		return crocmgr.ErrNotResumable
+	}
+	if item.Resume.Direction == crocmgr.DirectionSend {
+		return ui.sendPage.Resume(item)
+	}
+	return ui.receivePage.Resume(item)
+}
+
+// openLinks 处理启动参数中的 mocroc 链接，系统打开链接时会这样启动
+func (ui *MainUI) openLinks(args []string) {
+	for _, arg := range args {
+		if !share.IsInviteURI(arg) {
+			continue
+		}
+		invite, err := share.ParseInvite(arg)
+		if err != nil {
+			dialog.ShowError(err, ui.window)
+			return
+		}
+		ui.OpenInvite(invite)
+		return
+	}
+}
+
 // GetSendDetailPage 获取发送详情页实例
 func (ui *MainUI) GetSendDetailPage() *pages.SendDetailPage {
 	return ui.sendDetailPage
@@ -0,0 +1,82 @@
+package pages
+
+import (
+	"log"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/shapled/mocroc/internal/codephrase"
+	"github.com/shapled/mocroc/internal/storage"
+)
+
+// codeSettings 发送页的接收码生成设置
+// 选择词表和单词数量，显示接收码的熵估计，修改后立即保存。
+type codeSettings struct {
+	prefs storage.Preferences
+
+	wordlistSelect *widget.Select
+	wordsSelect    *widget.Select
+	entropyLabel   *widget.Label
+}
+
+func newCodeSettings(prefs storage.Preferences) *codeSettings {
+	s := &codeSettings{prefs: prefs}
+	options := storage.CodeOptions(prefs)
+
+	var descriptions []string
+	for _, list := range codephrase.Wordlists() {
+		descriptions = append(descriptions, list.Description)
+	}
+	var counts []string
+	for n := codephrase.MinWords; n <= codephrase.MaxWords; n++ {
+		counts = append(counts, strconv.Itoa(n))
+	}
+
+	list, _ := codephrase.LookupWordlist(options.Wordlist)
+	s.wordlistSelect = widget.NewSelect(descriptions, nil)
+	s.wordlistSelect.SetSelected(list.Description)
+	s.wordsSelect = widget.NewSelect(counts, nil)
+	s.wordsSelect.SetSelected(strconv.Itoa(options.Words))
+	s.entropyLabel = widget.NewLabel("接收码强度: " + options.Describe())
+
+	// 显示保存的设置后再监听修改
+	s.wordlistSelect.OnChanged = func(string) { s.onChanged() }
+	s.wordsSelect.OnChanged = func(string) { s.onChanged() }
+	return s
+}
+
+// content 返回接收码设置表单
+func (s *codeSettings) content() fyne.CanvasObject {
+	return container.NewVBox(
+		widget.NewForm(
+			&widget.FormItem{Text: "接收码词表:", Widget: s.wordlistSelect},
+			&widget.FormItem{Text: "单词数量:", Widget: s.wordsSelect},
+		),
+		s.entropyLabel,
+	)
+}
+
+// options 返回表单中的接收码生成设置
+func (s *codeSettings) options() codephrase.Options {
+	options := codephrase.DefaultOptions()
+	for _, list := range codephrase.Wordlists() {
+		if list.Description == s.wordlistSelect.Selected {
+			options.Wordlist = list.Name
+		}
+	}
+	if n, err := strconv.Atoi(s.wordsSelect.Selected); err == nil {
+		options.Words = n
+	}
+	return options
+}
+
+// onChanged 更新熵估计并保存设置
+func (s *codeSettings) onChanged() {
+	options := s.options()
+	s.entropyLabel.SetText("接收码强度: " + options.Describe())
+	if err := storage.SetCodeOptions(s.prefs, options); err != nil {
+		log.Printf("保存接收码设置失败: %v\n", err)
+	}
+}
@@ -0,0 +1,144 @@
+package pages
+
+import (
+	"context"
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/storage"
+)
+
+// DiagnosticsPage 中继诊断页面
+// 检查每个中继配置的连通性、密码和延迟。
+type DiagnosticsPage struct {
+	diagnostics   *crocmgr.Diagnostics
+	relayProfiles *storage.RelayProfileStore
+
+	// UI 组件
+	checkBtn    *widget.Button
+	autoCheck   *widget.Check
+	statusLabel *widget.Label
+	resultList  *widget.List
+
+	profiles []crocmgr.RelayProfile
+	content  fyne.CanvasObject
+}
+
+func NewDiagnosticsPage(diagnostics *crocmgr.Diagnostics, relayProfiles *storage.RelayProfileStore) *DiagnosticsPage {
+	page := &DiagnosticsPage{
+		diagnostics:   diagnostics,
+		relayProfiles: relayProfiles,
+		profiles:      relayProfiles.List(),
+	}
+	page.createWidgets()
+	page.buildContent()
+
+	// 中继配置变化后刷新列表
+	relayProfiles.OnChange(func() {
+		fyne.Do(page.refresh)
+	})
+	return page
+}
+
+func (page *DiagnosticsPage) createWidgets() {
+	page.resultList = widget.NewList(
+		func() int {
+			return len(page.profiles)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewCard("", "", widget.NewLabel(""))
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(page.profiles) {
+				return
+			}
+			p := page.profiles[id]
+			card := obj.(*widget.Card)
+			card.SetTitle("")
+			card.SetContent(widget.NewRichTextFromMarkdown(
+				"**" + p.Name + "**\n" + page.statusText(p),
+			))
+		},
+	)
+
+	page.checkBtn = widget.NewButtonWithIcon("开始诊断", theme.SearchIcon(), page.onCheck)
+	page.checkBtn.Importance = widget.HighImportance
+
+	page.autoCheck = widget.NewCheck("新的传输自动选择延迟最低的中继", func(checked bool) {
+		if checked != page.relayProfiles.AutoSelect() {
+			page.relayProfiles.SetAutoSelect(checked)
+		}
+	})
+	page.autoCheck.SetChecked(page.relayProfiles.AutoSelect())
+
+	page.statusLabel = widget.NewLabel("检查中继的连通性、密码和延迟")
+	page.statusLabel.Wrapping = fyne.TextWrapWord
+}
+
+func (page *DiagnosticsPage) buildContent() {
+	page.content = container.NewBorder(
+		container.NewVBox(page.checkBtn, page.autoCheck, page.statusLabel, widget.NewSeparator()),
+		nil, nil, nil,
+		page.resultList,
+	)
+}
+
+// statusText 返回配置最近一次检查结果的说明
+func (page *DiagnosticsPage) statusText(p crocmgr.RelayProfile) string {
+	status, ok := page.diagnostics.Last(p.Name)
+	if !ok {
+		return "⏳ 未检查"
+	}
+	icon := "❌"
+	if status.Healthy() {
+		icon = "✅"
+	}
+	text := icon + " " + status.Summary()
+	if status.Address != "" {
+		text += "\n🌐 " + status.Address
+	}
+	return text
+}
+
+// 事件处理器
+func (page *DiagnosticsPage) onCheck() {
+	page.checkBtn.Disable()
+	page.statusLabel.SetText("正在检查中继...")
+	profiles := page.relayProfiles.List()
+
+	go func() {
+		statuses := page.diagnostics.CheckAll(context.Background(), profiles)
+		healthy := 0
+		for _, s := range statuses {
+			if s.Healthy() {
+				healthy++
+			}
+		}
+		fyne.Do(func() {
+			page.statusLabel.SetText(formatDiagnosticsResult(healthy, len(statuses)))
+			page.checkBtn.Enable()
+			page.refresh()
+		})
+	}()
+}
+
+func formatDiagnosticsResult(healthy, total int) string {
+	if healthy == 0 {
+		return "没有可用的中继，请检查网络或中继配置"
+	}
+	return fmt.Sprintf("诊断完成: %d/%d 个中继可用", healthy, total)
+}
+
+func (page *DiagnosticsPage) refresh() {
+	page.profiles = page.relayProfiles.List()
+	page.autoCheck.SetChecked(page.relayProfiles.AutoSelect())
+	page.resultList.Refresh()
+}
+
+func (page *DiagnosticsPage) Build() fyne.CanvasObject {
+	return page.content
+}
@@ -0,0 +1,207 @@
+package pages
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/shapled/mocroc/internal/storage"
+)
+
+// fileTree 发送页的文件列表
+// 以树形显示选择的文件和文件夹，展开文件夹时才读取内容；文件夹中的文件和子文件夹可以取消勾选，
+// 取消勾选的路径不发送，压缩发送文件夹时也不放入压缩文件。只在主线程中访问。
+type fileTree struct {
+	paths     []string            // 选择的文件和文件夹
+	skip      map[string]bool     // 取消勾选的绝对路径
+	children  map[string][]string // 已经读取的文件夹内容
+	infos     map[string]os.FileInfo
+	onChanged func()
+
+	tree *widget.Tree
+}
+
+func newFileTree(onChanged func()) *fileTree {
+	f := &fileTree{
+		skip:      make(map[string]bool),
+		children:  make(map[string][]string),
+		infos:     make(map[string]os.FileInfo),
+		onChanged: onChanged,
+	}
+	f.tree = widget.NewTree(f.childUIDs, f.isBranch, f.createNode, f.updateNode)
+	return f
+}
+
+// widget 返回文件树
+func (f *fileTree) widget() fyne.CanvasObject {
+	// 树没有最小高度，固定显示区域的大小，内容较多时在树中滚动
+	return container.NewGridWrap(fyne.NewSize(400, 240), f.tree)
+}
+
+// add 添加选择的文件或文件夹，已经选择过时不重复添加
+func (f *fileTree) add(path string) {
+	if slices.Contains(f.paths, path) {
+		return
+	}
+	f.paths = append(f.paths, path)
+	f.changed()
+}
+
+// remove 移除选择的文件或文件夹和其中取消勾选的路径
+func (f *fileTree) remove(path string) {
+	f.paths = slices.DeleteFunc(f.paths, func(p string) bool { return p == path })
+	for s := range f.skip {
+		if isWithin(path, s) {
+			delete(f.skip, s)
+		}
+	}
+	f.changed()
+}
+
+// setSelection 替换选择的文件和取消勾选的路径，用于继续发送
+func (f *fileTree) setSelection(paths, skip []string) {
+	f.paths = slices.Clone(paths)
+	f.skip = make(map[string]bool)
+	for _, s := range skip {
+		f.skip[s] = true
+	}
+	f.changed()
+}
+
+// selection 返回选择的文件和文件夹，以及其中取消勾选的路径
+func (f *fileTree) selection() (paths, skip []string) {
+	for s := range f.skip {
+		skip = append(skip, s)
+	}
+	slices.Sort(skip)
+	return slices.Clone(f.paths), skip
+}
+
+// changed 清空读取过的内容后刷新，并通知发送页
+func (f *fileTree) changed() {
+	f.children = make(map[string][]string)
+	f.infos = make(map[string]os.FileInfo)
+	f.tree.Refresh()
+	if f.onChanged != nil {
+		f.onChanged()
+	}
+}
+
+func (f *fileTree) childUIDs(uid widget.TreeNodeID) []widget.TreeNodeID {
+	if uid == "" {
+		return f.paths
+	}
+	if children, ok := f.children[uid]; ok {
+		return children
+	}
+	entries, err := os.ReadDir(uid)
+	if err != nil {
+		return nil
+	}
+	var children []string
+	for _, e := range entries {
+		child := filepath.Join(uid, e.Name())
+		if info, err := e.Info(); err == nil {
+			f.infos[child] = info
+		}
+		children = append(children, child)
+	}
+	f.children[uid] = children
+	return children
+}
+
+func (f *fileTree) isBranch(uid widget.TreeNodeID) bool {
+	if uid == "" {
+		return true
+	}
+	info := f.info(uid)
+	return info != nil && info.IsDir()
+}
+
+// info 返回文件信息，结果会缓存
+func (f *fileTree) info(path string) os.FileInfo {
+	if info, ok := f.infos[path]; ok {
+		return info
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	f.infos[path] = info
+	return info
+}
+
+func (f *fileTree) createNode(bool) fyne.CanvasObject {
+	deleteBtn := widget.NewButtonWithIcon("", theme.DeleteIcon(), nil)
+	return container.NewBorder(nil, nil, widget.NewCheck("", nil), deleteBtn, widget.NewLabel(""))
+}
+
+func (f *fileTree) updateNode(uid widget.TreeNodeID, branch bool, obj fyne.CanvasObject) {
+	c := obj.(*fyne.Container)
+	label := c.Objects[0].(*widget.Label)
+	check := c.Objects[1].(*widget.Check)
+	deleteBtn := c.Objects[2].(*widget.Button)
+
+	name := filepath.Base(uid)
+	if branch {
+		label.SetText("📁 " + name + "/")
+	} else if info := f.info(uid); info != nil {
+		label.SetText(name + " (" + storage.FormatFileSize(info.Size()) + ")")
+	} else {
+		label.SetText(name)
+	}
+
+	// 选择的文件和文件夹可以移除，其中的内容只能取消勾选
+	if slices.Contains(f.paths, uid) {
+		check.Hide()
+		deleteBtn.Show()
+		deleteBtn.OnTapped = func() { f.remove(uid) }
+		return
+	}
+	deleteBtn.Hide()
+	check.Show()
+	// 上级文件夹取消勾选时其中的内容都不发送，不能单独勾选
+	parentSkipped := f.parentSkipped(uid)
+	check.OnChanged = nil
+	check.SetChecked(!f.skip[uid] && !parentSkipped)
+	if parentSkipped {
+		check.Disable()
+	} else {
+		check.Enable()
+	}
+	check.OnChanged = func(checked bool) { f.toggle(uid, checked) }
+}
+
+// toggle 勾选或取消勾选文件夹中的文件或子文件夹
+func (f *fileTree) toggle(path string, checked bool) {
+	if checked {
+		delete(f.skip, path)
+	} else {
+		f.skip[path] = true
+	}
+	// 只刷新显示，文件夹内容不变
+	f.tree.Refresh()
+	if f.onChanged != nil {
+		f.onChanged()
+	}
+}
+
+// parentSkipped 上级文件夹是否已经取消勾选
+func (f *fileTree) parentSkipped(path string) bool {
+	for s := range f.skip {
+		if s != path && isWithin(s, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithin path 是否为 dir 或在 dir 中
+func isWithin(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
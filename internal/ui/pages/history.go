@@ -2,11 +2,16 @@ package pages
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
 	"github.com/shapled/mocroc/internal/storage"
 )
 
@@ -19,6 +24,29 @@ type HistoryPage struct {
 	statsCard   *widget.Card
 	clearBtn    *widget.Button
 	noDataLabel *widget.Label
+	textCheck   *widget.Check
+
+	// 搜索和筛选
+	searchEntry  *widget.Entry
+	typeChips    *filterChips
+	statusChips  *filterChips
+	dateChips    *filterChips
+	sizeChips    *filterChips
+	sortSelect   *widget.Select
+	resetBtn     *widget.Button
+	noMatchLabel *widget.Label
+
+	// 分页
+	items     []HistoryItem // 当前页的记录
+	pageIndex int
+	prevBtn   *widget.Button
+	nextBtn   *widget.Button
+	pageLabel *widget.Label
+
+	// 继续中断的传输和打开详情页，由主界面设置
+	onResume func(HistoryItem) error
+	onOpen   func(HistoryItem)
+	window   fyne.Window
 
 	// 容器
 	content fyne.CanvasObject
@@ -31,6 +59,7 @@ func NewHistoryPage(storage *storage.HistoryStorage) *HistoryPage {
 		storage: storage,
 	}
 	tab.createWidgets()
+	tab.applyQuery()
 	tab.buildContent()
 	return tab
 }
@@ -39,37 +68,70 @@ func (page *HistoryPage) createWidgets() {
 	// 历史记录列表
 	page.historyList = widget.NewList(
 		func() int {
-			items, _ := page.storage.GetAll()
-			return len(items)
+			return len(page.items)
 		},
 		func() fyne.CanvasObject {
-			return widget.NewCard("", "", widget.NewLabel(""))
+			resumeBtn := widget.NewButtonWithIcon("继续传输", theme.MediaPlayIcon(), nil)
+			return widget.NewCard("", "", container.NewVBox(widget.NewRichText(), container.NewHBox(resumeBtn)))
 		},
 		func(id widget.ListItemID, obj fyne.CanvasObject) {
 			card := obj.(*widget.Card)
-			items, err := page.storage.GetAll()
-			if err != nil {
-				card.SetContent(widget.NewLabel("加载失败: " + err.Error()))
+			if id >= len(page.items) {
 				return
 			}
-			if id >= len(items) {
-				return
-			}
-			item := items[id]
+			item := page.items[id]
 
-			statusIcon := page.getStatusIcon(item.Status)
-			description := widget.NewRichTextFromMarkdown(
-				"**" + item.FileName + "**\n" +
-					"📁 " + item.FileSize + " | 🔑 " + item.Code + "\n" +
-					"🕒 " + item.Timestamp.Format("2006-01-02 15:04") + " | " +
-					statusIcon + " " + item.Status,
-			)
+			markdown := "**" + item.FileName + "**\n" +
+				"📁 " + item.FileSize + fileCounts(item) + " | 🔑 " + item.Code + "\n" +
+				"🕒 " + item.Timestamp.Format("2006-01-02 15:04") + " | " +
+				statusIcon(item.Status) + " " + string(item.Status)
+			if item.Text != "" {
+				markdown += "\n💬 " + textSnippet(item.Text)
+			}
+			if item.Manifest != nil && item.Manifest.SavePath != "" {
+				markdown += "\n📂 " + item.Manifest.SavePath
+			}
+			if item.Verification != nil {
+				icon := "🔒 "
+				if !item.Verification.Passed() {
+					icon = "⚠️ "
+				}
+				markdown += "\n" + icon + item.Verification.Summary()
+			}
+			if summary := conflictSummary(item.ReceivedFiles); summary != "" {
+				markdown += "\n📝 " + summary
+			}
+			if item.Resumable() {
+				markdown += "\n⏸ " + resumeSummary(*item.Resume)
+			}
 
 			card.SetTitle("")
-			card.SetContent(description)
+			content, ok := card.Content.(*fyne.Container)
+			if !ok {
+				card.SetContent(widget.NewRichTextFromMarkdown(markdown))
+				return
+			}
+			content.Objects[0].(*widget.RichText).ParseMarkdown(markdown)
+			actions := content.Objects[1].(*fyne.Container)
+			resumeBtn := actions.Objects[0].(*widget.Button)
+			if item.Resumable() && page.onResume != nil {
+				resumeBtn.OnTapped = func() { page.onResumeItem(item) }
+				actions.Show()
+			} else {
+				resumeBtn.OnTapped = nil
+				actions.Hide()
+			}
 		},
 	)
 
+	// 点击记录打开详情页
+	page.historyList.OnSelected = func(id widget.ListItemID) {
+		page.historyList.Unselect(id)
+		if id < len(page.items) && page.onOpen != nil {
+			page.onOpen(page.items[id])
+		}
+	}
+
 	// 统计信息
 	page.statsCard = page.buildStatsCard()
 
@@ -78,6 +140,93 @@ func (page *HistoryPage) createWidgets() {
 
 	// 无数据显示
 	page.noDataLabel = widget.NewLabel("暂无传输记录")
+
+	// 文本内容默认不保存
+	page.textCheck = widget.NewCheck("在历史记录中保存文本内容", page.storage.SetStoreText)
+	page.textCheck.SetChecked(page.storage.StoreText())
+
+	// 搜索和筛选，条件改变后回到第一页
+	page.searchEntry = widget.NewEntry()
+	page.searchEntry.SetPlaceHolder("搜索文件名或接收码")
+	page.searchEntry.OnChanged = func(string) { page.onFilterChanged() }
+	page.typeChips = newFilterChips(historyTypeLabels, true, page.onFilterChanged)
+	page.statusChips = newFilterChips(historyStatusLabels, false, page.onFilterChanged)
+	page.dateChips = newFilterChips(historyDateLabels, true, page.onFilterChanged)
+	page.sizeChips = newFilterChips(historySizeLabels, true, page.onFilterChanged)
+	page.sortSelect = widget.NewSelect(historySortLabels, nil)
+	page.sortSelect.SetSelectedIndex(0)
+	page.sortSelect.OnChanged = func(string) { page.onFilterChanged() }
+	page.resetBtn = widget.NewButtonWithIcon("清除筛选", theme.ContentClearIcon(), page.onResetFilters)
+	page.noMatchLabel = widget.NewLabel("没有符合条件的记录")
+	page.noMatchLabel.Hide()
+
+	page.prevBtn = widget.NewButtonWithIcon("上一页", theme.NavigateBackIcon(), func() {
+		page.pageIndex--
+		page.applyQuery()
+	})
+	page.nextBtn = widget.NewButtonWithIcon("下一页", theme.NavigateNextIcon(), func() {
+		page.pageIndex++
+		page.applyQuery()
+	})
+	page.pageLabel = widget.NewLabel("")
+}
+
+// historyPageSize 历史页每页显示的记录数
+const historyPageSize = 20
+
+// applyQuery 按当前的筛选条件和页码查询记录并刷新列表
+func (page *HistoryPage) applyQuery() {
+	q := page.historyQuery(time.Now())
+	q.Offset, q.Limit = page.pageIndex*historyPageSize, historyPageSize
+	result, err := page.storage.Query(q)
+	// 删除记录后当前页可能超出范围，退回最后一页
+	if err == nil && len(result.Items) == 0 && page.pageIndex > 0 {
+		page.pageIndex = max(0, (result.Total-1)/historyPageSize)
+		q.Offset = page.pageIndex * historyPageSize
+		result, err = page.storage.Query(q)
+	}
+	if err != nil {
+		page.items = nil
+		page.pageLabel.SetText("查询失败: " + err.Error())
+		page.historyList.Refresh()
+		return
+	}
+
+	page.items = result.Items
+	pages := max(1, (result.Total+historyPageSize-1)/historyPageSize)
+	page.pageLabel.SetText(fmt.Sprintf("第 %d/%d 页，共 %d 条", page.pageIndex+1, pages, result.Total))
+	if page.pageIndex > 0 {
+		page.prevBtn.Enable()
+	} else {
+		page.prevBtn.Disable()
+	}
+	if page.pageIndex+1 < pages {
+		page.nextBtn.Enable()
+	} else {
+		page.nextBtn.Disable()
+	}
+	if result.Total == 0 {
+		page.noMatchLabel.Show()
+	} else {
+		page.noMatchLabel.Hide()
+	}
+	page.historyList.Refresh()
+}
+
+func (page *HistoryPage) onFilterChanged() {
+	page.pageIndex = 0
+	page.applyQuery()
+}
+
+// onResetFilters 清除搜索和所有筛选条件
+func (page *HistoryPage) onResetFilters() {
+	for _, c := range []*filterChips{page.typeChips, page.statusChips, page.dateChips, page.sizeChips} {
+		c.reset()
+	}
+	// 排序和搜索框没有改变时不会触发查询，最后再查询一次
+	page.sortSelect.SetSelectedIndex(0)
+	page.searchEntry.SetText("")
+	page.onFilterChanged()
 }
 
 func (page *HistoryPage) buildStatsCard() *widget.Card {
@@ -109,14 +258,28 @@ func (page *HistoryPage) buildContent() {
 	if len(items) == 0 {
 		page.content = container.NewVBox(
 			widget.NewCard("历史记录", "", page.noDataLabel),
+			page.textCheck,
 		)
 	} else {
+		filters := container.NewVBox(
+			page.searchEntry,
+			page.typeChips.widget(),
+			page.statusChips.widget(),
+			page.dateChips.widget(),
+			page.sizeChips.widget(),
+			container.NewBorder(nil, nil, widget.NewLabel("排序"), page.resetBtn, page.sortSelect),
+		)
+		pager := container.NewBorder(nil, nil, page.prevBtn, page.nextBtn, container.NewCenter(page.pageLabel))
 		vbox := container.NewVBox(
 			page.statsCard,
 			widget.NewSeparator(),
+			filters,
 			widget.NewLabel("传输记录:"),
+			page.noMatchLabel,
 			page.historyList,
+			pager,
 			widget.NewSeparator(),
+			page.textCheck,
 			page.clearBtn,
 		)
 		page.content = container.NewVScroll(vbox)
@@ -127,21 +290,66 @@ func (page *HistoryPage) Build() fyne.CanvasObject {
 	return page.content
 }
 
-// 辅助方法
-func (page *HistoryPage) getStatusIcon(status string) string {
+// SetOnResume 设置继续中断传输的回调，出错时在 window 中显示
+func (page *HistoryPage) SetOnResume(window fyne.Window, callback func(HistoryItem) error) {
+	page.window = window
+	page.onResume = callback
+}
+
+// SetOnOpen 设置点击记录时打开详情页的回调
+func (page *HistoryPage) SetOnOpen(callback func(HistoryItem)) {
+	page.onOpen = callback
+}
+
+// statusIcon 返回传输状态对应的图标
+func statusIcon(status lifecycle.State) string {
 	switch status {
-	case "completed":
+	case lifecycle.Completed:
 		return "✅"
-	case "failed":
+	case lifecycle.Failed:
 		return "❌"
-	case "in_progress":
+	case lifecycle.Cancelled:
+		return "🚫"
+	case lifecycle.Preparing, lifecycle.Waiting, lifecycle.Transferring, lifecycle.Verifying:
 		return "⏳"
 	default:
 		return "❓"
 	}
 }
 
+// maxTextSnippet 历史记录中显示的文本最多字符数
+const maxTextSnippet = 40
+
+// textSnippet 返回文本的单行摘要
+func textSnippet(text string) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) > maxTextSnippet {
+		return string(runes[:maxTextSnippet]) + "…"
+	}
+	return string(runes)
+}
+
+// fileCounts 返回发送文件夹时的文件数和文件夹数
+func fileCounts(item storage.HistoryItem) string {
+	if item.NumFolders == 0 {
+		return ""
+	}
+	return fmt.Sprintf("（%d 个文件，%d 个文件夹）", item.NumFiles, item.NumFolders)
+}
+
+// resumeSummary 返回中断时的完成情况
+func resumeSummary(r crocmgr.Resume) string {
+	return fmt.Sprintf("已完成 %d/%d 个文件，%s / %s",
+		r.FilesDone(), len(r.Files), storage.FormatFileSize(r.BytesDone()), storage.FormatFileSize(r.TotalBytes()))
+}
+
 // 事件处理器
+func (page *HistoryPage) onResumeItem(item HistoryItem) {
+	if err := page.onResume(item); err != nil && page.window != nil {
+		dialog.ShowError(err, page.window)
+	}
+}
+
 func (page *HistoryPage) onClearHistory() {
 	page.storage.Clear()
 	page.refresh()
@@ -149,8 +357,8 @@ func (page *HistoryPage) onClearHistory() {
 
 func (page *HistoryPage) refresh() {
 	page.statsCard = page.buildStatsCard()
+	page.applyQuery()
 	page.buildContent()
-	page.historyList.Refresh()
 }
 
 // Refresh 公开的刷新方法
@@ -0,0 +1,255 @@
+package pages
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	fynestorage "fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
+	"github.com/shapled/mocroc/internal/storage"
+)
+
+// HistoryDetailPage 历史记录详情页，显示完整的文件清单，可以重新传输、打开文件夹或删除记录
+type HistoryDetailPage struct {
+	storage *storage.HistoryStorage
+	window  fyne.Window
+	itemID  string
+
+	// 由主界面设置
+	onResend  func(HistoryItem) error
+	onRetry   func(HistoryItem) error
+	onDeleted func()
+}
+
+func NewHistoryDetailPage(storage *storage.HistoryStorage, window fyne.Window) *HistoryDetailPage {
+	return &HistoryDetailPage{storage: storage, window: window}
+}
+
+// SetActions 设置重新发送、重试接收和删除记录后的回调
+func (page *HistoryDetailPage) SetActions(onResend, onRetry func(HistoryItem) error, onDeleted func()) {
+	page.onResend = onResend
+	page.onRetry = onRetry
+	page.onDeleted = onDeleted
+}
+
+// SetItem 设置显示的记录，每次构建时重新读取，显示传输中的记录的最新状态
+func (page *HistoryDetailPage) SetItem(id string) {
+	page.itemID = id
+}
+
+func (page *HistoryDetailPage) Build() fyne.CanvasObject {
+	item, ok := page.storage.Get(page.itemID)
+	if !ok {
+		return container.NewPadded(widget.NewLabel("记录不存在或已被删除"))
+	}
+
+	mainContent := container.NewVBox(page.buildInfoCard(item))
+	if item.Text != "" {
+		mainContent.Add(page.buildTextCard(item.Text))
+	}
+	if item.Manifest != nil && len(item.Manifest.Files) > 0 {
+		mainContent.Add(page.buildManifestCard(*item.Manifest))
+	}
+	mainContent.Add(page.buildActionCard(item))
+	return container.NewPadded(mainContent)
+}
+
+// buildInfoCard 显示接收码、中继、耗时、平均速度和失败原因
+func (page *HistoryDetailPage) buildInfoCard(item HistoryItem) fyne.CanvasObject {
+	kind := "发送"
+	if item.Type == "receive" {
+		kind = "接收"
+	}
+	rows := container.NewVBox(
+		detailRow("类型:", kind),
+		detailRow("文件:", item.FileName),
+		detailRow("大小:", item.FileSize+fileCounts(item)),
+		detailRow("接收码:", item.Code),
+		detailRow("状态:", statusIcon(item.Status)+" "+string(item.Status)),
+		detailRow("时间:", item.Timestamp.Format("2006-01-02 15:04:05")),
+		detailRow("耗时:", item.TransferTime().Round(time.Second).String()),
+	)
+	if speed := item.AverageSpeed(); speed > 0 {
+		rows.Add(detailRow("平均速度:", storage.FormatFileSize(int64(speed))+"/s"))
+	}
+	if item.Relay != nil {
+		rows.Add(detailRow("中继:", relayDescription(*item.Relay)))
+	}
+	if dir := item.Folder(); dir != "" {
+		rows.Add(detailRow("位置:", dir))
+	}
+	if item.Verification != nil {
+		rows.Add(detailRow("校验:", item.Verification.Summary()))
+	}
+	if msg := item.ErrorMessage(); msg != "" {
+		rows.Add(detailRow("原因:", msg))
+	}
+	return widget.NewCard("传输信息", "", rows)
+}
+
+// buildTextCard 显示保存的文本内容
+func (page *HistoryDetailPage) buildTextCard(text string) fyne.CanvasObject {
+	label := widget.NewLabel(text)
+	label.Wrapping = fyne.TextWrapWord
+	label.Selectable = true
+	return widget.NewCard("文本内容", storage.FormatFileSize(int64(len(text))), label)
+}
+
+// buildManifestCard 列出清单中的所有文件，包括大小和校验值
+func (page *HistoryDetailPage) buildManifestCard(m crocmgr.Manifest) fyne.CanvasObject {
+	summary := fmt.Sprintf("共 %d 个文件，%s", len(m.Files), storage.FormatFileSize(m.TotalBytes))
+	if m.NumFolders > 0 {
+		summary = fmt.Sprintf("共 %d 个文件，%d 个文件夹，%s", len(m.Files), m.NumFolders, storage.FormatFileSize(m.TotalBytes))
+	}
+	if m.HashAlgorithm != "" {
+		summary += "，校验算法 " + m.HashAlgorithm
+	}
+
+	list := widget.NewList(
+		func() int { return len(m.Files) },
+		func() fyne.CanvasObject {
+			hash := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+			hash.Truncation = fyne.TextTruncateEllipsis
+			name := widget.NewLabel("")
+			name.Truncation = fyne.TextTruncateEllipsis
+			return container.NewVBox(container.NewBorder(nil, nil, nil, widget.NewLabel(""), name), hash)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			f := m.Files[id]
+			rows := obj.(*fyne.Container)
+			row := rows.Objects[0].(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(f.Path)
+			row.Objects[1].(*widget.Label).SetText(storage.FormatFileSize(f.Size))
+			rows.Objects[1].(*widget.Label).SetText(f.Hash)
+		},
+	)
+	// 列表没有最小高度，固定显示区域的大小，文件较多时在列表中滚动
+	return widget.NewCard("文件清单", summary, container.NewGridWrap(fyne.NewSize(400, 240), list))
+}
+
+// buildActionCard 创建操作按钮，传输中的记录不能重新传输或删除
+func (page *HistoryDetailPage) buildActionCard(item HistoryItem) fyne.CanvasObject {
+	finished := item.Status.IsFinished()
+	buttons := container.NewVBox()
+
+	if item.Type == "send" && page.onResend != nil {
+		resendBtn := widget.NewButtonWithIcon("使用新的接收码重新发送", theme.MailSendIcon(), func() {
+			page.run(page.onResend, item)
+		})
+		resendBtn.Importance = widget.HighImportance
+		if paths, _ := item.SendPaths(); !finished || (len(paths) == 0 && item.Text == "") {
+			resendBtn.Disable()
+		}
+		buttons.Add(resendBtn)
+	}
+	if item.Type == "receive" && page.onRetry != nil && (item.Status == lifecycle.Failed || item.Status == lifecycle.Cancelled) {
+		retryBtn := widget.NewButtonWithIcon("使用相同的接收码重试", theme.ViewRefreshIcon(), func() {
+			page.run(page.onRetry, item)
+		})
+		retryBtn.Importance = widget.HighImportance
+		buttons.Add(retryBtn)
+	}
+
+	if dir := item.Folder(); dir != "" {
+		buttons.Add(widget.NewButtonWithIcon("打开所在文件夹", theme.FolderOpenIcon(), func() {
+			if err := openFolder(dir); err != nil {
+				dialog.ShowError(err, page.window)
+			}
+		}))
+	}
+
+	var copyBtn *widget.Button
+	copyBtn = widget.NewButtonWithIcon("复制接收码", theme.ContentCopyIcon(), func() {
+		fyne.CurrentApp().Clipboard().SetContent(item.Code)
+		copyBtn.SetText("已复制")
+	})
+	buttons.Add(copyBtn)
+
+	deleteBtn := widget.NewButtonWithIcon("删除记录", theme.DeleteIcon(), func() { page.onDelete(item) })
+	deleteBtn.Importance = widget.DangerImportance
+	if !finished {
+		deleteBtn.Disable()
+	}
+	buttons.Add(deleteBtn)
+
+	return widget.NewCard("操作", "", buttons)
+}
+
+// run 执行重新发送或重试，出错时显示错误
+func (page *HistoryDetailPage) run(action func(HistoryItem) error, item HistoryItem) {
+	if err := action(item); err != nil {
+		dialog.ShowError(err, page.window)
+	}
+}
+
+func (page *HistoryDetailPage) onDelete(item HistoryItem) {
+	dialog.ShowConfirm("删除记录", "确定删除这条记录吗？已传输的文件不会被删除。", func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := page.storage.Delete(item.ID); err != nil {
+			dialog.ShowError(err, page.window)
+			return
+		}
+		if page.onDeleted != nil {
+			page.onDeleted()
+		}
+	}, page.window)
+}
+
+// detailRow 创建信息行，内容较长时换行
+func detailRow(label, value string) fyne.CanvasObject {
+	labelWidget := widget.NewLabelWithStyle(label, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	valueWidget := widget.NewLabel(value)
+	valueWidget.Wrapping = fyne.TextWrapBreak
+	valueWidget.Selectable = true
+	return container.NewBorder(nil, nil, labelWidget, nil, valueWidget)
+}
+
+// relayDescription 返回中继配置的简短说明
+func relayDescription(p crocmgr.RelayProfile) string {
+	switch {
+	case p.Embedded && len(p.Ports) > 0:
+		return "本机内置中继（端口 " + p.Ports[0] + "）"
+	case p.OnlyLocal:
+		return "仅局域网"
+	case relayHost(p.Address) == crocmgr.DefaultRelayAddress && p.Address6 == "":
+		return crocmgr.PublicRelayProfileName
+	case p.Address == "":
+		return p.Address6
+	default:
+		return p.Address
+	}
+}
+
+// relayHost 返回中继地址中的主机名，记录的地址带有端口
+func relayHost(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+// openFolder 用系统的文件管理器打开文件夹
+func openFolder(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("文件夹已不存在: %w", err)
+	}
+	u, err := url.Parse(fynestorage.NewFileURI(dir).String())
+	if err != nil {
+		return fmt.Errorf("打开文件夹失败: %w", err)
+	}
+	if err := fyne.CurrentApp().OpenURL(u); err != nil {
+		return fmt.Errorf("打开文件夹失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package pages
+
+import (
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/shapled/mocroc/internal/lifecycle"
+	"github.com/shapled/mocroc/internal/storage"
+)
+
+// filterChips 一组筛选按钮，选中的按钮高亮，再次点击取消选中
+// single 为 true 时最多选中一个。
+type filterChips struct {
+	buttons   []*widget.Button
+	selected  []bool
+	single    bool
+	onChanged func()
+}
+
+func newFilterChips(labels []string, single bool, onChanged func()) *filterChips {
+	c := &filterChips{selected: make([]bool, len(labels)), single: single, onChanged: onChanged}
+	for i, label := range labels {
+		btn := widget.NewButton(label, func() { c.toggle(i) })
+		btn.Importance = widget.LowImportance
+		c.buttons = append(c.buttons, btn)
+	}
+	return c
+}
+
+// widget 返回按钮行，窗口较窄时可以横向滚动
+func (c *filterChips) widget() fyne.CanvasObject {
+	row := container.NewHBox()
+	for _, btn := range c.buttons {
+		row.Add(btn)
+	}
+	return container.NewHScroll(row)
+}
+
+func (c *filterChips) toggle(i int) {
+	checked := !c.selected[i]
+	if c.single {
+		clear(c.selected)
+	}
+	c.selected[i] = checked
+	c.update()
+	if c.onChanged != nil {
+		c.onChanged()
+	}
+}
+
+// reset 取消所有选中，不通知
+func (c *filterChips) reset() {
+	clear(c.selected)
+	c.update()
+}
+
+func (c *filterChips) update() {
+	for i, btn := range c.buttons {
+		if c.selected[i] {
+			btn.Importance = widget.HighImportance
+		} else {
+			btn.Importance = widget.LowImportance
+		}
+		btn.Refresh()
+	}
+}
+
+// 历史页的筛选按钮，顺序与下面的取值一一对应
+var (
+	historyTypeLabels = []string{"发送", "接收"}
+	historyTypes      = []string{"send", "receive"}
+
+	historyStatusLabels = []string{"成功", "失败", "已取消", "进行中"}
+	historyStatuses     = [][]lifecycle.State{
+		{lifecycle.Completed},
+		{lifecycle.Failed},
+		{lifecycle.Cancelled},
+		{lifecycle.Preparing, lifecycle.Waiting, lifecycle.Transferring, lifecycle.Verifying},
+	}
+
+	historyDateLabels = []string{"今天", "最近 7 天", "最近 30 天"}
+	historyDateDays   = []int{1, 7, 30}
+
+	historySizeLabels = []string{"< 10 MB", "10 MB - 1 GB", "> 1 GB"}
+	historySizes      = [][2]int64{{0, 10 << 20}, {10 << 20, 1 << 30}, {1 << 30, 0}}
+
+	historySortLabels = []string{"最新在前", "最早在前", "最大在前", "耗时最长在前"}
+	historySorts      = []storage.HistoryQuery{
+		{Sort: storage.SortByTime},
+		{Sort: storage.SortByTime, Ascending: true},
+		{Sort: storage.SortBySize},
+		{Sort: storage.SortByDuration},
+	}
+)
+
+// historyQuery 根据搜索框、筛选按钮和排序生成查询条件，不包括分页
+func (page *HistoryPage) historyQuery(now time.Time) storage.HistoryQuery {
+	var q storage.HistoryQuery
+	if i := page.sortSelect.SelectedIndex(); i >= 0 {
+		q = historySorts[i]
+	}
+	q.Keyword = page.searchEntry.Text
+
+	for i, ok := range page.typeChips.selected {
+		if ok {
+			q.Type = historyTypes[i]
+		}
+	}
+	for i, ok := range page.statusChips.selected {
+		if ok {
+			q.Statuses = append(q.Statuses, historyStatuses[i]...)
+		}
+	}
+	for i, ok := range page.dateChips.selected {
+		if ok {
+			// 按自然日计算，「今天」从今天零点开始
+			y, m, d := now.Date()
+			q.Since = time.Date(y, m, d-historyDateDays[i]+1, 0, 0, 0, 0, now.Location())
+		}
+	}
+	for i, ok := range page.sizeChips.selected {
+		if ok {
+			q.MinSize, q.MaxSize = historySizes[i][0], historySizes[i][1]
+		}
+	}
+	return q
+}
@@ -8,18 +8,20 @@ import (
 )
 
 type HomePage struct {
-	window    fyne.Window
-	onSend    func()
-	onReceive func()
-	onHistory func()
+	window        fyne.Window
+	onSend        func()
+	onReceive     func()
+	onHistory     func()
+	onDiagnostics func()
 }
 
-func NewHomePage(window fyne.Window, onSend, onReceive, onHistory func()) *HomePage {
+func NewHomePage(window fyne.Window, onSend, onReceive, onHistory, onDiagnostics func()) *HomePage {
 	return &HomePage{
-		window:    window,
-		onSend:    onSend,
-		onReceive: onReceive,
-		onHistory: onHistory,
+		window:        window,
+		onSend:        onSend,
+		onReceive:     onReceive,
+		onHistory:     onHistory,
+		onDiagnostics: onDiagnostics,
 	}
 }
 
@@ -42,8 +44,11 @@ func (page *HomePage) Build() fyne.CanvasObject {
 	historyBtn := widget.NewButtonWithIcon("传输历史", theme.HistoryIcon(), page.onHistory)
 	historyBtn.Importance = widget.MediumImportance
 
+	diagnosticsBtn := widget.NewButtonWithIcon("网络诊断", theme.SearchIcon(), page.onDiagnostics)
+	diagnosticsBtn.Importance = widget.MediumImportance
+
 	// 按钮样式设置 - 确保符合移动端标准 (至少48px高度)
-	for _, btn := range []*widget.Button{sendBtn, receiveBtn, historyBtn} {
+	for _, btn := range []*widget.Button{sendBtn, receiveBtn, historyBtn, diagnosticsBtn} {
 		btn.Resize(fyne.NewSize(280, 56)) // 增加宽度，保持合适的高度
 	}
 
@@ -54,6 +59,8 @@ func (page *HomePage) Build() fyne.CanvasObject {
 		receiveBtn,
 		widget.NewLabel(""), // 按钮间距
 		historyBtn,
+		widget.NewLabel(""), // 按钮间距
+		diagnosticsBtn,
 	)
 
 	// 主内容布局 - 使用更好的间距
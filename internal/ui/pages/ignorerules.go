@@ -0,0 +1,140 @@
+package pages
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/storage"
+)
+
+// maxPlanLines 发送预览中每个列表最多显示的文件数
+const maxPlanLines = 500
+
+// ignoreSettings 发送页的忽略规则
+// 选择内置规则、填写自定义规则，可以遵循文件夹中的 .gitignore，修改后保存并通知发送页更新预览。
+type ignoreSettings struct {
+	prefs     storage.Preferences
+	onChanged func()
+
+	presetChecks []*widget.Check
+	gitCheck     *widget.Check
+	patternEntry *widget.Entry
+	infoLabel    *widget.Label
+}
+
+func newIgnoreSettings(prefs storage.Preferences, onChanged func()) *ignoreSettings {
+	s := &ignoreSettings{prefs: prefs, onChanged: onChanged}
+	rules := storage.IgnoreRules(prefs)
+
+	for _, preset := range crocmgr.IgnorePresets() {
+		check := widget.NewCheck("忽略"+preset.Description, nil)
+		for _, name := range rules.Presets {
+			if name == preset.Name {
+				check.SetChecked(true)
+			}
+		}
+		s.presetChecks = append(s.presetChecks, check)
+	}
+	s.gitCheck = widget.NewCheck("遵循文件夹中的 .gitignore", nil)
+	s.gitCheck.SetChecked(rules.GitIgnore)
+	s.patternEntry = widget.NewMultiLineEntry()
+	s.patternEntry.SetPlaceHolder("*.log\ntmp/")
+	s.patternEntry.SetText(strings.Join(rules.Patterns, "\n"))
+	s.patternEntry.Wrapping = fyne.TextWrapOff
+	s.infoLabel = widget.NewLabel("每行一条规则，写法与 .gitignore 相同，匹配所选文件夹中的相对路径")
+	s.infoLabel.Wrapping = fyne.TextWrapWord
+
+	// 勾选内置规则和 .gitignore 后立即保存
+	for _, check := range s.presetChecks {
+		check.OnChanged = func(bool) { s.onSave() }
+	}
+	s.gitCheck.OnChanged = func(bool) { s.onSave() }
+	return s
+}
+
+// content 返回忽略规则表单
+func (s *ignoreSettings) content() fyne.CanvasObject {
+	box := container.NewVBox(widget.NewLabelWithStyle("忽略规则:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+	for _, check := range s.presetChecks {
+		box.Add(check)
+	}
+	box.Add(s.gitCheck)
+	box.Add(widget.NewForm(&widget.FormItem{Text: "自定义规则:", Widget: s.patternEntry}))
+	box.Add(widget.NewButtonWithIcon("保存规则", theme.DocumentSaveIcon(), s.onSave))
+	box.Add(s.infoLabel)
+	return box
+}
+
+// rules 返回表单中的忽略规则
+func (s *ignoreSettings) rules() (crocmgr.IgnoreRules, error) {
+	var rules crocmgr.IgnoreRules
+	for i, preset := range crocmgr.IgnorePresets() {
+		if s.presetChecks[i].Checked {
+			rules.Presets = append(rules.Presets, preset.Name)
+		}
+	}
+	rules.GitIgnore = s.gitCheck.Checked
+	var err error
+	rules.Patterns, err = crocmgr.ParseIgnorePatterns(s.patternEntry.Text)
+	return rules, err
+}
+
+// onSave 检查并保存规则
+func (s *ignoreSettings) onSave() {
+	rules, err := s.rules()
+	if err == nil {
+		err = storage.SetIgnoreRules(s.prefs, rules)
+	}
+	if err != nil {
+		s.infoLabel.SetText("❌ " + err.Error())
+		return
+	}
+	s.infoLabel.SetText("✅ 忽略规则已更新")
+	if s.onChanged != nil {
+		s.onChanged()
+	}
+}
+
+// planSummary 返回发送预览的摘要
+func planSummary(plan crocmgr.SendPlan) string {
+	summary := fmt.Sprintf("将发送 %d 个文件 (%s)", len(plan.Files), storage.FormatFileSize(plan.TotalBytes()))
+	if len(plan.Excluded) > 0 {
+		summary += fmt.Sprintf("，忽略 %d 个文件 (%s)", len(plan.Excluded), storage.FormatFileSize(plan.ExcludedBytes()))
+	}
+	return summary
+}
+
+// showSendPlanDialog 在对话框中列出要发送和被忽略的文件
+func showSendPlanDialog(plan crocmgr.SendPlan, window fyne.Window) {
+	var b strings.Builder
+	b.WriteString(planSummary(plan) + "\n\n📤 发送:\n")
+	for i, f := range plan.Files {
+		if i == maxPlanLines {
+			fmt.Fprintf(&b, "…还有 %d 个文件\n", len(plan.Files)-i)
+			break
+		}
+		fmt.Fprintf(&b, "%s (%s)\n", path.Join(f.FolderRemote, f.Name), storage.FormatFileSize(f.Size))
+	}
+	if len(plan.Excluded) > 0 {
+		b.WriteString("\n🚫 忽略:\n")
+		for i, f := range plan.Excluded {
+			if i == maxPlanLines {
+				fmt.Fprintf(&b, "…还有 %d 个文件\n", len(plan.Excluded)-i)
+				break
+			}
+			fmt.Fprintf(&b, "%s (%s) ← %s\n", f.Name, storage.FormatFileSize(f.Size), f.Rule)
+		}
+	}
+
+	label := widget.NewLabel(strings.TrimSpace(b.String()))
+	scroll := container.NewVScroll(label)
+	scroll.SetMinSize(fyne.NewSize(420, 360))
+	dialog.ShowCustom("发送预览", "关闭", scroll, window)
+}
@@ -0,0 +1,68 @@
+package pages
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/shapled/mocroc/internal/share"
+)
+
+// qrCodeDisplaySize 界面中二维码的显示边长
+const qrCodeDisplaySize = 240
+
+// newQRCodeContent 创建接收信息的二维码、中继说明、保存和复制链接按钮
+func newQRCodeContent(invite share.Invite, window fyne.Window) fyne.CanvasObject {
+	png, err := invite.QRCode(share.QRCodeSize)
+	if err != nil {
+		return widget.NewLabel(err.Error())
+	}
+
+	image := canvas.NewImageFromResource(fyne.NewStaticResource("mocroc-"+invite.Code+".png", png))
+	image.FillMode = canvas.ImageFillContain
+	image.SetMinSize(fyne.NewSize(qrCodeDisplaySize, qrCodeDisplaySize))
+
+	relayLabel := widget.NewLabelWithStyle("中继: "+invite.RelayDescription(), fyne.TextAlignCenter, fyne.TextStyle{})
+	saveBtn := widget.NewButtonWithIcon("保存二维码", theme.DocumentSaveIcon(), func() {
+		saveQRCode(invite.Code, png, window)
+	})
+	var copyBtn *widget.Button
+	copyBtn = widget.NewButtonWithIcon("复制链接", theme.ContentCopyIcon(), func() {
+		fyne.CurrentApp().Clipboard().SetContent(invite.URI())
+		copyBtn.SetText("已复制")
+	})
+
+	return container.NewVBox(
+		container.NewCenter(image),
+		relayLabel,
+		container.NewCenter(container.NewHBox(saveBtn, copyBtn)),
+	)
+}
+
+// saveQRCode 把二维码保存为 PNG 文件，方便通过聊天工具分享
+func saveQRCode(code string, png []byte, window fyne.Window) {
+	save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+		if _, err := writer.Write(png); err != nil {
+			dialog.ShowError(fmt.Errorf("保存二维码失败: %w", err), window)
+		}
+	}, window)
+	save.SetFileName("mocroc-" + code + ".png")
+	save.Show()
+}
+
+// showQRCodeDialog 在对话框中显示接收信息的二维码
+func showQRCodeDialog(invite share.Invite, window fyne.Window) {
+	dialog.ShowCustom("接收码 "+invite.Code, "关闭", newQRCodeContent(invite, window), window)
+}
@@ -1,20 +1,22 @@
 package pages
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
-	"runtime"
 	"strings"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	fynestorage "fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
-	"github.com/schollz/croc/v10/src/croc"
+	"github.com/shapled/mocroc/internal/codephrase"
 	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
+	"github.com/shapled/mocroc/internal/share"
 	"github.com/shapled/mocroc/internal/storage"
 )
 
@@ -22,41 +24,61 @@ type ReceivePage struct {
 	crocManager    *crocmgr.Manager
 	window         fyne.Window
 	historyStorage *storage.HistoryStorage
+	relayProfiles  *storage.RelayProfileStore
+	prefs          storage.Preferences
 
 	// 回调函数
 	onNavigateToDetail func()
-	onUpdateDetail   func(state string, progress float64, message string)
 
 	// UI 组件
-	scanBtn       *widget.Button
-	codeEntry     *widget.Entry
-	downloadBtn   *widget.Button
-	cancelBtn     *widget.Button
-	savePathBtn   *widget.Button
-	savePathLabel *widget.Label
-	progressBar   *widget.ProgressBar
-	statusLabel   *widget.Label
+	scanBtn        *widget.Button
+	codeEntry      *widget.Entry
+	codeHint       *widget.Label
+	suggestBtn     *widget.Button
+	downloadBtn    *widget.Button
+	cancelBtn      *widget.Button
+	savePathBtn    *widget.Button
+	savePathLabel  *widget.Label
+	conflictSelect *widget.Select
+	progressBar    *widget.ProgressBar
+	statusLabel    *widget.Label
+	advancedCheck  *widget.Check
+	advancedCard   *widget.Card
+	rulesCheck     *widget.Check
+	rulesCard      *widget.Card
+	relay          *relaySettings
+	saveRules      *saveRulesSettings
 
 	// 数据
-	receiveCode  string
-	savePath     string
-	isReceiving  bool
-	currentItemID string // 当前传输记录的ID
+	receiveCode string
+	savePath    string
+	isReceiving bool
+	historyIDs  map[string]string     // 接收码到历史记录ID的映射，只在主线程中访问
+	cancelStart context.CancelFunc    // 取消还没有开始的接收，只在主线程中访问
+	transfer    *crocmgr.Transfer     // 只在主线程中访问
+	invite      *share.Invite         // 二维码或链接中的接收信息
+	retryRelay  *crocmgr.RelayProfile // 重试历史记录时上次使用的中继
+	retryCode   string                // 重试的接收码，与输入的接收码一致时使用 retryRelay
 
 	// 容器
 	content fyne.CanvasObject
 }
 
-func NewReceiveTab(crocManager *crocmgr.Manager, window fyne.Window, historyStorage *storage.HistoryStorage) *ReceivePage {
+func NewReceiveTab(crocManager *crocmgr.Manager, window fyne.Window, historyStorage *storage.HistoryStorage, relayProfiles *storage.RelayProfileStore, prefs storage.Preferences) *ReceivePage {
 	tab := &ReceivePage{
 		crocManager:    crocManager,
 		window:         window,
 		historyStorage: historyStorage,
-		savePath:       getDefaultSavePath(),
+		relayProfiles:  relayProfiles,
+		prefs:          prefs,
+		savePath:       storage.SaveRules(prefs).Dir,
+		historyIDs:     make(map[string]string),
 	}
 	tab.createWidgets()
 	tab.buildContent()
 	tab.content.Refresh()
+	// 在主线程中处理接收任务的事件
+	crocManager.Events().SubscribeWith(fyne.Do, tab.onTransferEvent)
 	return tab
 }
 
@@ -64,15 +86,16 @@ func (page *ReceivePage) SetOnNavigateToDetail(callback func()) {
 	page.onNavigateToDetail = callback
 }
 
-func (page *ReceivePage) SetOnUpdateDetail(callback func(state string, progress float64, message string)) {
-	page.onUpdateDetail = callback
-}
-
 // GetReceiveData 获取接收数据用于详情页
 func (page *ReceivePage) GetReceiveData() (code string, savePath string) {
 	return page.receiveCode, page.savePath
 }
 
+// ConflictPolicy 返回保存目录中已有同名文件时的处理方式
+func (page *ReceivePage) ConflictPolicy() crocmgr.ConflictPolicy {
+	return storage.ConflictPolicy(page.prefs)
+}
+
 // GetIsReceiving 获取接收状态
 func (page *ReceivePage) GetIsReceiving() bool {
 	return page.isReceiving
@@ -87,12 +110,30 @@ func (page *ReceivePage) createWidgets() {
 	page.codeEntry = widget.NewEntry()
 	page.codeEntry.SetPlaceHolder("请输入接收码")
 	page.codeEntry.Resize(fyne.NewSize(280, 48)) // 移动端标准尺寸
+	page.codeHint = widget.NewLabelWithStyle("", fyne.TextAlignCenter, fyne.TextStyle{})
+	page.codeHint.Wrapping = fyne.TextWrapWord
+	page.suggestBtn = widget.NewButtonWithIcon("使用建议", theme.ConfirmIcon(), nil)
+	page.suggestBtn.Hide()
 
 	// 保存位置
 	page.savePathLabel = widget.NewLabel(page.savePath)
 	page.savePathBtn = widget.NewButtonWithIcon("选择保存位置", theme.FolderIcon(), page.onSelectSavePath)
 	page.savePathBtn.Resize(fyne.NewSize(200, 48)) // 符合移动端标准
 
+	// 同名文件处理方式，修改后立即保存
+	var policies []string
+	for _, p := range crocmgr.ConflictPolicies() {
+		policies = append(policies, p.Description())
+	}
+	page.conflictSelect = widget.NewSelect(policies, nil)
+	page.conflictSelect.SetSelected(page.ConflictPolicy().Description())
+	page.conflictSelect.OnChanged = func(string) {
+		policy := crocmgr.ConflictPolicies()[page.conflictSelect.SelectedIndex()]
+		if err := storage.SetConflictPolicy(page.prefs, policy); err != nil {
+			page.crocManager.Log("保存同名文件处理方式失败: " + err.Error())
+		}
+	}
+
 	// 下载和取消按钮
 	page.downloadBtn = widget.NewButtonWithIcon("开始接收", theme.DownloadIcon(), page.onDownload)
 	page.downloadBtn.Resize(fyne.NewSize(280, 56)) // 移动端标准尺寸
@@ -107,6 +148,30 @@ func (page *ReceivePage) createWidgets() {
 	// 进度显示
 	page.progressBar = widget.NewProgressBar()
 	page.statusLabel = widget.NewLabel("等待接收码...")
+
+	// 中继设置
+	page.relay = newRelaySettings(page.relayProfiles, page.crocManager.Diagnostics(), page.window)
+	// 保存位置规则
+	page.saveRules = newSaveRulesSettings(page.prefs)
+	page.rulesCard = widget.NewCard("", "", page.saveRules.content())
+	page.rulesCard.Hide()
+	page.rulesCheck = widget.NewCheck("保存规则", func(checked bool) {
+		if checked {
+			page.rulesCard.Show()
+		} else {
+			page.rulesCard.Hide()
+		}
+	})
+
+	page.advancedCard = widget.NewCard("", "", page.relay.content())
+	page.advancedCard.Hide()
+	page.advancedCheck = widget.NewCheck("中继设置", func(checked bool) {
+		if checked {
+			page.advancedCard.Show()
+		} else {
+			page.advancedCard.Hide()
+		}
+	})
 }
 
 func (page *ReceivePage) buildPreReceiveContent() fyne.CanvasObject {
@@ -127,8 +192,10 @@ func (page *ReceivePage) buildPreReceiveContent() fyne.CanvasObject {
 	divider := container.NewCenter(widget.NewLabel("—— 或手动输入 ——"))
 
 	// 接收码输入区域 - 居中显示
-	codeContainer := container.NewCenter(
-		page.codeEntry,
+	codeContainer := container.NewVBox(
+		container.NewCenter(page.codeEntry),
+		page.codeHint,
+		container.NewCenter(page.suggestBtn),
 	)
 
 	// 确认接收按钮
@@ -137,14 +204,7 @@ func (page *ReceivePage) buildPreReceiveContent() fyne.CanvasObject {
 	)
 
 	// 设置接收码输入变化时的验证
-	page.codeEntry.OnChanged = func(s string) {
-		// 启用/禁用下载按钮
-		if len(strings.TrimSpace(s)) >= 3 { // 最少3个字符才能启用
-			page.downloadBtn.Enable()
-		} else {
-			page.downloadBtn.Disable()
-		}
-	}
+	page.codeEntry.OnChanged = page.onCodeChanged
 
 	// 保存位置区域
 	saveSection := container.NewHBox(
@@ -174,7 +234,15 @@ func (page *ReceivePage) buildPreReceiveContent() fyne.CanvasObject {
 		confirmContainer,
 		widget.NewLabel(""), // 大间距
 		widget.NewLabel(""), // 大间距
-		widget.NewCard("保存设置", "", container.NewPadded(saveSection)),
+		widget.NewCard("保存设置", "", container.NewPadded(container.NewVBox(
+			saveSection,
+			widget.NewForm(&widget.FormItem{Text: "同名文件:", Widget: page.conflictSelect}),
+		))),
+		page.rulesCheck,
+		page.rulesCard,
+		widget.NewLabel(""), // 间距
+		page.advancedCheck,
+		page.advancedCard,
 		widget.NewLabel(""), // 间距
 		helpText,
 	)
@@ -244,6 +312,23 @@ func (page *ReceivePage) Cancel() error {
 	return nil
 }
 
+// Accept 接受发送方提供的文件，开始接收
+// 同名文件按设置的方式处理，choices 是逐个询问时为每个文件选择的方式。
+func (page *ReceivePage) Accept(choices crocmgr.ConflictChoices) error {
+	if page.transfer == nil {
+		return crocmgr.ErrNoOffer
+	}
+	return page.transfer.AcceptWith(page.ConflictPolicy(), choices)
+}
+
+// Reject 拒绝发送方提供的文件，历史记录在收到取消事件后更新
+func (page *ReceivePage) Reject() error {
+	if page.transfer == nil {
+		return crocmgr.ErrNoOffer
+	}
+	return page.transfer.Reject()
+}
+
 func (page *ReceivePage) refreshDisplay() {
 	page.buildContent()
 	page.content.Refresh()
@@ -255,8 +340,74 @@ func (page *ReceivePage) onScanQR() {
 		page.statusLabel.SetText("⚠️ 正在接收文件，请完成后再尝试扫描")
 		return
 	}
-	// TODO: 实现二维码扫描
-	page.statusLabel.SetText("📷 二维码扫描功能开发中，请使用手动输入")
+
+	// Fyne 没有摄像头接口，从相册或截图中选择二维码图片
+	open := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, page.window)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		invite, err := share.DecodeQRCodeReader(reader)
+		if err != nil {
+			page.statusLabel.SetText("❌ " + err.Error())
+			return
+		}
+		page.ApplyInvite(invite)
+	}, page.window)
+	open.SetFilter(fynestorage.NewExtensionFileFilter([]string{".png", ".jpg", ".jpeg"}))
+	open.Show()
+}
+
+// onCodeChanged 检查输入的接收码
+// 无效时禁用接收按钮；单词不在词表中时提示，能确定修正时提供建议。
+func (page *ReceivePage) onCodeChanged(s string) {
+	// 粘贴的接收链接直接解析
+	if share.IsInviteURI(s) {
+		if invite, err := share.ParseInvite(s); err == nil {
+			page.ApplyInvite(invite)
+			return
+		}
+	}
+
+	page.suggestBtn.Hide()
+	if strings.TrimSpace(s) == "" {
+		page.codeHint.SetText("")
+		page.downloadBtn.Disable()
+		return
+	}
+	result, err := codephrase.Inspect(s)
+	if err != nil {
+		page.codeHint.SetText("❌ " + err.Error())
+		page.downloadBtn.Disable()
+		return
+	}
+	page.downloadBtn.Enable()
+
+	switch {
+	case result.Suggestion != "":
+		page.codeHint.SetText("⚠️ 接收码中的单词可能有误，是否是 " + result.Suggestion + "？")
+		page.suggestBtn.OnTapped = func() { page.codeEntry.SetText(result.Suggestion) }
+		page.suggestBtn.Show()
+	case len(result.Unknown) > 0:
+		page.codeHint.SetText("⚠️ 词表中没有 " + strings.Join(result.Unknown, "、") + "，请与发送方确认接收码")
+	default:
+		page.codeHint.SetText("")
+	}
+}
+
+// ApplyInvite 填入二维码或链接中的接收码和中继设置
+// 接收时使用发送方的中继，不受自动选择影响。
+func (page *ReceivePage) ApplyInvite(invite share.Invite) {
+	page.invite = &invite
+	page.codeEntry.SetText(invite.Code)
+	page.relay.load(invite.Profile("发送方中继"))
+	page.relay.showInfo("使用发送方的中继: " + invite.RelayDescription())
+	page.statusLabel.SetText("✅ 已识别接收码: " + invite.Code)
 }
 
 func (page *ReceivePage) onSelectSavePath() {
@@ -270,7 +421,14 @@ func (page *ReceivePage) onSelectSavePath() {
 			return
 		}
 
-		page.savePath = reader.Path()
+		// 保存位置和规则一起保存，重启后仍然使用
+		rules := storage.SaveRules(page.prefs)
+		rules.Dir = reader.Path()
+		if err := storage.SetSaveRules(page.prefs, rules); err != nil {
+			page.statusLabel.SetText("❌ 保存位置无法保存: " + err.Error())
+			return
+		}
+		page.savePath = rules.Dir
 		page.savePathLabel.SetText(page.savePath)
 		page.statusLabel.SetText("✅ 保存位置已更新")
 	}, page.window)
@@ -282,11 +440,20 @@ func (page *ReceivePage) onDownload() {
 		return
 	}
 
-	code := strings.TrimSpace(page.codeEntry.Text)
-	if code == "" {
+	if strings.TrimSpace(page.codeEntry.Text) == "" {
 		page.statusLabel.SetText("❌ 请先输入接收码")
 		return
 	}
+	// 在创建 croc 客户端之前拦截 croc 无法使用的接收码
+	result, err := codephrase.Inspect(page.codeEntry.Text)
+	if err != nil {
+		page.statusLabel.SetText("❌ " + err.Error())
+		return
+	}
+	code := result.Code
+	if code != page.codeEntry.Text {
+		page.codeEntry.SetText(code)
+	}
 
 	page.receiveCode = code
 
@@ -296,7 +463,7 @@ func (page *ReceivePage) onDownload() {
 		page.statusLabel.SetText("创建历史记录失败: " + err.Error())
 		return
 	}
-	page.currentItemID = itemID
+	page.historyIDs[code] = itemID
 
 	// 先导航到详情页（此时状态还是 Idle，允许导航）
 	if page.onNavigateToDetail != nil {
@@ -307,7 +474,15 @@ func (page *ReceivePage) onDownload() {
 	page.isReceiving = true
 
 	// 启动接收协程
-	go page.startReceiving()
+	// 接收码与识别的二维码一致时使用发送方的中继，与重试的记录一致时使用上次的中继
+	var invite *share.Invite
+	var relay *crocmgr.RelayProfile
+	if page.invite != nil && page.invite.Code == code {
+		invite = page.invite
+	} else if page.retryRelay != nil && page.retryCode == code {
+		relay = page.retryRelay
+	}
+	go page.startReceiving(page.startContext(), invite, relay)
 }
 
 func (page *ReceivePage) onCancel() {
@@ -316,141 +491,323 @@ func (page *ReceivePage) onCancel() {
 	}
 
 	page.statusLabel.SetText("正在取消接收...")
-	page.crocManager.Cancel()
+	// 还在选择中继时不再开始接收
+	page.cancelStart()
+	// 只取消当前的接收任务，界面和历史记录在任务结束、收到取消事件后更新
+	if page.transfer != nil {
+		page.transfer.Cancel()
+	}
+}
 
-	// 更新历史记录状态为已取消
-	page.updateHistoryItemStatus("cancelled")
+// startContext 返回开始接收之前可以被取消的 context，在主线程中调用
+func (page *ReceivePage) startContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	page.cancelStart = cancel
+	return ctx
+}
+
+// setTransfer 在主线程中记录开始的接收任务，开始之前已经取消时立即取消任务
+func (page *ReceivePage) setTransfer(ctx context.Context, transfer *crocmgr.Transfer) {
+	fyne.Do(func() {
+		page.transfer = transfer
+		if ctx.Err() != nil {
+			transfer.Cancel()
+		}
+	})
+}
 
-	// 重置状态
+// resetReceiveState 接收任务结束或没有开始时回到输入接收码的界面
+func (page *ReceivePage) resetReceiveState() {
 	fyne.Do(func() {
 		page.isReceiving = false
+		page.cancelStart()
+		page.transfer = nil
 		page.refreshDisplay()
-		page.progressBar.SetValue(0.0)
-		page.statusLabel.SetText("接收已取消")
-		page.receiveCode = ""
-		page.currentItemID = ""
 	})
-
 }
 
-// 辅助函数
-func getDefaultSavePath() string {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		// 如果获取用户主目录失败，使用临时目录
-		if runtime.GOOS == "windows" {
-			return os.Getenv("TEMP")
+func (page *ReceivePage) startReceiving(ctx context.Context, invite *share.Invite, relay *crocmgr.RelayProfile) {
+	defer page.resetReceiveState()
+
+	// 创建 Croc 选项，中继服务器由中继设置决定
+	options := crocmgr.DefaultOptions(false, page.receiveCode)
+	switch {
+	case invite != nil:
+		invite.Apply(&options)
+	case relay != nil:
+		local, err := relay.Apply(&options)
+		if err != nil {
+			page.publishFailure(err, nil)
+			return
+		}
+		if local != nil {
+			page.relay.showLocalRelay(local)
+		}
+	default:
+		if err := page.relay.apply(&options); err != nil {
+			page.publishFailure(err, nil)
+			return
 		}
-		return "/tmp"
 	}
 
-	downloads := filepath.Join(home, "Downloads")
-	if _, err := os.Stat(downloads); os.IsNotExist(err) {
-		// 如果 Downloads 目录不存在，使用主目录
-		return home
+	// 文件保存到保存目录，不改变进程的工作目录
+	rules := storage.SaveRules(page.prefs)
+	rules.Dir = page.savePath
+	if ctx.Err() != nil {
+		page.publishCancelled()
+		return
+	}
+
+	// 创建独立的接收任务，不会影响同时进行的发送
+	// 收到文件列表后等待用户在详情页确认，确认后按保存规则放到对应的文件夹
+	transfer, err := page.crocManager.StartReceiveWithRules(options, rules)
+	if err != nil {
+		page.publishFailure(err, nil)
+		return
 	}
+	page.setTransfer(ctx, transfer)
 
-	return downloads
+	page.crocManager.Log("开始接收文件...")
+
+	// 界面和历史记录由传输事件驱动，这里只等待任务结束
+	if err := transfer.Wait(); err != nil {
+		page.crocManager.Log("接收结束: " + err.Error())
+		return
+	}
+	page.crocManager.Log("接收完成")
 }
 
-func (page *ReceivePage) startReceiving() {
-	startTime := time.Now()
+// Resume 使用相同的接收码继续历史记录中中断的接收
+// 为继续的接收创建新的历史记录，原记录不再显示继续按钮。
+func (page *ReceivePage) Resume(item storage.HistoryItem) error {
+	if page.isReceiving {
+		return errors.New("正在接收中，请等待当前任务完成")
+	}
+	if !item.Resumable() || item.Resume.Direction != crocmgr.DirectionReceive {
+		return crocmgr.ErrNotResumable
+	}
+	resume := *item.Resume
+	page.receiveCode = resume.Code
+	page.codeEntry.SetText(resume.Code)
 
-	defer func() {
-		fyne.Do(func() {
-			page.isReceiving = false
-			page.refreshDisplay()
-		})
-	}()
+	recordID, err := page.historyStorage.Add(storage.HistoryItem{
+		Type:       "receive",
+		FileName:   item.FileName,
+		FileSize:   item.FileSize,
+		Code:       resume.Code,
+		Status:     lifecycle.Preparing,
+		Timestamp:  time.Now(),
+		ClientInfo: item.ClientInfo,
+		NumFiles:   item.NumFiles,
+		Resume:     &resume,
+	})
+	if err != nil {
+		return fmt.Errorf("创建历史记录失败: %w", err)
+	}
+	page.historyIDs[resume.Code] = recordID
+	if err := page.historyStorage.Update(item.ID, func(old *storage.HistoryItem) {
+		old.Resume = nil
+	}); err != nil {
+		page.crocManager.Log("更新历史记录失败: " + err.Error())
+	}
 
-	// 更新历史记录状态为进行中
-	page.updateHistoryItemStatus("in_progress")
+	if page.onNavigateToDetail != nil {
+		page.onNavigateToDetail()
+	}
+	page.isReceiving = true
+	go page.resumeReceiving(page.startContext(), resume)
+	return nil
+}
 
-	// 通知详情页更新状态
-	if page.onUpdateDetail != nil {
-		page.onUpdateDetail("connecting", 0.0, "正在连接发送方...")
+// Retry 重新接收失败或取消的记录
+// 有断点信息时继续接收，否则使用相同的接收码和上次的中继重新开始，保存到当前的保存位置。
+func (page *ReceivePage) Retry(item storage.HistoryItem) error {
+	if item.Resumable() {
+		return page.Resume(item)
+	}
+	if page.isReceiving {
+		return errors.New("正在接收中，请等待当前任务完成")
+	}
+	if item.Type != "receive" || item.Code == "" {
+		return errors.New("只能重试有接收码的接收记录")
+	}
+	if item.Status != lifecycle.Failed && item.Status != lifecycle.Cancelled {
+		return errors.New("只能重试失败或取消的接收")
+	}
+	if _, err := codephrase.Inspect(item.Code); err != nil {
+		return err
 	}
 
-	// 创建 Croc 选项 - 根据文档中的正确配置
-	options := croc.Options{
-		IsSender:       false,
-		SharedSecret:   page.receiveCode,
-		Debug:          false,
-		NoPrompt:       true, // 对应命令行的 --yes 参数
-		Stdout:         false,
-		NoMultiplexing: false,
-		HashAlgorithm:  "xxhash",
-		Curve:          "p256", // 必须小写，不是 "P-256"
-		ZipFolder:      false,
-		Exclude:        []string{},
-		GitIgnore:      false,
-		Overwrite:      false,
+	page.invite = nil
+	page.retryCode, page.retryRelay = item.Code, item.Relay
+	page.codeEntry.SetText(item.Code)
+	if item.Relay != nil {
+		page.relay.showInfo("使用上次的中继: " + relayDescription(*item.Relay))
 	}
+	page.onDownload()
+	return nil
+}
 
-	// 接收端必须设置中继服务器配置才能正常工作
-	options.RelayAddress = "croc.schollz.com"
-	options.RelayPorts = []string{"9009", "9010", "9011", "9012", "9013"}
-	options.RelayPassword = "pass123"
-	options.OnlyLocal = false
-	options.DisableLocal = false
+// resumeReceiving 在后台继续中断的接收，已经确认过文件列表，不再等待确认
+func (page *ReceivePage) resumeReceiving(ctx context.Context, resume crocmgr.Resume) {
+	defer page.resetReceiveState()
 
-	// 创建 Croc 客户端
-	client, err := page.crocManager.CreateCrocClient(options)
+	if ctx.Err() != nil {
+		page.publishCancelled()
+		return
+	}
+	transfer, err := page.crocManager.Resume(resume)
 	if err != nil {
-		fyne.Do(func() {
-			page.statusLabel.SetText("创建客户端失败: " + err.Error())
-		})
-		// 更新历史记录状态为失败
-		page.updateHistoryItemStatus("failed")
-		// 通知详情页更新状态
-		if page.onUpdateDetail != nil {
-			page.onUpdateDetail("failed", 0.0, "创建客户端失败: "+err.Error())
-		}
+		// 没能重新开始时保留断点信息，之后还可以再试
+		page.publishFailure(err, &resume)
+		return
+	}
+	page.setTransfer(ctx, transfer)
+	page.crocManager.Log("继续接收文件...")
+	if err := transfer.Wait(); err != nil {
+		page.crocManager.Log("接收结束: " + err.Error())
 		return
 	}
+	page.crocManager.Log("接收完成")
+}
 
-	page.crocManager.Log("开始接收文件...")
+// publishFailure 发布创建任务之前的失败，让详情页和历史记录一起更新
+func (page *ReceivePage) publishFailure(err error, resume *crocmgr.Resume) {
+	page.crocManager.Events().Publish(crocmgr.Event{
+		Type:      crocmgr.EventFailed,
+		Direction: crocmgr.DirectionReceive,
+		Code:      page.receiveCode,
+		State:     lifecycle.Failed,
+		Err:       err,
+		Resume:    resume,
+	})
+}
 
-	// 通知详情页更新状态为接收中
-	if page.onUpdateDetail != nil {
-		page.onUpdateDetail("receiving", 0.1, "正在接收文件...")
-	}
+// publishCancelled 发布开始之前取消的接收，历史记录按取消处理
+func (page *ReceivePage) publishCancelled() {
+	page.crocManager.Events().Publish(crocmgr.Event{
+		Type:      crocmgr.EventCancelled,
+		Direction: crocmgr.DirectionReceive,
+		Code:      page.receiveCode,
+		State:     lifecycle.Cancelled,
+		Err:       crocmgr.ErrTransferCancelled,
+	})
+}
 
-	// 启动接收
-	err = client.Receive()
-	if err != nil {
-		fyne.Do(func() {
-			page.statusLabel.SetText("接收失败: " + err.Error())
-		})
-		page.crocManager.Log("接收失败: " + err.Error())
-		// 更新历史记录状态为失败
-		page.updateHistoryItemStatus("failed")
-		// 通知详情页更新状态
-		if page.onUpdateDetail != nil {
-			page.onUpdateDetail("failed", 0.0, "接收失败: "+err.Error())
-		}
+// onTransferEvent 处理接收任务的事件，更新界面和历史记录
+func (page *ReceivePage) onTransferEvent(e crocmgr.Event) {
+	if e.Direction != crocmgr.DirectionReceive {
+		return
+	}
+	historyID, ok := page.historyIDs[e.Code]
+	if !ok {
 		return
 	}
 
-	// 计算传输耗时
-	duration := int64(time.Since(startTime).Seconds())
+	message := receiveEventMessage(e, page.savePath)
+	page.statusLabel.SetText(message)
+	switch e.State {
+	case lifecycle.Transferring, lifecycle.Verifying:
+		page.progressBar.SetValue(e.Progress.Fraction())
+	case lifecycle.Completed:
+		page.progressBar.SetValue(1.0)
+	}
 
-	// 接收完成 - 更新历史记录状态为已完成，并记录耗时
-	page.updateHistoryItemCompleted(duration)
+	if e.Type == crocmgr.EventOffer && e.Offer != nil {
+		page.updateHistoryItemOffer(historyID, *e.Offer, e.Manifest)
+	}
+	if e.IsText && page.historyStorage.StoreText() {
+		page.updateHistoryItemText(historyID, e.Text)
+	}
+	if e.Relay != nil {
+		page.updateHistoryItemRelay(historyID, *e.Relay)
+	}
 
-	// 通知详情页更新状态为完成
-	if page.onUpdateDetail != nil {
-		page.onUpdateDetail("completed", 1.0, "接收完成！文件保存在: "+page.savePath)
+	// 进度事件不改变状态，不需要写入历史记录
+	if e.Type != crocmgr.EventProgress && e.Type != crocmgr.EventFileStarted {
+		page.updateHistoryItemStatus(historyID, e.State, message)
 	}
+	if e.IsFinal() {
+		page.updateHistoryItemResume(historyID, e.Resume)
+		if e.Verification != nil {
+			page.updateHistoryItemVerification(historyID, *e.Verification)
+		}
+		if len(e.Files) > 0 {
+			page.updateHistoryItemFiles(historyID, e.Files)
+		}
+		if e.Manifest != nil {
+			page.updateHistoryItemManifest(historyID, *e.Manifest)
+		}
+		delete(page.historyIDs, e.Code)
+	}
+}
 
-	fyne.Do(func() {
-		page.progressBar.SetValue(1.0)
-		page.statusLabel.SetText("接收完成！文件保存在: " + page.savePath)
-	})
-	page.crocManager.Log("接收完成")
+// receiveEventMessage 返回接收事件对应的状态信息
+func receiveEventMessage(e crocmgr.Event, savePath string) string {
+	switch e.Type {
+	case crocmgr.EventOffer:
+		if e.Offer != nil {
+			return fmt.Sprintf("发送方提供了 %s（%s），请确认是否接收",
+				offerFileName(*e.Offer), storage.FormatFileSize(e.Offer.TotalBytes))
+		}
+	case crocmgr.EventCompleted:
+		if e.IsText {
+			return "文本接收完成"
+		}
+		message := "接收完成！文件保存在: " + savePath
+		if summary := conflictSummary(e.Files); summary != "" {
+			message += "\n" + summary
+		}
+		if e.Verification != nil {
+			message += "\n" + e.Verification.Summary()
+		}
+		return message
+	case crocmgr.EventFailed:
+		return "接收失败: " + errorText(e.Err)
+	case crocmgr.EventCancelled:
+		if errors.Is(e.Err, crocmgr.ErrOfferRejected) {
+			return "已拒绝接收"
+		}
+		return "接收已取消"
+	}
+
+	switch e.State {
+	case lifecycle.Waiting:
+		return "正在连接发送方..."
+	case lifecycle.Verifying:
+		return "接收完成，正在校验文件..."
+	default:
+		return formatProgress("正在接收文件", e.Progress)
+	}
+}
 
-	// 清空当前记录ID
-	page.currentItemID = ""
+// conflictSummary 返回同名文件的处理结果，没有同名文件时为空
+func conflictSummary(files []crocmgr.ReceivedFile) string {
+	renamed, overwritten, skipped := 0, 0, 0
+	for _, f := range files {
+		switch f.Conflict {
+		case crocmgr.ConflictRename:
+			renamed++
+		case crocmgr.ConflictOverwrite:
+			overwritten++
+		case crocmgr.ConflictSkip:
+			skipped++
+		}
+	}
+	var parts []string
+	if renamed > 0 {
+		parts = append(parts, fmt.Sprintf("%d 个重命名保存", renamed))
+	}
+	if overwritten > 0 {
+		parts = append(parts, fmt.Sprintf("%d 个覆盖", overwritten))
+	}
+	if skipped > 0 {
+		parts = append(parts, fmt.Sprintf("%d 个跳过", skipped))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "同名文件: " + strings.Join(parts, "，")
 }
 
 // createReceiveHistoryItem 创建接收历史记录
@@ -460,7 +817,7 @@ func (page *ReceivePage) createReceiveHistoryItem(code string) (string, error) {
 		FileName:   "等待接收文件信息",
 		FileSize:   "未知",
 		Code:       code,
-		Status:     "in_progress",
+		Status:     lifecycle.Preparing,
 		Timestamp:  time.Now(),
 		Duration:   0,
 		ClientInfo: "接收端",
@@ -470,33 +827,103 @@ func (page *ReceivePage) createReceiveHistoryItem(code string) (string, error) {
 	return page.historyStorage.Add(item)
 }
 
-// updateHistoryItemStatus 更新历史记录状态
-func (page *ReceivePage) updateHistoryItemStatus(status string) {
-	if page.currentItemID == "" {
-		return
+// offerFileName 返回文件列表的显示名称，单个文件时为文件名
+func offerFileName(o crocmgr.Offer) string {
+	if o.IsText {
+		return "文本内容"
+	}
+	if o.NumFiles() == 1 {
+		return o.Files[0].Name
 	}
+	return fmt.Sprintf("%d 个文件", o.NumFiles())
+}
 
-	err := page.historyStorage.Update(page.currentItemID, func(item *storage.HistoryItem) {
-		item.Status = status
+// updateHistoryItemOffer 用发送方提供的文件列表更新历史记录
+func (page *ReceivePage) updateHistoryItemOffer(historyID string, o crocmgr.Offer, m *crocmgr.Manifest) {
+	err := page.historyStorage.Update(historyID, func(item *storage.HistoryItem) {
+		item.FileName = offerFileName(o)
+		item.FileSize = storage.FormatFileSize(o.TotalBytes)
+		item.NumFiles = o.NumFiles()
+		if m != nil {
+			item.SetManifest(*m)
+		}
 	})
 	if err != nil {
-		page.crocManager.Log("更新历史记录状态失败: " + err.Error())
+		page.crocManager.Log("更新历史记录文件信息失败: " + err.Error())
+	}
+}
+
+// updateHistoryItemManifest 在历史记录中保存传输结束时的文件清单，其中包含发送方的校验值
+func (page *ReceivePage) updateHistoryItemManifest(historyID string, m crocmgr.Manifest) {
+	err := page.historyStorage.Update(historyID, func(item *storage.HistoryItem) {
+		item.SetManifest(m)
+	})
+	if err != nil {
+		page.crocManager.Log("更新历史记录文件清单失败: " + err.Error())
+	}
+}
+
+// updateHistoryItemRelay 在历史记录中保存任务使用的中继，重试时使用
+func (page *ReceivePage) updateHistoryItemRelay(historyID string, relay crocmgr.RelayProfile) {
+	err := page.historyStorage.Update(historyID, func(item *storage.HistoryItem) {
+		item.Relay = &relay
+	})
+	if err != nil {
+		page.crocManager.Log("更新历史记录中继失败: " + err.Error())
+	}
+}
+
+// updateHistoryItemText 在历史记录中保存接收到的文本
+func (page *ReceivePage) updateHistoryItemText(historyID string, text string) {
+	err := page.historyStorage.Update(historyID, func(item *storage.HistoryItem) {
+		item.Text = text
+	})
+	if err != nil {
+		page.crocManager.Log("更新历史记录文本失败: " + err.Error())
 	}
 }
 
-// updateHistoryItemCompleted 更新历史记录为完成状态
-func (page *ReceivePage) updateHistoryItemCompleted(duration int64) {
-	if page.currentItemID == "" {
+// updateHistoryItemStatus 更新历史记录状态和耗时，状态未变化时不做任何事
+func (page *ReceivePage) updateHistoryItemStatus(historyID string, state lifecycle.State, message string) {
+	if err := page.historyStorage.Transition(historyID, state, message); err != nil {
+		page.crocManager.Log("更新历史记录状态失败: " + err.Error())
 		return
 	}
 
-	err := page.historyStorage.Update(page.currentItemID, func(item *storage.HistoryItem) {
-		item.Status = "completed"
-		item.Duration = duration
-		// 这里可以进一步更新文件信息，但需要更复杂的实现
-		// 目前保持基础信息
+	err := page.historyStorage.Update(historyID, func(item *storage.HistoryItem) {
+		item.Duration = int64(time.Since(item.Timestamp).Seconds())
+	})
+	if err != nil {
+		page.crocManager.Log("更新历史记录耗时失败: " + err.Error())
+	}
+}
+
+// updateHistoryItemResume 记录中断时的断点信息，完成时清除
+func (page *ReceivePage) updateHistoryItemResume(historyID string, resume *crocmgr.Resume) {
+	err := page.historyStorage.Update(historyID, func(item *storage.HistoryItem) {
+		item.Resume = resume
+	})
+	if err != nil {
+		page.crocManager.Log("更新历史记录断点信息失败: " + err.Error())
+	}
+}
+
+// updateHistoryItemVerification 在历史记录中保存接收完成后的校验报告
+func (page *ReceivePage) updateHistoryItemVerification(historyID string, v crocmgr.Verification) {
+	err := page.historyStorage.Update(historyID, func(item *storage.HistoryItem) {
+		item.Verification = &v
+	})
+	if err != nil {
+		page.crocManager.Log("更新历史记录校验报告失败: " + err.Error())
+	}
+}
+
+// updateHistoryItemFiles 在历史记录中保存接收文件的最终位置
+func (page *ReceivePage) updateHistoryItemFiles(historyID string, files []crocmgr.ReceivedFile) {
+	err := page.historyStorage.Update(historyID, func(item *storage.HistoryItem) {
+		item.ReceivedFiles = files
 	})
 	if err != nil {
-		page.crocManager.Log("更新历史记录完成状态失败: " + err.Error())
+		page.crocManager.Log("更新历史记录文件位置失败: " + err.Error())
 	}
 }
@@ -2,42 +2,53 @@ package pages
 
 import (
 	"fmt"
+	"path/filepath"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
+	"github.com/shapled/mocroc/internal/storage"
 )
 
-type ReceiveDetailState int
-
-const (
-	ReceiveDetailStateConnecting ReceiveDetailState = iota
-	ReceiveDetailStateReceiving
-	ReceiveDetailStateCompleted
-	ReceiveDetailStateFailed
-	ReceiveDetailStateCancelled
-)
+// maxOfferFiles 预览中最多列出的文件数
+const maxOfferFiles = 20
 
 type ReceiveDetailPage struct {
 	window     fyne.Window
 	onBack     func()
 	onCancel   func()
-	state      ReceiveDetailState
+	onAccept   func(crocmgr.ConflictChoices)
+	onReject   func()
+	state      *lifecycle.Machine
 	fileName   string
+	code       string
 	senderInfo string
 	progress   float64
 	statusMsg  string
 	savePath   string
+	offer      *crocmgr.Offer // 等待确认的文件列表
+	text       string         // 接收到的文本
+	isText     bool
+
+	verification *crocmgr.Verification   // 接收完成后的校验报告
+	policy       crocmgr.ConflictPolicy  // 同名文件的处理方式
+	choices      crocmgr.ConflictChoices // 逐个询问时为每个同名文件选择的方式
+	files        []crocmgr.ReceivedFile  // 接收完成后文件保存的位置
 }
 
-func NewReceiveDetailPage(window fyne.Window, onBack, onCancel func()) *ReceiveDetailPage {
+func NewReceiveDetailPage(window fyne.Window, onBack, onCancel func(), onAccept func(crocmgr.ConflictChoices), onReject func()) *ReceiveDetailPage {
 	return &ReceiveDetailPage{
 		window:   window,
 		onBack:   onBack,
 		onCancel: onCancel,
-		state:    ReceiveDetailStateConnecting,
+		onAccept: onAccept,
+		onReject: onReject,
+		state:    lifecycle.NewMachine(),
 		progress: 0.0,
+		policy:   crocmgr.DefaultConflictPolicy,
 	}
 }
 
@@ -45,12 +56,35 @@ func (page *ReceiveDetailPage) SetFileName(name string) {
 	page.fileName = name
 }
 
+func (page *ReceiveDetailPage) SetCode(code string) {
+	page.code = code
+}
+
 func (page *ReceiveDetailPage) SetSenderInfo(info string) {
 	page.senderInfo = info
 }
 
-func (page *ReceiveDetailPage) SetState(state ReceiveDetailState) {
-	page.state = state
+// SetConflictPolicy 设置同名文件的处理方式，逐个询问时在预览中为每个文件选择
+func (page *ReceiveDetailPage) SetConflictPolicy(policy crocmgr.ConflictPolicy) {
+	page.policy = policy
+}
+
+// Reset 开始新的接收，状态回到准备中
+func (page *ReceiveDetailPage) Reset() {
+	page.state = lifecycle.NewMachine()
+	page.progress = 0.0
+	page.statusMsg = ""
+	page.offer = nil
+	page.text = ""
+	page.isText = false
+	page.verification = nil
+	page.choices = nil
+	page.files = nil
+}
+
+// SetState 推进到新状态，已结束或后退的状态会被拒绝
+func (page *ReceiveDetailPage) SetState(state lifecycle.State) error {
+	return page.state.Advance(state, "")
 }
 
 func (page *ReceiveDetailPage) SetProgress(progress float64) {
@@ -65,6 +99,46 @@ func (page *ReceiveDetailPage) SetSavePath(path string) {
 	page.savePath = path
 }
 
+// HandleEvent 处理当前接收码的接收事件，返回页面是否需要刷新
+func (page *ReceiveDetailPage) HandleEvent(e crocmgr.Event) bool {
+	if e.Direction != crocmgr.DirectionReceive || e.Code == "" || e.Code != page.code {
+		return false
+	}
+	// 过期的事件（例如完成后到达的进度）会被状态机拒绝
+	if err := page.SetState(e.State); err != nil {
+		return false
+	}
+	page.statusMsg = receiveEventMessage(e, page.savePath)
+	// 文本传输的文件名是随机的临时文件名，不显示
+	if e.Type == crocmgr.EventFileStarted && e.Progress.FileName != "" && (page.offer == nil || !page.offer.IsText) {
+		page.fileName = e.Progress.FileName
+	}
+	if e.IsText {
+		page.text = e.Text
+		page.isText = true
+	}
+	if e.Type == crocmgr.EventOffer && e.Offer != nil {
+		page.offer = e.Offer
+		page.fileName = offerFileName(*e.Offer)
+		page.choices = make(crocmgr.ConflictChoices)
+	}
+	if e.Verification != nil {
+		page.verification = e.Verification
+	}
+	if len(e.Files) > 0 {
+		page.files = e.Files
+	}
+	switch e.State {
+	case lifecycle.Transferring, lifecycle.Verifying:
+		page.progress = e.Progress.Fraction()
+	case lifecycle.Completed:
+		page.progress = 1.0
+	default:
+		page.progress = 0.0
+	}
+	return true
+}
+
 func (page *ReceiveDetailPage) Build() fyne.CanvasObject {
 	// 信息卡片
 	infoCard := widget.NewCard("传输信息", "", container.NewVBox(
@@ -75,8 +149,9 @@ func (page *ReceiveDetailPage) Build() fyne.CanvasObject {
 	))
 
 	// 进度卡片
+	state := page.state.State()
 	var progressCard fyne.CanvasObject
-	if page.state == ReceiveDetailStateReceiving || page.state == ReceiveDetailStateConnecting {
+	if !state.IsFinished() {
 		progressBar := widget.NewProgressBar()
 		progressBar.SetValue(page.progress)
 		progressCard = widget.NewCard("传输进度", "", container.NewVBox(
@@ -95,13 +170,13 @@ func (page *ReceiveDetailPage) Build() fyne.CanvasObject {
 
 	// 操作按钮
 	var actionButton *widget.Button
-	switch page.state {
-	case ReceiveDetailStateConnecting, ReceiveDetailStateReceiving:
+	switch state {
+	case lifecycle.Preparing, lifecycle.Waiting, lifecycle.Transferring, lifecycle.Verifying:
 		actionButton = widget.NewButtonWithIcon("取消接收", theme.CancelIcon(), page.onCancel)
-	case ReceiveDetailStateCompleted:
+	case lifecycle.Completed:
 		actionButton = widget.NewButtonWithIcon("完成", theme.ConfirmIcon(), page.onBack)
 		actionButton.Importance = widget.HighImportance
-	case ReceiveDetailStateFailed, ReceiveDetailStateCancelled:
+	case lifecycle.Failed, lifecycle.Cancelled:
 		actionButton = widget.NewButtonWithIcon("重新接收", theme.ViewRefreshIcon(), page.onBack)
 		actionButton.Importance = widget.MediumImportance
 	default:
@@ -111,17 +186,177 @@ func (page *ReceiveDetailPage) Build() fyne.CanvasObject {
 	actionCard := widget.NewCard("操作", "", actionButton)
 
 	// 主内容
-	mainContent := container.NewVBox(
-		infoCard,
-		progressCard,
-		statusCard,
-		actionCard,
-	)
+	mainContent := container.NewVBox(infoCard)
+	if page.offer != nil && state == lifecycle.Waiting {
+		mainContent.Add(page.buildOfferCard())
+	}
+	if page.isText && state == lifecycle.Completed {
+		mainContent.Add(page.buildTextCard())
+	}
+	if state == lifecycle.Completed {
+		if card := page.buildFilesCard(); card != nil {
+			mainContent.Add(card)
+		}
+	}
+	if page.verification != nil && state.IsFinished() {
+		mainContent.Add(page.buildVerificationCard())
+	}
+	mainContent.Add(progressCard)
+	mainContent.Add(statusCard)
+	mainContent.Add(actionCard)
 
 	// 使用滚动容器
 	return container.NewScroll(container.NewPadded(mainContent))
 }
 
+// buildOfferCard 创建文件预览卡片，确认后才开始接收
+func (page *ReceiveDetailPage) buildOfferCard() fyne.CanvasObject {
+	o := page.offer
+	summary := fmt.Sprintf("共 %d 个文件，%s", o.NumFiles(), storage.FormatFileSize(o.TotalBytes))
+	if o.NumFolders > 0 {
+		summary = fmt.Sprintf("共 %d 个文件，%d 个文件夹，%s", o.NumFiles(), o.NumFolders, storage.FormatFileSize(o.TotalBytes))
+	}
+
+	files := container.NewVBox()
+	for i, f := range o.Files {
+		if i == maxOfferFiles {
+			files.Add(widget.NewLabel(fmt.Sprintf("… 还有 %d 个文件", o.NumFiles()-maxOfferFiles)))
+			break
+		}
+		name := f.Path()
+		if f.SaveTo != "" {
+			// 按保存规则放到其他文件夹
+			name += " → " + f.SaveTo + "/"
+		}
+		if !f.Exists {
+			files.Add(container.NewBorder(nil, nil, nil, widget.NewLabel(storage.FormatFileSize(f.Size)), widget.NewLabel(name)))
+			continue
+		}
+		// 保存目录中已有同名文件，逐个询问时在这里选择处理方式
+		var action fyne.CanvasObject = widget.NewLabel(page.policy.Description())
+		if page.policy == crocmgr.ConflictAsk {
+			action = page.newConflictSelect(f.Path())
+		}
+		files.Add(container.NewBorder(nil, nil, nil, action, widget.NewLabel("⚠️ "+name+"（已存在）")))
+	}
+	if conflicts := len(o.Conflicts()); conflicts > 0 {
+		files.Add(widget.NewLabel(fmt.Sprintf("%d 个文件与保存目录中的文件同名", conflicts)))
+	}
+
+	var acceptBtn, rejectBtn *widget.Button
+	acceptBtn = widget.NewButtonWithIcon("接收", theme.ConfirmIcon(), func() {
+		acceptBtn.Disable()
+		rejectBtn.Disable()
+		page.onAccept(page.choices)
+	})
+	acceptBtn.Importance = widget.HighImportance
+	rejectBtn = widget.NewButtonWithIcon("拒绝", theme.CancelIcon(), func() {
+		acceptBtn.Disable()
+		rejectBtn.Disable()
+		page.onReject()
+	})
+
+	return widget.NewCard("文件预览", summary, container.NewVBox(
+		files,
+		container.NewGridWithColumns(2, rejectBtn, acceptBtn),
+	))
+}
+
+// newConflictSelect 创建同名文件处理方式的选择框，默认重命名保存
+func (page *ReceiveDetailPage) newConflictSelect(name string) *widget.Select {
+	policies := []crocmgr.ConflictPolicy{crocmgr.ConflictRename, crocmgr.ConflictOverwrite, crocmgr.ConflictSkip}
+	var options []string
+	for _, p := range policies {
+		options = append(options, p.Description())
+	}
+	sel := widget.NewSelect(options, nil)
+	choice, ok := page.choices[name]
+	if !ok {
+		choice = crocmgr.ConflictRename
+	}
+	sel.SetSelected(choice.Description())
+	sel.OnChanged = func(string) {
+		page.choices[name] = policies[sel.SelectedIndex()]
+	}
+	return sel
+}
+
+// buildFilesCard 列出按保存规则放到其他文件夹的文件和处理过的同名文件，没有时返回 nil
+func (page *ReceiveDetailPage) buildFilesCard() fyne.CanvasObject {
+	files := container.NewVBox()
+	for _, f := range page.files {
+		var text string
+		switch f.Conflict {
+		case "":
+			if f.Path == filepath.Join(page.savePath, filepath.FromSlash(f.Name)) {
+				continue
+			}
+			text = "📁 " + f.Name + " → " + f.Path
+		case crocmgr.ConflictRename:
+			text = "📝 " + f.Name + " → " + f.Path
+		case crocmgr.ConflictOverwrite:
+			text = "♻️ " + f.Name + "（已覆盖）"
+		case crocmgr.ConflictSkip:
+			text = "⏭️ " + f.Name + "（已跳过）"
+		}
+		label := widget.NewLabel(text)
+		label.Wrapping = fyne.TextWrapBreak
+		files.Add(label)
+	}
+	if len(files.Objects) == 0 {
+		return nil
+	}
+	return widget.NewCard("文件位置", conflictSummary(page.files), files)
+}
+
+// buildTextCard 显示接收到的文本，可以复制到剪贴板
+func (page *ReceiveDetailPage) buildTextCard() fyne.CanvasObject {
+	text := widget.NewLabel(page.text)
+	text.Wrapping = fyne.TextWrapWord
+	text.Selectable = true
+
+	var copyBtn *widget.Button
+	copyBtn = widget.NewButtonWithIcon("复制", theme.ContentCopyIcon(), func() {
+		fyne.CurrentApp().Clipboard().SetContent(page.text)
+		copyBtn.SetText("已复制")
+	})
+
+	return widget.NewCard("文本内容", storage.FormatFileSize(int64(len(page.text))), container.NewVBox(
+		text,
+		copyBtn,
+	))
+}
+
+// buildVerificationCard 显示每个文件的校验值和校验结论
+func (page *ReceiveDetailPage) buildVerificationCard() fyne.CanvasObject {
+	v := page.verification
+	files := container.NewVBox()
+	for i, f := range v.Files {
+		if i == maxOfferFiles {
+			files.Add(widget.NewLabel(fmt.Sprintf("… 还有 %d 个文件", len(v.Files)-maxOfferFiles)))
+			break
+		}
+		icon := "✅ "
+		if !f.OK {
+			icon = "❌ "
+		}
+		files.Add(widget.NewLabel(icon + f.Name))
+
+		detail := f.Actual
+		switch {
+		case f.Error != "":
+			detail = "无法读取: " + f.Error
+		case !f.OK:
+			detail = "期望: " + f.Expected + "\n实际: " + f.Actual
+		}
+		checksum := widget.NewLabelWithStyle(detail, fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+		checksum.Wrapping = fyne.TextWrapBreak
+		checksum.Selectable = true
+		files.Add(checksum)
+	}
+	return widget.NewCard("校验结果", v.Summary(), files)
+}
+
 // createInfoRow 创建信息行
 func (page *ReceiveDetailPage) createInfoRow(label, value, placeholder string) fyne.CanvasObject {
 	labelWidget := widget.NewLabelWithStyle(label, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
@@ -135,16 +370,23 @@ func (page *ReceiveDetailPage) createInfoRow(label, value, placeholder string) f
 }
 
 func (page *ReceiveDetailPage) getStateText() string {
-	switch page.state {
-	case ReceiveDetailStateConnecting:
+	switch page.state.State() {
+	case lifecycle.Preparing:
+		return "准备中"
+	case lifecycle.Waiting:
+		if page.offer != nil {
+			return "等待确认"
+		}
 		return "连接中"
-	case ReceiveDetailStateReceiving:
+	case lifecycle.Transferring:
 		return "接收中"
-	case ReceiveDetailStateCompleted:
+	case lifecycle.Verifying:
+		return "校验中"
+	case lifecycle.Completed:
 		return "接收完成"
-	case ReceiveDetailStateFailed:
+	case lifecycle.Failed:
 		return "接收失败"
-	case ReceiveDetailStateCancelled:
+	case lifecycle.Cancelled:
 		return "已取消"
 	default:
 		return "未知状态"
@@ -0,0 +1,210 @@
+package pages
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/schollz/croc/v10/src/croc"
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/storage"
+)
+
+// relaySettings 发送页和接收页共用的中继设置
+// 选择已保存的中继配置，也可以修改后保存为新的配置。
+// 开启自动选择时使用延迟最低的可用中继。
+type relaySettings struct {
+	store       *storage.RelayProfileStore
+	diagnostics *crocmgr.Diagnostics
+	window      fyne.Window
+
+	profileSelect     *widget.Select
+	nameEntry         *widget.Entry
+	addressEntry      *widget.Entry
+	address6Entry     *widget.Entry
+	portsEntry        *widget.Entry
+	passwordEntry     *widget.Entry
+	onlyLocalCheck    *widget.Check
+	disableLocalCheck *widget.Check
+	embeddedCheck     *widget.Check
+	autoCheck         *widget.Check
+	infoLabel         *widget.Label
+}
+
+func newRelaySettings(store *storage.RelayProfileStore, diagnostics *crocmgr.Diagnostics, window fyne.Window) *relaySettings {
+	s := &relaySettings{store: store, diagnostics: diagnostics, window: window}
+
+	s.nameEntry = widget.NewEntry()
+	s.addressEntry = widget.NewEntry()
+	s.address6Entry = widget.NewEntry()
+	s.address6Entry.SetPlaceHolder("可选")
+	s.portsEntry = widget.NewEntry()
+	s.portsEntry.SetPlaceHolder("9009,9010,9011,9012,9013")
+	s.passwordEntry = widget.NewPasswordEntry()
+	s.onlyLocalCheck = widget.NewCheck("仅使用局域网", nil)
+	s.disableLocalCheck = widget.NewCheck("禁用局域网直连", nil)
+	s.embeddedCheck = widget.NewCheck("在本机启动内置中继（局域网/离线）", func(checked bool) {
+		if checked {
+			s.addressEntry.Disable()
+			s.address6Entry.Disable()
+		} else {
+			s.addressEntry.Enable()
+			s.address6Entry.Enable()
+			s.infoLabel.Hide()
+		}
+	})
+	s.autoCheck = widget.NewCheck("自动选择延迟最低的中继", func(checked bool) {
+		if checked != s.store.AutoSelect() {
+			s.store.SetAutoSelect(checked)
+		}
+	})
+	s.autoCheck.SetChecked(store.AutoSelect())
+	s.infoLabel = widget.NewLabel("")
+	s.infoLabel.Wrapping = fyne.TextWrapWord
+	s.infoLabel.Hide()
+
+	s.profileSelect = widget.NewSelect(store.Names(), func(name string) {
+		if p, ok := s.store.Get(name); ok {
+			s.load(p)
+		}
+	})
+	s.profileSelect.SetSelected(store.Default().Name)
+
+	// 其他页面修改配置后刷新选项
+	store.OnChange(s.refreshProfiles)
+	return s
+}
+
+// content 返回中继设置表单
+func (s *relaySettings) content() fyne.CanvasObject {
+	buttons := container.NewHBox(
+		widget.NewButtonWithIcon("保存配置", theme.DocumentSaveIcon(), s.onSave),
+		widget.NewButtonWithIcon("设为默认", theme.ConfirmIcon(), s.onSetDefault),
+		widget.NewButtonWithIcon("删除", theme.DeleteIcon(), s.onDelete),
+	)
+	return container.NewVBox(
+		s.autoCheck,
+		widget.NewForm(&widget.FormItem{Text: "中继配置:", Widget: s.profileSelect}),
+		widget.NewForm(
+			&widget.FormItem{Text: "名称:", Widget: s.nameEntry},
+			&widget.FormItem{Text: "中继地址:", Widget: s.addressEntry},
+			&widget.FormItem{Text: "IPv6 地址:", Widget: s.address6Entry},
+			&widget.FormItem{Text: "端口:", Widget: s.portsEntry},
+			&widget.FormItem{Text: "密码:", Widget: s.passwordEntry},
+		),
+		s.onlyLocalCheck,
+		s.disableLocalCheck,
+		s.embeddedCheck,
+		buttons,
+		s.infoLabel,
+	)
+}
+
+// load 把中继配置显示到表单
+func (s *relaySettings) load(p crocmgr.RelayProfile) {
+	s.nameEntry.SetText(p.Name)
+	s.addressEntry.SetText(p.Address)
+	s.address6Entry.SetText(p.Address6)
+	s.portsEntry.SetText(strings.Join(p.Ports, ","))
+	s.passwordEntry.SetText(p.Password)
+	s.onlyLocalCheck.SetChecked(p.OnlyLocal)
+	s.disableLocalCheck.SetChecked(p.DisableLocal)
+	s.embeddedCheck.SetChecked(p.Embedded)
+}
+
+// profile 返回表单中的中继配置，包括尚未保存的修改
+func (s *relaySettings) profile() crocmgr.RelayProfile {
+	return crocmgr.RelayProfile{
+		Name:         strings.TrimSpace(s.nameEntry.Text),
+		Address:      strings.TrimSpace(s.addressEntry.Text),
+		Address6:     strings.TrimSpace(s.address6Entry.Text),
+		Ports:        crocmgr.ParseRelayPorts(s.portsEntry.Text),
+		Password:     s.passwordEntry.Text,
+		OnlyLocal:    s.onlyLocalCheck.Checked,
+		DisableLocal: s.disableLocalCheck.Checked,
+		Embedded:     s.embeddedCheck.Checked,
+	}
+}
+
+func (s *relaySettings) refreshProfiles() {
+	selected := s.profileSelect.Selected
+	s.profileSelect.SetOptions(s.store.Names())
+	if _, ok := s.store.Get(selected); !ok {
+		s.profileSelect.SetSelected(s.store.Default().Name)
+	}
+	s.autoCheck.SetChecked(s.store.AutoSelect())
+}
+
+func (s *relaySettings) onSave() {
+	p := s.profile()
+	if err := s.store.Save(p); err != nil {
+		dialog.ShowError(err, s.window)
+		return
+	}
+	s.profileSelect.SetSelected(p.Name)
+}
+
+func (s *relaySettings) onSetDefault() {
+	if err := s.store.SetDefault(s.profileSelect.Selected); err != nil {
+		dialog.ShowError(err, s.window)
+	}
+}
+
+func (s *relaySettings) onDelete() {
+	name := s.profileSelect.Selected
+	dialog.ShowConfirm("删除中继配置", "确定删除 "+name+" 吗？", func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := s.store.Delete(name); err != nil {
+			dialog.ShowError(err, s.window)
+		}
+	}, s.window)
+}
+
+// apply 校验中继配置并写入 croc 配置，需要时启动内置中继
+// 开启自动选择时先检查所有中继，在后台 goroutine 中调用。
+func (s *relaySettings) apply(options *croc.Options) error {
+	profile := s.profile()
+	if s.store.AutoSelect() {
+		fastest, status, err := s.diagnostics.Fastest(context.Background(), s.store.List())
+		if err != nil {
+			return fmt.Errorf("自动选择中继失败: %w", err)
+		}
+		profile = fastest
+		s.showInfo(fmt.Sprintf("已自动选择中继: %s（延迟 %d ms）", profile.Name, status.Latency.Round(time.Millisecond).Milliseconds()))
+	}
+
+	relay, err := profile.Apply(options)
+	if err != nil {
+		return err
+	}
+	if relay != nil {
+		s.showLocalRelay(relay)
+	}
+	return nil
+}
+
+// showLocalRelay 显示局域网内其他设备可以使用的中继地址
+func (s *relaySettings) showLocalRelay(relay *crocmgr.LocalRelay) {
+	addresses := relay.LANAddresses()
+	text := "内置中继已启动: " + relay.Address()
+	if len(addresses) > 0 {
+		text += "\n其他设备请使用中继地址: " + strings.Join(addresses, " 或 ")
+	}
+	s.showInfo(text)
+}
+
+// showInfo 在中继设置下方显示提示信息
+func (s *relaySettings) showInfo(text string) {
+	fyne.Do(func() {
+		s.infoLabel.SetText(text)
+		s.infoLabel.Show()
+	})
+}
@@ -0,0 +1,83 @@
+package pages
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/storage"
+)
+
+// saveRulesSettings 接收页的保存位置规则
+// 按扩展名或接收码前缀把文件放到不同的文件夹，可以再按日期分目录；保存目录由接收页选择。
+type saveRulesSettings struct {
+	prefs storage.Preferences
+
+	dateCheck *widget.Check
+	typeEntry *widget.Entry
+	codeEntry *widget.Entry
+	infoLabel *widget.Label
+}
+
+func newSaveRulesSettings(prefs storage.Preferences) *saveRulesSettings {
+	s := &saveRulesSettings{prefs: prefs}
+	rules := storage.SaveRules(prefs)
+
+	s.dateCheck = widget.NewCheck("按接收日期建立子目录（"+crocmgr.DateFolderLayout+"）", nil)
+	s.dateCheck.SetChecked(rules.DateFolders)
+	s.typeEntry = widget.NewMultiLineEntry()
+	s.typeEntry.SetPlaceHolder("jpg,png,heic = ~/Pictures/mocroc")
+	s.typeEntry.SetText(crocmgr.FormatTypeRules(rules.TypeRules))
+	s.typeEntry.Wrapping = fyne.TextWrapOff
+	s.codeEntry = widget.NewMultiLineEntry()
+	s.codeEntry.SetPlaceHolder("work- = 工作")
+	s.codeEntry.SetText(crocmgr.FormatCodeRules(rules.CodeRules))
+	s.codeEntry.Wrapping = fyne.TextWrapOff
+	s.infoLabel = widget.NewLabel("每行一条规则，文件夹可以是绝对路径、~/ 开头的主目录路径或保存位置下的子目录；扩展名规则优先")
+	s.infoLabel.Wrapping = fyne.TextWrapWord
+
+	// 修改日期分目录后立即保存
+	s.dateCheck.OnChanged = func(bool) { s.onSave() }
+	return s
+}
+
+// content 返回保存位置规则表单
+func (s *saveRulesSettings) content() fyne.CanvasObject {
+	return container.NewVBox(
+		s.dateCheck,
+		widget.NewForm(
+			&widget.FormItem{Text: "按扩展名:", Widget: s.typeEntry},
+			&widget.FormItem{Text: "按接收码前缀:", Widget: s.codeEntry},
+		),
+		widget.NewButtonWithIcon("保存规则", theme.DocumentSaveIcon(), s.onSave),
+		s.infoLabel,
+	)
+}
+
+// rules 返回表单中的保存位置规则，保存目录使用已保存的目录
+func (s *saveRulesSettings) rules() (crocmgr.SaveRules, error) {
+	rules := storage.SaveRules(s.prefs)
+	rules.DateFolders = s.dateCheck.Checked
+	var err error
+	if rules.TypeRules, err = crocmgr.ParseTypeRules(s.typeEntry.Text); err != nil {
+		return rules, err
+	}
+	if rules.CodeRules, err = crocmgr.ParseCodeRules(s.codeEntry.Text); err != nil {
+		return rules, err
+	}
+	return rules, nil
+}
+
+// onSave 检查并保存规则
+func (s *saveRulesSettings) onSave() {
+	rules, err := s.rules()
+	if err == nil {
+		err = storage.SetSaveRules(s.prefs, rules)
+	}
+	if err != nil {
+		s.infoLabel.SetText("❌ " + err.Error())
+		return
+	}
+	s.infoLabel.SetText("✅ 保存规则已更新")
+}
@@ -1,8 +1,9 @@
 package pages
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,7 +15,10 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"github.com/schollz/croc/v10/src/croc"
+	"github.com/shapled/mocroc/internal/codephrase"
 	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
+	"github.com/shapled/mocroc/internal/share"
 	"github.com/shapled/mocroc/internal/storage"
 )
 
@@ -24,63 +28,74 @@ const (
 )
 
 type SendPage struct {
-	crocManager *crocmgr.Manager
-	window      fyne.Window
-	storage     *storage.HistoryStorage
+	crocManager   *crocmgr.Manager
+	window        fyne.Window
+	storage       *storage.HistoryStorage
+	relayProfiles *storage.RelayProfileStore
+	prefs         storage.Preferences
 
 	// 回调函数
 	onNavigateToDetail func()
-	onUpdateDetail     func(state string, progress float64, message string)
+	onInvite           func(share.Invite) // 中继确定后在主线程中调用
 
 	// UI 组件
-	modeRadio         *widget.RadioGroup
-	fileContent       *fyne.Container
-	textContent       *fyne.Container
-	addFilesBtn       *widget.Button
-	textEntry         *widget.Entry
-	fileList          *widget.List
-	sendBtn           *widget.Button
-	cancelBtn         *widget.Button
-	codeLabel         *widget.Label
-	progressBar       *widget.ProgressBar
-	statusLabel       *widget.Label
-	advancedCheck     *widget.Check
-	disableLocalCheck *widget.Check
+	modeRadio     *widget.RadioGroup
+	fileContent   *fyne.Container
+	textContent   *fyne.Container
+	addFilesBtn   *widget.Button
+	textEntry     *widget.Entry
+	addFolderBtn  *widget.Button
+	files         *fileTree
+	planLabel     *widget.Label
+	previewBtn    *widget.Button
+	sendBtn       *widget.Button
+	cancelBtn     *widget.Button
+	codeLabel     *widget.Label
+	progressBar   *widget.ProgressBar
+	statusLabel   *widget.Label
+	advancedCheck *widget.Check
 
 	// 配置组件
 	preSendCard   *widget.Card
 	postSendCard  *widget.Card
 	advancedCard  *widget.Card
 	compressCheck *widget.Check
-	relayEntry    *widget.Entry
-	passwordEntry *widget.Entry
+	hashSelect    *widget.Select
+	code          *codeSettings
+	relay         *relaySettings
+	ignore        *ignoreSettings
 
 	// 数据
-	selectedFiles  []string
 	sendText       string
 	codePhrase     string
+	planVersion    int // 每次重新计算发送预览时递增，丢弃过期的结果
 	currentMode    string
 	isTransferring bool
-	isCancelled    bool // 取消标志
+	cancelStart    context.CancelFunc // 取消还没有开始的发送，只在主线程中访问
+	transfer       *crocmgr.Transfer  // 只在主线程中访问
+	invite         *share.Invite      // 当前发送的接收信息，只在主线程中访问
 
 	// 历史记录相关
-	currentHistoryID string
-	sendStartTime    time.Time
+	historyIDs map[string]string // 接收码到历史记录ID的映射，只在主线程中访问
 
 	// 容器
 	content fyne.CanvasObject
 }
 
-func NewSendTab(crocManager *crocmgr.Manager, window fyne.Window, a fyne.App) *SendPage {
-	rand.Seed(time.Now().UnixNano())
+func NewSendTab(crocManager *crocmgr.Manager, window fyne.Window, historyStorage *storage.HistoryStorage, relayProfiles *storage.RelayProfileStore, prefs storage.Preferences) *SendPage {
 	tab := &SendPage{
-		crocManager: crocManager,
-		window:      window,
-		storage:     storage.NewHistoryStorage(a),
-		currentMode: sendFileMode,
+		crocManager:   crocManager,
+		window:        window,
+		storage:       historyStorage,
+		relayProfiles: relayProfiles,
+		prefs:         prefs,
+		currentMode:   sendFileMode,
+		historyIDs:    make(map[string]string),
 	}
 	tab.createWidgets()
 	tab.buildContent()
+	// 在主线程中处理发送任务的事件
+	crocManager.Events().SubscribeWith(fyne.Do, tab.onTransferEvent)
 	return tab
 }
 
@@ -88,8 +103,9 @@ func (page *SendPage) SetOnNavigateToDetail(callback func()) {
 	page.onNavigateToDetail = callback
 }
 
-func (page *SendPage) SetOnUpdateDetail(callback func(state string, progress float64, message string)) {
-	page.onUpdateDetail = callback
+// SetOnInvite 设置接收信息回调，用于在详情页显示二维码
+func (page *SendPage) SetOnInvite(callback func(share.Invite)) {
+	page.onInvite = callback
 }
 
 // GetSendData 获取发送数据用于详情页
@@ -97,8 +113,8 @@ func (page *SendPage) GetSendData() (fileName string, code string, isText bool)
 	if page.currentMode == sendTextMode {
 		fileName = "文本内容"
 		isText = true
-	} else if len(page.selectedFiles) > 0 {
-		fileName = filepath.Base(page.selectedFiles[0])
+	} else if len(page.files.paths) > 0 {
+		fileName = filepath.Base(page.files.paths[0])
 		isText = false
 	}
 	code = page.codePhrase
@@ -112,27 +128,18 @@ func (page *SendPage) GetIsTransferring() bool {
 
 func (page *SendPage) createWidgets() {
 	// --- File Widgets ---
-	page.fileList = widget.NewList(
-		func() int { return len(page.selectedFiles) },
-		func() fyne.CanvasObject {
-			deleteBtn := widget.NewButtonWithIcon("", theme.DeleteIcon(), nil)
-			deleteBtn.Resize(fyne.NewSize(44, 44)) // 移动端最小触摸区域
-			return container.NewHBox(widget.NewLabel(""), deleteBtn)
-		},
-		func(id widget.ListItemID, obj fyne.CanvasObject) {
-			c := obj.(*fyne.Container)
-			label := c.Objects[0].(*widget.Label)
-			btn := c.Objects[1].(*widget.Button)
-			if id < len(page.selectedFiles) {
-				label.SetText(filepath.Base(page.selectedFiles[id]))
-			}
-			btn.OnTapped = func() { page.deleteFile(id) }
-		},
-	)
-	page.fileList.Resize(fyne.NewSize(400, 200)) // 设置最小高度
-	page.addFilesBtn = widget.NewButtonWithIcon("选择文件或文件夹", theme.FileIcon(), page.onAddFiles)
+	page.files = newFileTree(func() {
+		page.updateSendButton()
+		page.refreshPlan()
+	})
+	page.addFilesBtn = widget.NewButtonWithIcon("选择文件", theme.FileIcon(), page.onAddFiles)
 	page.addFilesBtn.Resize(fyne.NewSize(280, 56)) // 移动端标准尺寸
 	page.addFilesBtn.Importance = widget.HighImportance
+	page.addFolderBtn = widget.NewButtonWithIcon("选择文件夹", theme.FolderIcon(), page.onAddFolder)
+	page.addFolderBtn.Importance = widget.HighImportance
+	page.planLabel = widget.NewLabel("")
+	page.planLabel.Wrapping = fyne.TextWrapWord
+	page.previewBtn = widget.NewButtonWithIcon("预览发送内容", theme.VisibilityIcon(), page.onPreview)
 
 	// --- Text Widgets ---
 	page.textEntry = widget.NewMultiLineEntry()
@@ -159,22 +166,26 @@ func (page *SendPage) createWidgets() {
 	page.statusLabel = widget.NewLabel("准备就绪")
 
 	// --- Advanced Options ---
-	page.disableLocalCheck = widget.NewCheck("禁用本地传输", nil)
-	page.compressCheck = widget.NewCheck("自动压缩文件夹", nil)
-	page.relayEntry = widget.NewEntry()
-	page.relayEntry.SetText("croc.schollz.com")
-	page.passwordEntry = widget.NewPasswordEntry()
-	page.passwordEntry.SetText("pass123")
-
-	relayForm := widget.NewForm(
-		&widget.FormItem{Text: "中继地址:", Widget: page.relayEntry},
-		&widget.FormItem{Text: "密码:", Widget: page.passwordEntry},
-	)
+	page.compressCheck = widget.NewCheck("自动压缩文件夹", func(bool) { page.refreshPlan() })
+	// 接收方使用发送方选择的算法校验收到的文件
+	var hashes []string
+	for _, a := range crocmgr.HashAlgorithms() {
+		hashes = append(hashes, a.Description)
+	}
+	page.hashSelect = widget.NewSelect(hashes, nil)
+	page.hashSelect.SetSelectedIndex(0)
+	page.code = newCodeSettings(page.prefs)
+	page.relay = newRelaySettings(page.relayProfiles, page.crocManager.Diagnostics(), page.window)
+	page.ignore = newIgnoreSettings(page.prefs, page.refreshPlan)
 
 	page.advancedCard = widget.NewCard("", "", container.NewVBox(
 		page.compressCheck,
-		page.disableLocalCheck,
-		relayForm,
+		widget.NewForm(&widget.FormItem{Text: "校验算法:", Widget: page.hashSelect}),
+		page.code.content(),
+		widget.NewSeparator(),
+		page.ignore.content(),
+		widget.NewSeparator(),
+		page.relay.content(),
 	))
 	page.advancedCard.Hide()
 
@@ -197,11 +208,13 @@ func (page *SendPage) createWidgets() {
 func (page *SendPage) buildContent() {
 	// --- File Content Area ---
 	page.fileContent = container.NewVBox(
-		page.addFilesBtn,
+		container.NewGridWithColumns(2, page.addFilesBtn, page.addFolderBtn),
 		widget.NewLabel(""), // 间距
 		widget.NewLabelWithStyle("已选择的文件:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
 		widget.NewLabel(""), // 小间距
-		page.fileList,
+		page.files.widget(),
+		page.planLabel,
+		page.previewBtn,
 	)
 
 	// --- Text Content Area ---
@@ -306,39 +319,54 @@ func (page *SendPage) onAddFiles() {
 		}
 		defer reader.Close()
 		path := reader.URI().Path()
-		page.selectedFiles = append(page.selectedFiles, path)
 		fyne.Do(func() {
-			page.fileList.Refresh()
-			page.updateSendButton()
-			page.statusLabel.SetText(fmt.Sprintf("已添加 %d 个文件", len(page.selectedFiles)))
+			page.files.add(path)
+			page.statusLabel.SetText(fmt.Sprintf("已选择 %d 项", len(page.files.paths)))
+		})
+	}, page.window)
+}
+
+// onAddFolder 选择要发送的文件夹，文件列表中可以展开并取消勾选其中的内容
+func (page *SendPage) onAddFolder() {
+	dialog.ShowFolderOpen(func(list fyne.ListableURI, err error) {
+		if err != nil || list == nil {
+			return
+		}
+		path := list.Path()
+		fyne.Do(func() {
+			page.files.add(path)
+			page.statusLabel.SetText(fmt.Sprintf("已选择 %d 项", len(page.files.paths)))
 		})
 	}, page.window)
 }
 
 func (page *SendPage) onSend() {
-	if page.currentMode == sendFileMode && len(page.selectedFiles) == 0 {
-		page.statusLabel.SetText("请先选择文件")
-		return
+	if err := page.send(); err != nil {
+		page.statusLabel.SetText(err.Error())
+	}
+}
+
+// send 生成新的接收码，创建历史记录并开始发送当前选择的文件或文本
+func (page *SendPage) send() error {
+	if page.currentMode == sendFileMode && len(page.files.paths) == 0 {
+		return errors.New("请先选择文件")
 	}
 
 	if page.currentMode == sendTextMode && page.sendText == "" {
-		page.statusLabel.SetText("请先输入文本")
-		return
+		return errors.New("请先输入文本")
 	}
 
 	// 生成接收码
-	code, err := page.generateCode()
+	code, err := codephrase.Generate(page.code.options())
 	if err != nil {
-		page.statusLabel.SetText("生成接收码失败: " + err.Error())
-		return
+		return fmt.Errorf("生成接收码失败: %w", err)
 	}
 	page.codePhrase = code
 
 	// 创建历史记录
 	historyItem := page.createHistoryItem(code)
 	if historyItem == nil {
-		page.statusLabel.SetText("创建历史记录失败")
-		return
+		return errors.New("创建历史记录失败")
 	}
 
 	// 先导航到详情页（此时状态还是 Idle，允许导航）
@@ -348,10 +376,40 @@ func (page *SendPage) onSend() {
 
 	// 然后设置传输状态
 	page.isTransferring = true
-	page.sendStartTime = time.Now()
 
 	// 在后台开始发送
-	go page.startSending()
+	paths, skip := page.files.selection()
+	go page.startSending(page.startContext(), paths, skip)
+	return nil
+}
+
+// Resend 使用新的接收码重新发送历史记录中的文件或文本
+// 使用当前的忽略规则、中继和接收码设置；文件已经不存在时返回错误。
+func (page *SendPage) Resend(item storage.HistoryItem) error {
+	if page.isTransferring {
+		return errors.New("正在发送，请等待当前任务完成")
+	}
+	if item.Type != "send" {
+		return errors.New("只能重新发送发送记录")
+	}
+
+	paths, skip := item.SendPaths()
+	switch {
+	case len(paths) > 0:
+		for _, path := range paths {
+			if _, err := os.Stat(path); err != nil {
+				return fmt.Errorf("发送的文件已不存在: %w", err)
+			}
+		}
+		page.modeRadio.SetSelected(sendFileMode)
+		page.files.setSelection(paths, skip)
+	case item.Text != "":
+		page.modeRadio.SetSelected(sendTextMode)
+		page.textEntry.SetText(item.Text)
+	default:
+		return errors.New("历史记录中没有保存发送的文件或文本，无法重新发送")
+	}
+	return page.send()
 }
 
 func (page *SendPage) onCancel() {
@@ -359,53 +417,118 @@ func (page *SendPage) onCancel() {
 		return
 	}
 	page.statusLabel.SetText("正在取消发送...")
-	// 更新详情页状态为取消中
-	if page.onUpdateDetail != nil {
-		page.onUpdateDetail("cancelled", 0.0, "正在取消发送...")
-	}
 
-	// 设置取消标志
-	page.isCancelled = true
+	// 还在选择中继或计算发送的文件时不再开始发送
+	page.cancelStart()
+	// 只取消当前的发送任务，界面和历史记录在收到取消事件后更新
+	if page.transfer != nil {
+		page.transfer.Cancel()
+	}
+}
 
-	// 取消 croc 管理器的 context
-	page.crocManager.Cancel()
+// startContext 返回开始发送之前可以被取消的 context，在主线程中调用
+func (page *SendPage) startContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	page.cancelStart = cancel
+	return ctx
+}
 
-	// 不立即重置状态，等待发送进程检测到取消信号
+// setTransfer 在主线程中记录开始的发送任务，开始之前已经取消时立即取消任务
+func (page *SendPage) setTransfer(ctx context.Context, transfer *crocmgr.Transfer) {
 	fyne.Do(func() {
-		page.statusLabel.SetText("发送已取消")
-		// 更新详情页状态为已取消
-		if page.onUpdateDetail != nil {
-			page.onUpdateDetail("cancelled", 0.0, "发送已取消")
+		page.transfer = transfer
+		if ctx.Err() != nil {
+			transfer.Cancel()
 		}
 	})
 }
 
 func (page *SendPage) resetSendState() {
-	page.isTransferring = false
-	page.isCancelled = false // 重置取消标志
 	fyne.Do(func() {
+		page.isTransferring = false
+		page.cancelStart()
+		page.transfer = nil
 		page.preSendCard.Show()
 		page.postSendCard.Hide()
 		page.progressBar.SetValue(0.0)
 		page.codePhrase = ""
+		page.invite = nil
 		page.codeLabel.SetText("等待生成接收码...")
 	})
 }
 
-func (page *SendPage) deleteFile(index int) {
-	if index < 0 || index >= len(page.selectedFiles) {
+// onPreview 按忽略规则列出要发送和被忽略的文件
+func (page *SendPage) onPreview() {
+	if len(page.files.paths) == 0 {
+		page.statusLabel.SetText("请先选择文件")
 		return
 	}
-	page.selectedFiles = append(page.selectedFiles[:index], page.selectedFiles[index+1:]...)
-	fyne.Do(func() {
-		page.fileList.Refresh()
-		page.updateSendButton()
-		page.statusLabel.SetText(fmt.Sprintf("已删除文件，剩余 %d 个", len(page.selectedFiles)))
-	})
+	options, err := page.planOptions()
+	if err != nil {
+		page.planLabel.SetText("❌ " + err.Error())
+		return
+	}
+	paths, skip := page.files.selection()
+	go func() {
+		plan, err := crocmgr.PlanSend(paths, skip, options)
+		fyne.Do(func() {
+			if err != nil {
+				page.planLabel.SetText("❌ " + err.Error())
+				return
+			}
+			showSendPlanDialog(plan, page.window)
+		})
+	}()
+}
+
+// refreshPlan 在后台按忽略规则重新计算要发送的文件，更新摘要
+func (page *SendPage) refreshPlan() {
+	page.planVersion++
+	version := page.planVersion
+	if len(page.files.paths) == 0 {
+		page.planLabel.SetText("")
+		return
+	}
+	options, err := page.planOptions()
+	if err != nil {
+		page.planLabel.SetText("❌ " + err.Error())
+		return
+	}
+	paths, skip := page.files.selection()
+	go func() {
+		plan, err := crocmgr.PlanSend(paths, skip, options)
+		fyne.Do(func() {
+			if version != page.planVersion {
+				return
+			}
+			if err != nil {
+				page.planLabel.SetText("❌ " + err.Error())
+				return
+			}
+			page.planLabel.SetText(planSummary(plan))
+		})
+	}()
 }
 
+// planOptions 返回预览使用的 croc 配置
+// 预览时不压缩文件夹，压缩发送时压缩文件中的内容与预览相同。
+func (page *SendPage) planOptions() (croc.Options, error) {
+	var options croc.Options
+	rules, err := page.ignore.rules()
+	if err != nil {
+		return options, err
+	}
+	rules.Apply(&options)
+	return options, nil
+}
+
+// onShowQRCode 在对话框中显示当前发送的二维码
 func (page *SendPage) onShowQRCode() {
-	// Placeholder
+	if page.invite == nil {
+		page.statusLabel.SetText("开始发送后显示二维码")
+		return
+	}
+	showQRCodeDialog(*page.invite, page.window)
 }
 
 // --- Helper Functions ---
@@ -413,7 +536,7 @@ func (page *SendPage) onShowQRCode() {
 func (page *SendPage) updateSendButton() {
 	enabled := false
 	if !page.isTransferring {
-		if page.currentMode == sendFileMode && len(page.selectedFiles) > 0 {
+		if page.currentMode == sendFileMode && len(page.files.paths) > 0 {
 			enabled = true
 		} else if page.currentMode == sendTextMode && strings.TrimSpace(page.sendText) != "" {
 			enabled = true
@@ -427,304 +550,250 @@ func (page *SendPage) updateSendButton() {
 	}
 }
 
-func (page *SendPage) generateCode() (string, error) {
-	// 英语词根列表 - 第一部分 (前缀/形容词)
-	wordRoots1 := []string{
-		"act", "ask", "big", "bold", "bright", "calm", "clear", "cool", "dark", "deep",
-		"easy", "fast", "fine", "flat", "free", "full", "good", "grand", "great", "green",
-		"hard", "high", "honest", "hot", "huge", "kind", "large", "late", "light", "long",
-		"loud", "low", "mad", "main", "new", "nice", "old", "open", "plain", "pure",
-		"quick", "quiet", "rare", "real", "rich", "round", "safe", "sharp", "slow", "soft",
-		"sore", "square", "star", "still", "sweet", "thick", "thin", "tight", "true", "vast",
-		"warm", "weak", "white", "wild", "wise", "young",
-	}
-
-	// 英语词根列表 - 第二部分 (名词/动作)
-	wordRoots2 := []string{
-		"art", "ball", "band", "bank", "base", "bell", "bird", "boat", "body", "book",
-		"box", "boy", "bug", "camp", "car", "card", "care", "case", "cat", "chair",
-		"chance", "change", "charge", "city", "class", "cloud", "coat", "code", "coin", "come",
-		"cook", "copper", "copy", "corn", "cost", "cottage", "cotton", "count", "cover", "crack",
-		"cream", "crop", "cross", "crowd", "crown", "cry", "cup", "curve", "cut", "dance",
-		"day", "deal", "deer", "design", "door", "draw", "dream", "dress", "drop", "drum",
-		"duck", "dust", "earth", "edge", "engine", "event", "face", "fact", "fall", "family",
-		"farm", "father", "fear", "field", "fire", "fish", "flag", "flower", "fly", "forest",
-		"form", "fountain", "fox", "friend", "fruit", "game", "garden", "gate", "giant", "gift",
-		"girl", "glass", "glove", "gold", "grass", "group", "guide", "hair", "hand", "head",
-		"heart", "hill", "history", "home", "hope", "horn", "horse", "hour", "house", "hunter",
-		"iron", "island", "jack", "jam", "jar", "jet", "job", "join", "judge", "key",
-		"kick", "king", "kiss", "kite", "knife", "lake", "lamp", "land", "language", "leaf",
-		"leg", "letter", "life", "light", "line", "lion", "lock", "look", "love", "machine",
-		"man", "map", "mark", "mask", "match", "meal", "meat", "milk", "mind", "mine",
-		"minute", "mirror", "money", "moon", "morning", "mother", "mountain", "mouth", "music", "name",
-		"nation", "nature", "nerve", "news", "night", "noise", "north", "nose", "note", "number",
-		"ocean", "offer", "office", "orange", "order", "page", "paint", "paper", "park", "part",
-		"pen", "pencil", "person", "picture", "pie", "pilot", "pipe", "place", "plane", "plant",
-		"plate", "play", "point", "pond", "post", "pot", "price", "prince", "prison", "problem",
-		"process", "produce", "queen", "question", "rain", "range", "rate", "ray", "reason", "record",
-		"rest", "rice", "ring", "river", "road", "rock", "roll", "roof", "room", "root",
-		"rose", "rule", "salt", "sand", "scale", "school", "science", "sea", "seat", "seed",
-		"serve", "shade", "shake", "shape", "share", "sheep", "sheet", "ship", "shirt", "shoe",
-		"shop", "show", "side", "sign", "silk", "silver", "sing", "size", "skin", "skirt",
-		"sky", "sleep", "slave", "snow", "soap", "soldier", "son", "song", "sort", "sound",
-		"south", "space", "spare", "speak", "spring", "square", "stamp", "star", "state", "steam",
-		"steel", "step", "stick", "stone", "stop", "store", "storm", "story", "street", "study",
-		"substance", "sugar", "summer", "support", "surprise", "system", "table", "tail", "teacher", "team",
-		"teeth", "temperature", "test", "text", "than", "that", "theft", "theory", "there", "thick",
-		"thing", "thought", "thread", "thrill", "throat", "thumb", "thunder", "ticket", "time", "tin",
-		"tire", "title", "today", "together", "tomorrow", "tone", "tongue", "tooth", "top", "touch",
-		"tower", "town", "trade", "train", "transport", "tray", "tree", "trick", "trip", "trouble",
-		"trousers", "truck", "turn", "twist", "umbrella", "uncle", "under", "unit", "value", "verse",
-		"vessel", "view", "voice", "walk", "wall", "war", "wash", "watch", "water", "wave",
-		"weather", "week", "weight", "west", "wheel", "whip", "whistle", "white", "wide", "wife",
-		"wind", "window", "wing", "winter", "wire", "wise", "woman", "women", "wood", "word",
-		"work", "world", "worm", "wound", "write", "wrong", "year", "yesterday", "young", "youth",
-	}
-
-	// 随机选择词根
-	root1 := wordRoots1[rand.Intn(len(wordRoots1))]
-	root2 := wordRoots2[rand.Intn(len(wordRoots2))]
-
-	// 组合成单词
-	word1 := root1 + root2
-
-	// 生成第二个随机单词
-	root3 := wordRoots1[rand.Intn(len(wordRoots1))]
-	root4 := wordRoots2[rand.Intn(len(wordRoots2))]
-	word2 := root3 + root4
-
-	// 生成随机数字 (100-999)
-	num := rand.Intn(9000) + 1000
-
-	return fmt.Sprintf("%s-%s-%d", word1, word2, num), nil
-}
-
-func (page *SendPage) startSending() {
+func (page *SendPage) startSending(ctx context.Context, paths, skip []string) {
 	defer page.resetSendState()
 
-	var sendFiles []string
-	var err error
+	// 每次发送都是独立的传输任务，不会影响同时进行的接收
+	options, err := page.buildCrocOptions()
+	if err != nil {
+		page.publishFailure(err, nil)
+		return
+	}
+	page.showInvite(options)
+	if ctx.Err() != nil {
+		page.publishCancelled()
+		return
+	}
 
+	var transfer *crocmgr.Transfer
 	if page.currentMode == sendTextMode {
-		var tmpFile *os.File
-		tmpFile, err = page.createTextFile(page.sendText)
-		if err != nil {
-			fyne.Do(func() { page.statusLabel.SetText("文本发送失败: " + err.Error()) })
-			return
-		}
-		defer os.Remove(tmpFile.Name())
-		sendFiles = []string{tmpFile.Name()}
+		// 文本使用 croc 的文本模式发送，接收端直接显示内容
+		transfer, err = page.crocManager.StartSendText(options, page.sendText)
 	} else {
-		sendFiles = make([]string, len(page.selectedFiles))
-		copy(sendFiles, page.selectedFiles)
+		// 记录发送的路径和取消勾选的内容，中断后可以继续发送
+		transfer, err = page.crocManager.StartSendSelection(options, paths, skip)
 	}
-
-	options := page.buildCrocOptions()
-	client, err := page.crocManager.CreateCrocClient(options)
 	if err != nil {
-		fyne.Do(func() { page.statusLabel.SetText("创建客户端失败: " + err.Error()) })
+		page.publishFailure(err, nil)
 		return
 	}
+	page.setTransfer(ctx, transfer)
 
+	// 界面和历史记录由传输事件驱动，这里只等待任务结束后清理
+	transfer.Wait()
+}
+
+// showInvite 在主线程中保存并通知当前发送的接收信息
+func (page *SendPage) showInvite(options croc.Options) {
+	invite := share.NewInvite(options)
 	fyne.Do(func() {
-		page.statusLabel.SetText("等待接收方连接...")
-		// 更新详情页状态为等待连接
-		if page.onUpdateDetail != nil {
-			page.onUpdateDetail("waiting", 0.0, "等待接收方连接...")
+		page.invite = &invite
+		if page.onInvite != nil {
+			page.onInvite(invite)
 		}
-		// 更新历史记录状态
-		page.updateHistoryStatus("waiting", 0.0, "等待接收方连接...")
 	})
+}
 
-	filesInfo, emptyFolders, totalNumberFolders, err := croc.GetFilesInfo(sendFiles, page.compressCheck.Checked, false, []string{})
-	if err != nil {
-		fyne.Do(func() {
-			page.statusLabel.SetText("获取文件信息失败: " + err.Error())
-			if page.onUpdateDetail != nil {
-				page.onUpdateDetail("failed", 0.0, "获取文件信息失败: "+err.Error())
-			}
-		})
-		page.resetSendState()
-		return
+// Resume 使用相同的接收码和文件继续历史记录中中断的发送
+// 为继续的发送创建新的历史记录，原记录不再显示继续按钮。
+func (page *SendPage) Resume(item storage.HistoryItem) error {
+	if page.isTransferring {
+		return errors.New("正在发送，请等待当前任务完成")
+	}
+	if !item.Resumable() || item.Resume.Direction != crocmgr.DirectionSend {
+		return crocmgr.ErrNotResumable
 	}
+	resume := *item.Resume
 
-	// 开始发送，更新状态
-	fyne.Do(func() {
-		if page.currentMode == sendTextMode {
-			page.statusLabel.SetText("正在发送文本...")
-			if page.onUpdateDetail != nil {
-				page.onUpdateDetail("sending", 0.0, "正在发送文本...")
-			}
-		} else {
-			page.statusLabel.SetText("正在发送文件...")
-			if page.onUpdateDetail != nil {
-				page.onUpdateDetail("sending", 0.0, "正在发送文件...")
-			}
-		}
-		// 更新历史记录状态为发送中
-		page.updateHistoryStatus("sending", 0.0, "正在发送数据...")
+	// 恢复发送的文件，详情页显示相同的文件名
+	page.modeRadio.SetSelected(sendFileMode)
+	page.files.setSelection(resume.Paths, resume.Skip)
+	page.codePhrase = resume.Code
+
+	recordID, err := page.storage.Add(storage.HistoryItem{
+		Type:       "send",
+		FileName:   item.FileName,
+		FileSize:   item.FileSize,
+		Code:       resume.Code,
+		Status:     lifecycle.Preparing,
+		Timestamp:  time.Now(),
+		ClientInfo: item.ClientInfo,
+		NumFiles:   item.NumFiles,
+		NumFolders: item.NumFolders,
+		Resume:     &resume,
 	})
+	if err != nil {
+		return fmt.Errorf("创建历史记录失败: %w", err)
+	}
+	page.historyIDs[resume.Code] = recordID
+	if err := page.storage.Update(item.ID, func(old *storage.HistoryItem) {
+		old.Resume = nil
+	}); err != nil {
+		fmt.Printf("更新历史记录失败: %v\n", err)
+	}
 
-	// 在单独的 goroutine 中执行发送，以便可以响应取消
-	go func() {
-		defer page.resetSendState() // 确保状态被重置
+	if page.onNavigateToDetail != nil {
+		page.onNavigateToDetail()
+	}
+	page.isTransferring = true
+	go page.resumeSending(page.startContext(), resume)
+	return nil
+}
 
-		err := client.Send(filesInfo, emptyFolders, totalNumberFolders)
-		if err != nil {
-			// 检查是否是因为取消导致的错误
-			if page.isCancelled {
-				fyne.Do(func() {
-					page.statusLabel.SetText("发送已取消")
-					if page.onUpdateDetail != nil {
-						page.onUpdateDetail("cancelled", 0.0, "发送已取消")
-					}
-					// 更新历史记录状态为已取消
-					page.updateHistoryStatus("cancelled", 0.0, "发送已取消")
-				})
-			} else {
-				fyne.Do(func() {
-					page.statusLabel.SetText("发送失败: " + err.Error())
-					if page.onUpdateDetail != nil {
-						page.onUpdateDetail("failed", 0.0, "发送失败: "+err.Error())
-					}
-					// 更新历史记录状态为失败
-					page.updateHistoryStatus("failed", 0.0, "发送失败: "+err.Error())
-				})
-			}
-			return
-		}
+// resumeSending 在后台继续中断的发送
+func (page *SendPage) resumeSending(ctx context.Context, resume crocmgr.Resume) {
+	defer page.resetSendState()
 
-		// 发送成功
-		fyne.Do(func() {
-			page.progressBar.SetValue(1.0)
-			page.statusLabel.SetText("发送完成！")
-			if page.onUpdateDetail != nil {
-				page.onUpdateDetail("completed", 1.0, "发送完成！")
-			}
-			// 更新历史记录状态为完成
-			page.updateHistoryStatus("completed", 1.0, "发送完成！")
-		})
-	}()
+	if ctx.Err() != nil {
+		page.publishCancelled()
+		return
+	}
+	transfer, err := page.crocManager.Resume(resume)
+	if err != nil {
+		// 没能重新开始时保留断点信息，之后还可以再试
+		page.publishFailure(err, &resume)
+		return
+	}
+	page.showInvite(transfer.Client().Options)
+	page.setTransfer(ctx, transfer)
+	transfer.Wait()
+}
 
-	// 启动进度监控
-	go page.monitorProgress()
+// publishFailure 发布创建任务之前的失败，让详情页和历史记录一起更新
+func (page *SendPage) publishFailure(err error, resume *crocmgr.Resume) {
+	page.crocManager.Events().Publish(crocmgr.Event{
+		Type:      crocmgr.EventFailed,
+		Direction: crocmgr.DirectionSend,
+		Code:      page.codePhrase,
+		State:     lifecycle.Failed,
+		Err:       err,
+		Resume:    resume,
+	})
 }
 
-func (page *SendPage) monitorProgress() {
-	// 简化的进度监控 - 只模拟进度，实际状态由发送 goroutine 处理
-	ctx := page.crocManager.GetContext()
-	steps := []float64{0.1, 0.3, 0.5, 0.7, 0.9}
+// publishCancelled 发布开始之前取消的发送，历史记录按取消处理
+func (page *SendPage) publishCancelled() {
+	page.crocManager.Events().Publish(crocmgr.Event{
+		Type:      crocmgr.EventCancelled,
+		Direction: crocmgr.DirectionSend,
+		Code:      page.codePhrase,
+		State:     lifecycle.Cancelled,
+		Err:       crocmgr.ErrTransferCancelled,
+	})
+}
 
-	for _, progress := range steps {
-		// 检查取消标志
-		if page.isCancelled {
-			return
-		}
+// onTransferEvent 处理发送任务的事件，更新界面和历史记录
+func (page *SendPage) onTransferEvent(e crocmgr.Event) {
+	if e.Direction != crocmgr.DirectionSend {
+		return
+	}
+	historyID, ok := page.historyIDs[e.Code]
+	if !ok {
+		return
+	}
 
-		select {
-		case <-ctx.Done():
-			// 用户取消
-			return
-		case <-time.After(500 * time.Millisecond):
-			// 再次检查取消标志
-			if page.isCancelled {
-				return
-			}
+	message := sendEventMessage(e)
+	page.statusLabel.SetText(message)
+	switch e.State {
+	case lifecycle.Transferring, lifecycle.Verifying:
+		page.progressBar.SetValue(e.Progress.Fraction())
+	case lifecycle.Completed:
+		page.progressBar.SetValue(1.0)
+	}
 
-			// 只有在未取消时才更新进度
-			if !page.isCancelled {
-				fyne.Do(func() {
-					page.progressBar.SetValue(progress)
-					// 更新详情页进度
-					if page.onUpdateDetail != nil {
-						page.onUpdateDetail("sending", progress, fmt.Sprintf("发送中... %.1f%%", progress*100))
-					}
-				})
-			}
+	// 进度事件不改变状态，不需要写入历史记录
+	if e.Type != crocmgr.EventProgress && e.Type != crocmgr.EventFileStarted {
+		page.updateHistoryStatus(historyID, e.State, message)
+	}
+	if e.Relay != nil {
+		page.updateHistoryRelay(historyID, *e.Relay)
+	}
+	if e.IsFinal() {
+		page.updateHistoryResume(historyID, e.Resume)
+		if e.Manifest != nil {
+			page.updateHistoryManifest(historyID, *e.Manifest)
 		}
+		delete(page.historyIDs, e.Code)
 	}
 }
 
-func (page *SendPage) buildCrocOptions() croc.Options {
-	return croc.Options{
-		IsSender:      true,
-		SharedSecret:  page.codePhrase,
-		Debug:         false,
-		NoPrompt:      true,
-		Stdout:        false,
-		HashAlgorithm: "xxhash",
-		Curve:         "p256",
-		ZipFolder:     page.compressCheck.Checked,
-		OnlyLocal:     false,
-		DisableLocal:  page.disableLocalCheck.Checked,
-		RelayAddress:  page.relayEntry.Text,
-		RelayPorts:    []string{"9009", "9010", "9011", "9012", "9013"},
-		RelayPassword: page.passwordEntry.Text,
+// sendEventMessage 返回发送事件对应的状态信息
+func sendEventMessage(e crocmgr.Event) string {
+	switch e.Type {
+	case crocmgr.EventCompleted:
+		return "发送完成！"
+	case crocmgr.EventFailed:
+		return "发送失败: " + errorText(e.Err)
+	case crocmgr.EventCancelled:
+		return "发送已取消"
+	}
+
+	switch e.State {
+	case lifecycle.Waiting:
+		return "等待接收方连接..."
+	case lifecycle.Verifying:
+		return "发送完成，等待接收方校验..."
+	default:
+		return formatProgress("正在发送", e.Progress)
 	}
 }
 
-func (page *SendPage) createTextFile(textContent string) (*os.File, error) {
-	tmpFile, err := os.CreateTemp("", "mocroc-text-*.txt")
+func (page *SendPage) buildCrocOptions() (croc.Options, error) {
+	options := crocmgr.DefaultOptions(true, page.codePhrase)
+	options.ZipFolder = page.compressCheck.Checked
+	if i := page.hashSelect.SelectedIndex(); i >= 0 {
+		options.HashAlgorithm = crocmgr.HashAlgorithms()[i].Name
+	}
+	rules, err := page.ignore.rules()
 	if err != nil {
-		return nil, fmt.Errorf("创建临时文件失败: %w", err)
+		return options, err
 	}
-	if _, err := tmpFile.WriteString(textContent); err != nil {
-		tmpFile.Close()
-		os.Remove(tmpFile.Name())
-		return nil, fmt.Errorf("写入临时文件失败: %w", err)
+	rules.Apply(&options)
+	if err := page.relay.apply(&options); err != nil {
+		return options, err
 	}
-	tmpFile.Close()
-	return tmpFile, nil
+	return options, nil
 }
 
 // createHistoryItem 创建历史记录
+// 发送文件时按忽略规则和勾选计算文件数、文件夹数和大小。
 func (page *SendPage) createHistoryItem(code string) *storage.HistoryItem {
-	var fileName string
-	var fileSize string
-	var numFiles int
-
-	if page.currentMode == sendFileMode {
-		if len(page.selectedFiles) == 0 {
-			return nil
-		}
-
-		// 获取文件信息
-		var totalSize int64
-		for _, filePath := range page.selectedFiles {
-			info, err := os.Stat(filePath)
-			if err != nil {
-				continue
-			}
-			totalSize += info.Size()
-		}
-
-		if len(page.selectedFiles) == 1 {
-			fileName = filepath.Base(page.selectedFiles[0])
-		} else {
-			fileName = fmt.Sprintf("%d 个文件", len(page.selectedFiles))
-		}
-
-		fileSize = formatFileSize(totalSize)
-		numFiles = len(page.selectedFiles)
-	} else if page.currentMode == sendTextMode {
-		fileName = "文本内容"
-		fileSize = formatFileSize(int64(len(page.sendText)))
-		numFiles = 1
-	} else {
-		return nil
-	}
-
-	// 创建历史记录项
 	historyItem := storage.HistoryItem{
 		Type:       "send",
-		FileName:   fileName,
-		FileSize:   fileSize,
 		Code:       code,
-		Status:     "in_progress",
+		Status:     lifecycle.Preparing,
 		Timestamp:  time.Now(),
 		Duration:   0,
 		ClientInfo: "MoCroc",
-		NumFiles:   numFiles,
+	}
+
+	switch page.currentMode {
+	case sendFileMode:
+		paths, skip := page.files.selection()
+		if len(paths) == 0 {
+			return nil
+		}
+		options, err := page.planOptions()
+		if err != nil {
+			fmt.Printf("读取忽略规则失败: %v\n", err)
+			return nil
+		}
+		plan, err := crocmgr.PlanSend(paths, skip, options)
+		if err != nil {
+			fmt.Printf("读取文件信息失败: %v\n", err)
+			return nil
+		}
+		historyItem.SetSendPlan(paths, plan)
+		historyItem.Skip = skip
+	case sendTextMode:
+		historyItem.FileName = "文本内容"
+		historyItem.FileSize = storage.FormatFileSize(int64(len(page.sendText)))
+		historyItem.NumFiles = 1
+		if page.storage.StoreText() {
+			historyItem.Text = page.sendText
+		}
+	default:
+		return nil
 	}
 
 	// 保存到存储
@@ -734,40 +803,71 @@ func (page *SendPage) createHistoryItem(code string) *storage.HistoryItem {
 		return nil
 	}
 
-	// 保存记录ID供后续更新使用
-	page.currentHistoryID = recordID
+	// 保存记录ID供后续事件更新使用
+	page.historyIDs[code] = recordID
 
 	return &historyItem
 }
 
-// updateHistoryStatus 更新历史记录状态
-func (page *SendPage) updateHistoryStatus(status string, progress float64, message string) {
-	if page.currentHistoryID == "" {
+// updateHistoryStatus 更新历史记录状态和耗时，状态未变化时不做任何事
+func (page *SendPage) updateHistoryStatus(historyID string, state lifecycle.State, message string) {
+	if err := page.storage.Transition(historyID, state, message); err != nil {
+		fmt.Printf("更新历史记录失败: %v\n", err)
 		return
 	}
 
-	duration := time.Since(page.sendStartTime).Seconds()
+	err := page.storage.Update(historyID, func(item *storage.HistoryItem) {
+		item.Duration = int64(time.Since(item.Timestamp).Seconds())
+	})
+	if err != nil {
+		fmt.Printf("更新历史记录失败: %v\n", err)
+	}
+}
+
+// updateHistoryResume 记录中断时的断点信息，完成时清除
+func (page *SendPage) updateHistoryResume(historyID string, resume *crocmgr.Resume) {
+	err := page.storage.Update(historyID, func(item *storage.HistoryItem) {
+		item.Resume = resume
+	})
+	if err != nil {
+		fmt.Printf("更新历史记录失败: %v\n", err)
+	}
+}
 
-	err := page.storage.Update(page.currentHistoryID, func(item *storage.HistoryItem) {
-		item.Status = status
-		item.Duration = int64(duration)
+// updateHistoryManifest 记录传输结束时的文件清单，其中包含发送时计算的校验值
+func (page *SendPage) updateHistoryManifest(historyID string, m crocmgr.Manifest) {
+	err := page.storage.Update(historyID, func(item *storage.HistoryItem) {
+		item.SetManifest(m)
 	})
+	if err != nil {
+		fmt.Printf("更新历史记录失败: %v\n", err)
+	}
+}
 
+// updateHistoryRelay 记录任务使用的中继，重试时使用
+func (page *SendPage) updateHistoryRelay(historyID string, relay crocmgr.RelayProfile) {
+	err := page.storage.Update(historyID, func(item *storage.HistoryItem) {
+		item.Relay = &relay
+	})
 	if err != nil {
 		fmt.Printf("更新历史记录失败: %v\n", err)
 	}
 }
 
-// formatFileSize 格式化文件大小
-func formatFileSize(size int64) string {
-	const unit = 1024
-	if size < unit {
-		return fmt.Sprintf("%d B", size)
+// errorText 返回错误信息，err 为空时返回未知错误
+func errorText(err error) string {
+	if err == nil {
+		return "未知错误"
 	}
-	div, exp := int64(unit), 0
-	for n := size / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+	return err.Error()
+}
+
+// formatProgress 格式化传输进度，多文件时附带当前文件信息
+func formatProgress(action string, p crocmgr.Progress) string {
+	message := fmt.Sprintf("%s... %.1f%% (%s / %s)", action, p.Fraction()*100,
+		storage.FormatFileSize(p.BytesDone), storage.FormatFileSize(p.TotalBytes))
+	if p.NumFiles > 1 {
+		message += fmt.Sprintf("\n文件 %d/%d: %s", p.FileIndex+1, p.NumFiles, p.FileName)
 	}
-	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+	return message
 }
@@ -7,28 +7,21 @@ import (
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
-)
-
-type SendDetailState int
-
-const (
-	SendDetailStatePreparing SendDetailState = iota
-	SendDetailStateWaiting                   // 等待接收端连接
-	SendDetailStateSending                   // 正在发送数据
-	SendDetailStateCompleted
-	SendDetailStateFailed
-	SendDetailStateCancelled
+	"github.com/shapled/mocroc/internal/crocmgr"
+	"github.com/shapled/mocroc/internal/lifecycle"
+	"github.com/shapled/mocroc/internal/share"
 )
 
 type SendDetailPage struct {
 	window    fyne.Window
 	onBack    func()
 	onCancel  func()
-	state     SendDetailState
+	state     *lifecycle.Machine
 	fileName  string
 	code      string
 	progress  float64
 	statusMsg string
+	invite    *share.Invite // 接收信息，中继确定后才有
 }
 
 func NewSendDetailPage(window fyne.Window, onBack, onCancel func()) *SendDetailPage {
@@ -36,7 +29,7 @@ func NewSendDetailPage(window fyne.Window, onBack, onCancel func()) *SendDetailP
 		window:   window,
 		onBack:   onBack,
 		onCancel: onCancel,
-		state:    SendDetailStatePreparing,
+		state:    lifecycle.NewMachine(),
 		progress: 0.0,
 	}
 }
@@ -49,18 +42,37 @@ func (page *SendDetailPage) SetCode(code string) {
 	page.code = code
 }
 
-func (page *SendDetailPage) SetState(state SendDetailState) {
-	page.state = state
+// Reset 开始新的发送，状态回到准备中
+func (page *SendDetailPage) Reset() {
+	page.state = lifecycle.NewMachine()
+	page.progress = 0.0
+	page.statusMsg = ""
+	page.invite = nil
+}
+
+// SetInvite 设置接收信息，等待接收方连接时显示二维码
+func (page *SendDetailPage) SetInvite(invite share.Invite) {
+	if invite.Code == page.code {
+		page.invite = &invite
+	}
+}
+
+// SetState 推进到新状态，已结束或后退的状态会被拒绝
+func (page *SendDetailPage) SetState(state lifecycle.State) error {
+	return page.state.Advance(state, "")
 }
 
 func (page *SendDetailPage) SetStatusMessage(msg string) {
 	page.statusMsg = msg
 }
 
-// SetStateAndMessage 同时设置状态和消息
-func (page *SendDetailPage) SetStateAndMessage(state SendDetailState, message string) {
-	page.state = state
+// SetStateAndMessage 同时设置状态和消息，状态被拒绝时消息保持不变
+func (page *SendDetailPage) SetStateAndMessage(state lifecycle.State, message string) error {
+	if err := page.state.Advance(state, message); err != nil {
+		return err
+	}
 	page.statusMsg = message
+	return nil
 }
 
 // SetProgress 设置进度
@@ -68,6 +80,24 @@ func (page *SendDetailPage) SetProgress(progress float64) {
 	page.progress = progress
 }
 
+// HandleEvent 处理当前接收码的发送事件，返回页面是否需要刷新
+func (page *SendDetailPage) HandleEvent(e crocmgr.Event) bool {
+	if e.Direction != crocmgr.DirectionSend || e.Code == "" || e.Code != page.code {
+		return false
+	}
+	// 过期的事件（例如完成后到达的进度）会被状态机拒绝
+	if err := page.SetStateAndMessage(e.State, sendEventMessage(e)); err != nil {
+		return false
+	}
+	switch e.State {
+	case lifecycle.Transferring, lifecycle.Verifying:
+		page.progress = e.Progress.Fraction()
+	case lifecycle.Completed:
+		page.progress = 1.0
+	}
+	return true
+}
+
 func (page *SendDetailPage) Build() fyne.CanvasObject {
 	// 信息卡片
 	infoCard := widget.NewCard("传输信息", "", container.NewVBox(
@@ -77,16 +107,17 @@ func (page *SendDetailPage) Build() fyne.CanvasObject {
 	))
 
 	// 进度卡片
+	state := page.state.State()
 	var progressCard fyne.CanvasObject
-	switch page.state {
-	case SendDetailStateSending:
+	switch state {
+	case lifecycle.Transferring, lifecycle.Verifying:
 		progressBar := widget.NewProgressBar()
 		progressBar.SetValue(page.progress)
 		progressCard = widget.NewCard("传输进度", "", container.NewVBox(
 			progressBar,
 			widget.NewLabel(fmt.Sprintf("%.1f%%", page.progress*100)),
 		))
-	case SendDetailStateWaiting:
+	case lifecycle.Waiting:
 		// 等待状态显示无限进度条
 		progressBar := widget.NewProgressBarInfinite()
 		progressCard = widget.NewCard("等待连接", "", container.NewVBox(
@@ -105,13 +136,13 @@ func (page *SendDetailPage) Build() fyne.CanvasObject {
 
 	// 操作按钮
 	var actionButton *widget.Button
-	switch page.state {
-	case SendDetailStatePreparing, SendDetailStateWaiting, SendDetailStateSending:
+	switch state {
+	case lifecycle.Preparing, lifecycle.Waiting, lifecycle.Transferring, lifecycle.Verifying:
 		actionButton = widget.NewButtonWithIcon("取消发送", theme.CancelIcon(), page.onCancel)
-	case SendDetailStateCompleted:
+	case lifecycle.Completed:
 		actionButton = widget.NewButtonWithIcon("完成", theme.ConfirmIcon(), page.onBack)
 		actionButton.Importance = widget.HighImportance
-	case SendDetailStateFailed, SendDetailStateCancelled:
+	case lifecycle.Failed, lifecycle.Cancelled:
 		actionButton = widget.NewButtonWithIcon("重新发送", theme.ViewRefreshIcon(), page.onBack)
 		actionButton.Importance = widget.MediumImportance
 	default:
@@ -121,12 +152,13 @@ func (page *SendDetailPage) Build() fyne.CanvasObject {
 	actionCard := widget.NewCard("操作", "", actionButton)
 
 	// 主内容 - 使用边框布局让内容更好地填充空间
-	mainContent := container.NewVBox(
-		infoCard,
-		progressCard,
-		statusCard,
-		actionCard,
-	)
+	mainContent := container.NewVBox(infoCard)
+	if page.invite != nil && (state == lifecycle.Preparing || state == lifecycle.Waiting) {
+		mainContent.Add(widget.NewCard("扫码接收", "在另一台设备的 MoCroc 中扫描", newQRCodeContent(*page.invite, page.window)))
+	}
+	mainContent.Add(progressCard)
+	mainContent.Add(statusCard)
+	mainContent.Add(actionCard)
 
 	// 使用滚动容器
 	return container.NewScroll(container.NewPadded(mainContent))
@@ -145,18 +177,20 @@ func (page *SendDetailPage) createInfoRow(label, value, placeholder string) fyne
 }
 
 func (page *SendDetailPage) getStateText() string {
-	switch page.state {
-	case SendDetailStatePreparing:
+	switch page.state.State() {
+	case lifecycle.Preparing:
 		return "准备中"
-	case SendDetailStateWaiting:
+	case lifecycle.Waiting:
 		return "等待接收端连接"
-	case SendDetailStateSending:
+	case lifecycle.Transferring:
 		return "发送中"
-	case SendDetailStateCompleted:
+	case lifecycle.Verifying:
+		return "等待接收端校验"
+	case lifecycle.Completed:
 		return "发送完成"
-	case SendDetailStateFailed:
+	case lifecycle.Failed:
 		return "发送失败"
-	case SendDetailStateCancelled:
+	case lifecycle.Cancelled:
 		return "已取消"
 	default:
 		return "未知状态"
@@ -1,20 +1,31 @@
 package main
 
 import (
+	"os"
+
 	"fyne.io/fyne/v2/app"
+	"github.com/shapled/mocroc/internal/cli"
 	"github.com/shapled/mocroc/internal/ui"
 )
 
+// appID 应用 ID，界面和命令行通过它找到同一份历史记录
+const appID = "com.shapled.mocroc"
+
 func main() {
+	// 带子命令时以命令行模式运行，不启动界面
+	if cli.IsCommand(os.Args[1:]) {
+		os.Exit(cli.Run(appID, os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	// 创建 Fyne 应用
-	a := app.NewWithID("com.shapled.mocroc")
+	a := app.NewWithID(appID)
 
 	// 创建主窗口
 	w := a.NewWindow("MoCroc")
 	w.SetIcon(nil) // TODO: 添加应用图标
 
-	// 构建主界面
-	mainUI := ui.NewMainUI(a, w)
+	// 构建主界面，通过 mocroc:// 链接启动时直接打开接收页
+	mainUI := ui.NewMainUI(a, w, os.Args[1:])
 
 	// 设置窗口内容并显示
 	w.SetContent(mainUI)
@@ -0,0 +1,38 @@
+module github.com/schollz/croc/v10
+
+go 1.24.0
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/chzyer/readline v1.5.1
+	github.com/denisbrodbeck/machineid v1.0.1
+	github.com/kalafut/imohash v1.1.1
+	github.com/magisterquis/connectproxy v0.0.0-20200725203833-3582e84f0c9b
+	github.com/minio/highwayhash v1.0.3
+	github.com/sabhiram/go-gitignore v0.0.0-20210923224102-525f6e181f06
+	github.com/schollz/cli/v2 v2.2.1
+	github.com/schollz/logger v1.2.0
+	github.com/schollz/pake/v3 v3.1.0
+	github.com/schollz/peerdiscovery v1.7.6
+	github.com/schollz/progressbar/v3 v3.18.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	github.com/stretchr/testify v1.11.1
+	golang.org/x/crypto v0.43.0
+	golang.org/x/net v0.46.0
+	golang.org/x/sys v0.37.0
+	golang.org/x/term v0.36.0
+	golang.org/x/time v0.14.0
+)
+
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/cpuguy83/go-md2man/v2 v2.0.7 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/rivo/uniseg v0.4.7 // indirect
+	github.com/russross/blackfriday/v2 v2.1.0 // indirect
+	github.com/tscholl2/siec v0.0.0-20240310163802-c2c6f6198406 // indirect
+	github.com/twmb/murmur3 v1.1.8 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)